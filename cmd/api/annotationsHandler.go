@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/service"
+	"shuvoedward/Bible_project/internal/validator"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type AnnotationServiceInterface interface {
+	ListAnnotations(ctx context.Context, userID int64, input service.AnnotationsInput) ([]*service.ChapterAnnotations, data.Metadata, *validator.Validator, error)
+}
+
+type AnnotationHandler struct {
+	app     *application
+	service AnnotationServiceInterface
+}
+
+func NewAnnotationHandler(app *application, annotationService AnnotationServiceInterface) *AnnotationHandler {
+	return &AnnotationHandler{
+		app:     app,
+		service: annotationService,
+	}
+}
+
+// Annotations are notes and highlights, API keys need to read both
+var annotationScopes = []string{data.APIScopeNotesRead, data.APIScopeHighlightsRead}
+
+func (h *AnnotationHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, "/v1/me/annotations",
+		h.app.generalRateLimit(h.app.requireScopes(annotationScopes, h.List)))
+}
+
+// @Summary List notes and highlights of a book
+// @Description Returns the user's located notes (BIBLE, CROSS_REFERENCE, and GENERAL notes referencing the passage) and highlights within a chapter range, grouped by chapter and starting verse. Pagination counts notes and highlights together, in chapter and verse order. Verse 0 holds highlights covering a whole chapter. API keys need the notes:read and highlights:read scopes.
+// @Tags annotations
+// @Produce json
+// @Param book query string true "Book name" example(Romans)
+// @Param from query int false "First chapter" default(1) minimum(1) maximum(150)
+// @Param to query int false "Last chapter, defaults to the end of the book" minimum(1) maximum(150)
+// @Param page query int false "Page number" default(1) minimum(1) maximum(10000)
+// @Param page_size query int false "Number of items per page" default(10) minimum(1) maximum(100)
+// @Success 200 {object} object{book=string,chapters=[]service.ChapterAnnotations,metadata=data.Metadata} "Annotations grouped by chapter and verse"
+// @Failure 400 {object} map[string]string "Invalid query parameters"
+// @Failure 403 {object} map[string]string "API key without the required scopes"
+// @Failure 422 {object} map[string]map[string]string "Validation errors"
+// @Failure 429 {object} map[string]string "Rate limit exceeded"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/annotations [get]
+func (h *AnnotationHandler) List(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	filters, err := h.app.readPaginationParams(r)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+
+	input := service.AnnotationsInput{
+		Book:     query.Get("book"),
+		Page:     filters.Page,
+		PageSize: filters.PageSize,
+	}
+
+	if query.Has("from") {
+		input.FromChapter, err = strconv.Atoi(query.Get("from"))
+		if err != nil || input.FromChapter < 1 {
+			h.app.badRequestResponse(w, r, errors.New("from must be a positive integer"))
+			return
+		}
+	}
+
+	if query.Has("to") {
+		input.ToChapter, err = strconv.Atoi(query.Get("to"))
+		if err != nil || input.ToChapter < 1 {
+			h.app.badRequestResponse(w, r, errors.New("to must be a positive integer"))
+			return
+		}
+	}
+
+	chapters, metadata, v, err := h.service.ListAnnotations(r.Context(), user.ID, input)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"book": input.Book, "chapters": chapters, "metadata": metadata}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/service"
+	"shuvoedward/Bible_project/internal/validator"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type APIKeyServiceInterface interface {
+	CreateAPIKey(ctx context.Context, userID int64, input service.APIKeyInput) (*data.APIKey, *validator.Validator, error)
+	DeleteAPIKey(ctx context.Context, userID, keyID int64) error
+	ListAPIKeys(ctx context.Context, userID int64) ([]*data.APIKey, error)
+}
+
+type APIKeyHandler struct {
+	app     *application
+	service APIKeyServiceInterface
+}
+
+func NewAPIKeyHandler(app *application, service APIKeyServiceInterface) *APIKeyHandler {
+	return &APIKeyHandler{
+		app:     app,
+		service: service,
+	}
+}
+
+// API keys are managed with a login token only, requireActivatedUser rejects API keys
+func (h *APIKeyHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", h.app.generalRateLimit(h.app.requireActivatedUser(h.List)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", h.app.generalRateLimit(h.app.requireActivatedUser(h.Create)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", h.app.generalRateLimit(h.app.requireActivatedUser(h.Delete)))
+}
+
+func (h *APIKeyHandler) handleAPIKeyError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		h.app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrDuplicateAPIKeyName):
+		h.app.editConflictResponse(w, r, err)
+	default:
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary List API keys
+// @Description Lists the user's API keys with their scopes, expiry and last use, newest first. Keys are identified by their prefix, the full key is only shown on creation. Last use is updated at most every 5 minutes.
+// @Tags api-keys
+// @Produce json
+// @Success 200 {object} object{api_keys=[]data.APIKey} "API keys"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Account not activated or request made with an API key"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/api-keys [get]
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	keys, err := h.service.ListAPIKeys(r.Context(), user.ID)
+	if err != nil {
+		h.handleAPIKeyError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Create an API key
+// @Description Creates a named API key for scripts and integrations, sent as "Bearer <key>" like a token. It only reaches endpoints within its scopes: notes:read, notes:write, highlights:read, highlights:write. Without an expiry the key works until deleted. The key is returned this once.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param key body object{name=string,scopes=[]string,expiry=string} true "API key" example({"name": "Backup script", "scopes": ["notes:read", "highlights:read"], "expiry": "2027-01-01T00:00:00Z"})
+// @Success 201 {object} object{api_key=data.APIKey} "API key created"
+// @Failure 400 {object} object{error=string} "Invalid request body"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Account not activated or request made with an API key"
+// @Failure 409 {object} object{error=string} "Name already used"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/api-keys [post]
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name   string     `json:"name"`
+		Scopes []string   `json:"scopes"`
+		Expiry *time.Time `json:"expiry"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := h.app.contextGetUser(r)
+
+	key, v, err := h.service.CreateAPIKey(r.Context(), user.ID, service.APIKeyInput{
+		Name:   input.Name,
+		Scopes: input.Scopes,
+		Expiry: input.Expiry,
+	})
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleAPIKeyError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Delete an API key
+// @Description Revokes an API key, it stops working immediately
+// @Tags api-keys
+// @Param id path int true "API key ID"
+// @Success 204 "API key deleted"
+// @Failure 400 {object} object{error=string} "Invalid API key ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Account not activated or request made with an API key"
+// @Failure 404 {object} object{error=string} "API key not found"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/api-keys/{id} [delete]
+func (h *APIKeyHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	keyID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = h.service.DeleteAPIKey(r.Context(), user.ID, keyID)
+	if err != nil {
+		h.handleAPIKeyError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -10,18 +10,29 @@ import (
 type DeleteExpiredTokenInterface interface {
 	DeleteExpiredTokens(ctx context.Context) (int64, error)
 }
+
+type TrashPurgerInterface interface {
+	PurgeTrash(ctx context.Context, retention time.Duration) (int, error)
+}
+
 type backgroundTasks struct {
-	deleteToken DeleteExpiredTokenInterface
-	logger      *slog.Logger
+	deleteToken    DeleteExpiredTokenInterface
+	purgeTrash     TrashPurgerInterface
+	trashRetention time.Duration
+	logger         *slog.Logger
 }
 
 func newBackgroundTasks(
 	tokenModel data.TokenModel,
+	trashPurger TrashPurgerInterface,
+	trashRetention time.Duration,
 	logger *slog.Logger,
 ) *backgroundTasks {
 	return &backgroundTasks{
-		deleteToken: tokenModel,
-		logger:      logger,
+		deleteToken:    tokenModel,
+		purgeTrash:     trashPurger,
+		trashRetention: trashRetention,
+		logger:         logger,
 	}
 }
 
@@ -37,6 +48,7 @@ func (bt *backgroundTasks) start() {
 
 	for range ticker.C {
 		bt.cleanupExpiredTokens()
+		bt.purgeExpiredTrash()
 	}
 }
 
@@ -50,3 +62,17 @@ func (bt *backgroundTasks) cleanupExpiredTokens() {
 		bt.logger.Error("failed to cleanup tokens", "error", err)
 	}
 }
+
+func (bt *backgroundTasks) purgeExpiredTrash() {
+	// S3 deletions run one by one, give the purge more time than a query
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	purged, err := bt.purgeTrash.PurgeTrash(ctx, bt.trashRetention)
+	if err != nil {
+		bt.logger.Error("failed to purge trash", "purged", purged, "error", err)
+		return
+	}
+
+	bt.logger.Info("trash purged", "purged", purged)
+}
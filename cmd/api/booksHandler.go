@@ -7,12 +7,13 @@ import (
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/service"
 	"shuvoedward/Bible_project/internal/validator"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 type BookServiceInterface interface {
-	GetPassageWithUserData(ctx context.Context, userID int64, isAuthenticated bool, filter *data.LocationFilters) (*service.PassageResponse, *validator.Validator, error)
+	GetPassageWithUserData(ctx context.Context, user *data.User, filter *data.LocationFilters, options service.PassageOptions) (*service.PassageResponse, *validator.Validator, error)
 	SearchVersesByWord(ctx context.Context, searchQuery string, filters data.Filters) ([]*data.VerseMatch, data.Metadata, error)
 }
 
@@ -54,7 +55,7 @@ func (h *BookHandler) handlerBooksError(w http.ResponseWriter, r *http.Request,
 }
 
 // @Summary Get a Bible chapter or verse range
-// @Description Retrieves the text for a specified Bible chapter or a range of verses, along with associated user-specific data (highlights and notes) if the user is logged in and activated.
+// @Description Retrieves the text for a specified Bible chapter or a range of verses, along with associated user-specific data (highlights, the legend of the palette entries they use, notes, and GENERAL notes referencing the passage) if the user is logged in and activated. With an API key, notes need the notes:read scope and highlights and the legend need highlights:read; data the key can't read comes back empty. The translation and verse number display default to the user's preferences.
 // @Tags Bible, Passages
 // @Accept json
 // @Produce json
@@ -62,10 +63,13 @@ func (h *BookHandler) handlerBooksError(w http.ResponseWriter, r *http.Request,
 // @Param chapter path int true "The chapter number (e.g., 1)"
 // @Param svs query int false "Start verse number (must be used with evs)"
 // @Param evs query int false "End verse number (must be used with svs)"
+// @Param translation query string false "Translation, defaults to the user's preference" Enums(KJV)
+// @Param verse_numbers query string false "Verse number display, defaults to the user's preference" Enums(inline, superscript, hidden)
 // @Security ApiKeyAuth
-// @Success 200 {object} object{passage=data.Passage,highlights=[]data.Highlight,bible_notes=[]data.NoteResponse,cross_ref_notes=[]data.NoteResponse} "Successfully retrieved passage and user data"
+// @Success 200 {object} object{passage=data.Passage,highlights=[]data.Highlight,bible_notes=[]data.NoteResponse,cross_ref_notes=[]data.NoteResponse,referencing_notes=[]data.NoteResponse} "Successfully retrieved passage and user data"
 // @Failure 400 {object} object{error=string} "Invalid request parameters (e.g., invalid chapter or verse numbers)"
 // @Failure 404 {object} object{error=string} "Passage not found (e.g., invalid book/chapter combination)"
+// @Failure 422 {object} object{error=map[string]string} "Unknown translation or verse number display"
 // @Failure 500 {object} object{error=string} "Internal server error"
 // @Router /v1/bible/{book}/{chapter} [get]
 func (h *BookHandler) GetPassageWithUserData(w http.ResponseWriter, r *http.Request) {
@@ -83,9 +87,27 @@ func (h *BookHandler) GetPassageWithUserData(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	options := service.PassageOptions{
+		Translation:  strings.ToUpper(r.URL.Query().Get("translation")),
+		VerseNumbers: r.URL.Query().Get("verse_numbers"),
+	}
+
+	// An API key only gets the user data its scopes can read
+	if key := h.app.contextGetAPIKey(r); key != nil {
+		options.SkipNotes = !key.HasScope(data.APIScopeNotesRead)
+		options.SkipHighlights = !key.HasScope(data.APIScopeHighlightsRead)
+	}
+
 	ctx := r.Context()
-	response, v, err := h.bookService.GetPassageWithUserData(ctx, user.ID, user.Activated, filter)
+	response, v, err := h.bookService.GetPassageWithUserData(ctx, user, filter, options)
 	if v != nil && !v.Valid() {
+		// invalid options fail validation, an invalid location is a passage that doesn't exist
+		_, badTranslation := v.Errors["translation"]
+		_, badVerseNumbers := v.Errors["verse_numbers"]
+		if badTranslation || badVerseNumbers {
+			h.app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
 		h.app.notFoundResponse(w, r)
 		return
 	}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"shuvoedward/Bible_project/internal/events"
+	"shuvoedward/Bible_project/internal/service"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// heartbeatInterval keeps idle streams from being closed by proxies
+const heartbeatInterval = 25 * time.Second
+
+type EventServiceInterface interface {
+	Subscribe(ctx context.Context, userID, lastEventID int64) (*service.EventStream, error)
+}
+
+type EventHandler struct {
+	app     *application
+	service EventServiceInterface
+}
+
+func NewEventHandler(app *application, eventService EventServiceInterface) *EventHandler {
+	return &EventHandler{
+		app:     app,
+		service: eventService,
+	}
+}
+
+func (h *EventHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, "/v1/events",
+		h.app.generalRateLimit(h.app.requireActivatedUser(h.Stream)))
+}
+
+// @Summary Stream changes as Server-Sent Events
+// @Description Streams an event for every note, location, highlight and image the user creates, changes or deletes, from any device and any API instance. The event name is the entity type and the data is {"type","id","deleted","cursor"}; fetch the changed data with GET /v1/sync?since=<previous cursor>. The event id is the sync cursor: on reconnect, send it as the Last-Event-ID header (or last_event_id query parameter) to replay missed changes. If too many changes were missed a "resync" event is sent instead, and the client should catch up with GET /v1/sync. A comment line is sent every 25 seconds as heartbeat. The stream ends if the client falls behind, reconnect with Last-Event-ID.
+// @Tags sync
+// @Produce text/event-stream
+// @Param Last-Event-ID header int false "Cursor of the last received event"
+// @Param last_event_id query int false "Cursor of the last received event, for clients that can't set headers"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} map[string]string "Invalid Last-Event-ID"
+// @Failure 429 {object} map[string]string "Rate limit exceeded"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/events [get]
+func (h *EventHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	var since int64
+	if lastEventID != "" {
+		var err error
+		since, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || since < 0 {
+			h.app.badRequestResponse(w, r, errors.New("Last-Event-ID must be a cursor returned by a previous event"))
+			return
+		}
+	}
+
+	stream, err := h.service.Subscribe(r.Context(), user.ID, since)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer stream.Subscription.Close()
+
+	rc := http.NewResponseController(w)
+
+	// The server's write timeout would cut the stream
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Tell the client how long to wait before reconnecting
+	fmt.Fprint(w, "retry: 5000\n\n")
+
+	if stream.Resync {
+		fmt.Fprintf(w, "event: resync\ndata: {\"cursor\":%d}\n\n", since)
+	}
+
+	last := since
+	for _, event := range stream.Replay {
+		err = writeEvent(w, event)
+		if err != nil {
+			return
+		}
+		last = event.ID
+	}
+
+	if err = rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-stream.Subscription.Events():
+			if !ok {
+				// Dropped by the broker, the client reconnects with Last-Event-ID
+				return
+			}
+			// Already sent during the replay
+			if event.ID <= last {
+				continue
+			}
+			err = writeEvent(w, event)
+			last = event.ID
+
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+
+		case <-r.Context().Done():
+			return
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event events.Event) error {
+	js, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Entity, js)
+	return err
+}
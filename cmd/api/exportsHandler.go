@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/service"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type ExportServiceInterface interface {
+	GetExport(ctx context.Context, userID int64, exportID int64) (*data.Export, error)
+	RequestExport(ctx context.Context, userID int64) (*data.Export, error)
+}
+
+type ExportHandler struct {
+	app     *application
+	service ExportServiceInterface
+}
+
+func NewExportHandler(app *application, exportService ExportServiceInterface) *ExportHandler {
+	return &ExportHandler{
+		app:     app,
+		service: exportService,
+	}
+}
+
+// Exports hold notes with their images and highlights, API keys need to read both
+var exportScopes = []string{data.APIScopeNotesRead, data.APIScopeHighlightsRead}
+
+func (h *ExportHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, "/v1/exports",
+		h.app.generalRateLimit(h.app.requireScopes(exportScopes, h.Create)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/exports/:id",
+		h.app.generalRateLimit(h.app.requireScopes(exportScopes, h.Get)))
+}
+
+func (h *ExportHandler) handleExportError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrExportNotFound):
+		h.app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrExportInProgress):
+		h.app.editConflictResponse(w, r, err)
+	default:
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Export all study data
+// @Description Starts an export of the user's notes, locations, highlights and images. The archive is built in the background and contains export.json, one Markdown file per note with front-matter, and the image files. A time-limited download link is emailed when it is ready. While an export is in progress, requesting another returns that one; an export pending for over 30 minutes was interrupted and is marked as failed. API keys need the notes:read and highlights:read scopes.
+// @Tags exports
+// @Produce json
+// @Success 202 {object} map[string]data.Export "export: the pending export, Location header points to it"
+// @Failure 403 {object} map[string]string "API key without the required scopes"
+// @Failure 409 {object} map[string]string "An export is already in progress"
+// @Failure 429 {object} map[string]string "Rate limit exceeded"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/exports [post]
+func (h *ExportHandler) Create(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	export, err := h.service.RequestExport(r.Context(), user.ID)
+	if err != nil {
+		h.handleExportError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/exports/%d", export.ID))
+
+	err = h.app.writeJSON(w, http.StatusAccepted, envelope{"export": export}, headers)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Get an export
+// @Description Returns the status of an export. Once completed, includes a download link valid until expires_at.
+// @Tags exports
+// @Produce json
+// @Param id path int true "Export ID"
+// @Success 200 {object} map[string]data.Export "export"
+// @Failure 400 {object} map[string]string "Invalid export ID"
+// @Failure 403 {object} map[string]string "API key without the required scopes"
+// @Failure 404 {object} map[string]string "Export not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/exports/{id} [get]
+func (h *ExportHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	exportID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	export, err := h.service.GetExport(r.Context(), user.ID, exportID)
+	if err != nil {
+		h.handleExportError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"export": export}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
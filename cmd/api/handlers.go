@@ -5,23 +5,41 @@ import "shuvoedward/Bible_project/internal/service"
 // Handlers contains all HTTP methods
 // This is specific to the HTTP API entry point
 type Handlers struct {
-	Note      *NoteHandler
-	User      *UserHandler
-	Token     *TokenHandler
-	Highlight *HighlightHandler
-	Book      *BookHandler
-	Image     *ImageHandler
+	Note       *NoteHandler
+	User       *UserHandler
+	Token      *TokenHandler
+	TwoFactor  *TwoFactorHandler
+	APIKey     *APIKeyHandler
+	OIDC       *OIDCHandler
+	Highlight  *HighlightHandler
+	Book       *BookHandler
+	Image      *ImageHandler
+	Export     *ExportHandler
+	Import     *ImportHandler
+	Template   *TemplateHandler
+	Annotation *AnnotationHandler
+	Sync       *SyncHandler
+	Event      *EventHandler
 }
 
 // NewHandlers creates all HTTP handlers
 // Handlers are tied to HTTP - not reusable like services
 func NewHandlers(app *application, services *service.Service) *Handlers {
 	return &Handlers{
-		Note:      NewNoteHandler(app, services.Note),
-		User:      NewUserHandler(app, services.User),
-		Token:     NewTokenHandler(app, services.Token),
-		Highlight: NewHighlightHandler(app, services.Highlight),
-		Book:      NewBookHandler(app, services.Book, services.Autocomplete),
-		Image:     NewImageHandler(app, services.Image),
+		Note:       NewNoteHandler(app, services.Note),
+		User:       NewUserHandler(app, services.User),
+		Token:      NewTokenHandler(app, services.Token),
+		TwoFactor:  NewTwoFactorHandler(app, services.TwoFactor),
+		APIKey:     NewAPIKeyHandler(app, services.APIKey),
+		OIDC:       NewOIDCHandler(app, services.OIDC),
+		Highlight:  NewHighlightHandler(app, services.Highlight),
+		Book:       NewBookHandler(app, services.Book, services.Autocomplete),
+		Image:      NewImageHandler(app, services.Image),
+		Export:     NewExportHandler(app, services.Export),
+		Import:     NewImportHandler(app, services.Import),
+		Template:   NewTemplateHandler(app, services.Template),
+		Annotation: NewAnnotationHandler(app, services.Annotation),
+		Sync:       NewSyncHandler(app, services.Sync),
+		Event:      NewEventHandler(app, services.Event),
 	}
 }
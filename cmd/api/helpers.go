@@ -159,15 +159,13 @@ func (app *application) parseNoteQuery(r *http.Request) (service.ListNotesInput,
 		page = 1 // default
 	}
 
+	// left unset, the user's preferences fill them in
 	pageSize, err := strconv.Atoi(query.Get("page_size"))
 	if err != nil || pageSize < 1 {
-		pageSize = 10 // default
+		pageSize = 0
 	}
 
 	sort := query.Get("sort")
-	if sort == "" {
-		sort = "-created_at" // default
-	}
 
 	return service.ListNotesInput{
 		NoteType: noteType,
@@ -200,3 +198,16 @@ func (app *application) readPaginationParams(r *http.Request) (data.Filters, err
 
 	return data.Filters{Page: page, PageSize: pageSize}, nil
 }
+
+// batchStatus is 201 if every item of a batch was created, 200 if a partial batch
+// created only some of them and 422 if an atomic batch was rolled back
+func batchStatus(report *service.BatchReport) int {
+	switch {
+	case report.Complete():
+		return http.StatusCreated
+	case report.Mode == service.BatchModePartial:
+		return http.StatusOK
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
@@ -3,18 +3,27 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/service"
 	"shuvoedward/Bible_project/internal/validator"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 type HighlightServiceInterface interface {
+	CreatePaletteEntry(ctx context.Context, userID int64, entry *data.PaletteEntry) (*validator.Validator, error)
 	DeleteHighlight(ctx context.Context, highlightID int64, userID int64) (*validator.Validator, error)
+	DeletePaletteEntry(ctx context.Context, userID, entryID int64) error
+	GetHighlight(ctx context.Context, userID int64, highlightID int64) (*data.Highlight, error)
 	InsertHighlight(ctx context.Context, highlight *data.Highlight, userID int64) (*validator.Validator, error)
-	UpdateHighlight(ctx context.Context, highlightID int64, userID int64, color string) (*validator.Validator, error)
+	InsertHighlightBatch(ctx context.Context, userID int64, mode string, highlights []*data.Highlight) (*service.BatchReport, *validator.Validator, error)
+	ListHighlights(ctx context.Context, userID int64, input service.ListHighlightsInput) ([]*data.Highlight, data.Metadata, *validator.Validator, error)
+	ListPalette(ctx context.Context, userID int64) ([]*data.PaletteEntry, error)
+	UpdateHighlight(ctx context.Context, highlightID int64, userID int64, update *service.HighlightUpdate) (*validator.Validator, error)
+	UpdatePaletteEntry(ctx context.Context, userID, entryID int64, input service.PaletteEntryInput) (*data.PaletteEntry, *validator.Validator, error)
 }
 
 type HighlightHandler struct {
@@ -29,28 +38,159 @@ func NewHighlightHandler(app *application, service HighlightServiceInterface) *H
 	}
 }
 
-func (h *HighlightHandler) RegisterRoutes(router httprouter.Router) {
-	router.HandlerFunc(http.MethodPost, "/v1/highlights", h.app.generalRateLimit(h.app.requireActivatedUser(h.Insert)))
-	router.HandlerFunc(http.MethodPatch, "/v1/highlights/:id", h.app.requireActivatedUser(h.app.generalRateLimit(h.Update)))
-	router.HandlerFunc(http.MethodDelete, "/v1/highlights/:id", h.app.generalRateLimit(h.app.requireActivatedUser(h.Delete)))
+func (h *HighlightHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, "/v1/highlights", h.app.generalRateLimit(h.app.requireScope(data.APIScopeHighlightsRead, h.List)))
+	router.HandlerFunc(http.MethodGet, "/v1/highlights/:id", h.app.generalRateLimit(h.app.requireScope(data.APIScopeHighlightsRead, h.paletteOr(h.Get, h.ListPalette))))
+	router.HandlerFunc(http.MethodPost, "/v1/highlights", h.app.generalRateLimit(h.app.requireScope(data.APIScopeHighlightsWrite, h.Insert)))
+	router.HandlerFunc(http.MethodPost, "/v1/highlights/batch", h.app.generalRateLimit(h.app.requireScope(data.APIScopeHighlightsWrite, h.InsertBatch)))
+	router.HandlerFunc(http.MethodPost, "/v1/highlights/palette", h.app.generalRateLimit(h.app.requireScope(data.APIScopeHighlightsWrite, h.CreatePaletteEntry)))
+	router.HandlerFunc(http.MethodPatch, "/v1/highlights/:id", h.app.requireScope(data.APIScopeHighlightsWrite, h.app.generalRateLimit(h.Update)))
+	router.HandlerFunc(http.MethodPatch, "/v1/highlights/:id/:entryID", h.app.generalRateLimit(h.app.requireScope(data.APIScopeHighlightsWrite, h.paletteOr(nil, h.UpdatePaletteEntry))))
+	router.HandlerFunc(http.MethodDelete, "/v1/highlights/:id", h.app.generalRateLimit(h.app.requireScope(data.APIScopeHighlightsWrite, h.Delete)))
+	router.HandlerFunc(http.MethodDelete, "/v1/highlights/:id/:entryID", h.app.generalRateLimit(h.app.requireScope(data.APIScopeHighlightsWrite, h.paletteOr(nil, h.DeletePaletteEntry))))
+}
+
+// paletteOr serves palette when the :id segment is "palette", otherwise highlight.
+// httprouter doesn't allow /v1/highlights/palette next to /v1/highlights/:id for the
+// same method, so the palette routes share the highlight ones. A nil highlight
+// responds 404.
+func (h *HighlightHandler) paletteOr(highlight, palette http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		switch {
+		case params.ByName("id") == "palette":
+			palette(w, r)
+		case highlight != nil:
+			highlight(w, r)
+		default:
+			h.app.notFoundResponse(w, r)
+		}
+	}
 }
 
 func (h *HighlightHandler) handleHighlightError(w http.ResponseWriter, r *http.Request, err error) {
 	switch {
-	case errors.Is(err, service.ErrHighlightNotFound):
+	case errors.Is(err, service.ErrHighlightNotFound),
+		errors.Is(err, service.ErrPaletteEntryNotFound):
 		h.app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrDuplicatePaletteColor):
+		h.app.errorResponse(w, r, http.StatusConflict, err.Error())
 	default:
 		h.app.serverErrorResponse(w, r, err)
 	}
 }
 
+// @Summary List highlights
+// @Description Returns a page of the user's highlights across the whole Bible, e.g. all yellow highlights in Psalms. Newest first by default; "canonical" sorts by book, chapter and verse.
+// @Tags highlights
+// @Produce json
+// @Param color query string false "Only highlights of this color (case-insensitive)" example(#FFFF00)
+// @Param book query string false "Only highlights in this book" example(Psalms)
+// @Param from query string false "Created on or after this date (YYYY-MM-DD)"
+// @Param to query string false "Created on or before this date (YYYY-MM-DD)"
+// @Param sort query string false "Sort order" Enums(canonical, created_at, -created_at, updated_at, -updated_at) default(-created_at)
+// @Param page query int false "Page number" default(1) minimum(1) maximum(10000)
+// @Param page_size query int false "Number of items per page" default(10) minimum(1) maximum(100)
+// @Success 200 {object} object{highlights=[]data.Highlight,metadata=data.Metadata} "Highlights with pagination metadata"
+// @Failure 400 {object} object{error=string} "Invalid query parameters"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/highlights [get]
+func (h *HighlightHandler) List(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	filters, err := h.app.readPaginationParams(r)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+
+	input := service.ListHighlightsInput{
+		Color:    query.Get("color"),
+		Book:     query.Get("book"),
+		Sort:     query.Get("sort"),
+		Page:     filters.Page,
+		PageSize: filters.PageSize,
+	}
+
+	if query.Has("from") {
+		from, err := time.Parse(time.DateOnly, query.Get("from"))
+		if err != nil {
+			h.app.badRequestResponse(w, r, errors.New("from must be a date like 2006-01-02"))
+			return
+		}
+		input.From = &from
+	}
+
+	if query.Has("to") {
+		to, err := time.Parse(time.DateOnly, query.Get("to"))
+		if err != nil {
+			h.app.badRequestResponse(w, r, errors.New("to must be a date like 2006-01-02"))
+			return
+		}
+		// The whole last day is included
+		until := to.AddDate(0, 0, 1)
+		input.Until = &until
+	}
+
+	highlights, metadata, v, err := h.service.ListHighlights(r.Context(), user.ID, input)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleHighlightError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"highlights": highlights, "metadata": metadata}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Get a highlight
+// @Description Returns one of the user's highlights
+// @Tags highlights
+// @Produce json
+// @Param id path int true "Highlight ID"
+// @Success 200 {object} object{highlight=data.Highlight} "Highlight"
+// @Failure 400 {object} object{error=string} "Invalid highlight ID"
+// @Failure 404 {object} object{error=string} "Highlight not found or unauthorized"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/highlights/{id} [get]
+func (h *HighlightHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	highlightID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	highlight, err := h.service.GetHighlight(r.Context(), user.ID, highlightID)
+	if err != nil {
+		h.handleHighlightError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"highlight": highlight}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
 // @Summary Create a new highlight
 // @Description Create a new Bible verse highlight with color and position details
 // @Tags highlights
 // @Accept json
 // @Produce json
 // @Param highlight body data.Highlight true "Highlight data (user_id will be set automatically from auth)"
-// @Success 201 {object} object{highlight=data.Highlight} "Successfully created highlight"
+// @Success 201 {object} object{highlight=data.Highlight} "Successfully created highlight, Location header points to it"
 // @Failure 400 {object} map[string]string "Invalid JSON or request body"
 // @Failure 422 {object} map[string]map[string]string "Validation errors"
 // @Failure 500 {object} map[string]string "Internal server error"
@@ -78,7 +218,62 @@ func (h *HighlightHandler) Insert(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.app.writeJSON(w, http.StatusCreated, envelope{"highlight": highlight}, nil)
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/highlights/%d", highlight.ID))
+
+	err = h.app.writeJSON(w, http.StatusCreated, envelope{"highlight": highlight}, headers)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+type HighlightBatchInput struct {
+	Mode       string            `json:"mode"`
+	Highlights []*data.Highlight `json:"highlights"`
+}
+
+// @Summary Create highlights in a batch
+// @Description Creates up to 500 highlights in a single request and transaction, each validated like POST /v1/highlights. With mode "atomic" (default) nothing is created unless every highlight is valid and inserted; with mode "partial" the valid highlights are created and the others reported. Every highlight gets a result with its index, status (created, invalid, failed or rolled_back), and ID or errors.
+// @Tags highlights
+// @Accept json
+// @Produce json
+// @Param input body HighlightBatchInput true "Mode and highlights"
+// @Success 201 {object} object{batch=service.BatchReport} "Every highlight created"
+// @Success 200 {object} object{batch=service.BatchReport} "Partial batch, some highlights failed"
+// @Failure 400 {object} object{error=string} "Invalid JSON or request body"
+// @Failure 422 {object} object{batch=service.BatchReport} "Atomic batch rolled back, or invalid mode or item count"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/highlights/batch [post]
+func (h *HighlightHandler) InsertBatch(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	input := HighlightBatchInput{Mode: service.BatchModeAtomic}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	for i, highlight := range input.Highlights {
+		if highlight == nil {
+			h.app.badRequestResponse(w, r, fmt.Errorf("highlight %d must be an object", i))
+			return
+		}
+	}
+
+	report, v, err := h.service.InsertHighlightBatch(r.Context(), user.ID, input.Mode, input.Highlights)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleHighlightError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, batchStatus(report), envelope{"batch": report}, nil)
 	if err != nil {
 		h.app.serverErrorResponse(w, r, err)
 	}
@@ -86,13 +281,13 @@ func (h *HighlightHandler) Insert(w http.ResponseWriter, r *http.Request) {
 
 // updateHighlightHandler updates the color of a specific highlight
 // @Summary Update highlight color
-// @Description Update the color of an existing highlight owned by the authenticated user
+// @Description Update the color of an existing highlight owned by the authenticated user. With a palette_id the highlight takes the color of that palette entry; without one it no longer refers to a palette entry.
 // @Tags highlights
 // @Accept json
 // @Produce json
 // @Param id path int true "Highlight ID"
 // @Param input body object true "Highlight color update" example({"color": "#FFFF00"})
-// @Success 200 {object} object{highlights=object{id=int,color=string}} "Successfully updated highlight"
+// @Success 200 {object} object{highlights=object{id=int,color=string,palette_id=int}} "Successfully updated highlight"
 // @Failure 400 {object} object{error=string} "Invalid request (bad ID or JSON)"
 // @Failure 404 {object} object{error=string} "Highlight not found or unauthorized"
 // @Failure 422 {object} object{error=map[string]string} "Validation failed"
@@ -109,7 +304,8 @@ func (h *HighlightHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
-		Color string `json:"color"`
+		Color     string `json:"color"`
+		PaletteID *int64 `json:"palette_id"`
 	}
 
 	err = h.app.readJSON(r, &input)
@@ -118,7 +314,9 @@ func (h *HighlightHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	v, err := h.service.UpdateHighlight(r.Context(), highlightID, user.ID, input.Color)
+	update := &service.HighlightUpdate{Color: input.Color, PaletteID: input.PaletteID}
+
+	v, err := h.service.UpdateHighlight(r.Context(), highlightID, user.ID, update)
 	if v != nil && !v.Valid() {
 		h.app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -131,9 +329,11 @@ func (h *HighlightHandler) Update(w http.ResponseWriter, r *http.Request) {
 	response := struct {
 		HighlightID int64  `json:"id"`
 		Color       string `json:"color"`
+		PaletteID   *int64 `json:"palette_id"`
 	}{
 		HighlightID: highlightID,
-		Color:       input.Color,
+		Color:       update.Color,
+		PaletteID:   update.PaletteID,
 	}
 
 	err = h.app.writeJSON(w, http.StatusOK, envelope{"highlights": response}, nil)
@@ -174,3 +374,159 @@ func (h *HighlightHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// @Summary List the highlight palette
+// @Description Returns the user's palette in display order. Each entry gives a highlight color its meaning, e.g. green = promises.
+// @Tags highlights
+// @Produce json
+// @Success 200 {object} object{palette=[]data.PaletteEntry} "Palette entries"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/highlights/palette [get]
+func (h *HighlightHandler) ListPalette(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	palette, err := h.service.ListPalette(r.Context(), user.ID)
+	if err != nil {
+		h.handleHighlightError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"palette": palette}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Add a palette entry
+// @Description Adds a color with its meaning to the user's palette. Without an order the entry is put last.
+// @Tags highlights
+// @Accept json
+// @Produce json
+// @Param input body object{color=string,label=string,order=int} true "Palette entry" example({"color": "#00AA00", "label": "Promises"})
+// @Success 201 {object} object{palette_entry=data.PaletteEntry} "Created palette entry"
+// @Failure 400 {object} object{error=string} "Invalid JSON or request body"
+// @Failure 409 {object} object{error=string} "Color already in the palette"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/highlights/palette [post]
+func (h *HighlightHandler) CreatePaletteEntry(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	var input struct {
+		Color string `json:"color"`
+		Label string `json:"label"`
+		Order int    `json:"order"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &data.PaletteEntry{
+		Color: input.Color,
+		Label: input.Label,
+		Order: input.Order,
+	}
+
+	v, err := h.service.CreatePaletteEntry(r.Context(), user.ID, entry)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleHighlightError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/highlights/palette/%d", entry.ID))
+
+	err = h.app.writeJSON(w, http.StatusCreated, envelope{"palette_entry": entry}, headers)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Update a palette entry
+// @Description Changes the color, label or order of a palette entry, omitted fields are kept. Highlights referencing the entry follow a new color; renaming the label leaves them untouched.
+// @Tags highlights
+// @Accept json
+// @Produce json
+// @Param entryID path int true "Palette entry ID"
+// @Param input body object{color=string,label=string,order=int} true "Fields to change" example({"label": "God's promises"})
+// @Success 200 {object} object{palette_entry=data.PaletteEntry} "Updated palette entry"
+// @Failure 400 {object} object{error=string} "Invalid entry ID or JSON"
+// @Failure 404 {object} object{error=string} "Palette entry not found"
+// @Failure 409 {object} object{error=string} "Color already in the palette"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/highlights/palette/{entryID} [patch]
+func (h *HighlightHandler) UpdatePaletteEntry(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	entryID, err := h.app.readIDParam(r, "entryID")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Color *string `json:"color"`
+		Label *string `json:"label"`
+		Order *int    `json:"order"`
+	}
+
+	err = h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry, v, err := h.service.UpdatePaletteEntry(r.Context(), user.ID, entryID, service.PaletteEntryInput(input))
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleHighlightError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"palette_entry": entry}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Delete a palette entry
+// @Description Removes an entry from the user's palette. Its highlights keep their color but no longer refer to an entry.
+// @Tags highlights
+// @Param entryID path int true "Palette entry ID"
+// @Success 204 "Palette entry deleted"
+// @Failure 400 {object} object{error=string} "Invalid entry ID"
+// @Failure 404 {object} object{error=string} "Palette entry not found"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/highlights/palette/{entryID} [delete]
+func (h *HighlightHandler) DeletePaletteEntry(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	entryID, err := h.app.readIDParam(r, "entryID")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = h.service.DeletePaletteEntry(r.Context(), user.ID, entryID)
+	if err != nil {
+		h.handleHighlightError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -7,12 +7,28 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/service"
 	"shuvoedward/Bible_project/internal/validator"
+	"strings"
 	"testing"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 type mockHighlightService struct{}
 
+func (s *mockHighlightService) CreatePaletteEntry(
+	ctx context.Context,
+	userID int64,
+	entry *data.PaletteEntry,
+) (*validator.Validator, error) {
+	if entry.Color == "#000000" {
+		return nil, data.ErrDuplicatePaletteColor
+	}
+	entry.ID = 1
+	return nil, nil
+}
+
 func (s *mockHighlightService) DeleteHighlight(
 	ctx context.Context,
 	highlightID int64,
@@ -21,34 +37,126 @@ func (s *mockHighlightService) DeleteHighlight(
 	return nil, nil
 }
 
+func (s *mockHighlightService) DeletePaletteEntry(
+	ctx context.Context,
+	userID int64,
+	entryID int64,
+) error {
+	if entryID != 1 {
+		return service.ErrPaletteEntryNotFound
+	}
+	return nil
+}
+
+func (s *mockHighlightService) GetHighlight(
+	ctx context.Context,
+	userID int64,
+	highlightID int64,
+) (*data.Highlight, error) {
+	if highlightID != 1 {
+		return nil, service.ErrHighlightNotFound
+	}
+	return &data.Highlight{ID: 1, Book: "Psalms", Chapter: 23, Color: "#FFFF00"}, nil
+}
+
 func (s *mockHighlightService) InsertHighlight(
 	ctx context.Context,
 	highlight *data.Highlight,
 	userID int64,
 ) (*validator.Validator, error) {
+	highlight.ID = 1
 	return nil, nil
 }
 
+func (s *mockHighlightService) InsertHighlightBatch(
+	ctx context.Context,
+	userID int64,
+	mode string,
+	highlights []*data.Highlight,
+) (*service.BatchReport, *validator.Validator, error) {
+	report := &service.BatchReport{Mode: mode}
+	for i, highlight := range highlights {
+		item := &service.BatchItemResult{Index: i, Status: service.BatchStatusCreated, ID: int64(i + 1)}
+		if highlight.Color == "" {
+			item.Status = service.BatchStatusInvalid
+			item.ID = 0
+			report.Failed++
+		} else {
+			report.Created++
+		}
+		report.Items = append(report.Items, item)
+	}
+	return report, nil, nil
+}
+
+func (s *mockHighlightService) ListHighlights(
+	ctx context.Context,
+	userID int64,
+	input service.ListHighlightsInput,
+) ([]*data.Highlight, data.Metadata, *validator.Validator, error) {
+	if input.Sort == "invalid" {
+		v := validator.New()
+		v.AddError("sort", "invalid sort value")
+		return nil, data.Metadata{}, v, nil
+	}
+	return []*data.Highlight{}, data.Metadata{}, nil, nil
+}
+
+func (s *mockHighlightService) ListPalette(
+	ctx context.Context,
+	userID int64,
+) ([]*data.PaletteEntry, error) {
+	return []*data.PaletteEntry{{ID: 1, Color: "#00AA00", Label: "Promises", Order: 1}}, nil
+}
+
 func (s *mockHighlightService) UpdateHighlight(
 	ctx context.Context,
 	highlightID int64,
 	userID int64,
-	color string,
+	update *service.HighlightUpdate,
 ) (*validator.Validator, error) {
 	return nil, nil
 }
 
+func (s *mockHighlightService) UpdatePaletteEntry(
+	ctx context.Context,
+	userID int64,
+	entryID int64,
+	input service.PaletteEntryInput,
+) (*data.PaletteEntry, *validator.Validator, error) {
+	if entryID != 1 {
+		return nil, nil, service.ErrPaletteEntryNotFound
+	}
+	return &data.PaletteEntry{ID: 1, Color: "#00AA00", Label: *input.Label, Order: 1}, nil, nil
+}
+
 func TestHighlightHandler_Insert(t *testing.T) {
 	handler := NewHighlightHandler(testApp, &mockHighlightService{})
 
 	tests := []struct {
-		name           string
-		body           map[string]any
-		user           *data.User
-		expectedStatus int
+		name             string
+		body             map[string]any
+		user             *data.User
+		expectedStatus   int
+		expectedLocation string
 	}{
 		{
 			name: "valid insert",
+			body: map[string]any{
+				"book":         "Genesis",
+				"chapter":      1,
+				"start_verse":  1,
+				"end_verse":    1,
+				"start_offset": 0,
+				"end_offset":   10,
+				"color":        "#FFFF00",
+			},
+			user:             &data.User{ID: 1, Activated: true},
+			expectedStatus:   http.StatusCreated,
+			expectedLocation: "/v1/highlights/1",
+		},
+		{
+			name: "unknown field",
 			body: map[string]any{
 				"book":    "Genesis",
 				"chapter": 1,
@@ -56,7 +164,7 @@ func TestHighlightHandler_Insert(t *testing.T) {
 				"color":   "#FFFF00",
 			},
 			user:           &data.User{ID: 1, Activated: true},
-			expectedStatus: http.StatusCreated,
+			expectedStatus: http.StatusBadRequest,
 		},
 	}
 
@@ -64,7 +172,7 @@ func TestHighlightHandler_Insert(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			body, _ := json.Marshal(tt.body)
 			r := httptest.NewRequest(http.MethodPost, "/v1/highlights", bytes.NewReader(body))
-			r.Header.Set("Content-TYpe", "application/json")
+			r.Header.Set("Content-Type", "application/json")
 
 			r = testApp.contextSetUser(r, tt.user)
 
@@ -75,7 +183,144 @@ func TestHighlightHandler_Insert(t *testing.T) {
 			if w.Code != tt.expectedStatus {
 				t.Errorf("got %d, want %d", w.Code, tt.expectedStatus)
 			}
+
+			if got := w.Header().Get("Location"); got != tt.expectedLocation {
+				t.Errorf("got Location %q, want %q", got, tt.expectedLocation)
+			}
+		})
+	}
+
+}
+
+func TestHighlightHandler_InsertBatch(t *testing.T) {
+	handler := NewHighlightHandler(testApp, &mockHighlightService{})
+
+	highlight := func(color string) map[string]any {
+		return map[string]any{
+			"book":         "John",
+			"chapter":      3,
+			"start_verse":  16,
+			"end_verse":    16,
+			"start_offset": 0,
+			"end_offset":   10,
+			"color":        color,
+		}
+	}
+
+	tests := []struct {
+		name           string
+		body           map[string]any
+		expectedStatus int
+	}{
+		{
+			name:           "all created",
+			body:           map[string]any{"highlights": []any{highlight("#FFFF00"), highlight("#00FF00")}},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "atomic batch with a failure",
+			body:           map[string]any{"highlights": []any{highlight("#FFFF00"), highlight("")}},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "partial batch with a failure",
+			body:           map[string]any{"mode": "partial", "highlights": []any{highlight("#FFFF00"), highlight("")}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "null item",
+			body:           map[string]any{"highlights": []any{nil}},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			r := httptest.NewRequest(http.MethodPost, "/v1/highlights/batch", bytes.NewReader(body))
+			r = testApp.contextSetUser(r, &data.User{ID: 1, Activated: true})
+
+			w := httptest.NewRecorder()
+
+			handler.InsertBatch(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got %d, want %d", w.Code, tt.expectedStatus)
+			}
 		})
 	}
+}
+
+func TestHighlightHandler_Routes(t *testing.T) {
+	handler := NewHighlightHandler(testApp, &mockHighlightService{})
+
+	router := httprouter.New()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{name: "list", url: "/v1/highlights?color=%23FFFF00&book=Psalms", expectedStatus: http.StatusOK},
+		{name: "list with invalid sort", url: "/v1/highlights?sort=invalid", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "list with invalid date", url: "/v1/highlights?from=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "get", url: "/v1/highlights/1", expectedStatus: http.StatusOK},
+		{name: "get missing", url: "/v1/highlights/2", expectedStatus: http.StatusNotFound},
+	}
 
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			r = testApp.contextSetUser(r, &data.User{ID: 1, Activated: true})
+
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got %d, want %d", w.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestHighlightHandler_PaletteRoutes(t *testing.T) {
+	handler := NewHighlightHandler(testApp, &mockHighlightService{})
+
+	router := httprouter.New()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{name: "list", method: http.MethodGet, url: "/v1/highlights/palette", expectedStatus: http.StatusOK},
+		{name: "create", method: http.MethodPost, url: "/v1/highlights/palette", body: `{"color": "#00AA00", "label": "Promises"}`, expectedStatus: http.StatusCreated},
+		{name: "create duplicate color", method: http.MethodPost, url: "/v1/highlights/palette", body: `{"color": "#000000", "label": "Sin"}`, expectedStatus: http.StatusConflict},
+		{name: "rename", method: http.MethodPatch, url: "/v1/highlights/palette/1", body: `{"label": "God's promises"}`, expectedStatus: http.StatusOK},
+		{name: "rename missing", method: http.MethodPatch, url: "/v1/highlights/palette/2", body: `{"label": "Sin"}`, expectedStatus: http.StatusNotFound},
+		{name: "delete", method: http.MethodDelete, url: "/v1/highlights/palette/1", expectedStatus: http.StatusNoContent},
+		{name: "delete invalid id", method: http.MethodDelete, url: "/v1/highlights/palette/abc", expectedStatus: http.StatusBadRequest},
+		{name: "no palette segment", method: http.MethodDelete, url: "/v1/highlights/1/1", expectedStatus: http.StatusNotFound},
+		{name: "highlight still served", method: http.MethodGet, url: "/v1/highlights/1", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			r = testApp.contextSetUser(r, &data.User{ID: 1, Activated: true})
+
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got %d, want %d", w.Code, tt.expectedStatus)
+			}
+		})
+	}
 }
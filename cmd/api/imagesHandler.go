@@ -30,8 +30,8 @@ func NewImageHandler(app *application, service ImageHandlerInterface) *ImageHand
 }
 
 func (h *ImageHandler) RegisterRoutes(router *httprouter.Router) {
-	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/images", h.app.generalRateLimit(h.app.requireActivatedUser(h.Upload)))
-	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id/images/*s3_key", h.app.generalRateLimit(h.app.requireActivatedUser(h.Delete)))
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/images", h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Upload)))
+	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id/images/*s3_key", h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Delete)))
 }
 
 func (h *ImageHandler) handlerImageError(w http.ResponseWriter, r *http.Request, err error) {
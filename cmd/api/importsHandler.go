@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/service"
+	"shuvoedward/Bible_project/internal/validator"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type ImportServiceInterface interface {
+	ImportHighlightsCSV(ctx context.Context, userID int64, r io.Reader) (*service.ImportReport, *validator.Validator, error)
+	ImportMarkdownArchive(ctx context.Context, userID int64, archive []byte) (*service.ImportReport, *validator.Validator, error)
+}
+
+type ImportHandler struct {
+	app     *application
+	service ImportServiceInterface
+}
+
+func NewImportHandler(app *application, importService ImportServiceInterface) *ImportHandler {
+	return &ImportHandler{
+		app:     app,
+		service: importService,
+	}
+}
+
+func (h *ImportHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, "/v1/imports",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Create)))
+}
+
+// @Summary Import notes or highlights
+// @Description Imports a zip of Markdown files as notes, or a CSV of highlights. Markdown front-matter may set title, note_type and locations (e.g. "John 3:16"); notes without a type become BIBLE notes when they have locations and GENERAL notes titled after the file otherwise. API keys need the notes:write scope, and highlights:write too for a CSV. The CSV needs a header row with book, chapter, start_verse, end_verse, color and optionally start_offset, end_offset and palette_id; rows are validated like POST /v1/highlights and rows without offsets cover whole verses. Every file or row is reported as imported, skipped (already exists) or failed.
+// @Tags imports
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "A .zip of Markdown files or a .csv of highlights (max 20MB)"
+// @Success 200 {object} map[string]service.ImportReport "report: per-item results"
+// @Failure 400 {object} map[string]string "Invalid multipart form"
+// @Failure 403 {object} map[string]string "API key without the required scope"
+// @Failure 422 {object} map[string]map[string]string "Unsupported or unreadable file"
+// @Failure 429 {object} map[string]string "Rate limit exceeded"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/imports [post]
+func (h *ImportHandler) Create(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 20<<20)
+
+	err := r.ParseMultipartForm(20 << 20) // 20 MB limit
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	var report *service.ImportReport
+	var v *validator.Validator
+
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".zip":
+		archive, err := io.ReadAll(file)
+		if err != nil {
+			h.app.badRequestResponse(w, r, err)
+			return
+		}
+		report, v, err = h.service.ImportMarkdownArchive(r.Context(), user.ID, archive)
+		if err != nil {
+			h.app.serverErrorResponse(w, r, err)
+			return
+		}
+	case ".csv":
+		if key := h.app.contextGetAPIKey(r); key != nil && !key.HasScope(data.APIScopeHighlightsWrite) {
+			h.app.missingScopeResponse(w, r, data.APIScopeHighlightsWrite)
+			return
+		}
+		report, v, err = h.service.ImportHighlightsCSV(r.Context(), user.ID, file)
+		if err != nil {
+			h.app.serverErrorResponse(w, r, err)
+			return
+		}
+	default:
+		v = validator.New()
+		v.AddError("file", "must be a .zip of Markdown files or a .csv of highlights")
+	}
+
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
@@ -11,7 +11,7 @@
 // @Security ApiKeyAuth
 // @in header
 // @name Authorization
-// @description API token authentication. Use format: "Bearer <your-api-token>"
+// @description Authentication token or API key. Use format: "Bearer <token>". API keys only reach endpoints within their scopes.
 package main
 
 import (
@@ -27,6 +27,7 @@ import (
 	"runtime"
 	"shuvoedward/Bible_project/internal/cache"
 	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/events"
 	imageProcessor "shuvoedward/Bible_project/internal/imageCompress"
 	"shuvoedward/Bible_project/internal/mailer"
 	"shuvoedward/Bible_project/internal/ratelimit"
@@ -34,6 +35,7 @@ import (
 	"shuvoedward/Bible_project/internal/scheduler"
 	"shuvoedward/Bible_project/internal/service"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -86,6 +88,10 @@ type config struct {
 	redisConfig cache.RedisConfig
 
 	corsTrustedOrigin string
+
+	trashRetentionDays int
+
+	oidcProviders []service.OIDCProviderConfig
 }
 
 type application struct {
@@ -93,6 +99,7 @@ type application struct {
 	logger      *slog.Logger
 	services    *service.Service
 	rateLimiter *ratelimit.Limiters
+	events      *events.Broker
 	wg          *sync.WaitGroup
 }
 
@@ -132,8 +139,17 @@ func main() {
 	}
 
 	scheduler := scheduler.NewScheduler(5)
+	scheduler.Mailer = mailer
+	scheduler.Logger = logger
 	scheduler.Start()
 
+	broker, err := events.NewBroker(cfg.db.dsn, logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	defer broker.Close()
+
 	// 4. Initialize data layer models
 	model := data.NewModels(db)
 
@@ -155,6 +171,8 @@ func main() {
 		booksSearchIndex,
 		imgProcessor,
 		scheduler,
+		broker,
+		cfg.oidcProviders,
 	)
 
 	rateLimitEnabled := cfg.env == "production"
@@ -172,7 +190,12 @@ func main() {
 	setupMetrics(version, db)
 
 	// 10. Initialize background tasks with panic recovery
-	backgroundTasks := newBackgroundTasks(model.Tokens, logger)
+	backgroundTasks := newBackgroundTasks(
+		model.Tokens,
+		services.Note,
+		time.Duration(cfg.trashRetentionDays)*24*time.Hour,
+		logger,
+	)
 	go backgroundTasks.start()
 
 	// 11. Create application container
@@ -181,6 +204,7 @@ func main() {
 		logger:      logger,
 		services:    services,
 		rateLimiter: rateLimiters,
+		events:      broker,
 		wg:          &sync.WaitGroup{},
 	}
 
@@ -289,8 +313,15 @@ func loadConfig(cfg *config) {
 
 	flag.StringVar(&cfg.corsTrustedOrigin, "cors-trusted-origin", "http://localhost:9000", "Cross Origin Trusted")
 
+	flag.IntVar(&cfg.trashRetentionDays, "trash-retention-days", 30, "Days a deleted note stays in the trash before it is purged")
+
+	var oidcProviders string
+	flag.StringVar(&oidcProviders, "oidc-providers", os.Getenv("OIDC_PROVIDERS"), "Comma separated OpenID Connect providers to log in with, each configured by OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and _REDIRECT_URL")
+
 	flag.Parse()
 
+	cfg.oidcProviders = loadOIDCProviders(oidcProviders)
+
 	if cfg.env == "production" {
 		password := os.Getenv("DB_PASSWORD")
 		port := getEnvAsInt("DB_PORT", 5432)
@@ -308,6 +339,31 @@ func loadConfig(cfg *config) {
 
 }
 
+// loadOIDCProviders reads the configuration of each named provider from the environment,
+// e.g. OIDC_GOOGLE_ISSUER for "google"
+func loadOIDCProviders(names string) []service.OIDCProviderConfig {
+	var providers []service.OIDCProviderConfig
+
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		providers = append(providers, service.OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		})
+	}
+
+	return providers
+}
+
 func makeBooksMap() map[string]struct{} {
 	books := make(map[string]struct{}, 66)
 	for _, bookTitle := range data.AllBooks {
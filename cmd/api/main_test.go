@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"shuvoedward/Bible_project/internal/cache"
@@ -61,6 +62,76 @@ func (s *mockUserService) UpdatePassword(ctx context.Context, tokenPlaintext, pa
 	return nil, nil
 }
 
+func (s *mockUserService) GetUser(ctx context.Context, userID int64) (*data.User, error) {
+	return &data.User{ID: userID, Name: "Test User", Email: "test@example.com", Activated: true}, nil
+}
+
+func (s *mockUserService) UpdateUser(ctx context.Context, userID int64, input service.UserUpdate) (*data.User, *validator.Validator, error) {
+	if input.Name != nil && *input.Name == "" {
+		v := validator.New()
+		v.AddError("name", "must be provided")
+		return nil, v, nil
+	}
+
+	user, _ := s.GetUser(ctx, userID)
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	return user, nil, nil
+}
+
+func (s *mockUserService) RequestEmailChange(ctx context.Context, userID int64, newEmail, password string) (*validator.Validator, error) {
+	switch {
+	case password != "password123":
+		return nil, service.ErrPasswordNotMatch
+	case newEmail == "duplicate@example.com":
+		return nil, service.ErrDuplicateEmail
+	}
+
+	return nil, nil
+}
+
+func (s *mockUserService) ConfirmEmailChange(ctx context.Context, tokenPlaintext string) (*data.User, error) {
+	if tokenPlaintext == "invalid-token" {
+		return nil, service.ErrTokenNotFound
+	}
+
+	return &data.User{ID: 1, Name: "Test User", Email: "new@example.com", Activated: true}, nil
+}
+
+func (s *mockUserService) DeleteUser(ctx context.Context, userID int64, password string) (*validator.Validator, error) {
+	if password == "" {
+		v := validator.New()
+		v.AddError("password", "must be provided")
+		return v, nil
+	}
+	if password != "password123" {
+		return nil, service.ErrPasswordNotMatch
+	}
+
+	return nil, nil
+}
+
+func (s *mockUserService) GetPreferences(ctx context.Context, userID int64) (data.Preferences, error) {
+	return data.DefaultPreferences(), nil
+}
+
+func (s *mockUserService) UpdatePreferences(ctx context.Context, userID int64, input service.PreferencesUpdate) (data.Preferences, *validator.Validator, error) {
+	preferences := data.DefaultPreferences()
+
+	if input.Timezone != nil {
+		if *input.Timezone == "Mars/Olympus_Mons" {
+			v := validator.New()
+			v.AddError("timezone", "must be an IANA time zone like Europe/London")
+			return data.Preferences{}, v, nil
+		}
+		preferences.Timezone = *input.Timezone
+	}
+
+	return preferences, nil, nil
+}
+
 type mockTokenService struct{}
 
 func (s *mockTokenService) CreateActivationToken(ctx context.Context, email string) (*validator.Validator, error) {
@@ -71,16 +142,42 @@ func (s *mockTokenService) CreateActivationToken(ctx context.Context, email stri
 	return nil, nil
 }
 
-func (s *mockTokenService) CreateAuthToken(ctx context.Context, email, password string) (string, *validator.Validator, error) {
+func (s *mockTokenService) CreateAuthToken(ctx context.Context, email, password string, info data.SessionInfo) (*service.LoginResult, *validator.Validator, error) {
 	if email == "invalid-email" {
-		return "", nil, service.ErrEmailNotFound
+		return nil, nil, service.ErrEmailNotFound
 	}
 
 	if password == "invalid-password" {
-		return "", nil, service.ErrPasswordNotMatch
+		return nil, nil, service.ErrPasswordNotMatch
+	}
+
+	if email == "locked-email" {
+		return nil, nil, &service.LoginLockedError{RetryAfter: 1500 * time.Millisecond}
+	}
+
+	if email == "two-factor-email" {
+		return &service.LoginResult{Challenge: &data.Token{Plaintext: "valid-challenge", Expiry: time.Now().Add(5 * time.Minute)}}, nil, nil
 	}
 
-	return "valid-token", nil, nil
+	return &service.LoginResult{TokenPair: mockTokenPair()}, nil, nil
+}
+
+func (s *mockTokenService) CreateMagicLink(ctx context.Context, email string) (*validator.Validator, error) {
+	if email == "" {
+		v := validator.New()
+		v.AddError("email", "must be provided")
+		return v, nil
+	}
+
+	return nil, nil
+}
+
+func (s *mockTokenService) ExchangeMagicLink(ctx context.Context, tokenPlaintext string, info data.SessionInfo) (*service.LoginResult, *validator.Validator, error) {
+	if tokenPlaintext == "invalid-token" {
+		return nil, nil, service.ErrInvalidToken
+	}
+
+	return &service.LoginResult{TokenPair: mockTokenPair()}, nil, nil
 }
 
 func (s *mockTokenService) CreatePasswordResetToken(ctx context.Context, email string) (*validator.Validator, error) {
@@ -102,6 +199,65 @@ func (s *mockTokenService) GetUserForToken(ctx context.Context, tokenPlainText s
 	}, nil
 }
 
+func (s *mockTokenService) ListSessions(ctx context.Context, userID int64, currentToken string) ([]*data.Session, error) {
+	return []*data.Session{{ID: 1, Current: currentToken == "valid-token"}}, nil
+}
+
+func (s *mockTokenService) RefreshToken(ctx context.Context, refreshPlaintext string, info data.SessionInfo) (*service.TokenPair, error) {
+	if refreshPlaintext != "valid-refresh-token" {
+		return nil, service.ErrInvalidToken
+	}
+
+	return mockTokenPair(), nil
+}
+
+func mockTokenPair() *service.TokenPair {
+	return &service.TokenPair{
+		Access:  &data.Token{Plaintext: "valid-token", Expiry: time.Now().Add(15 * time.Minute)},
+		Refresh: &data.Token{Plaintext: "valid-refresh-token", Expiry: time.Now().Add(30 * 24 * time.Hour)},
+	}
+}
+
+func (s *mockTokenService) RevokeAllTokens(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (s *mockTokenService) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	if sessionID != 1 {
+		return service.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *mockTokenService) RevokeToken(ctx context.Context, userID int64, tokenPlaintext string) error {
+	if tokenPlaintext == "" {
+		return errors.New("missing token")
+	}
+
+	return nil
+}
+
+func (s *mockTokenService) UnlockLogin(ctx context.Context, tokenPlaintext string) error {
+	if tokenPlaintext == "invalid-token" {
+		return service.ErrInvalidToken
+	}
+
+	return nil
+}
+
+func (s *mockTokenService) VerifyTwoFactor(ctx context.Context, challengePlaintext, code string, info data.SessionInfo) (*service.TokenPair, *validator.Validator, error) {
+	if challengePlaintext != "valid-challenge" {
+		return nil, nil, service.ErrInvalidToken
+	}
+
+	if code != "123456" {
+		return nil, nil, service.ErrInvalidTwoFactorCode
+	}
+
+	return mockTokenPair(), nil, nil
+}
+
 var testApp *application
 
 func TestMain(m *testing.M) {
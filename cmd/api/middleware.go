@@ -22,6 +22,11 @@ func (rw *responseWriter) WriteHeader(status int) {
 	rw.ResponseWriter.WriteHeader(status)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush event streams
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -39,7 +44,7 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 	})
 }
 
-// authenticate validates the authentication token and adds user to context
+// authenticate validates the authentication token or API key and adds user to context
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -62,6 +67,25 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		ctx := r.Context()
 
+		if strings.HasPrefix(token, data.APIKeyPrefix) {
+			user, key, err := app.services.APIKey.GetUserForAPIKey(ctx, token)
+			if err != nil {
+				switch {
+				case errors.Is(err, service.ErrInvalidToken):
+					app.invalidAuthTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetAPIKey(r, key)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		user, err := app.services.Token.GetUserForToken(ctx, token)
 		if err != nil {
 			switch {
@@ -74,12 +98,64 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// requireAuthenticatedUser requires a signed in user, API keys are rejected
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		if app.contextGetAPIKey(r) != nil {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireActivatedUser requires a signed in, activated user, API keys are rejected
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		if app.contextGetAPIKey(r) != nil {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope requires an activated user like requireActivatedUser, and also lets in
+// API keys granted scope. Routes that use it are the ones API keys can reach.
+func (app *application) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return app.requireScopes([]string{scope}, next)
+}
+
+// requireScopes is requireScope for routes serving more than one kind of data, e.g.
+// notes and highlights, API keys need every scope
+func (app *application) requireScopes(scopes []string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
@@ -93,6 +169,14 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 			return
 		}
 
+		key := app.contextGetAPIKey(r)
+		for _, scope := range scopes {
+			if key != nil && !key.HasScope(scope) {
+				app.missingScopeResponse(w, r, scope)
+				return
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"shuvoedward/Bible_project/internal/data"
+	"testing"
+)
+
+func TestRequireScope(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	readKey := &data.APIKey{Scopes: []string{data.APIScopeNotesRead}}
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		user           *data.User
+		key            *data.APIKey
+		expectedStatus int
+	}{
+		{"login token", testApp.requireScope(data.APIScopeNotesWrite, ok), &data.User{ID: 1, Activated: true}, nil, http.StatusOK},
+		{"key with scope", testApp.requireScope(data.APIScopeNotesRead, ok), &data.User{ID: 1, Activated: true}, readKey, http.StatusOK},
+		{"key without scope", testApp.requireScope(data.APIScopeNotesWrite, ok), &data.User{ID: 1, Activated: true}, readKey, http.StatusForbidden},
+		{"key without every scope", testApp.requireScopes([]string{data.APIScopeNotesRead, data.APIScopeHighlightsRead}, ok), &data.User{ID: 1, Activated: true}, readKey, http.StatusForbidden},
+		{"inactive user", testApp.requireScope(data.APIScopeNotesRead, ok), &data.User{ID: 1}, readKey, http.StatusForbidden},
+		{"anonymous", testApp.requireScope(data.APIScopeNotesRead, ok), data.AnonymousUser, nil, http.StatusUnauthorized},
+		{"key on login-only route", testApp.requireActivatedUser(ok), &data.User{ID: 1, Activated: true}, readKey, http.StatusForbidden},
+		{"key on authenticated route", testApp.requireAuthenticatedUser(ok), &data.User{ID: 1, Activated: true}, readKey, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req = testApp.contextSetUser(req, tt.user)
+			if tt.key != nil {
+				req = testApp.contextSetAPIKey(req, tt.key)
+			}
+			rr := httptest.NewRecorder()
+
+			tt.handler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/service"
 	"shuvoedward/Bible_project/internal/validator"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -17,10 +17,17 @@ type NoteServiceInterface interface {
 	CreateNote(ctx context.Context, userID int64, input service.CreateNoteInput) (*data.NoteResponse, *validator.Validator, error)
 	DeleteLink(ctx context.Context, userID int64, noteID int64, locationID int64) (*validator.Validator, error)
 	DeleteNote(ctx context.Context, userID int64, noteID int64) error
+	ExpandVerseEmbeds(ctx context.Context, content string) []*service.VerseEmbed
+	GetBacklinks(ctx context.Context, userID int64, noteID int64) ([]*data.NoteMetadata, error)
+	GetDanglingLinks(ctx context.Context, userID int64) ([]*data.NoteLink, error)
+	GetNoteLinks(ctx context.Context, userID int64, noteID int64) ([]*data.NoteLink, error)
 	GetNote(ctx context.Context, userID int64, noteID int64) (*data.NoteResponse, []*data.ImageData, error)
 	LinkNote(ctx context.Context, noteLinkLocation *data.NoteInputLocation) (*data.NoteResponse, *validator.Validator, error)
-	ListNotesMetadata(ctx context.Context, userID int64, input service.ListNotesInput) ([]*data.NoteMetadata, *validator.Validator, error)
-	SearchNotes(ctx context.Context, userID int64, input service.SearchInput) ([]*data.NoteSearchResponse, data.Metadata, *validator.Validator, error)
+	LinkNoteBatch(ctx context.Context, userID int64, noteID int64, mode string, locations []*data.NoteInputLocation) (*service.BatchReport, *validator.Validator, error)
+	ListNotesMetadata(ctx context.Context, user *data.User, input service.ListNotesInput) ([]*data.NoteMetadata, *validator.Validator, error)
+	ListTrash(ctx context.Context, userID int64, page int, pageSize int) ([]*data.TrashedNote, data.Metadata, *validator.Validator, error)
+	RestoreNote(ctx context.Context, userID int64, noteID int64) (*data.NoteResponse, error)
+	SearchNotes(ctx context.Context, userID int64, input service.SearchInput) (*service.SearchResult, *validator.Validator, error)
 	UpdateNote(ctx context.Context, content *data.NoteContent) (*data.NoteResponse, *validator.Validator, error)
 }
 
@@ -38,28 +45,46 @@ func NewNoteHandler(app *application, noteService NoteServiceInterface) *NoteHan
 
 func (h *NoteHandler) RegisterRoutes(router *httprouter.Router) {
 	router.HandlerFunc(http.MethodPost, "/v1/notes",
-		h.app.requireActivatedUser(h.Create))
+		h.app.requireScope(data.APIScopeNotesWrite, h.Create))
 
 	router.HandlerFunc(http.MethodGet, "/v1/notes/:id",
-		h.app.generalRateLimit(h.app.requireActivatedUser(h.Get)))
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesRead, h.Get)))
 
 	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id",
-		h.app.generalRateLimit(h.app.requireActivatedUser(h.Delete)))
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Delete)))
 
 	router.HandlerFunc(http.MethodPut, "/v1/notes/:id",
-		h.app.generalRateLimit(h.app.requireActivatedUser(h.Update)))
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Update)))
 
 	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/locations",
-		h.app.generalRateLimit(h.app.requireActivatedUser(h.Link)))
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Link)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/locations/batch",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.LinkBatch)))
 
 	router.HandlerFunc(http.MethodGet, "/v1/notes",
-		h.app.requireActivatedUser(h.app.requireActivatedUser((h.ListNotesMetadata))))
+		h.app.requireScope(data.APIScopeNotesRead, h.ListNotesMetadata))
 
 	router.HandlerFunc(http.MethodGet, "/v1/search/notes",
-		h.app.requireActivatedUser(h.app.generalRateLimit(h.SearchNote)))
+		h.app.requireScope(data.APIScopeNotesRead, h.app.generalRateLimit(h.SearchNote)))
 
 	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id/locations/:locationID",
-		h.app.generalRateLimit(h.app.requireActivatedUser(h.DeleteLink)))
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.DeleteLink)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/backlinks",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesRead, h.Backlinks)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/links",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesRead, h.Links)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/links/dangling",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesRead, h.DanglingLinks)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/trash",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesRead, h.ListTrash)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/trash/:id/restore",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Restore)))
 }
 
 type CreateNoteInput struct {
@@ -74,17 +99,27 @@ type CreateNoteInput struct {
 	EndVerse    int    `json:"end_verse"`    // end verse must be provided, included. when just one verse, svs = 1 and evs = 1.
 	StartOffset int    `json:"start_offset"` // Character offset within start verse
 	EndOffset   int    `json:"end_offset"`   // Character offset within end verse
+
+	// Pre-fills the content of a BIBLE note from a template, content must be empty
+	TemplateID int64 `json:"template_id"`
+
+	// Referenced range, required for CROSS_REFERENCE notes. The note shows up at both ends.
+	TargetBook       string `json:"target_book"`
+	TargetChapter    int    `json:"target_chapter"`
+	TargetStartVerse int    `json:"target_start_verse"`
+	TargetEndVerse   int    `json:"target_end_verse"`
 }
 
 // createNoteHandler inserts a note
 // @Summary Create a new note
-// @Description Creates a new note of type GENERAL, BIBLE, or CROSS_REFERENCE. GENERAL notes only require title and content. BIBLE and CROSS_REFERENCE notes require additional location fields (book, chapter, verses, and offsets), title optional for BIBLE and no title necessary for CROSS_REFERENCE.
+// @Description Creates a new note of type GENERAL, BIBLE, or CROSS_REFERENCE. GENERAL notes only require title and content. BIBLE and CROSS_REFERENCE notes require additional location fields (book, chapter, verses, and offsets), title optional for BIBLE and no title necessary for CROSS_REFERENCE. CROSS_REFERENCE notes also require the target range (target_book, target_chapter, target_start_verse, target_end_verse); content is optional and defaults to "<source> → <target>". With template_id, a BIBLE note's content is pre-filled from the template for the location and content must be omitted.
 // @Tags notes
 // @Accept json
 // @Produce json
 // @Param input body CreateNoteInput true "Note creation data"
 // @Success 201 {object} map[string]data.NoteResponse "Successfully created note"
 // @Failure 400 {object} map[string]interface{} "Invalid request body"
+// @Failure 404 {object} map[string]string "Template not found"
 // @Failure 409 {object} map[string]interface{} "Duplicate title (GENERAL), location already linked (BIBLE/CROSS_REFERENCE), or duplicate content"
 // @Failure 422 {object} map[string]map[string]string "Validation errors"
 // @Failure 429 {object} map[string]string "Rate limit exceeded"
@@ -120,14 +155,22 @@ func (h *NoteHandler) Create(w http.ResponseWriter, r *http.Request) {
 		EndVerse:    input.EndVerse,
 		StartOffset: input.StartOffset,
 		EndOffset:   input.EndOffset,
+		TemplateID:  input.TemplateID,
+
+		TargetBook:       input.TargetBook,
+		TargetChapter:    input.TargetChapter,
+		TargetStartVerse: input.TargetStartVerse,
+		TargetEndVerse:   input.TargetEndVerse,
 	}
 
 	note, v, err := h.service.CreateNote(r.Context(), user.ID, serviceInput)
 	if v != nil && !v.Valid() {
 		h.app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 	if err != nil {
 		h.handleNoteError(w, r, err)
+		return
 	}
 
 	err = h.app.writeJSON(w, http.StatusCreated, envelope{"note": note}, nil)
@@ -142,6 +185,8 @@ func (h *NoteHandler) handleNoteError(w http.ResponseWriter, r *http.Request, er
 		h.app.notFoundResponse(w, r)
 	case errors.Is(err, service.ErrLinkNotFound):
 		h.app.notFoundResponse(w, r)
+	case errors.Is(err, service.ErrTemplateNotFound):
+		h.app.notFoundResponse(w, r)
 	case errors.Is(err, data.ErrDuplicateTitleGeneral):
 		// GENERAL notes must have unique titles per user
 		h.app.editConflictResponse(w, r, err)
@@ -156,9 +201,9 @@ func (h *NoteHandler) handleNoteError(w http.ResponseWriter, r *http.Request, er
 	}
 }
 
-// deleteNoteHandler deletes a note
+// deleteNoteHandler moves a note to the trash
 // @Summary Delete a note
-// @Description Deletes a note and all associated images. The note must belong to the authenticated user. Images are removed from S3 storage first, then from the database. If S3 deletion fails, the operation aborts to prevent orphaned objects.
+// @Description Moves a note to the trash. The note must belong to the authenticated user. Trashed notes are hidden from lists, search and the passage view, can be restored with POST /v1/trash/{id}/restore, and are permanently deleted with their images after the retention period.
 // @Tags notes
 // @Produce json
 // @Param id path int true "Note ID"
@@ -169,14 +214,6 @@ func (h *NoteHandler) handleNoteError(w http.ResponseWriter, r *http.Request, er
 // @Security ApiKeyAuth
 // @Router /v1/notes/{id} [delete]
 func (h *NoteHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	/*
-		Design Decision: Delete S3 first, then DB
-		- No orphaned S3 objects costing you money
-		- If anything fails, user can retry
-		- DB remains authoritative source
-		- In the rare case DB fails after S3 succeeds, user just retries and
-		  note is gone but images already deleted (idempotent)
-	*/
 	user := h.app.contextGetUser(r)
 
 	noteID, err := h.app.readIDParam(r, "id")
@@ -188,6 +225,7 @@ func (h *NoteHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	err = h.service.DeleteNote(r.Context(), user.ID, noteID)
 	if err != nil {
 		h.handleNoteError(w, r, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -195,7 +233,7 @@ func (h *NoteHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 // updateNoteHandler updates a note
 // @Summary Update a note
-// @Description Updates a note's title and content. The note must belong to the authenticated user and the note_type must match. For BIBLE and CROSS_REFERENCE notes, content is hashed to prevent duplicate annotations.
+// @Description Updates a note's title and content. The note must belong to the authenticated user and the note_type must match. GENERAL notes need a title, BIBLE notes may have one and CROSS_REFERENCE notes can't; content is at most 50,000 characters, as on create. For BIBLE and CROSS_REFERENCE notes, content is hashed to prevent duplicate annotations. Renaming a GENERAL note rewrites the [[Title]] links of the notes linking to it, notes that can't be rewritten are listed in unrewritten_links and their links are left dangling.
 // @Tags notes
 // @Accept json
 // @Produce json
@@ -329,6 +367,80 @@ func (h *NoteHandler) Link(w http.ResponseWriter, r *http.Request) {
 
 }
 
+type LocationInput struct {
+	Book        string `json:"book"`
+	Chapter     int    `json:"chapter"`
+	StartVerse  int    `json:"start_verse"`
+	EndVerse    int    `json:"end_verse"`
+	StartOffset int    `json:"start_offset"`
+	EndOffset   int    `json:"end_offset"`
+}
+
+type LocationBatchInput struct {
+	Mode      string          `json:"mode"`
+	Locations []LocationInput `json:"locations"`
+}
+
+// @Summary Link a note to locations in a batch
+// @Description Links an existing note to up to 500 verse locations in a single request and transaction, each validated like POST /v1/notes/{id}/locations. With mode "atomic" (default) nothing is linked unless every location is valid and inserted; with mode "partial" the valid locations are linked and the others reported. Every location gets a result with its index, status (created, invalid, failed or rolled_back), and location ID or errors.
+// @Tags notes
+// @Accept json
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param input body LocationBatchInput true "Mode and locations"
+// @Success 201 {object} object{batch=service.BatchReport} "Every location linked"
+// @Success 200 {object} object{batch=service.BatchReport} "Partial batch, some locations failed"
+// @Failure 400 {object} map[string]interface{} "Invalid input"
+// @Failure 404 {object} map[string]interface{} "Note not found or doesn't belong to user"
+// @Failure 422 {object} object{batch=service.BatchReport} "Atomic batch rolled back, or invalid mode or item count"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/notes/{id}/locations/batch [post]
+func (h *NoteHandler) LinkBatch(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	noteID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	input := LocationBatchInput{Mode: service.BatchModeAtomic}
+
+	err = h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	locations := make([]*data.NoteInputLocation, len(input.Locations))
+	for i, location := range input.Locations {
+		locations[i] = &data.NoteInputLocation{
+			Book:        location.Book,
+			Chapter:     location.Chapter,
+			StartVerse:  location.StartVerse,
+			EndVerse:    location.EndVerse,
+			StartOffset: location.StartOffset,
+			EndOffset:   location.EndOffset,
+		}
+	}
+
+	report, v, err := h.service.LinkNoteBatch(r.Context(), user.ID, noteID, input.Mode, locations)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleNoteError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, batchStatus(report), envelope{"batch": report}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
 // deleteLinkHandler removes a location link from a note.
 // @Summary Delete note location link
 // @Description Removes a specific location link from a note. Only the note owner can delete links.
@@ -381,8 +493,8 @@ func (h *NoteHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param note_type query string true "Note type" Enums(GENERAL, BIBLE)
 // @Param page query int false "Page number" default(1) minimum(1) maximum(10000)
-// @Param page_size query int false "Number of items per page" default(10) minimum(1) maximum(100)
-// @Param sort query string false "Sort field and direction" Enums(created_at, -created_at, title, -title) default(-created_at)
+// @Param page_size query int false "Number of items per page, defaults to the user's preference" minimum(1) maximum(100)
+// @Param sort query string false "Sort field and direction, defaults to the user's preference" Enums(created_at, -created_at, title, -title)
 // @Success 200 {object} map[string][]data.NoteMetadata"Successfully retrieved notes (key is note_type)"
 // @Failure 400 {object} map[string]interface{} "Invalid query parameters or validation errors"
 // @Failure 422 {object} map[string]interface{} "Validation failed"
@@ -400,7 +512,7 @@ func (h *NoteHandler) ListNotesMetadata(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	notesMetadata, v, err := h.service.ListNotesMetadata(r.Context(), user.ID, input)
+	notesMetadata, v, err := h.service.ListNotesMetadata(r.Context(), user, input)
 	if !v.Valid() {
 		h.app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -420,14 +532,16 @@ func (h *NoteHandler) ListNotesMetadata(w http.ResponseWriter, r *http.Request)
 
 // getNoteHandler retrieves a single note along with all its associated images.
 // For each image, generates a presigned URL valid for 3 hours to allow secure access to S3 objects.
+// With ?expand=verses, {{reference}} embeds in the content are expanded to verse text.
 // @Summary Get a single note by ID
-// @Description Retrieve a specific note with its content and all associated images. Each image includes a presigned URL for temporary S3 access.
+// @Description Retrieve a specific note with its content and all associated images. Each image includes a presigned URL for temporary S3 access. Pass expand=verses to resolve embeds like {{John 3:16-18}} into verse text; an embed that cannot be resolved carries an error instead of failing the request.
 // @Tags notes
 // @Accept json
 // @Produce json
 // @Param id path int true "Note ID"
-// @Success 200 {object} map[string]interface{} "note: NoteContent object, images: array of ImageData objects with presigned URLs"
-// @Failure 400 {object} map[string]interface{} "Invalid note ID parameter"
+// @Param expand query string false "Expand verse embeds" Enums(verses)
+// @Success 200 {object} map[string]interface{} "note: NoteContent object, images: array of ImageData objects with presigned URLs, embeds: array of VerseEmbed objects (only with expand=verses)"
+// @Failure 400 {object} map[string]interface{} "Invalid note ID or expand parameter"
 // @Failure 404 {object} map[string]interface{} "Note not found or doesn't belong to user"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Security ApiKeyAuth
@@ -441,14 +555,28 @@ func (h *NoteHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expand := r.URL.Query().Get("expand")
+	if expand != "" && expand != "verses" {
+		h.app.badRequestResponse(w, r, errors.New("expand must be verses"))
+		return
+	}
+
 	note, images, err := h.service.GetNote(r.Context(), user.ID, notesID)
 	if err != nil {
 		h.handleNoteError(w, r, err)
+		return
 	}
 
 	// Return note content and images array to client
 	// Frontend will match image IDs in content with images array
-	err = h.app.writeJSON(w, http.StatusOK, envelope{"note": note, "images": images}, nil)
+	env := envelope{"note": note, "images": images}
+
+	// Embeds are expanded at read time so they follow the current translation
+	if expand == "verses" {
+		env["embeds"] = h.service.ExpandVerseEmbeds(r.Context(), note.Content)
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		h.app.serverErrorResponse(w, r, err)
 	}
@@ -456,14 +584,20 @@ func (h *NoteHandler) Get(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Search notes with full-text search
-// @Description Search through user's notes using PostgreSQL full-text search with pagination
+// @Description Search through user's notes using PostgreSQL full-text search with pagination. Results carry a snippet with matched terms wrapped in <mark> tags. Facets count all matches by note type and by book; each ignores its own filter.
 // @Tags notes
 // @Accept json
 // @Produce json
 // @Param q query string true "Search query"
-// @Param page query int true "Page number (min: 1, max: 10000)"
-// @Param page_size query int true "Items per page (min: 1, max: 100)"
-// @Success 200 {object} object{notes=[]data.NoteSearchResponse,metadata=data.Metadata} "Search results with pagination metadata"
+// @Param type query string false "Note type" Enums(GENERAL, BIBLE, CROSS_REFERENCE)
+// @Param book query string false "Only notes located in this book, references in GENERAL notes included"
+// @Param from query string false "Created on or after this date (YYYY-MM-DD)"
+// @Param to query string false "Created on or before this date (YYYY-MM-DD)"
+// @Param tag query string false "Only notes containing #tag"
+// @Param sort query string false "Sort order" Enums(relevance, created_at, -created_at, updated_at, -updated_at) default(relevance)
+// @Param page query int false "Page number" default(1) minimum(1) maximum(10000)
+// @Param page_size query int false "Number of items per page" default(10) minimum(1) maximum(100)
+// @Success 200 {object} object{notes=[]data.NoteSearchResponse,metadata=data.Metadata,facets=data.NoteSearchFacets} "Search results with pagination metadata and facets"
 // @Failure 400 {object} map[string]string "Invalid request parameters"
 // @Failure 422 {object} map[string]map[string]string "Validation errors"
 // @Failure 500 {object} map[string]string "Internal server error"
@@ -477,28 +611,213 @@ func (h *NoteHandler) SearchNote(w http.ResponseWriter, r *http.Request) {
 	searchQuery := query.Get("q")
 	if searchQuery == "" {
 		h.app.badRequestResponse(w, r, errors.New("search query can't be empty"))
+		return
 	}
 
-	// check err here, it falls into bad requests?
-	page, err := strconv.Atoi(query.Get("page"))
-	pageSize, err := strconv.Atoi(query.Get("page_size"))
+	filters, err := h.app.readPaginationParams(r)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
 
 	searchInput := service.SearchInput{
 		SearchQuery: searchQuery,
-		Page:        page,
-		PageSize:    pageSize,
+		Page:        filters.Page,
+		PageSize:    filters.PageSize,
+		Sort:        query.Get("sort"),
+		NoteType:    strings.ToUpper(query.Get("type")),
+		Book:        query.Get("book"),
+		Tag:         query.Get("tag"),
+	}
+
+	if query.Has("from") {
+		from, err := time.Parse(time.DateOnly, query.Get("from"))
+		if err != nil {
+			h.app.badRequestResponse(w, r, errors.New("from must be a date like 2006-01-02"))
+			return
+		}
+		searchInput.From = &from
+	}
+
+	if query.Has("to") {
+		to, err := time.Parse(time.DateOnly, query.Get("to"))
+		if err != nil {
+			h.app.badRequestResponse(w, r, errors.New("to must be a date like 2006-01-02"))
+			return
+		}
+		// The whole last day is included
+		until := to.AddDate(0, 0, 1)
+		searchInput.Until = &until
+	}
+
+	result, v, err := h.service.SearchNotes(r.Context(), user.ID, searchInput)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleNoteError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"notes": result.Notes, "metadata": result.Metadata, "facets": result.Facets}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Get backlinks of a note
+// @Description Lists the notes whose content links to this note with [[note:123]] or [[Note Title]]. Links are parsed when a note is saved.
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} map[string][]data.NoteMetadata "backlinks: notes linking to this note"
+// @Failure 400 {object} map[string]string "Invalid note ID"
+// @Failure 404 {object} map[string]string "Note not found or does not belong to user"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/notes/{id}/backlinks [get]
+func (h *NoteHandler) Backlinks(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	noteID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
 	}
 
-	results, metadata, v, err := h.service.SearchNotes(r.Context(), user.ID, searchInput)
+	backlinks, err := h.service.GetBacklinks(r.Context(), user.ID, noteID)
+	if err != nil {
+		h.handleNoteError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"backlinks": backlinks}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Get outgoing links of a note
+// @Description Lists the [[note:123]] and [[Note Title]] links in this note's content. Links that don't resolve to one of the user's notes are marked dangling.
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} map[string][]data.NoteLink "links: outgoing links"
+// @Failure 400 {object} map[string]string "Invalid note ID"
+// @Failure 404 {object} map[string]string "Note not found or does not belong to user"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/notes/{id}/links [get]
+func (h *NoteHandler) Links(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	noteID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	links, err := h.service.GetNoteLinks(r.Context(), user.ID, noteID)
+	if err != nil {
+		h.handleNoteError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"links": links}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary List dangling note links
+// @Description Lists every link across the user's notes that doesn't resolve to a note, e.g. [[Some Title]] when no GENERAL note has that title. Creating or renaming a note to that title resolves the link.
+// @Tags notes
+// @Produce json
+// @Success 200 {object} map[string][]data.NoteLink "dangling_links: unresolved links with their source note"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/links/dangling [get]
+func (h *NoteHandler) DanglingLinks(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	links, err := h.service.GetDanglingLinks(r.Context(), user.ID)
+	if err != nil {
+		h.handleNoteError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"dangling_links": links}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary List trashed notes
+// @Description Lists the user's deleted notes, most recently deleted first. Notes stay in the trash until restored or purged after the retention period.
+// @Tags notes
+// @Produce json
+// @Param page query int false "Page number" default(1) minimum(1) maximum(10000)
+// @Param page_size query int false "Number of items per page" default(10) minimum(1) maximum(100)
+// @Success 200 {object} object{notes=[]data.TrashedNote,metadata=data.Metadata} "Trashed notes with pagination metadata"
+// @Failure 400 {object} map[string]string "Invalid pagination parameters"
+// @Failure 422 {object} map[string]map[string]string "Validation errors"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/trash [get]
+func (h *NoteHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	filters, err := h.app.readPaginationParams(r)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	notes, metadata, v, err := h.service.ListTrash(r.Context(), user.ID, filters.Page, filters.PageSize)
 	if v != nil && !v.Valid() {
 		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleNoteError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"notes": notes, "metadata": metadata}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Restore a trashed note
+// @Description Takes a note out of the trash with its locations and images.
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} map[string]data.NoteResponse "note: the restored note"
+// @Failure 400 {object} map[string]string "Invalid note ID"
+// @Failure 404 {object} map[string]string "Note not in the user's trash"
+// @Failure 409 {object} map[string]string "A note with the same title (GENERAL) or content was created since"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/trash/{id}/restore [post]
+func (h *NoteHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	noteID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
 	}
+
+	note, err := h.service.RestoreNote(r.Context(), user.ID, noteID)
 	if err != nil {
 		h.handleNoteError(w, r, err)
 		return
 	}
 
-	err = h.app.writeJSON(w, http.StatusOK, envelope{"notes": results, "metadata": metadata}, nil)
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"note": note}, nil)
 	if err != nil {
 		h.app.serverErrorResponse(w, r, err)
 	}
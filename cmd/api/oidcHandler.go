@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/service"
+	"shuvoedward/Bible_project/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type OIDCServiceInterface interface {
+	AuthorizationURL(ctx context.Context, providerName string) (*service.OIDCAuthorization, error)
+	Login(ctx context.Context, providerName, code, state string, info data.SessionInfo) (*service.LoginResult, *validator.Validator, error)
+	Providers() []string
+}
+
+type OIDCHandler struct {
+	app     *application
+	service OIDCServiceInterface
+}
+
+func NewOIDCHandler(app *application, service OIDCServiceInterface) *OIDCHandler {
+	return &OIDCHandler{
+		app:     app,
+		service: service,
+	}
+}
+
+func (h *OIDCHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, "/v1/tokens/oidc", h.app.generalRateLimit(h.ListProviders))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/oidc/:provider", h.app.authRateLimit(h.StartLogin))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/oidc/:provider/callback", h.app.authRateLimit(h.FinishLogin))
+}
+
+func (h *OIDCHandler) handleOIDCError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrOIDCProviderNotFound):
+		h.app.notFoundResponse(w, r)
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		h.app.errorResponse(w, r, http.StatusUnauthorized, "invalid or expired login state, please start the login again")
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		h.app.errorResponse(w, r, http.StatusUnauthorized, "the identity provider login failed, please start the login again")
+	case errors.Is(err, service.ErrOIDCEmailNotVerified):
+		h.app.errorResponse(w, r, http.StatusForbidden, "the identity provider has not verified your email address")
+	default:
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary List identity providers
+// @Description Lists the OpenID Connect providers users can log in with
+// @Tags authentication
+// @Produce json
+// @Success 200 {object} object{providers=[]string} "Provider names"
+// @Router /v1/tokens/oidc [get]
+func (h *OIDCHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	err := h.app.writeJSON(w, http.StatusOK, envelope{"providers": h.service.Providers()}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Start an identity provider login
+// @Description Starts a login at an OpenID Connect provider with the authorization code flow and PKCE. The client sends the user to the authorization URL, the provider redirects back to the configured redirect URL with a code and the state, which the client compares to the returned state before finishing the login within 10 minutes.
+// @Tags authentication
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} object{authorization_url=string,state=string} "Where to send the user"
+// @Failure 404 {object} object{error=string} "Provider not configured"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Router /v1/tokens/oidc/{provider} [post]
+func (h *OIDCHandler) StartLogin(w http.ResponseWriter, r *http.Request) {
+	providerName := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+
+	authorization, err := h.service.AuthorizationURL(r.Context(), providerName)
+	if err != nil {
+		h.handleOIDCError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"authorization_url": authorization.URL, "state": authorization.State}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Finish an identity provider login
+// @Description Exchanges the code the provider redirected back with for tokens, like a login with email and password. On the first login the identity is linked to the user with the same email, or a new activated user is created. Either requires the provider to have verified the email, and activates an account that wasn't yet, replacing its password. Users with two-factor authentication get a challenge token.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param login body object{code=string,state=string,device_name=string} true "Code and state from the redirect" example({"code": "SplxlOBeZQQYbYS6WxSbIA", "state": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU"})
+// @Success 201 {object} object{auth_token=string,auth_token_expiry=string,refresh_token=string,refresh_token_expiry=string} "Successfully authenticated"
+// @Success 202 {object} object{two_factor_required=bool,challenge_token=string,challenge_token_expiry=string} "Two-factor code required"
+// @Failure 400 {object} object{error=string} "Invalid request body"
+// @Failure 401 {object} object{error=string} "Invalid or expired state, or the provider rejected the login"
+// @Failure 403 {object} object{error=string} "Email not verified by the provider"
+// @Failure 404 {object} object{error=string} "Provider not configured"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Router /v1/tokens/oidc/{provider}/callback [post]
+func (h *OIDCHandler) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code       string `json:"code"`
+		State      string `json:"state"`
+		DeviceName string `json:"device_name"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	providerName := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+
+	info := data.SessionInfo{
+		UserAgent:  r.UserAgent(),
+		IP:         getIP(r),
+		DeviceName: input.DeviceName,
+	}
+
+	result, v, err := h.service.Login(r.Context(), providerName, input.Code, input.State, info)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleOIDCError(w, r, err)
+		return
+	}
+
+	status, env := loginResultEnvelope(result)
+
+	err = h.app.writeJSON(w, status, env, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
@@ -17,8 +17,18 @@ func (app *application) routes(handlers *Handlers) http.Handler {
 	handlers.Note.RegisterRoutes(router)
 	handlers.User.RegisterRoutes(router)
 	handlers.Token.RegisterRoutes(router)
+	handlers.TwoFactor.RegisterRoutes(router)
+	handlers.APIKey.RegisterRoutes(router)
+	handlers.OIDC.RegisterRoutes(router)
+	handlers.Highlight.RegisterRoutes(router)
 	handlers.Book.RegisterRoutes(router)
 	handlers.Image.RegisterRoutes(router)
+	handlers.Export.RegisterRoutes(router)
+	handlers.Import.RegisterRoutes(router)
+	handlers.Template.RegisterRoutes(router)
+	handlers.Annotation.RegisterRoutes(router)
+	handlers.Sync.RegisterRoutes(router)
+	handlers.Event.RegisterRoutes(router)
 
 	router.Handler(http.MethodGet, "/swagger/*any", httpSwagger.WrapHandler)
 
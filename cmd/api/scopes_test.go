@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/service"
+	"shuvoedward/Bible_project/internal/validator"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type mockAnnotationService struct{}
+
+func (s *mockAnnotationService) ListAnnotations(
+	ctx context.Context,
+	userID int64,
+	input service.AnnotationsInput,
+) ([]*service.ChapterAnnotations, data.Metadata, *validator.Validator, error) {
+	return []*service.ChapterAnnotations{}, data.Metadata{}, nil, nil
+}
+
+type mockExportService struct{}
+
+func (s *mockExportService) GetExport(ctx context.Context, userID int64, exportID int64) (*data.Export, error) {
+	return &data.Export{ID: exportID}, nil
+}
+
+func (s *mockExportService) RequestExport(ctx context.Context, userID int64) (*data.Export, error) {
+	return &data.Export{ID: 1}, nil
+}
+
+type mockImportService struct{}
+
+func (s *mockImportService) ImportHighlightsCSV(ctx context.Context, userID int64, r io.Reader) (*service.ImportReport, *validator.Validator, error) {
+	return &service.ImportReport{}, nil, nil
+}
+
+func (s *mockImportService) ImportMarkdownArchive(ctx context.Context, userID int64, archive []byte) (*service.ImportReport, *validator.Validator, error) {
+	return &service.ImportReport{}, nil, nil
+}
+
+// passageData is a passage with one highlight, using palette entry 1, and one Bible note
+type passageData struct{}
+
+func (passageData) Get(ctx context.Context, filters *data.LocationFilters) (*data.Passage, error) {
+	return &data.Passage{Book: filters.Book, Chapter: filters.Chapter}, nil
+}
+
+func (passageData) SearchVersesByWord(ctx context.Context, searchQuery string, filters data.Filters) ([]*data.VerseMatch, data.Metadata, error) {
+	return nil, data.Metadata{}, nil
+}
+
+func (passageData) GetAll(ctx context.Context, userID int64) ([]*data.PaletteEntry, error) {
+	return []*data.PaletteEntry{{ID: 1, Color: "green", Label: "Promises"}}, nil
+}
+
+func (passageData) GetAllLocatedForChapter(ctx context.Context, userID int64, filter *data.LocationFilters) ([]*data.NoteResponse, []*data.NoteResponse, []*data.NoteResponse, error) {
+	return []*data.NoteResponse{{ID: 1}}, []*data.NoteResponse{}, []*data.NoteResponse{}, nil
+}
+
+type passageHighlights struct{}
+
+func (passageHighlights) Get(ctx context.Context, userID int64, filter *data.LocationFilters) ([]*data.Highlight, error) {
+	paletteID := int64(1)
+	return []*data.Highlight{{ID: 1, Color: "green", PaletteID: &paletteID}}, nil
+}
+
+// importRequest is a multipart import of a file named filename
+func importRequest(t *testing.T, filename string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	file, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("book,chapter,start_verse,end_verse,color\n"))
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/imports", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+
+	return r
+}
+
+// TestAPIKeyScopes covers the routes serving notes and highlights together, which a key
+// scoped to notes only must not reach
+func TestAPIKeyScopes(t *testing.T) {
+	router := httprouter.New()
+	NewAnnotationHandler(testApp, &mockAnnotationService{}).RegisterRoutes(router)
+	NewExportHandler(testApp, &mockExportService{}).RegisterRoutes(router)
+	NewImportHandler(testApp, &mockImportService{}).RegisterRoutes(router)
+
+	notesOnly := &data.APIKey{Scopes: []string{data.APIScopeNotesRead, data.APIScopeNotesWrite}}
+	readAll := &data.APIKey{Scopes: []string{data.APIScopeNotesRead, data.APIScopeHighlightsRead}}
+	writeAll := &data.APIKey{Scopes: []string{data.APIScopeNotesWrite, data.APIScopeHighlightsWrite}}
+
+	get := func(target string) func(*testing.T) *http.Request {
+		return func(*testing.T) *http.Request { return httptest.NewRequest(http.MethodGet, target, nil) }
+	}
+	post := func(target string) func(*testing.T) *http.Request {
+		return func(*testing.T) *http.Request { return httptest.NewRequest(http.MethodPost, target, nil) }
+	}
+	upload := func(filename string) func(*testing.T) *http.Request {
+		return func(t *testing.T) *http.Request { return importRequest(t, filename) }
+	}
+
+	tests := []struct {
+		name           string
+		request        func(*testing.T) *http.Request
+		key            *data.APIKey
+		expectedStatus int
+	}{
+		{"annotations with notes-only key", get("/v1/me/annotations?book=Romans"), notesOnly, http.StatusForbidden},
+		{"annotations with read key", get("/v1/me/annotations?book=Romans"), readAll, http.StatusOK},
+		{"export create with notes-only key", post("/v1/exports"), notesOnly, http.StatusForbidden},
+		{"export create with read key", post("/v1/exports"), readAll, http.StatusAccepted},
+		{"export get with notes-only key", get("/v1/exports/1"), notesOnly, http.StatusForbidden},
+		{"export get with read key", get("/v1/exports/1"), readAll, http.StatusOK},
+		{"highlights import with notes-only key", upload("highlights.csv"), notesOnly, http.StatusForbidden},
+		{"highlights import with write key", upload("highlights.csv"), writeAll, http.StatusOK},
+		{"notes import with notes-only key", upload("notes.zip"), notesOnly, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.request(t)
+			r = testApp.contextSetUser(r, &data.User{ID: 1, Activated: true})
+			r = testApp.contextSetAPIKey(r, tt.key)
+
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got %d, want %d: %s", w.Code, tt.expectedStatus, w.Body)
+			}
+		})
+	}
+}
+
+// TestAPIKeyScopes_Passage covers the passage route, which leaves out the user data a
+// key can't read instead of refusing the passage
+func TestAPIKeyScopes_Passage(t *testing.T) {
+	books := service.NewBookService(passageData{}, passageHighlights{}, passageData{}, passageData{},
+		service.NewBibleValidator(map[string]struct{}{"John": {}}), slog.New(slog.DiscardHandler))
+
+	router := httprouter.New()
+	NewBookHandler(testApp, books, nil).RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		key        *data.APIKey
+		notes      int
+		highlights int
+	}{
+		{"notes-only key", &data.APIKey{Scopes: []string{data.APIScopeNotesRead}}, 1, 0},
+		{"highlights-only key", &data.APIKey{Scopes: []string{data.APIScopeHighlightsRead}}, 0, 1},
+		{"read key", &data.APIKey{Scopes: []string{data.APIScopeNotesRead, data.APIScopeHighlightsRead}}, 1, 1},
+		{"session", nil, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/bible/John/3", nil)
+			r = testApp.contextSetUser(r, &data.User{ID: 1, Activated: true})
+			if tt.key != nil {
+				r = testApp.contextSetAPIKey(r, tt.key)
+			}
+
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("got %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			var body struct {
+				Response struct {
+					Passage    *data.Passage
+					Highlights []*data.Highlight
+					Legend     []*data.PaletteEntry
+					BibleNotes []*data.NoteResponse
+				} `json:"response"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			got := body.Response
+			if got.Passage == nil || got.Passage.Book != "John" {
+				t.Errorf("got passage %+v, want John 3", got.Passage)
+			}
+			if len(got.BibleNotes) != tt.notes {
+				t.Errorf("got %d notes, want %d", len(got.BibleNotes), tt.notes)
+			}
+			if len(got.Highlights) != tt.highlights || len(got.Legend) != tt.highlights {
+				t.Errorf("got %d highlights and %d legend entries, want %d", len(got.Highlights), len(got.Legend), tt.highlights)
+			}
+		})
+	}
+}
@@ -22,6 +22,11 @@ func (app *application) serve(handlers *Handlers) error {
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
 
+	// Event streams never finish on their own, closing the broker ends them on shutdown
+	if app.events != nil {
+		srv.RegisterOnShutdown(func() { app.events.Close() })
+	}
+
 	shutdownError := make(chan error)
 
 	// Start goroutine to listen for shutdown OS signals
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"shuvoedward/Bible_project/internal/service"
+	"shuvoedward/Bible_project/internal/validator"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type SyncServiceInterface interface {
+	Pull(ctx context.Context, userID, since int64, limit int) (*service.SyncPull, *validator.Validator, error)
+	Push(ctx context.Context, userID int64, changes []service.SyncPushChange) (*service.SyncPushReport, *validator.Validator, error)
+}
+
+type SyncHandler struct {
+	app     *application
+	service SyncServiceInterface
+}
+
+func NewSyncHandler(app *application, syncService SyncServiceInterface) *SyncHandler {
+	return &SyncHandler{
+		app:     app,
+		service: syncService,
+	}
+}
+
+func (h *SyncHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, "/v1/sync",
+		h.app.generalRateLimit(h.app.requireActivatedUser(h.Pull)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/sync",
+		h.app.generalRateLimit(h.app.requireActivatedUser(h.Push)))
+}
+
+// SyncPushChange is one offline change, the fields used depend on type and op
+type SyncPushChange struct {
+	ClientID   string `json:"client_id"`
+	Type       string `json:"type"`
+	Op         string `json:"op"`
+	ID         int64  `json:"id"`
+	BaseCursor int64  `json:"base_cursor"`
+
+	NoteID      int64  `json:"note_id"`
+	Title       string `json:"title"`
+	Content     string `json:"content"`
+	NoteType    string `json:"note_type"`
+	Book        string `json:"book"`
+	Chapter     int    `json:"chapter"`
+	StartVerse  int    `json:"start_verse"`
+	EndVerse    int    `json:"end_verse"`
+	StartOffset int    `json:"start_offset"`
+	EndOffset   int    `json:"end_offset"`
+
+	TargetBook       string `json:"target_book"`
+	TargetChapter    int    `json:"target_chapter"`
+	TargetStartVerse int    `json:"target_start_verse"`
+	TargetEndVerse   int    `json:"target_end_verse"`
+
+	Color     string `json:"color"`
+	PaletteID *int64 `json:"palette_id"`
+}
+
+type SyncPushInput struct {
+	Changes []SyncPushChange `json:"changes"`
+}
+
+// @Summary Pull changes since a cursor
+// @Description Returns the current state of the notes, note locations, highlights and image metadata the user created or changed after the since cursor, oldest change first. Deleted entities, notes moved to the trash and their locations and images are returned as tombstones. Pass the returned cursor as since on the next call, and keep calling while has_more is true. since=0 returns everything.
+// @Tags sync
+// @Produce json
+// @Param since query int false "Cursor returned by the previous sync" default(0) minimum(0)
+// @Param limit query int false "Maximum number of entities" default(500) minimum(1) maximum(1000)
+// @Success 200 {object} service.SyncPull "Changes, tombstones and the next cursor"
+// @Failure 400 {object} map[string]string "Invalid query parameters"
+// @Failure 422 {object} map[string]map[string]string "Validation errors"
+// @Failure 429 {object} map[string]string "Rate limit exceeded"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/sync [get]
+func (h *SyncHandler) Pull(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	query := r.URL.Query()
+
+	var since int64
+	var limit int
+	var err error
+
+	if query.Has("since") {
+		since, err = strconv.ParseInt(query.Get("since"), 10, 64)
+		if err != nil {
+			h.app.badRequestResponse(w, r, errors.New("since must be an integer"))
+			return
+		}
+	}
+
+	if query.Has("limit") {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil {
+			h.app.badRequestResponse(w, r, errors.New("limit must be an integer"))
+			return
+		}
+	}
+
+	pull, v, err := h.service.Pull(r.Context(), user.ID, since, limit)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"sync": pull}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Push offline changes
+// @Description Applies up to 100 changes made offline, in order, each with the same validation as the regular endpoints. type is note, location or highlight; op is create, update or delete (locations can't be updated). Updates and deletes with a base_cursor are rejected as conflicts if the entity changed on the server after that cursor, and the server copy is returned. Every change gets its own result (applied, conflict, invalid, not_found or failed); one failing change doesn't stop the others.
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Param input body SyncPushInput true "Changes"
+// @Success 200 {object} service.SyncPushReport "Per-change results and the current cursor"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 422 {object} map[string]map[string]string "Validation errors"
+// @Failure 429 {object} map[string]string "Rate limit exceeded"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/sync [post]
+func (h *SyncHandler) Push(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	var input SyncPushInput
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	changes := make([]service.SyncPushChange, len(input.Changes))
+	for i, change := range input.Changes {
+		changes[i] = service.SyncPushChange(change)
+	}
+
+	report, v, err := h.service.Push(r.Context(), user.ID, changes)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"sync": report}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/service"
+	"shuvoedward/Bible_project/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type TemplateServiceInterface interface {
+	CreateTemplate(ctx context.Context, userID int64, input service.TemplateInput) (*data.NoteTemplate, *validator.Validator, error)
+	DeleteTemplate(ctx context.Context, userID int64, templateID int64) error
+	GetTemplate(ctx context.Context, userID int64, templateID int64) (*data.NoteTemplate, error)
+	ListTemplates(ctx context.Context, userID int64) ([]*data.NoteTemplate, error)
+	UpdateTemplate(ctx context.Context, userID int64, templateID int64, input service.TemplateInput) (*data.NoteTemplate, *validator.Validator, error)
+}
+
+type TemplateHandler struct {
+	app     *application
+	service TemplateServiceInterface
+}
+
+func NewTemplateHandler(app *application, templateService TemplateServiceInterface) *TemplateHandler {
+	return &TemplateHandler{
+		app:     app,
+		service: templateService,
+	}
+}
+
+func (h *TemplateHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, "/v1/templates",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesRead, h.List)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/templates",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Create)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/templates/:id",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesRead, h.Get)))
+
+	router.HandlerFunc(http.MethodPut, "/v1/templates/:id",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Update)))
+
+	router.HandlerFunc(http.MethodDelete, "/v1/templates/:id",
+		h.app.generalRateLimit(h.app.requireScope(data.APIScopeNotesWrite, h.Delete)))
+}
+
+func (h *TemplateHandler) handleTemplateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrTemplateNotFound):
+		h.app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrDuplicateTemplateName):
+		h.app.editConflictResponse(w, r, err)
+	default:
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+type TemplateInput struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Sections    []data.TemplateSection `json:"sections"`
+}
+
+// @Summary List note templates
+// @Description Returns the built-in templates (SOAP, Inductive, Sermon outline) followed by the user's own templates.
+// @Tags templates
+// @Produce json
+// @Success 200 {object} map[string][]data.NoteTemplate "templates"
+// @Failure 429 {object} map[string]string "Rate limit exceeded"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/templates [get]
+func (h *TemplateHandler) List(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	templates, err := h.service.ListTemplates(r.Context(), user.ID)
+	if err != nil {
+		h.handleTemplateError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"templates": templates}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Get a note template
+// @Description Returns a built-in template or one of the user's templates.
+// @Tags templates
+// @Produce json
+// @Param id path int true "Template ID"
+// @Success 200 {object} map[string]data.NoteTemplate "template"
+// @Failure 400 {object} map[string]string "Invalid template ID"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/templates/{id} [get]
+func (h *TemplateHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	templateID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	template, err := h.service.GetTemplate(r.Context(), user.ID, templateID)
+	if err != nil {
+		h.handleTemplateError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"template": template}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Create a note template
+// @Description Creates a template made of named sections. Headings and bodies may contain the placeholders {{passage}}, {{date}}, {{book}} and {{chapter}}, filled in when a BIBLE note is created with template_id. Any other {{reference}} must be a valid scripture reference and is kept as a verse embed.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param input body TemplateInput true "Template"
+// @Success 201 {object} map[string]data.NoteTemplate "template"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 409 {object} map[string]string "Template name already used"
+// @Failure 422 {object} map[string]map[string]string "Validation errors"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/templates [post]
+func (h *TemplateHandler) Create(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	var input TemplateInput
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	template, v, err := h.service.CreateTemplate(r.Context(), user.ID, service.TemplateInput(input))
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleTemplateError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/templates/%d", template.ID))
+
+	err = h.app.writeJSON(w, http.StatusCreated, envelope{"template": template}, headers)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Replace a note template
+// @Description Replaces the name, description and sections of one of the user's templates. Built-in templates are read-only. Notes already created from the template are not changed.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param id path int true "Template ID"
+// @Param input body TemplateInput true "Template"
+// @Success 200 {object} map[string]data.NoteTemplate "template"
+// @Failure 400 {object} map[string]string "Invalid request body or template ID"
+// @Failure 404 {object} map[string]string "Template not found or built-in"
+// @Failure 409 {object} map[string]string "Template name already used"
+// @Failure 422 {object} map[string]map[string]string "Validation errors"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/templates/{id} [put]
+func (h *TemplateHandler) Update(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	templateID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input TemplateInput
+	err = h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	template, v, err := h.service.UpdateTemplate(r.Context(), user.ID, templateID, service.TemplateInput(input))
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleTemplateError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"template": template}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Delete a note template
+// @Description Deletes one of the user's templates. Built-in templates can't be deleted.
+// @Tags templates
+// @Produce json
+// @Param id path int true "Template ID"
+// @Success 204 "Template successfully deleted"
+// @Failure 400 {object} map[string]string "Invalid template ID"
+// @Failure 404 {object} map[string]string "Template not found or built-in"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/templates/{id} [delete]
+func (h *TemplateHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	templateID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = h.service.DeleteTemplate(r.Context(), user.ID, templateID)
+	if err != nil {
+		h.handleTemplateError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
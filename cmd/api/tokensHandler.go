@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"html/template"
 	"net/http"
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/service"
@@ -13,9 +14,18 @@ import (
 
 type TokenServiceInterface interface {
 	CreateActivationToken(ctx context.Context, email string) (*validator.Validator, error)
-	CreateAuthToken(ctx context.Context, email string, password string) (string, *validator.Validator, error)
+	CreateAuthToken(ctx context.Context, email string, password string, info data.SessionInfo) (*service.LoginResult, *validator.Validator, error)
+	CreateMagicLink(ctx context.Context, email string) (*validator.Validator, error)
 	CreatePasswordResetToken(ctx context.Context, email string) (*validator.Validator, error)
+	ExchangeMagicLink(ctx context.Context, tokenPlaintext string, info data.SessionInfo) (*service.LoginResult, *validator.Validator, error)
 	GetUserForToken(ctx context.Context, tokenPlainText string) (*data.User, error)
+	ListSessions(ctx context.Context, userID int64, currentToken string) ([]*data.Session, error)
+	RefreshToken(ctx context.Context, refreshPlaintext string, info data.SessionInfo) (*service.TokenPair, error)
+	RevokeAllTokens(ctx context.Context, userID int64) error
+	RevokeSession(ctx context.Context, userID, sessionID int64) error
+	RevokeToken(ctx context.Context, userID int64, tokenPlaintext string) error
+	UnlockLogin(ctx context.Context, tokenPlaintext string) error
+	VerifyTwoFactor(ctx context.Context, challengePlaintext, code string, info data.SessionInfo) (*service.TokenPair, *validator.Validator, error)
 }
 
 type TokenHandler struct {
@@ -32,20 +42,42 @@ func NewTokenHandler(app *application, service TokenServiceInterface) *TokenHand
 
 func (h *TokenHandler) RegisterRoutes(router *httprouter.Router) {
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", h.app.authRateLimit(h.CreateAuthenticationToken))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", h.app.generalRateLimit(h.app.requireAuthenticatedUser(h.RevokeAuthenticationToken)))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication/all", h.app.generalRateLimit(h.app.requireAuthenticatedUser(h.RevokeAllAuthenticationTokens)))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", h.app.authRateLimit(h.RefreshAuthenticationToken))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/two-factor", h.app.authRateLimit(h.VerifyTwoFactor))
+	router.HandlerFunc(http.MethodGet, "/v1/tokens/unlock/:token", h.app.authRateLimit(h.ConfirmUnlockLogin))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/unlock/:token", h.app.authRateLimit(h.UnlockLogin))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link", h.app.authRateLimit(h.CreateMagicLink))
+	router.HandlerFunc(http.MethodGet, "/v1/tokens/magic-link/:token", h.app.authRateLimit(h.ConfirmMagicLink))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link/:token", h.app.authRateLimit(h.ExchangeMagicLink))
 
 	router.HandlerFunc(http.MethodGet, "/v1/tokens/password-reset", h.app.authRateLimit(h.CreatePasswordResetToken))
 
 	router.HandlerFunc(http.MethodGet, "/v1/tokens/activation", h.CreateActivationToken)
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", h.app.generalRateLimit(h.app.requireAuthenticatedUser(h.ListSessions)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", h.app.generalRateLimit(h.app.requireAuthenticatedUser(h.RevokeSession)))
 }
 
 func (h *TokenHandler) handleTokenError(w http.ResponseWriter, r *http.Request, err error) {
+	var locked *service.LoginLockedError
+
 	switch {
+	case errors.As(err, &locked):
+		h.app.loginLockedResponse(w, r, locked.RetryAfter)
 	case errors.Is(err, service.ErrEmailNotFound):
 		h.app.invalidCredentialResponse(w, r)
 	case errors.Is(err, service.ErrPasswordNotMatch):
 		h.app.invalidCredentialResponse(w, r)
 	case errors.Is(err, service.ErrUserActivated):
 		h.app.invalidCredentialResponse(w, r)
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		h.app.invalidCredentialResponse(w, r)
+	case errors.Is(err, service.ErrInvalidToken):
+		h.app.invalidAuthTokenResponse(w, r)
+	case errors.Is(err, service.ErrSessionNotFound):
+		h.app.notFoundResponse(w, r)
 	default:
 		h.app.serverErrorResponse(w, r, err)
 	}
@@ -53,21 +85,24 @@ func (h *TokenHandler) handleTokenError(w http.ResponseWriter, r *http.Request,
 
 // createAuthenticationTokenHandler authenticates a user and returns a token
 // @Summary User login
-// @Description Authenticate user with email and password, returns a token valid for 24 hours
+// @Description Authenticate user with email and password. Returns an access token valid for 15 minutes and a refresh token valid for 30 days to get new ones. The login is listed as a session with the user agent, IP and optional device name. Users with two-factor authentication get a challenge token valid for 5 minutes instead, to complete the login at /v1/tokens/two-factor. From the 3rd failed login to an email within an hour, the next login has to wait 1 second, doubling with every failure up to a minute. The 10th locks the email for 30 minutes and emails the account owner a link to unlock it. Unknown emails are delayed the same way.
 // @Tags authentication
 // @Accept json
 // @Produce json
-// @Param credentials body object{email=string,password=string} true "Login credentials" example({"email": "user@example.com", "password": "password123"})
-// @Success 201 {object} object{authentication_token=data.Token} "Successfully authenticated"
+// @Param credentials body object{email=string,password=string,device_name=string} true "Login credentials" example({"email": "user@example.com", "password": "password123", "device_name": "Work laptop"})
+// @Success 201 {object} object{auth_token=string,auth_token_expiry=string,refresh_token=string,refresh_token_expiry=string} "Successfully authenticated"
+// @Success 202 {object} object{two_factor_required=bool,challenge_token=string,challenge_token_expiry=string} "Two-factor code required"
 // @Failure 400 {object} object{error=string} "Invalid request body"
 // @Failure 401 {object} object{error=string} "Invalid credentials"
 // @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 429 {object} object{error=string} "Too many failed logins, retry after the seconds in the Retry-After header"
 // @Failure 500 {object} object{error=string} "Internal server error"
 // @Router /v1/tokens/authentication [post]
 func (h *TokenHandler) CreateAuthenticationToken(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		DeviceName string `json:"device_name"`
 	}
 
 	err := h.app.readJSON(r, &input)
@@ -78,7 +113,116 @@ func (h *TokenHandler) CreateAuthenticationToken(w http.ResponseWriter, r *http.
 
 	ctx := r.Context()
 
-	tokenPlaintext, v, err := h.service.CreateAuthToken(ctx, input.Email, input.Password)
+	info := data.SessionInfo{
+		UserAgent:  r.UserAgent(),
+		IP:         getIP(r),
+		DeviceName: input.DeviceName,
+	}
+
+	result, v, err := h.service.CreateAuthToken(ctx, input.Email, input.Password, info)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleTokenError(w, r, err)
+		return
+	}
+
+	status, env := loginResultEnvelope(result)
+
+	err = h.app.writeJSON(w, status, env, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unlockConfirmPage is what the emailed unlock link opens. Opening it changes nothing,
+// so mail scanners and link previews fetching it don't use up the link, the form
+// posts the token to unlock.
+var unlockConfirmPage = template.Must(template.New("unlock").Parse(`<!doctype html>
+<html>
+<head>
+    <meta name="viewport" content="width=device-width" />
+    <meta charset="utf-8" />
+    <title>Unlock your account</title>
+</head>
+<body>
+    <p>Logging in to your Bible Notes account is locked after too many failed attempts.</p>
+    <form method="post" action="/v1/tokens/unlock/{{.}}">
+        <button type="submit">Unlock my account</button>
+    </form>
+</body>
+</html>
+`))
+
+// @Summary Confirm unlocking login
+// @Description The page the emailed unlock link opens, with a form to confirm unlocking the account. Opening it doesn't use up the link.
+// @Tags authentication
+// @Produce html
+// @Param token path string true "Unlock token from the email"
+// @Success 200 {string} string "Confirmation form posting to /v1/tokens/unlock/{token}"
+// @Router /v1/tokens/unlock/{token} [get]
+func (h *TokenHandler) ConfirmUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	err := unlockConfirmPage.Execute(w, token)
+	if err != nil {
+		h.app.logError(r, err)
+	}
+}
+
+// @Summary Unlock login
+// @Description Lifts the lockout of an account after too many failed logins, with the token of the link emailed to its owner. Each link works once, while the lockout lasts.
+// @Tags authentication
+// @Produce json
+// @Param token path string true "Unlock token from the email"
+// @Success 200 {object} object{message=string} "Account unlocked"
+// @Failure 401 {object} object{error=string} "Invalid, expired or used link"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Router /v1/tokens/unlock/{token} [post]
+func (h *TokenHandler) UnlockLogin(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	err := h.service.UnlockLogin(r.Context(), token)
+	if err != nil {
+		h.handleTokenError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"message": "your account is unlocked, you can log in again"}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Request a login link
+// @Description Emails a link to log in without a password, valid for 15 minutes and working once. Requesting another link replaces the previous one. The response is the same whether or not the email belongs to an activated account, and an address gets at most one link a minute.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param email body object{email=string} true "User email" example({"email": "user@example.com"})
+// @Success 202 {object} object{message=string} "Login link will be sent if the account exists"
+// @Failure 400 {object} object{error=string} "Invalid request body"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Router /v1/tokens/magic-link [post]
+func (h *TokenHandler) CreateMagicLink(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v, err := h.service.CreateMagicLink(r.Context(), input.Email)
 	if v != nil && !v.Valid() {
 		h.app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -88,12 +232,310 @@ func (h *TokenHandler) CreateAuthenticationToken(w http.ResponseWriter, r *http.
 		return
 	}
 
-	err = h.app.writeJSON(w, http.StatusCreated, envelope{"auth_token": tokenPlaintext}, nil)
+	env := envelope{"message": "if an account uses this email, a login link will be sent to it"}
+
+	err = h.app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		h.app.serverErrorResponse(w, r, err)
 	}
 }
 
+// magicLinkConfirmPage is what the emailed login link opens. Opening it changes nothing,
+// so mail scanners and link previews fetching it don't use up the link, the form posts
+// the token to log in.
+var magicLinkConfirmPage = template.Must(template.New("magic-link").Parse(`<!doctype html>
+<html>
+<head>
+    <meta name="viewport" content="width=device-width" />
+    <meta charset="utf-8" />
+    <title>Log in to Bible Notes</title>
+</head>
+<body>
+    <p>Log in to your Bible Notes account on this device?</p>
+    <form method="post" action="/v1/tokens/magic-link/{{.}}">
+        <button type="submit">Log in</button>
+    </form>
+</body>
+</html>
+`))
+
+// @Summary Confirm logging in with a login link
+// @Description The page the emailed login link opens, with a form to confirm logging in. Opening it doesn't use up the link.
+// @Tags authentication
+// @Produce html
+// @Param token path string true "Token from the login link"
+// @Success 200 {string} string "Confirmation form posting to /v1/tokens/magic-link/{token}"
+// @Router /v1/tokens/magic-link/{token} [get]
+func (h *TokenHandler) ConfirmMagicLink(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	err := magicLinkConfirmPage.Execute(w, token)
+	if err != nil {
+		h.app.logError(r, err)
+	}
+}
+
+// @Summary Log in with a login link
+// @Description Exchanges the token of an emailed login link for tokens, like a login with email and password. The page the link opens, or a client handling the link itself, posts its token here, so link previews of mail clients don't use it up. Users with two-factor authentication get a challenge token.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param token path string true "Token from the login link"
+// @Param device body object{device_name=string} false "Optional device name" example({"device_name": "Kitchen tablet"})
+// @Success 201 {object} object{auth_token=string,auth_token_expiry=string,refresh_token=string,refresh_token_expiry=string} "Successfully authenticated"
+// @Success 202 {object} object{two_factor_required=bool,challenge_token=string,challenge_token_expiry=string} "Two-factor code required"
+// @Failure 400 {object} object{error=string} "Invalid request body"
+// @Failure 401 {object} object{error=string} "Invalid, expired or used link"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Router /v1/tokens/magic-link/{token} [post]
+func (h *TokenHandler) ExchangeMagicLink(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		DeviceName string `json:"device_name"`
+	}
+
+	if r.ContentLength != 0 {
+		err := h.app.readJSON(r, &input)
+		if err != nil {
+			h.app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	info := data.SessionInfo{
+		UserAgent:  r.UserAgent(),
+		IP:         getIP(r),
+		DeviceName: input.DeviceName,
+	}
+
+	result, v, err := h.service.ExchangeMagicLink(r.Context(), token, info)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleTokenError(w, r, err)
+		return
+	}
+
+	status, env := loginResultEnvelope(result)
+
+	err = h.app.writeJSON(w, status, env, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Complete two-factor login
+// @Description Answers the challenge of a login with two-factor authentication, with a 6 digit code from the authenticator app or one of the recovery codes. Each code works once. The challenge is dropped after 5 wrong codes.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param challenge body object{challenge_token=string,code=string,device_name=string} true "Challenge and code" example({"challenge_token": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU", "code": "123456"})
+// @Success 201 {object} object{auth_token=string,auth_token_expiry=string,refresh_token=string,refresh_token_expiry=string} "Successfully authenticated"
+// @Failure 400 {object} object{error=string} "Invalid request body"
+// @Failure 401 {object} object{error=string} "Invalid or expired challenge, or wrong code"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Router /v1/tokens/two-factor [post]
+func (h *TokenHandler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		DeviceName     string `json:"device_name"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	info := data.SessionInfo{
+		UserAgent:  r.UserAgent(),
+		IP:         getIP(r),
+		DeviceName: input.DeviceName,
+	}
+
+	pair, v, err := h.service.VerifyTwoFactor(r.Context(), input.ChallengeToken, input.Code, info)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleTokenError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusCreated, tokenPairEnvelope(pair), nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Refresh authentication
+// @Description Exchanges a refresh token for a new access token and refresh token of the same session. A refresh token works once: presenting a used one again signs its session out, since it may have been stolen.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param token body object{refresh_token=string,device_name=string} true "Refresh token" example({"refresh_token": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU"})
+// @Success 201 {object} object{auth_token=string,auth_token_expiry=string,refresh_token=string,refresh_token_expiry=string} "New tokens"
+// @Failure 400 {object} object{error=string} "Invalid request body"
+// @Failure 401 {object} object{error=string} "Invalid, expired or reused refresh token"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Router /v1/tokens/refresh [post]
+func (h *TokenHandler) RefreshAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+		DeviceName   string `json:"device_name"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	info := data.SessionInfo{
+		UserAgent:  r.UserAgent(),
+		IP:         getIP(r),
+		DeviceName: input.DeviceName,
+	}
+
+	pair, err := h.service.RefreshToken(r.Context(), input.RefreshToken, info)
+	if err != nil {
+		h.handleTokenError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusCreated, tokenPairEnvelope(pair), nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// loginResultEnvelope responds to a login with the token pair, or with the challenge
+// token and 202 Accepted when a two-factor code is required
+func loginResultEnvelope(result *service.LoginResult) (int, envelope) {
+	if result.Challenge != nil {
+		return http.StatusAccepted, envelope{
+			"two_factor_required":    true,
+			"challenge_token":        result.Challenge.Plaintext,
+			"challenge_token_expiry": result.Challenge.Expiry,
+		}
+	}
+
+	return http.StatusCreated, tokenPairEnvelope(result.TokenPair)
+}
+
+func tokenPairEnvelope(pair *service.TokenPair) envelope {
+	return envelope{
+		"auth_token":           pair.Access.Plaintext,
+		"auth_token_expiry":    pair.Access.Expiry,
+		"refresh_token":        pair.Refresh.Plaintext,
+		"refresh_token_expiry": pair.Refresh.Expiry,
+	}
+}
+
+// @Summary Log out
+// @Description Revokes the authentication token the request is made with and the refresh token of its session, they stop working immediately
+// @Tags authentication
+// @Success 204 "Token revoked"
+// @Failure 401 {object} object{error=string} "Missing or invalid token"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/tokens/authentication [delete]
+func (h *TokenHandler) RevokeAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	err := h.service.RevokeToken(r.Context(), user.ID, h.app.contextGetToken(r))
+	if err != nil {
+		h.handleTokenError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Sign out everywhere
+// @Description Revokes every authentication and refresh token of the user, including the one the request is made with, signing them out on all devices
+// @Tags authentication
+// @Success 204 "Tokens revoked"
+// @Failure 401 {object} object{error=string} "Missing or invalid token"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/tokens/authentication/all [delete]
+func (h *TokenHandler) RevokeAllAuthenticationTokens(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	err := h.service.RevokeAllTokens(r.Context(), user.ID)
+	if err != nil {
+		h.handleTokenError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary List sessions
+// @Description Lists the devices the user is signed in on: every login with its device name, user agent, IP, creation and last use, most recently used first. Last use is updated at most every 5 minutes. The session of the request is marked current.
+// @Tags authentication
+// @Produce json
+// @Success 200 {object} object{sessions=[]data.Session} "Sessions"
+// @Failure 401 {object} object{error=string} "Missing or invalid token"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/sessions [get]
+func (h *TokenHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	sessions, err := h.service.ListSessions(r.Context(), user.ID, h.app.contextGetToken(r))
+	if err != nil {
+		h.handleTokenError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Revoke a session
+// @Description Signs one of the user's devices out, its tokens stop working immediately
+// @Tags authentication
+// @Param id path int true "Session ID"
+// @Success 204 "Session revoked"
+// @Failure 400 {object} object{error=string} "Invalid session ID"
+// @Failure 401 {object} object{error=string} "Missing or invalid token"
+// @Failure 404 {object} object{error=string} "Session not found"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/sessions/{id} [delete]
+func (h *TokenHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	sessionID, err := h.app.readIDParam(r, "id")
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = h.service.RevokeSession(r.Context(), user.ID, sessionID)
+	if err != nil {
+		h.handleTokenError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // createPasswordResetTokenHandler generates a password reset token and sends reset email
 // @Summary Request password reset
 // @Description Generate a password reset token and send reset instructions via email. Token valid for 45 minutes.
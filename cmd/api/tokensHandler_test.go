@@ -2,10 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"shuvoedward/Bible_project/internal/cache"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/scheduler"
+	"shuvoedward/Bible_project/internal/service"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/julienschmidt/httprouter"
 )
 
 func TestTokenHandler_CreateAuthToken(t *testing.T) {
@@ -26,6 +40,8 @@ func TestTokenHandler_CreateAuthToken(t *testing.T) {
 		{"valid test", payload{"test@email.com", "strong password"}, http.StatusCreated},
 		{"invalid email", payload{"invalid-email", "invalid password"}, http.StatusUnauthorized},
 		{"invalid password", payload{"valid-email", "invalid-password"}, http.StatusUnauthorized},
+		{"two-factor required", payload{"two-factor-email", "strong password"}, http.StatusAccepted},
+		{"locked", payload{"locked-email", "strong password"}, http.StatusTooManyRequests},
 	}
 
 	for _, tt := range tests {
@@ -37,9 +53,368 @@ func TestTokenHandler_CreateAuthToken(t *testing.T) {
 
 			handler.CreateAuthenticationToken(rr, req)
 
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "2" {
+				t.Errorf("expected Retry-After 2, got %q", rr.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestTokenHandler_RevokeAuthenticationToken(t *testing.T) {
+	handler := NewTokenHandler(testApp, &mockTokenService{})
+
+	router := httprouter.New()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		url            string
+		user           *data.User
+		token          string
+		expectedStatus int
+	}{
+		{"log out", "/v1/tokens/authentication", &data.User{ID: 1}, "valid-token", http.StatusNoContent},
+		{"sign out everywhere", "/v1/tokens/authentication/all", &data.User{ID: 1}, "valid-token", http.StatusNoContent},
+		{"anonymous", "/v1/tokens/authentication", data.AnonymousUser, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, tt.url, nil)
+			req = testApp.contextSetUser(req, tt.user)
+			if tt.token != "" {
+				req = testApp.contextSetToken(req, tt.token)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestTokenHandler_Sessions(t *testing.T) {
+	handler := NewTokenHandler(testApp, &mockTokenService{})
+
+	router := httprouter.New()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		expectedStatus int
+	}{
+		{"list", http.MethodGet, "/v1/users/me/sessions", http.StatusOK},
+		{"revoke", http.MethodDelete, "/v1/users/me/sessions/1", http.StatusNoContent},
+		{"revoke missing", http.MethodDelete, "/v1/users/me/sessions/2", http.StatusNotFound},
+		{"revoke invalid id", http.MethodDelete, "/v1/users/me/sessions/abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			req = testApp.contextSetUser(req, &data.User{ID: 1})
+			req = testApp.contextSetToken(req, "valid-token")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestTokenHandler_RefreshAuthenticationToken(t *testing.T) {
+	handler := NewTokenHandler(testApp, &mockTokenService{})
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"valid", `{"refresh_token": "valid-refresh-token"}`, http.StatusCreated},
+		{"invalid token", `{"refresh_token": "used-refresh-token"}`, http.StatusUnauthorized},
+		{"invalid body", `{"refresh_token": 1}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/tokens/refresh", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			handler.RefreshAuthenticationToken(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if tt.expectedStatus == http.StatusCreated {
+				var response map[string]any
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				if response["refresh_token"] != "valid-refresh-token" {
+					t.Errorf("expected a rotated refresh token, got %v", response["refresh_token"])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenHandler_VerifyTwoFactor(t *testing.T) {
+	handler := NewTokenHandler(testApp, &mockTokenService{})
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"valid", `{"challenge_token": "valid-challenge", "code": "123456"}`, http.StatusCreated},
+		{"wrong code", `{"challenge_token": "valid-challenge", "code": "000000"}`, http.StatusUnauthorized},
+		{"invalid challenge", `{"challenge_token": "expired-challenge", "code": "123456"}`, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/tokens/two-factor", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			handler.VerifyTwoFactor(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestTokenHandler_MagicLink(t *testing.T) {
+	handler := NewTokenHandler(testApp, &mockTokenService{})
+
+	t.Run("request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/tokens/magic-link", bytes.NewReader([]byte(`{"email": "user@example.com"}`)))
+		rr := httptest.NewRecorder()
+
+		handler.CreateMagicLink(rr, req)
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("expected status %d, got %d", http.StatusAccepted, rr.Code)
+		}
+	})
+
+	tests := []struct {
+		name           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{"valid", "valid-token", "", http.StatusCreated},
+		{"valid with device name", "valid-token", `{"device_name": "Kitchen tablet"}`, http.StatusCreated},
+		{"invalid token", "invalid-token", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/tokens/magic-link/"+tt.token, bytes.NewReader([]byte(tt.body)))
+			params := httprouter.Params{httprouter.Param{Key: "token", Value: tt.token}}
+			req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+			rr := httptest.NewRecorder()
+
+			handler.ExchangeMagicLink(rr, req)
+
 			if rr.Code != tt.expectedStatus {
 				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
 			}
 		})
 	}
 }
+
+// linkTokens keeps the tokens of a real TokenService by plaintext
+type linkTokens struct {
+	data.TokenModel
+	tokens map[string]*data.Token
+}
+
+func (m *linkTokens) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*data.Token, error) {
+	token := &data.Token{Plaintext: rand.Text(), UserID: userID, Expiry: time.Now().Add(ttl), Scope: scope}
+	m.tokens[token.Plaintext] = token
+	return token, nil
+}
+
+func (m *linkTokens) NewSession(ctx context.Context, userID int64, ttl time.Duration, scope string, info data.SessionInfo) (*data.Token, error) {
+	return m.New(ctx, userID, ttl, scope)
+}
+
+func (m *linkTokens) Consume(ctx context.Context, scope, tokenPlaintext string) (int64, error) {
+	token, ok := m.tokens[tokenPlaintext]
+	if !ok || token.Scope != scope {
+		return 0, data.ErrRecordNotFound
+	}
+	delete(m.tokens, tokenPlaintext)
+	return token.UserID, nil
+}
+
+// linkUser is the only user, without two-factor authentication
+type linkUser struct {
+	data.UserModel
+	user *data.User
+}
+
+func (m *linkUser) GetByEmail(ctx context.Context, email string) (*data.User, error) {
+	if email != m.user.Email {
+		return nil, data.ErrRecordNotFound
+	}
+	return m.user, nil
+}
+
+func (m *linkUser) Get(ctx context.Context, id int64) (*data.User, error) {
+	return m.user, nil
+}
+
+func (m *linkUser) Enabled(ctx context.Context, userID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *linkUser) VerifyCode(ctx context.Context, userID int64, code string) (bool, error) {
+	return false, nil
+}
+
+var formAction = regexp.MustCompile(`<form method="post" action="([^"]+)">`)
+
+// TestTokenHandler_MagicLinkEmail follows the link of the login email like a browser
+func TestTokenHandler_MagicLinkEmail(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient, err := cache.NewRedisClient(cache.RedisConfig{Host: mr.Host(), Port: mr.Port()}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisClient.Close()
+
+	users := &linkUser{user: &data.User{ID: 1, Email: "alice@example.com", Activated: true}}
+	sched := scheduler.NewScheduler(0)
+	tokens := service.NewTokenService(&linkTokens{tokens: make(map[string]*data.Token)}, users, nil, users,
+		redisClient, sched, slog.New(slog.DiscardHandler))
+
+	router := httprouter.New()
+	NewTokenHandler(testApp, tokens).RegisterRoutes(router)
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tokens/magic-link", strings.NewReader(`{"email": "alice@example.com"}`)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("requesting a link: expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+
+	task := <-sched.TaskChannel
+	email, ok := task.Data.(scheduler.TaskMagicLinkData)
+	if !ok {
+		t.Fatalf("got task %+v, want a magic link email", task)
+	}
+	link, err := url.Parse(email.LoginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// scanners and link previews open the link too
+	for range 2 {
+		rr = serve(http.MethodGet, link.Path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("opening the link: expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	}
+
+	action := formAction.FindStringSubmatch(rr.Body.String())
+	if action == nil {
+		t.Fatalf("expected a confirmation form, got %s", rr.Body)
+	}
+
+	rr = serve(http.MethodPost, action[1])
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("confirming: expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	if !strings.Contains(rr.Body.String(), `"refresh_token"`) {
+		t.Errorf("expected tokens, got %s", rr.Body)
+	}
+
+	rr = serve(http.MethodPost, action[1])
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("confirming again: expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+// unlockRecorder records the tokens logins were unlocked with
+type unlockRecorder struct {
+	mockTokenService
+	unlocked []string
+}
+
+func (s *unlockRecorder) UnlockLogin(ctx context.Context, tokenPlaintext string) error {
+	err := s.mockTokenService.UnlockLogin(ctx, tokenPlaintext)
+	if err == nil {
+		s.unlocked = append(s.unlocked, tokenPlaintext)
+	}
+	return err
+}
+
+func TestTokenHandler_UnlockLogin(t *testing.T) {
+	tokens := &unlockRecorder{}
+	router := httprouter.New()
+	NewTokenHandler(testApp, tokens).RegisterRoutes(router)
+
+	t.Run("opening the link only asks to confirm", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/tokens/unlock/valid-token", nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), `<form method="post" action="/v1/tokens/unlock/valid-token">`) {
+			t.Errorf("expected a form posting the token, got %s", rr.Body)
+		}
+		if len(tokens.unlocked) != 0 {
+			t.Errorf("expected nothing unlocked, got %v", tokens.unlocked)
+		}
+	})
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{"confirmed", "valid-token", http.StatusOK},
+		{"invalid token", "invalid-token", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/tokens/unlock/"+tt.token, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+
+	if len(tokens.unlocked) != 1 || tokens.unlocked[0] != "valid-token" {
+		t.Errorf("expected the confirmed link to unlock, got %v", tokens.unlocked)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"shuvoedward/Bible_project/internal/service"
+	"shuvoedward/Bible_project/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type TwoFactorServiceInterface interface {
+	Enroll(ctx context.Context, userID int64) (*service.TOTPEnrollment, error)
+	Confirm(ctx context.Context, userID int64, code string) ([]string, *validator.Validator, error)
+	Disable(ctx context.Context, userID int64, password string) (*validator.Validator, error)
+}
+
+type TwoFactorHandler struct {
+	app     *application
+	service TwoFactorServiceInterface
+}
+
+func NewTwoFactorHandler(app *application, service TwoFactorServiceInterface) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		app:     app,
+		service: service,
+	}
+}
+
+func (h *TwoFactorHandler) RegisterRoutes(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/two-factor", h.app.generalRateLimit(h.app.requireActivatedUser(h.Enroll)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/two-factor/confirm", h.app.authRateLimit(h.app.requireActivatedUser(h.Confirm)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/two-factor", h.app.authRateLimit(h.app.requireActivatedUser(h.Disable)))
+}
+
+func (h *TwoFactorHandler) handleTwoFactorError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrTwoFactorEnabled):
+		h.app.editConflictResponse(w, r, err)
+	case errors.Is(err, service.ErrTwoFactorNotEnabled):
+		h.app.editConflictResponse(w, r, err)
+	case errors.Is(err, service.ErrPasswordNotMatch):
+		h.app.invalidCredentialResponse(w, r)
+	default:
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Set up two-factor authentication
+// @Description Generates a TOTP secret for an authenticator app, as the secret, an otpauth URI and a base64 encoded QR code PNG of the URI. Two-factor authentication is enabled once confirmed with a code. Setting up again before confirming replaces the secret.
+// @Tags two-factor
+// @Produce json
+// @Success 200 {object} object{two_factor=service.TOTPEnrollment} "Secret to add to an authenticator app"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Account not activated"
+// @Failure 409 {object} object{error=string} "Two-factor authentication already enabled"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/two-factor [post]
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	enrollment, err := h.service.Enroll(r.Context(), user.ID)
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"two_factor": enrollment}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Confirm two-factor authentication
+// @Description Enables two-factor authentication with a first code from the authenticator app. Returns 10 one-time recovery codes to sign in without the app, they are only shown this once.
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Param code body object{code=string} true "Code from the authenticator app" example({"code": "123456"})
+// @Success 200 {object} object{recovery_codes=[]string} "Two-factor authentication enabled"
+// @Failure 400 {object} object{error=string} "Invalid request body"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Account not activated"
+// @Failure 409 {object} object{error=string} "Not set up or already enabled"
+// @Failure 422 {object} object{error=map[string]string} "Invalid or expired code"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/two-factor/confirm [post]
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := h.app.contextGetUser(r)
+
+	recoveryCodes, v, err := h.service.Confirm(r.Context(), user.ID, input.Code)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turns two-factor authentication off after re-entering the password, the secret and recovery codes are deleted
+// @Tags two-factor
+// @Accept json
+// @Param password body object{password=string} true "Current password"
+// @Success 204 "Two-factor authentication disabled"
+// @Failure 400 {object} object{error=string} "Invalid request body"
+// @Failure 401 {object} object{error=string} "Unauthorized or wrong password"
+// @Failure 403 {object} object{error=string} "Account not activated"
+// @Failure 409 {object} object{error=string} "Two-factor authentication not enabled"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/two-factor [delete]
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := h.app.contextGetUser(r)
+
+	v, err := h.service.Disable(r.Context(), user.ID, input.Password)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleTwoFactorError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"html/template"
 	"net/http"
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/service"
@@ -16,6 +17,15 @@ type UserServiceInterface interface {
 	RegisterUser(ctx context.Context, name string, email string, password string) (*data.User, *validator.Validator, error)
 
 	UpdatePassword(ctx context.Context, tokenPlaintext string, password string) (*validator.Validator, error)
+
+	GetUser(ctx context.Context, userID int64) (*data.User, error)
+	UpdateUser(ctx context.Context, userID int64, input service.UserUpdate) (*data.User, *validator.Validator, error)
+	RequestEmailChange(ctx context.Context, userID int64, newEmail, password string) (*validator.Validator, error)
+	ConfirmEmailChange(ctx context.Context, tokenPlaintext string) (*data.User, error)
+	DeleteUser(ctx context.Context, userID int64, password string) (*validator.Validator, error)
+
+	GetPreferences(ctx context.Context, userID int64) (data.Preferences, error)
+	UpdatePreferences(ctx context.Context, userID int64, input service.PreferencesUpdate) (data.Preferences, *validator.Validator, error)
 }
 type UserHandler struct {
 	app     *application
@@ -35,6 +45,17 @@ func (h *UserHandler) RegisterRoutes(router *httprouter.Router) {
 	router.HandlerFunc(http.MethodGet, "/v1/users/activated/:token", h.app.authRateLimit(h.Activated))
 
 	router.HandlerFunc(http.MethodPut, "/v1/users/password", h.app.authRateLimit(h.UpdatePassword))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", h.app.generalRateLimit(h.app.requireAuthenticatedUser(h.GetMe)))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", h.app.generalRateLimit(h.app.requireAuthenticatedUser(h.UpdateMe)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", h.app.authRateLimit(h.app.requireAuthenticatedUser(h.DeleteMe)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/preferences", h.app.generalRateLimit(h.app.requireAuthenticatedUser(h.GetPreferences)))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/preferences", h.app.generalRateLimit(h.app.requireAuthenticatedUser(h.UpdatePreferences)))
+
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/email", h.app.authRateLimit(h.app.requireActivatedUser(h.RequestEmailChange)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/email/:token", h.app.authRateLimit(h.ConfirmEmailChangePage))
+	router.HandlerFunc(http.MethodPost, "/v1/users/email/:token", h.app.authRateLimit(h.ConfirmEmailChange))
 }
 
 func (h *UserHandler) handleUserError(w http.ResponseWriter, r *http.Request, err error) {
@@ -43,6 +64,12 @@ func (h *UserHandler) handleUserError(w http.ResponseWriter, r *http.Request, er
 		h.app.editConflictResponse(w, r, err)
 	case errors.Is(err, service.ErrTokenNotFound):
 		h.app.notFoundResponse(w, r)
+	case errors.Is(err, service.ErrUserNotFound):
+		h.app.notFoundResponse(w, r)
+	case errors.Is(err, service.ErrPasswordNotMatch):
+		h.app.invalidCredentialResponse(w, r)
+	case errors.Is(err, data.ErrEditConflict):
+		h.app.editConflictResponse(w, r, err)
 	default:
 		h.app.serverErrorResponse(w, r, err)
 	}
@@ -117,7 +144,7 @@ func (h *UserHandler) Activated(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Update user password
-// @Description Reset user password using a password reset token
+// @Description Reset user password using a password reset token. Every authentication token of the user is revoked, signing them out everywhere.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -157,3 +184,306 @@ func (h *UserHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		h.app.serverErrorResponse(w, r, err)
 	}
 }
+
+// @Summary Get own profile
+// @Description Returns the profile of the authenticated user
+// @Tags users
+// @Produce json
+// @Success 200 {object} object{user=data.User} "User profile"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Request made with an API key"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me [get]
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	profile, err := h.service.GetUser(r.Context(), user.ID)
+	if err != nil {
+		h.handleUserError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"user": profile}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Update own profile
+// @Description Partially updates the profile of the authenticated user, omitted fields are left as they are
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param input body object{name=string} true "Profile fields" example({"name": "John"})
+// @Success 200 {object} object{user=data.User} "Profile updated"
+// @Failure 400 {object} object{error=string} "Invalid request payload"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Request made with an API key"
+// @Failure 409 {object} object{error=string} "Edit conflict"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me [patch]
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name *string `json:"name"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := h.app.contextGetUser(r)
+
+	profile, v, err := h.service.UpdateUser(r.Context(), user.ID, service.UserUpdate{
+		Name: input.Name,
+	})
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleUserError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"user": profile}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Get own preferences
+// @Description Retrieves the authenticated user's preferences, the defaults of requests that leave an option out. Settings the user never chose have their default value.
+// @Tags users
+// @Produce json
+// @Success 200 {object} object{preferences=data.Preferences} "Preferences"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Request made with an API key"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/preferences [get]
+func (h *UserHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	user := h.app.contextGetUser(r)
+
+	preferences, err := h.service.GetPreferences(r.Context(), user.ID)
+	if err != nil {
+		h.handleUserError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Update own preferences
+// @Description Partially updates the authenticated user's preferences, omitted fields are left as they are. The translation and verse number display are the defaults of Bible passages, the notes sort and page size of note lists, the timezone is the day streaks and reading plans count in.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param input body object{translation=string,timezone=string,locale=string,highlight_color=string,verse_numbers=string,notes_sort=string,notes_page_size=int} true "Preferences to change" example({"timezone": "America/New_York", "verse_numbers": "superscript"})
+// @Success 200 {object} object{preferences=data.Preferences} "Preferences updated"
+// @Failure 400 {object} object{error=string} "Invalid request payload"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Request made with an API key"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/preferences [patch]
+func (h *UserHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Translation    *string `json:"translation"`
+		Timezone       *string `json:"timezone"`
+		Locale         *string `json:"locale"`
+		HighlightColor *string `json:"highlight_color"`
+		VerseNumbers   *string `json:"verse_numbers"`
+		NotesSort      *string `json:"notes_sort"`
+		NotesPageSize  *int    `json:"notes_page_size"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := h.app.contextGetUser(r)
+
+	preferences, v, err := h.service.UpdatePreferences(r.Context(), user.ID, service.PreferencesUpdate{
+		Translation:    input.Translation,
+		Timezone:       input.Timezone,
+		Locale:         input.Locale,
+		HighlightColor: input.HighlightColor,
+		VerseNumbers:   input.VerseNumbers,
+		NotesSort:      input.NotesSort,
+		NotesPageSize:  input.NotesPageSize,
+	})
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleUserError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Change own email
+// @Description Starts changing the email after re-entering the password. The new address gets a link valid for 24 hours to confirm it, the current address a notice. The email only changes once confirmed.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param input body object{email=string,password=string} true "New email and current password" example({"email": "john@example.org", "password": "pass1234"})
+// @Success 202 {object} object{message=string} "Confirmation email sent"
+// @Failure 400 {object} object{error=string} "Invalid request payload"
+// @Failure 401 {object} object{error=string} "Unauthorized or wrong password"
+// @Failure 403 {object} object{error=string} "Account not activated or request made with an API key"
+// @Failure 409 {object} object{error=string} "Email already used"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me/email [put]
+func (h *UserHandler) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := h.app.contextGetUser(r)
+
+	v, err := h.service.RequestEmailChange(r.Context(), user.ID, input.Email, input.Password)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleUserError(w, r, err)
+		return
+	}
+
+	env := envelope{"message": "an email will be sent to the new address with instructions to confirm it"}
+
+	err = h.app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// emailChangeConfirmPage is what the emailed confirmation link opens. Opening it changes
+// nothing, so mail scanners and link previews fetching it don't change the email, the
+// form posts the token to confirm the change.
+var emailChangeConfirmPage = template.Must(template.New("email-change").Parse(`<!doctype html>
+<html>
+<head>
+    <meta name="viewport" content="width=device-width" />
+    <meta charset="utf-8" />
+    <title>Confirm your new email address</title>
+</head>
+<body>
+    <p>Use this address for your Bible Notes account from now on?</p>
+    <form method="post" action="/v1/users/email/{{.}}">
+        <button type="submit">Confirm my new email address</button>
+    </form>
+</body>
+</html>
+`))
+
+// @Summary Confirm email change page
+// @Description The page the emailed confirmation link opens, with a form to confirm the new email address. Opening it doesn't change the email or use up the link.
+// @Tags users
+// @Produce html
+// @Param token path string true "Email change token"
+// @Success 200 {string} string "Confirmation form posting to /v1/users/email/{token}"
+// @Router /v1/users/email/{token} [get]
+func (h *UserHandler) ConfirmEmailChangePage(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	err := emailChangeConfirmPage.Execute(w, token)
+	if err != nil {
+		h.app.logError(r, err)
+	}
+}
+
+// @Summary Confirm email change
+// @Description Switches the account to the new email address using the token from the confirmation email. Each link works once.
+// @Tags users
+// @Produce json
+// @Param token path string true "Email change token"
+// @Success 200 {object} object{user=data.User} "Email changed"
+// @Failure 404 {object} object{error=string} "Invalid or expired token"
+// @Failure 409 {object} object{error=string} "Email already used"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Router /v1/users/email/{token} [post]
+func (h *UserHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	user, err := h.service.ConfirmEmailChange(r.Context(), token)
+	if err != nil {
+		h.handleUserError(w, r, err)
+		return
+	}
+
+	err = h.app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary Delete own account
+// @Description Deletes the account after re-entering the password, with its notes, highlights, images, exports and everything else. Every session is signed out. This can't be undone.
+// @Tags users
+// @Accept json
+// @Param password body object{password=string} true "Current password"
+// @Success 204 "Account deleted"
+// @Failure 400 {object} object{error=string} "Invalid request payload"
+// @Failure 401 {object} object{error=string} "Unauthorized or wrong password"
+// @Failure 403 {object} object{error=string} "Request made with an API key"
+// @Failure 422 {object} object{error=map[string]string} "Validation failed"
+// @Failure 500 {object} object{error=string} "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/me [delete]
+func (h *UserHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := h.app.readJSON(r, &input)
+	if err != nil {
+		h.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := h.app.contextGetUser(r)
+
+	v, err := h.service.DeleteUser(r.Context(), user.ID, input.Password)
+	if v != nil && !v.Valid() {
+		h.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		h.handleUserError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"shuvoedward/Bible_project/internal/data"
+	"strings"
 	"testing"
 
 	"github.com/julienschmidt/httprouter"
@@ -168,3 +170,180 @@ func TestUserHandler_UpdatePassword(t *testing.T) {
 
 	}
 }
+
+func TestUserHandler_UpdateMe(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+	}{
+		{"rename", `{"name": "Jane"}`, http.StatusOK},
+		{"empty name", `{"name": ""}`, http.StatusUnprocessableEntity},
+		{"unknown field", `{"email": "jane@example.com"}`, http.StatusBadRequest},
+	}
+
+	handler := NewUserHandler(testApp, &mockUserService{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/me", bytes.NewReader([]byte(tt.payload)))
+			req = testApp.contextSetUser(req, &data.User{ID: 1, Activated: true})
+			rr := httptest.NewRecorder()
+
+			handler.UpdateMe(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_UpdatePreferences(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+	}{
+		{"change timezone", `{"timezone": "America/New_York"}`, http.StatusOK},
+		{"unknown timezone", `{"timezone": "Mars/Olympus_Mons"}`, http.StatusUnprocessableEntity},
+		{"unknown field", `{"theme": "dark"}`, http.StatusBadRequest},
+	}
+
+	handler := NewUserHandler(testApp, &mockUserService{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/me/preferences", bytes.NewReader([]byte(tt.payload)))
+			req = testApp.contextSetUser(req, &data.User{ID: 1, Activated: true})
+			rr := httptest.NewRecorder()
+
+			handler.UpdatePreferences(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_RequestEmailChange(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        map[string]string
+		expectedStatus int
+	}{
+		{"valid", map[string]string{"email": "new@example.com", "password": "password123"}, http.StatusAccepted},
+		{"wrong password", map[string]string{"email": "new@example.com", "password": "wrong-password"}, http.StatusUnauthorized},
+		{"email taken", map[string]string{"email": "duplicate@example.com", "password": "password123"}, http.StatusConflict},
+	}
+
+	handler := NewUserHandler(testApp, &mockUserService{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.payload)
+			req := httptest.NewRequest(http.MethodPut, "/v1/users/me/email", bytes.NewReader(body))
+			req = testApp.contextSetUser(req, &data.User{ID: 1, Activated: true})
+			rr := httptest.NewRecorder()
+
+			handler.RequestEmailChange(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_DeleteMe(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        map[string]string
+		expectedStatus int
+	}{
+		{"valid", map[string]string{"password": "password123"}, http.StatusNoContent},
+		{"wrong password", map[string]string{"password": "wrong-password"}, http.StatusUnauthorized},
+		{"missing password", map[string]string{}, http.StatusUnprocessableEntity},
+	}
+
+	handler := NewUserHandler(testApp, &mockUserService{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.payload)
+			req := httptest.NewRequest(http.MethodDelete, "/v1/users/me", bytes.NewReader(body))
+			req = testApp.contextSetUser(req, &data.User{ID: 1, Activated: true})
+			rr := httptest.NewRecorder()
+
+			handler.DeleteMe(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// emailChangeRecorder records the tokens email changes were confirmed with
+type emailChangeRecorder struct {
+	mockUserService
+	confirmed []string
+}
+
+func (s *emailChangeRecorder) ConfirmEmailChange(ctx context.Context, tokenPlaintext string) (*data.User, error) {
+	user, err := s.mockUserService.ConfirmEmailChange(ctx, tokenPlaintext)
+	if err == nil {
+		s.confirmed = append(s.confirmed, tokenPlaintext)
+	}
+	return user, err
+}
+
+func TestUserHandler_ConfirmEmailChange(t *testing.T) {
+	users := &emailChangeRecorder{}
+	router := httprouter.New()
+	NewUserHandler(testApp, users).RegisterRoutes(router)
+
+	t.Run("opening the link leaves the email unchanged", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/users/email/valid-token", nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), `<form method="post" action="/v1/users/email/valid-token">`) {
+			t.Errorf("expected a form posting the token, got %s", rr.Body)
+		}
+		if len(users.confirmed) != 0 {
+			t.Errorf("expected no email change, got %v", users.confirmed)
+		}
+	})
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{"confirmed", "valid-token", http.StatusOK},
+		{"invalid token", "invalid-token", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/users/email/"+tt.token, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+
+	if len(users.confirmed) != 1 || users.confirmed[0] != "valid-token" {
+		t.Errorf("expected the confirmed link to change the email, got %v", users.confirmed)
+	}
+}
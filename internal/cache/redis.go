@@ -86,6 +86,30 @@ func (r *RedisClient) Set(ctx context.Context, key string, value string, ttl tim
 	return handleRedisError(err)
 }
 
+// SetNX sets key only if it doesn't exist yet, reporting whether it was set
+func (r *RedisClient) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	set, err := r.client.SetNX(ctx, key, value, ttl).Result()
+	if err != nil {
+		return false, handleRedisError(err)
+	}
+
+	return set, nil
+}
+
+// Incr increments the counter at key, a new counter expires after ttl
+func (r *RedisClient) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, ttl)
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, handleRedisError(err)
+	}
+
+	return count.Val(), nil
+}
+
 func (r *RedisClient) Get(ctx context.Context, key string) (string, error) {
 	val, err := r.client.Get(ctx, key).Result()
 
@@ -96,6 +120,32 @@ func (r *RedisClient) Get(ctx context.Context, key string) (string, error) {
 	return val, nil
 }
 
+// GetDel gets the value at key and deletes it, so only one caller ever gets it
+func (r *RedisClient) GetDel(ctx context.Context, key string) (string, error) {
+	val, err := r.client.GetDel(ctx, key).Result()
+	if err != nil {
+		return "", handleRedisError(err)
+	}
+
+	return val, nil
+}
+
+// TTL returns how long until key expires
+// Returns ErrKeyNotFound if key doesn't exist or doesn't expire
+func (r *RedisClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, handleRedisError(err)
+	}
+
+	// PTTL reports a missing key as -2 and a key without expiry as -1
+	if ttl < 0 {
+		return 0, ErrKeyNotFound
+	}
+
+	return ttl, nil
+}
+
 func (r *RedisClient) tokenKey(token string) string {
 	return fmt.Sprintf("token:%s", token)
 }
@@ -146,3 +196,49 @@ func (r *RedisClient) DeleteToken(token string) error {
 
 	return nil
 }
+
+// Del removes keys, missing keys are ignored
+func (r *RedisClient) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err := r.client.Del(ctx, keys...).Err()
+	return handleRedisError(err)
+}
+
+// SAdd adds members to the set at key and resets its expiry to ttl
+func (r *RedisClient) SAdd(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	args := make([]any, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.SAdd(ctx, key, args...)
+	pipe.Expire(ctx, key, ttl)
+
+	_, err := pipe.Exec(ctx)
+	return handleRedisError(err)
+}
+
+// SRem removes members from the set at key
+func (r *RedisClient) SRem(ctx context.Context, key string, members ...string) error {
+	args := make([]any, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+
+	err := r.client.SRem(ctx, key, args...).Err()
+	return handleRedisError(err)
+}
+
+// SMembers returns the members of the set at key, none if it doesn't exist
+func (r *RedisClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	members, err := r.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, handleRedisError(err)
+	}
+
+	return members, nil
+}
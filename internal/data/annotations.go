@@ -0,0 +1,223 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	AnnotationKindNote      = "note"
+	AnnotationKindHighlight = "highlight"
+)
+
+type AnnotationModel interface {
+	GetForChapters(ctx context.Context, userID int64, filter *AnnotationFilters) ([]*Annotation, Metadata, error)
+}
+
+// AnnotationFilters selects a chapter range of a book
+type AnnotationFilters struct {
+	Filters
+	Book        string
+	FromChapter int
+	ToChapter   int
+}
+
+// Annotation is either a located note or a highlight, Kind tells which one is set
+type Annotation struct {
+	Kind      string
+	Chapter   int
+	Verse     int
+	Note      *NoteResponse
+	Highlight *Highlight
+}
+
+type annotationModel struct {
+	db *sql.DB
+}
+
+func NewAnnotationModel(db *sql.DB) AnnotationModel {
+	return &annotationModel{db}
+}
+
+// GetForChapters retrieves the located notes (BIBLE, CROSS_REFERENCE, and GENERAL
+// through derived locations) and highlights of the user within a chapter range,
+// ordered by chapter and verse. A note linked at several locations appears once
+// per location. Pagination applies to the combined list.
+func (m annotationModel) GetForChapters(ctx context.Context, userID int64, filter *AnnotationFilters) ([]*Annotation, Metadata, error) {
+	query := `
+		SELECT
+			COUNT(*) OVER(),
+			kind, id, location_id, title, content, note_type, color,
+			chapter, start_verse, end_verse, start_offset, end_offset, derived,
+			created_at, updated_at
+		FROM (
+			SELECT
+				'note' AS kind,
+				n.id,
+				nl.id AS location_id,
+				COALESCE(n.title, '') AS title,
+				CASE
+					WHEN n.note_type = 'CROSS_REFERENCE' THEN n.content
+					ELSE ''
+				END AS content,
+				n.note_type,
+				'' AS color,
+				nl.chapter,
+				nl.start_verse,
+				nl.end_verse,
+				COALESCE(nl.start_offset, 0) AS start_offset,
+				COALESCE(nl.end_offset, 0) AS end_offset,
+				nl.derived,
+				n.created_at,
+				n.updated_at
+			FROM
+				notes AS n
+			JOIN
+				note_locations AS nl ON n.id = nl.note_id
+			JOIN
+				books AS b ON nl.book_id = b.id
+			WHERE
+				n.user_id = $1
+				AND n.deleted_at IS NULL
+				AND b.name = $2
+				AND nl.chapter BETWEEN $3 AND $4
+				AND (
+					n.note_type IN ('CROSS_REFERENCE', 'BIBLE')
+					OR (n.note_type = 'GENERAL' AND nl.derived)
+				)
+
+			UNION ALL
+
+			SELECT
+				'highlight',
+				h.id,
+				0,
+				'',
+				'',
+				'',
+				COALESCE(h.color, ''),
+				h.chapter,
+				COALESCE(h.start_verse, 0),
+				COALESCE(h.end_verse, 0),
+				h.start_offset,
+				h.end_offset,
+				FALSE,
+				h.created_at,
+				h.updated_at
+			FROM
+				highlights AS h
+			JOIN
+				books AS b ON h.book_id = b.id
+			WHERE
+				h.user_id = $1
+				AND b.name = $2
+				AND h.chapter BETWEEN $3 AND $4
+		) AS annotations
+		ORDER BY
+			chapter, start_verse, end_verse, kind DESC, id
+		LIMIT $5
+		OFFSET $6`
+
+	args := []any{userID, filter.Book, filter.FromChapter, filter.ToChapter, filter.limit(), filter.offset()}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	annotations := []*Annotation{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var (
+			annotation               Annotation
+			id, locationID           int64
+			title, content, noteType string
+			color                    string
+			startVerse, endVerse     int
+			startOffset, endOffset   *int
+			derived                  bool
+			createdAt, updatedAt     time.Time
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&annotation.Kind,
+			&id,
+			&locationID,
+			&title,
+			&content,
+			&noteType,
+			&color,
+			&annotation.Chapter,
+			&startVerse,
+			&endVerse,
+			&startOffset,
+			&endOffset,
+			&derived,
+			&createdAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		annotation.Verse = startVerse
+
+		switch annotation.Kind {
+		case AnnotationKindNote:
+			annotation.Note = &NoteResponse{
+				ID:        id,
+				UserID:    userID,
+				Title:     title,
+				Content:   content,
+				NoteType:  noteType,
+				CreatedAt: createdAt,
+				UpdatedAt: updatedAt,
+				Location: &LocationResponse{
+					ID:          locationID,
+					Book:        filter.Book,
+					Chapter:     annotation.Chapter,
+					StartVerse:  startVerse,
+					EndVerse:    endVerse,
+					StartOffset: derefInt(startOffset),
+					EndOffset:   derefInt(endOffset),
+					Derived:     derived,
+				},
+			}
+		case AnnotationKindHighlight:
+			annotation.Highlight = &Highlight{
+				ID:          id,
+				Book:        filter.Book,
+				Chapter:     annotation.Chapter,
+				StartVerse:  startVerse,
+				EndVerse:    endVerse,
+				StartOffset: startOffset,
+				EndOffset:   endOffset,
+				Color:       color,
+				CreatedAt:   createdAt,
+				UpdatedAt:   updatedAt,
+			}
+		}
+
+		annotations = append(annotations, &annotation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return annotations, calculateMetadata(totalRecords, filter.Page, filter.PageSize), nil
+}
+
+func derefInt(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
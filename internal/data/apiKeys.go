@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Scopes an API key can be granted, a key reaches the routes that require one of its scopes
+const (
+	APIScopeNotesRead       = "notes:read"
+	APIScopeNotesWrite      = "notes:write"
+	APIScopeHighlightsRead  = "highlights:read"
+	APIScopeHighlightsWrite = "highlights:write"
+)
+
+var APIScopes = []string{
+	APIScopeNotesRead,
+	APIScopeNotesWrite,
+	APIScopeHighlightsRead,
+	APIScopeHighlightsWrite,
+}
+
+// APIKeyPrefix starts every API key, telling them apart from authentication tokens
+const APIKeyPrefix = "bn_"
+
+var ErrDuplicateAPIKeyName = errors.New("an API key with this name already exists")
+
+type APIKeyModel interface {
+	New(ctx context.Context, key *APIKey) error
+	GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error)
+	GetUser(ctx context.Context, keyPlaintext string) (*User, *APIKey, error)
+	Touch(ctx context.Context, id int64) error
+	Delete(ctx context.Context, id, userID int64) error
+}
+
+// APIKey lets a script act for a user within its scopes. Plaintext is only set when
+// the key is created, Prefix identifies it afterwards.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Plaintext  string     `json:"key,omitempty"`
+	Hash       []byte     `json:"-"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+type apiKeyModel struct {
+	db DBTX
+}
+
+func NewAPIKeyModel(db DBTX) APIKeyModel {
+	return &apiKeyModel{db}
+}
+
+// New generates the key's plaintext and stores it, populating its ID, hash, prefix and creation time
+// Returns ErrDuplicateAPIKeyName if the user has a key with the same name
+func (m apiKeyModel) New(ctx context.Context, key *APIKey) error {
+	key.Plaintext = APIKeyPrefix + rand.Text()
+	key.Prefix = key.Plaintext[:len(APIKeyPrefix)+5]
+
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	query := `
+		INSERT INTO api_keys
+			(user_id, name, hash, prefix, scopes, expiry)
+		VALUES
+			($1, $2, $3, $4, $5, $6)
+		RETURNING
+			id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	args := []any{key.UserID, key.Name, key.Hash, key.Prefix, pq.Array(key.Scopes), key.Expiry}
+
+	err := m.db.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == UniqueViolation {
+			return ErrDuplicateAPIKeyName
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetAllForUser retrieves the user's API keys, expired ones included, newest first
+func (m apiKeyModel) GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT
+			id, user_id, name, prefix, scopes, expiry, last_used_at, created_at
+		FROM
+			api_keys
+		WHERE
+			user_id = $1
+		ORDER BY
+			created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Scopes),
+			&key.Expiry,
+			&key.LastUsedAt,
+			&key.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetUser retrieves an unexpired API key and the user it belongs to
+// Returns ErrRecordNotFound if the key doesn't exist or expired
+func (m apiKeyModel) GetUser(ctx context.Context, keyPlaintext string) (*User, *APIKey, error) {
+	hash := sha256.Sum256([]byte(keyPlaintext))
+
+	query := `
+		SELECT
+			u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.version, u.preferences,
+			k.id, k.name, k.prefix, k.scopes, k.expiry, k.last_used_at, k.created_at
+		FROM
+			api_keys AS k
+		JOIN
+			users AS u ON u.id = k.user_id
+		WHERE
+			k.hash = $1
+			AND (k.expiry IS NULL OR k.expiry > NOW())`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var user User
+	var key APIKey
+
+	err := m.db.QueryRowContext(ctx, query, hash[:]).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.Preferences,
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Scopes),
+		&key.Expiry,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrRecordNotFound
+		}
+		return nil, nil, err
+	}
+
+	key.UserID = user.ID
+
+	return &user, &key, nil
+}
+
+// Touch records that an API key was just used
+func (m apiKeyModel) Touch(ctx context.Context, id int64) error {
+	query := `
+		UPDATE
+			api_keys
+		SET
+			last_used_at = NOW()
+		WHERE
+			id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Delete revokes one of the user's API keys
+// Returns ErrRecordNotFound if it doesn't exist or belongs to another user
+func (m apiKeyModel) Delete(ctx context.Context, id, userID int64) error {
+	query := `
+		DELETE FROM
+			api_keys
+		WHERE
+			id = $1
+			AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
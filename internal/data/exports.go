@@ -0,0 +1,467 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+var ErrExportInProgress = errors.New("an export is already in progress")
+
+type ExportModel interface {
+	Insert(ctx context.Context, userID int64) (*Export, error)
+	Get(ctx context.Context, id, userID int64) (*Export, error)
+	GetPending(ctx context.Context, userID int64) (*Export, error)
+	Complete(ctx context.Context, id int64, s3Key string, expiresAt time.Time) error
+	Fail(ctx context.Context, id int64, reason string) error
+	GetNotes(ctx context.Context, userID int64) ([]*ExportNote, error)
+	GetHighlights(ctx context.Context, userID int64) ([]*Highlight, error)
+	GetKeysForUser(ctx context.Context, userID int64) ([]string, error)
+}
+
+type Export struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"-"`
+	Status      string     `json:"status"`
+	S3Key       *string    `json:"-"`
+	Error       *string    `json:"error,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// ExportNote is a note with all its locations and images, as written to an export archive
+type ExportNote struct {
+	NoteResponse
+	Locations []*LocationResponse `json:"locations"`
+	Images    []*ImageData        `json:"images"`
+}
+
+type exportModel struct {
+	db *sql.DB
+}
+
+func NewExportModel(db *sql.DB) ExportModel {
+	return &exportModel{db}
+}
+
+// Insert creates a pending export for the user.
+// Returns ErrExportInProgress if the user already has a pending export.
+func (m exportModel) Insert(ctx context.Context, userID int64) (*Export, error) {
+	query := `
+		INSERT INTO exports
+			(user_id)
+		VALUES
+			($1)
+		RETURNING
+			id, user_id, status, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var export Export
+
+	err := m.db.QueryRowContext(ctx, query, userID).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.CreatedAt,
+	)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == UniqueViolation {
+			return nil, ErrExportInProgress
+		}
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// Get retrieves an export of the user.
+// Returns ErrRecordNotFound if the export doesn't exist or doesn't belong to the user.
+func (m exportModel) Get(ctx context.Context, id, userID int64) (*Export, error) {
+	query := `
+		SELECT
+			id, user_id, status, s3_key, error, expires_at, created_at, completed_at
+		FROM
+			exports
+		WHERE
+			id = $1
+			AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var export Export
+
+	err := m.db.QueryRowContext(ctx, query, id, userID).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.S3Key,
+		&export.Error,
+		&export.ExpiresAt,
+		&export.CreatedAt,
+		&export.CompletedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// GetPending retrieves the pending export of the user.
+// Returns ErrRecordNotFound if the user has none.
+func (m exportModel) GetPending(ctx context.Context, userID int64) (*Export, error) {
+	query := `
+		SELECT
+			id, user_id, status, created_at
+		FROM
+			exports
+		WHERE
+			user_id = $1
+			AND status = 'pending'`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var export Export
+
+	err := m.db.QueryRowContext(ctx, query, userID).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// Complete marks a pending export as completed with the location of its archive
+func (m exportModel) Complete(ctx context.Context, id int64, s3Key string, expiresAt time.Time) error {
+	query := `
+		UPDATE
+			exports
+		SET
+			status = 'completed',
+			s3_key = $2,
+			expires_at = $3,
+			completed_at = NOW()
+		WHERE
+			id = $1
+			AND status = 'pending'`
+
+	return m.finish(ctx, query, id, s3Key, expiresAt)
+}
+
+// Fail marks a pending export as failed
+func (m exportModel) Fail(ctx context.Context, id int64, reason string) error {
+	query := `
+		UPDATE
+			exports
+		SET
+			status = 'failed',
+			error = $2,
+			completed_at = NOW()
+		WHERE
+			id = $1
+			AND status = 'pending'`
+
+	return m.finish(ctx, query, id, reason)
+}
+
+func (m exportModel) finish(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetNotes retrieves every note of the user with all its locations and image metadata.
+// Returns an empty slice if the user has no notes.
+func (m exportModel) GetNotes(ctx context.Context, userID int64) ([]*ExportNote, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	notesQuery := `
+		SELECT
+			n.id, n.user_id, COALESCE(n.title, ''), n.content, n.note_type, n.created_at, n.updated_at,
+			tb.name, xr.chapter, xr.start_verse, xr.end_verse
+		FROM
+			notes AS n
+		LEFT JOIN
+			note_cross_references AS xr ON xr.note_id = n.id
+		LEFT JOIN
+			books AS tb ON xr.book_id = tb.id
+		WHERE
+			n.user_id = $1
+			AND n.deleted_at IS NULL
+		ORDER BY
+			n.id`
+
+	rows, err := m.db.QueryContext(ctx, notesQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*ExportNote{}
+	byID := make(map[int64]*ExportNote)
+
+	for rows.Next() {
+		note := ExportNote{
+			Locations: []*LocationResponse{},
+			Images:    []*ImageData{},
+		}
+		var target nullableLocation
+		err := rows.Scan(
+			&note.ID,
+			&note.UserID,
+			&note.Title,
+			&note.Content,
+			&note.NoteType,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+			&target.Book,
+			&target.Chapter,
+			&target.StartVerse,
+			&target.EndVerse,
+		)
+		if err != nil {
+			return nil, err
+		}
+		note.Target = target.response()
+
+		notes = append(notes, &note)
+		byID[note.ID] = &note
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	locationsQuery := `
+		SELECT
+			nl.note_id, nl.id, b.name, nl.chapter, nl.start_verse, nl.end_verse,
+			COALESCE(nl.start_offset, 0), COALESCE(nl.end_offset, 0), nl.derived
+		FROM
+			note_locations nl
+		JOIN
+			notes n ON n.id = nl.note_id
+		JOIN
+			books b ON b.id = nl.book_id
+		WHERE
+			n.user_id = $1
+			AND n.deleted_at IS NULL
+		ORDER BY
+			nl.note_id, b.id, nl.chapter, nl.start_verse`
+
+	locationRows, err := m.db.QueryContext(ctx, locationsQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer locationRows.Close()
+
+	for locationRows.Next() {
+		var noteID int64
+		var location LocationResponse
+		err := locationRows.Scan(
+			&noteID,
+			&location.ID,
+			&location.Book,
+			&location.Chapter,
+			&location.StartVerse,
+			&location.EndVerse,
+			&location.StartOffset,
+			&location.EndOffset,
+			&location.Derived,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if note, ok := byID[noteID]; ok {
+			note.Locations = append(note.Locations, &location)
+		}
+	}
+
+	if err = locationRows.Err(); err != nil {
+		return nil, err
+	}
+
+	imagesQuery := `
+		SELECT
+			i.id, i.note_id, i.s3_key, COALESCE(i.width, 0), COALESCE(i.height, 0),
+			COALESCE(i.original_filename, ''), i.mime_type, COALESCE(i.file_size, 0), i.created_at
+		FROM
+			images i
+		JOIN
+			notes n ON n.id = i.note_id
+		WHERE
+			n.user_id = $1
+			AND n.deleted_at IS NULL
+		ORDER BY
+			i.note_id, i.id`
+
+	imageRows, err := m.db.QueryContext(ctx, imagesQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer imageRows.Close()
+
+	for imageRows.Next() {
+		var image ImageData
+		err := imageRows.Scan(
+			&image.ID,
+			&image.NoteID,
+			&image.S3Key,
+			&image.Width,
+			&image.Height,
+			&image.OriginalFileName,
+			&image.MimeType,
+			&image.FileSize,
+			&image.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if note, ok := byID[image.NoteID]; ok {
+			note.Images = append(note.Images, &image)
+		}
+	}
+
+	if err = imageRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// GetHighlights retrieves every highlight of the user.
+// Returns an empty slice if the user has no highlights.
+func (m exportModel) GetHighlights(ctx context.Context, userID int64) ([]*Highlight, error) {
+	query := `
+		SELECT
+			h.id, b.name, h.chapter, COALESCE(h.start_verse, 0), COALESCE(h.end_verse, 0),
+			h.start_offset, h.end_offset, COALESCE(h.color, ''), h.created_at, h.updated_at
+		FROM
+			highlights h
+		JOIN
+			books b ON b.id = h.book_id
+		WHERE
+			h.user_id = $1
+		ORDER BY
+			b.id, h.chapter, h.start_verse`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	highlights := []*Highlight{}
+
+	for rows.Next() {
+		var highlight Highlight
+		err := rows.Scan(
+			&highlight.ID,
+			&highlight.Book,
+			&highlight.Chapter,
+			&highlight.StartVerse,
+			&highlight.EndVerse,
+			&highlight.StartOffset,
+			&highlight.EndOffset,
+			&highlight.Color,
+			&highlight.CreatedAt,
+			&highlight.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		highlights = append(highlights, &highlight)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return highlights, nil
+}
+
+// GetKeysForUser retrieves the S3 keys of the user's export archives
+func (m exportModel) GetKeysForUser(ctx context.Context, userID int64) ([]string, error) {
+	query := `
+		SELECT
+			s3_key
+		FROM
+			exports
+		WHERE
+			user_id = $1
+			AND s3_key IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
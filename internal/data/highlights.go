@@ -3,13 +3,26 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrHighlightBookNotFound    = errors.New("book not found")
+	ErrHighlightPaletteNotFound = errors.New("palette entry not found")
+	ErrHighlightConstraint      = errors.New("highlight violates a database constraint")
 )
 
 type HighlightModel interface {
 	Insert(ctx context.Context, highlight *Highlight) error
 	Get(ctx context.Context, userID int64, filter *LocationFilters) ([]*Highlight, error)
-	Update(ctx context.Context, id, user_id int64, color string) error
+	GetByID(ctx context.Context, id, userID int64) (*Highlight, error)
+	GetAll(ctx context.Context, userID int64, filter *HighlightFilters) ([]*Highlight, Metadata, error)
+	Update(ctx context.Context, id, user_id int64, color string, paletteID *int64) error
 	Delete(ctx context.Context, id, userId int64) error
 }
 
@@ -23,15 +36,26 @@ type Highlight struct {
 	StartOffset *int      `json:"start_offset"`
 	EndOffset   *int      `json:"end_offset"`
 	Color       string    `json:"color"`
+	PaletteID   *int64    `json:"palette_id"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// HighlightFilters narrows a user's highlights, empty fields don't filter.
+// Until is exclusive.
+type HighlightFilters struct {
+	Filters
+	Color string
+	Book  string
+	From  *time.Time
+	Until *time.Time
+}
+
 type highlightModel struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewHighlightModel(db *sql.DB) HighlightModel {
+func NewHighlightModel(db DBTX) HighlightModel {
 	return &highlightModel{db}
 }
 
@@ -40,9 +64,9 @@ func NewHighlightModel(db *sql.DB) HighlightModel {
 func (m highlightModel) Insert(ctx context.Context, highlight *Highlight) error {
 	query := `
 		INSERT INTO highlights
-			(user_id, book_id, chapter, start_verse, end_verse, start_offset, end_offset, color)
+			(user_id, book_id, chapter, start_verse, end_verse, start_offset, end_offset, color, palette_id)
 		SELECT
-			$1, b.id, $3, $4, $5, $6, $7, $8
+			$1, b.id, $3, $4, $5, $6, $7, $8, $9
 		FROM 
 			books b
 		WHERE 
@@ -58,12 +82,29 @@ func (m highlightModel) Insert(ctx context.Context, highlight *Highlight) error
 		highlight.StartOffset,
 		highlight.EndOffset,
 		highlight.Color,
+		highlight.PaletteID,
 	}
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	return m.db.QueryRowContext(ctx, query, args...).Scan(&highlight.ID, &highlight.CreatedAt)
+	err := m.db.QueryRowContext(ctx, query, args...).Scan(&highlight.ID, &highlight.CreatedAt)
+	if err != nil {
+		var pgErr *pq.Error
+		switch {
+		// the SELECT found no book of this name
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrHighlightBookNotFound
+		// the palette entry was deleted after the highlight was validated
+		case errors.As(err, &pgErr) && pgErr.Code == ForeignKeyViolation && pgErr.Constraint == "highlights_palette_id_fkey":
+			return ErrHighlightPaletteNotFound
+		case errors.As(err, &pgErr) && pgErr.Code.Class() == "23":
+			return fmt.Errorf("%w: %s", ErrHighlightConstraint, pgErr.Constraint)
+		default:
+			return err
+		}
+	}
 
+	return nil
 }
 
 func (m highlightModel) Get(ctx context.Context, userID int64, filter *LocationFilters) ([]*Highlight, error) {
@@ -74,7 +115,7 @@ func (m highlightModel) Get(ctx context.Context, userID int64, filter *LocationF
 
 	query := `
 		SELECT 
-		h.id, h.user_id, h.book_id, h.chapter, h.start_verse, h.end_verse, h.start_offset, h.end_offset, h.color, h.created_at, h.updated_at
+		h.id, h.user_id, h.book_id, h.chapter, h.start_verse, h.end_verse, h.start_offset, h.end_offset, h.color, h.palette_id, h.created_at, h.updated_at
 		FROM highlights as h
 		JOIN books as b	ON b.id = h.book_id
 		WHERE h.user_id = $1
@@ -105,6 +146,7 @@ func (m highlightModel) Get(ctx context.Context, userID int64, filter *LocationF
 			&temp.StartOffset,
 			&temp.EndOffset,
 			&temp.Color,
+			&temp.PaletteID,
 			&temp.CreatedAt,
 			&temp.UpdatedAt,
 		)
@@ -122,21 +164,22 @@ func (m highlightModel) Get(ctx context.Context, userID int64, filter *LocationF
 	return highlights, nil
 }
 
-// Update modifies the color of an existing highlight
+// Update modifies the color and palette entry of an existing highlight
 // Returns ErrRecordNotFound if the highlight doesn't exist or doesn't belong to the user
-func (m highlightModel) Update(ctx context.Context, id, userID int64, color string) error {
+func (m highlightModel) Update(ctx context.Context, id, userID int64, color string, paletteID *int64) error {
 	query := `
 		UPDATE 
 			highlights
 		SET 
 			color = $1, 
+			palette_id = $4,
 			updated_at = now()
 		WHERE id = $2 AND user_id = $3`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	res, err := m.db.ExecContext(ctx, query, color, id, userID)
+	res, err := m.db.ExecContext(ctx, query, color, id, userID, paletteID)
 	if err != nil {
 		return err
 	}
@@ -177,3 +220,134 @@ func (m highlightModel) Delete(ctx context.Context, id, userID int64) error {
 
 	return nil
 }
+
+// GetByID retrieves a single highlight of the user
+// Returns ErrRecordNotFound if the highlight doesn't exist or doesn't belong to the user
+func (m highlightModel) GetByID(ctx context.Context, id, userID int64) (*Highlight, error) {
+	query := `
+		SELECT
+			h.id, b.name, h.chapter, COALESCE(h.start_verse, 0), COALESCE(h.end_verse, 0),
+			h.start_offset, h.end_offset, COALESCE(h.color, ''), h.palette_id, h.created_at, h.updated_at
+		FROM
+			highlights AS h
+		JOIN
+			books AS b ON b.id = h.book_id
+		WHERE
+			h.id = $1
+			AND h.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var highlight Highlight
+	err := m.db.QueryRowContext(ctx, query, id, userID).Scan(
+		&highlight.ID,
+		&highlight.Book,
+		&highlight.Chapter,
+		&highlight.StartVerse,
+		&highlight.EndVerse,
+		&highlight.StartOffset,
+		&highlight.EndOffset,
+		&highlight.Color,
+		&highlight.PaletteID,
+		&highlight.CreatedAt,
+		&highlight.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &highlight, nil
+}
+
+// GetAll retrieves a page of the user's highlights matching the filters.
+// The "canonical" sort orders them by book, chapter and verse.
+func (m highlightModel) GetAll(ctx context.Context, userID int64, filter *HighlightFilters) ([]*Highlight, Metadata, error) {
+	args := []any{userID}
+	conditions := []string{"h.user_id = $1"}
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Color != "" {
+		add("LOWER(h.color) = LOWER($%d)", filter.Color)
+	}
+	if filter.Book != "" {
+		add("b.name = $%d", filter.Book)
+	}
+	if filter.From != nil {
+		add("h.created_at >= $%d", *filter.From)
+	}
+	if filter.Until != nil {
+		add("h.created_at < $%d", *filter.Until)
+	}
+
+	orderBy := "b.id, h.chapter, h.start_verse, h.end_verse"
+	if filter.Sort != "canonical" {
+		orderBy = fmt.Sprintf("h.%s %s", filter.sortColumn(), filter.sortDirection())
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			h.id, b.name, h.chapter, COALESCE(h.start_verse, 0), COALESCE(h.end_verse, 0),
+			h.start_offset, h.end_offset, COALESCE(h.color, ''), h.palette_id, h.created_at, h.updated_at
+		FROM
+			highlights AS h
+		JOIN
+			books AS b ON b.id = h.book_id
+		WHERE
+			%s
+		ORDER BY
+			%s, h.id
+		LIMIT $%d
+		OFFSET $%d`, strings.Join(conditions, "\n\t\t\tAND "), orderBy, len(args)+1, len(args)+2)
+
+	args = append(args, filter.limit(), filter.offset())
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	highlights := []*Highlight{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var highlight Highlight
+		err := rows.Scan(
+			&totalRecords,
+			&highlight.ID,
+			&highlight.Book,
+			&highlight.Chapter,
+			&highlight.StartVerse,
+			&highlight.EndVerse,
+			&highlight.StartOffset,
+			&highlight.EndOffset,
+			&highlight.Color,
+			&highlight.PaletteID,
+			&highlight.CreatedAt,
+			&highlight.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		highlights = append(highlights, &highlight)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return highlights, calculateMetadata(totalRecords, filter.Page, filter.PageSize), nil
+}
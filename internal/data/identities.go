@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateIdentity = errors.New("identity already linked")
+
+type IdentityModel interface {
+	GetUser(ctx context.Context, provider, subject string) (*User, error)
+	NewUser(ctx context.Context, user *User, identity *Identity) error
+	Link(ctx context.Context, user *User, identity *Identity) error
+}
+
+// Identity is a user's account at an OpenID Connect provider, Subject identifies it
+// at the provider
+type Identity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type identityModel struct {
+	db DBTX
+}
+
+func NewIdentityModel(db DBTX) IdentityModel {
+	return &identityModel{db}
+}
+
+// GetUser retrieves the user an identity is linked to
+// Returns ErrRecordNotFound if the identity isn't linked
+func (m identityModel) GetUser(ctx context.Context, provider, subject string) (*User, error) {
+	query := `
+		SELECT
+			u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.version, u.preferences
+		FROM
+			identities AS i
+		JOIN
+			users AS u ON u.id = i.user_id
+		WHERE
+			i.provider = $1
+			AND i.subject = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.Preferences,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// NewUser creates a user together with the identity they signed up with
+// Returns ErrDuplicateEmail or ErrDuplicateIdentity if either already exists
+func (m identityModel) NewUser(ctx context.Context, user *User, identity *Identity) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = NewUserModel(tx).Insert(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+
+	err = m.insert(ctx, tx, identity)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Link links an identity to an existing user, saving the changes made to the user
+// along with it
+// Returns ErrEditConflict if the user changed meanwhile, or ErrDuplicateIdentity
+func (m identityModel) Link(ctx context.Context, user *User, identity *Identity) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = NewUserModel(tx).Update(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+
+	err = m.insert(ctx, tx, identity)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m identityModel) insert(ctx context.Context, db DBTX, identity *Identity) error {
+	query := `
+		INSERT INTO identities
+			(user_id, provider, subject, email)
+		VALUES
+			($1, $2, $3, $4)
+		RETURNING
+			id, created_at`
+
+	args := []any{identity.UserID, identity.Provider, identity.Subject, identity.Email}
+
+	err := db.QueryRowContext(ctx, query, args...).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == UniqueViolation {
+			return ErrDuplicateIdentity
+		}
+		return err
+	}
+
+	return nil
+}
@@ -11,6 +11,7 @@ type ImageModel interface {
 	Insert(ctx context.Context, userID int64, input *ImageData) (*ImageData, error)
 	Delete(ctx context.Context, userID int64, noteID int64, s3Key string) error
 	GetForNote(ctx context.Context, noteID int64) ([]*ImageData, error)
+	GetKeysForUser(ctx context.Context, userID int64) ([]string, error)
 }
 
 type ImageData struct {
@@ -158,3 +159,42 @@ func (m imageModel) GetForNote(ctx context.Context, noteID int64) ([]*ImageData,
 
 	return response, nil
 }
+
+// GetKeysForUser retrieves the S3 keys of all images of the user's notes, trashed ones included
+func (m imageModel) GetKeysForUser(ctx context.Context, userID int64) ([]string, error) {
+	query := `
+		SELECT
+			i.s3_key
+		FROM
+			images AS i
+		JOIN
+			notes AS n ON n.id = i.note_id
+		WHERE
+			n.user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
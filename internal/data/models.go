@@ -6,7 +6,10 @@ import (
 	"errors"
 )
 
-const UniqueViolation = "23505"
+const (
+	UniqueViolation     = "23505"
+	ForeignKeyViolation = "23503"
+)
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
@@ -27,24 +30,45 @@ type LocationFilters struct {
 }
 
 type Models struct {
-	Passages   PassageModel
-	Highlights HighlightModel
-	Users      UserModel
-	Tokens     TokenModel
-	Notes      NoteModel
-	NoteImages ImageModel
-	db         *sql.DB
+	Passages    PassageModel
+	Highlights  HighlightModel
+	Users       UserModel
+	Tokens      TokenModel
+	Notes       NoteModel
+	NoteImages  ImageModel
+	NoteLinks   NoteLinkModel
+	Exports     ExportModel
+	Templates   TemplateModel
+	Annotations AnnotationModel
+	Sync        SyncModel
+	Palette     PaletteModel
+	Sessions    SessionModel
+	TwoFactor   TwoFactorModel
+	APIKeys     APIKeyModel
+	Identities  IdentityModel
+	db          *sql.DB
+	tx          *sql.Tx
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Passages:   NewPassageModel(db),
-		Highlights: NewHighlightModel(db),
-		Users:      NewUserModel(db),
-		Tokens:     NewTokenModel(db),
-		Notes:      NewNoteModel(db),
-		NoteImages: NewImageModel(db),
-		db:         db,
+		Passages:    NewPassageModel(db),
+		Highlights:  NewHighlightModel(db),
+		Users:       NewUserModel(db),
+		Tokens:      NewTokenModel(db),
+		Notes:       NewNoteModel(db),
+		NoteImages:  NewImageModel(db),
+		NoteLinks:   NewNoteLinkModel(db),
+		Exports:     NewExportModel(db),
+		Templates:   NewTemplateModel(db),
+		Annotations: NewAnnotationModel(db),
+		Sync:        NewSyncModel(db),
+		Palette:     NewPaletteModel(db),
+		Sessions:    NewSessionModel(db),
+		TwoFactor:   NewTwoFactorModel(db),
+		APIKeys:     NewAPIKeyModel(db),
+		Identities:  NewIdentityModel(db),
+		db:          db,
 	}
 }
 
@@ -56,8 +80,11 @@ func (m Models) WithTx(ctx context.Context, fn func(Models) error) error {
 	defer tx.Rollback()
 
 	txModels := Models{
-		Users:  NewUserModel(tx),
-		Tokens: NewTokenModel(tx),
+		Users:      NewUserModel(tx),
+		Tokens:     NewTokenModel(tx),
+		Highlights: NewHighlightModel(tx),
+		Notes:      NewNoteModel(tx),
+		tx:         tx,
 	}
 
 	err = fn(txModels)
@@ -67,3 +94,69 @@ func (m Models) WithTx(ctx context.Context, fn func(Models) error) error {
 
 	return tx.Commit()
 }
+
+// Savepoint runs fn in a savepoint of the transaction started by WithTx, if fn fails
+// only its changes are rolled back and the transaction can go on.
+// Outside a transaction fn runs as is.
+func (m Models) Savepoint(ctx context.Context, fn func() error) error {
+	if m.tx == nil {
+		return fn()
+	}
+
+	return savepoint(ctx, m.tx, fn)
+}
+
+// savepoint runs fn in a savepoint of the transaction tx, if fn fails only its changes
+// are rolled back and the transaction can go on
+func savepoint(ctx context.Context, tx DBTX, fn func() error) error {
+	_, err := tx.ExecContext(ctx, "SAVEPOINT item")
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		_, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT item")
+		return errors.Join(err, rollbackErr)
+	}
+
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT item")
+	return err
+}
+
+// txScope is a transaction a model method started itself, or the caller's transaction
+// it joined, which the caller commits or rolls back.
+type txScope struct {
+	DBTX
+	tx *sql.Tx
+}
+
+// beginTx starts a transaction on db, or joins it if db already is a transaction
+// (models built by WithTx)
+func beginTx(ctx context.Context, db DBTX) (*txScope, error) {
+	conn, ok := db.(*sql.DB)
+	if !ok {
+		return &txScope{DBTX: db}, nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &txScope{DBTX: tx, tx: tx}, nil
+}
+
+func (t *txScope) Commit() error {
+	if t.tx == nil {
+		return nil
+	}
+	return t.tx.Commit()
+}
+
+func (t *txScope) Rollback() error {
+	if t.tx == nil {
+		return nil
+	}
+	return t.tx.Rollback()
+}
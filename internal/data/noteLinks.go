@@ -0,0 +1,317 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type NoteLinkModel interface {
+	Replace(ctx context.Context, userID, sourceNoteID int64, links []*NoteLinkInput) error
+	ResolveDangling(ctx context.Context, userID, noteID int64, title string) error
+	GetTitleLinking(ctx context.Context, userID, targetNoteID int64) ([]*NoteContent, error)
+	GetBacklinks(ctx context.Context, userID, noteID int64) ([]*NoteMetadata, error)
+	GetForNote(ctx context.Context, userID, noteID int64) ([]*NoteLink, error)
+	GetDangling(ctx context.Context, userID int64) ([]*NoteLink, error)
+}
+
+// NoteLinkInput is a link parsed from note content.
+// TargetNoteID is set for [[note:123]] links, TargetTitle for [[Note Title]] links.
+type NoteLinkInput struct {
+	Raw          string
+	TargetNoteID int64
+	TargetTitle  string
+}
+
+// LinkRewriteFailure is a note whose [[Title]] links couldn't be rewritten after the
+// linked note was renamed, its content is unchanged and the links are left dangling
+type LinkRewriteFailure struct {
+	NoteID int64  `json:"note_id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Error  string `json:"error"`
+}
+
+type NoteLink struct {
+	ID           int64  `json:"id"`
+	SourceNoteID int64  `json:"source_note_id"`
+	SourceTitle  string `json:"source_title,omitempty"`
+	TargetNoteID *int64 `json:"target_note_id"`
+	Raw          string `json:"link"`
+	Dangling     bool   `json:"dangling"`
+}
+
+type noteLinkModel struct {
+	db *sql.DB
+}
+
+func NewNoteLinkModel(db *sql.DB) NoteLinkModel {
+	return &noteLinkModel{db}
+}
+
+// Replace rebuilds the outgoing links of a note in a single transaction.
+// Each link is resolved against the user's notes at insert time; unresolved links
+// are stored with a NULL target so they can be reported as dangling.
+// Returns ErrRecordNotFound if the source note doesn't exist or doesn't belong to the user.
+func (m noteLinkModel) Replace(ctx context.Context, userID, sourceNoteID int64, links []*NoteLinkInput) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := `
+		DELETE FROM
+			note_links
+		WHERE
+			source_note_id = $1
+			AND user_id = $2`
+
+	_, err = tx.ExecContext(ctx, deleteQuery, sourceNoteID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Selecting from notes verifies the source note belongs to the user.
+	// The target is looked up by id for [[note:123]] links and by the
+	// case-insensitive GENERAL title for [[Note Title]] links.
+	insertQuery := `
+		INSERT INTO note_links
+			(user_id, source_note_id, target_note_id, target_title, raw)
+		SELECT
+			s.user_id,
+			s.id,
+			(
+				SELECT t.id
+				FROM notes t
+				WHERE t.user_id = s.user_id
+					AND t.deleted_at IS NULL
+					AND (
+						($3 > 0 AND t.id = $3)
+						OR ($3 = 0 AND t.note_type = 'GENERAL' AND LOWER(t.title) = LOWER($4))
+					)
+				LIMIT 1
+			),
+			NULLIF($4, ''),
+			$5
+		FROM
+			notes s
+		WHERE
+			s.id = $2
+			AND s.user_id = $1`
+
+	for _, link := range links {
+		result, err := tx.ExecContext(ctx, insertQuery, userID, sourceNoteID,
+			link.TargetNoteID, link.TargetTitle, link.Raw)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ResolveDangling points dangling [[Title]] links at a GENERAL note that now
+// carries that title (after create or rename).
+func (m noteLinkModel) ResolveDangling(ctx context.Context, userID, noteID int64, title string) error {
+	query := `
+		UPDATE
+			note_links
+		SET
+			target_note_id = $2
+		WHERE
+			user_id = $1
+			AND target_note_id IS NULL
+			AND LOWER(target_title) = LOWER($3)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.db.ExecContext(ctx, query, userID, noteID, title)
+	return err
+}
+
+// GetTitleLinking retrieves the notes linking to targetNoteID by title, which have to
+// be rewritten when the target's title changes.
+// Returns an empty slice if no note links to it by title.
+func (m noteLinkModel) GetTitleLinking(ctx context.Context, userID, targetNoteID int64) ([]*NoteContent, error) {
+	query := `
+		SELECT
+			n.id, COALESCE(n.title, ''), n.content, n.note_type
+		FROM
+			notes n
+		WHERE
+			n.user_id = $1
+			AND n.deleted_at IS NULL
+			AND n.id IN (
+				SELECT source_note_id
+				FROM note_links
+				WHERE target_note_id = $2
+					AND user_id = $1
+					AND target_title IS NOT NULL
+			)
+		ORDER BY
+			n.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID, targetNoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*NoteContent{}
+	for rows.Next() {
+		note := NoteContent{UserID: userID}
+		err := rows.Scan(&note.ID, &note.Title, &note.Content, &note.NoteType)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, &note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// GetBacklinks retrieves metadata of the notes linking to noteID.
+// Returns an empty slice if no note links to it.
+func (m noteLinkModel) GetBacklinks(ctx context.Context, userID, noteID int64) ([]*NoteMetadata, error) {
+	query := `
+		SELECT DISTINCT
+			n.id, COALESCE(n.title, ''),
+			SUBSTRING(n.content, 1, 200) AS preview,
+			n.note_type, n.created_at, n.updated_at
+		FROM
+			note_links l
+		JOIN
+			notes n ON n.id = l.source_note_id
+		WHERE
+			l.target_note_id = $1
+			AND l.user_id = $2
+			AND n.user_id = $2
+			AND n.deleted_at IS NULL
+		ORDER BY
+			n.updated_at DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backlinks := []*NoteMetadata{}
+
+	for rows.Next() {
+		var metadata NoteMetadata
+		err := rows.Scan(
+			&metadata.ID,
+			&metadata.Title,
+			&metadata.Preview,
+			&metadata.NoteType,
+			&metadata.CreatedAt,
+			&metadata.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		backlinks = append(backlinks, &metadata)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return backlinks, nil
+}
+
+// GetForNote retrieves the outgoing links of a note, dangling ones included.
+func (m noteLinkModel) GetForNote(ctx context.Context, userID, noteID int64) ([]*NoteLink, error) {
+	query := `
+		SELECT
+			l.id, l.source_note_id, '', l.target_note_id, l.raw
+		FROM
+			note_links l
+		WHERE
+			l.source_note_id = $1
+			AND l.user_id = $2
+		ORDER BY
+			l.id`
+
+	return m.queryLinks(ctx, query, noteID, userID)
+}
+
+// GetDangling retrieves every link of the user that doesn't resolve to a note.
+func (m noteLinkModel) GetDangling(ctx context.Context, userID int64) ([]*NoteLink, error) {
+	query := `
+		SELECT
+			l.id, l.source_note_id, COALESCE(n.title, ''), l.target_note_id, l.raw
+		FROM
+			note_links l
+		JOIN
+			notes n ON n.id = l.source_note_id
+		WHERE
+			l.user_id = $1
+			AND l.target_note_id IS NULL
+			AND n.deleted_at IS NULL
+		ORDER BY
+			l.source_note_id, l.id`
+
+	return m.queryLinks(ctx, query, userID)
+}
+
+func (m noteLinkModel) queryLinks(ctx context.Context, query string, args ...any) ([]*NoteLink, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*NoteLink{}
+
+	for rows.Next() {
+		var link NoteLink
+		err := rows.Scan(
+			&link.ID,
+			&link.SourceNoteID,
+			&link.SourceTitle,
+			&link.TargetNoteID,
+			&link.Raw,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		link.Dangling = link.TargetNoteID == nil
+		links = append(links, &link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
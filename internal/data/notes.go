@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -23,18 +24,24 @@ var ErrLocationAlreadyLinked = errors.New("this note already linked to this loca
 var ErrDuplicateContent = errors.New("a note with this content already exists")
 
 type NoteModel interface {
-	GetAllLocatedForChapter(ctx context.Context, userID int64, filter *LocationFilters) ([]*NoteResponse, []*NoteResponse, error)
+	GetAllLocatedForChapter(ctx context.Context, userID int64, filter *LocationFilters) ([]*NoteResponse, []*NoteResponse, []*NoteResponse, error)
 	Get(ctx context.Context, userID int64, id int64) (*NoteResponse, error)
 	GetAllMetadata(ctx context.Context, userID int64, filter *NoteQueryParams) ([]*NoteMetadata, error)
-	InsertLocated(ctx context.Context, content *NoteContent, location *NoteLocation) (*NoteResponse, error)
+	InsertLocated(ctx context.Context, content *NoteContent, location *NoteLocation, target *NoteLocation) (*NoteResponse, error)
 	InsertGeneral(ctx context.Context, note *NoteContent) (*NoteResponse, error)
 	ExistsForUser(ctx context.Context, id int64, userID int64) (bool, error)
 	Delete(ctx context.Context, id int64, userID int64) error
+	Trash(ctx context.Context, id int64, userID int64) error
+	Restore(ctx context.Context, id int64, userID int64) (*NoteResponse, error)
+	GetTrash(ctx context.Context, userID int64, filter *Filters) ([]*TrashedNote, Metadata, error)
+	GetTrashedBefore(ctx context.Context, before time.Time, limit int) ([]*TrashedNote, error)
 	Update(ctx context.Context, content *NoteContent) (*NoteResponse, error)
 
 	DeleteLink(ctx context.Context, note_id, location_id, userID int64) error
 	Link(ctx context.Context, input *NoteInputLocation) (*NoteResponse, error)
-	SearchNotes(ctx context.Context, userID int64, word string, filter *Filters) ([]*NoteSearchResponse, Metadata, error)
+	ReplaceDerivedLocations(ctx context.Context, noteID, userID int64, locations []*NoteLocation) ([]*NoteLocation, error)
+	SearchNotes(ctx context.Context, userID int64, filter *NoteSearchFilters) ([]*NoteSearchResponse, Metadata, error)
+	SearchFacets(ctx context.Context, userID int64, filter *NoteSearchFilters) (*NoteSearchFacets, error)
 }
 
 type NoteContent struct {
@@ -56,6 +63,7 @@ type NoteLocation struct {
 	EndVerse    int
 	StartOffset int
 	EndOffset   int
+	Derived     bool
 }
 
 type NoteMetadata struct {
@@ -67,6 +75,12 @@ type NoteMetadata struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+type TrashedNote struct {
+	NoteMetadata
+	UserID    int64     `json:"-"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
 type NoteInputLocation struct {
 	NoteID      int64
 	UserID      int64
@@ -86,6 +100,7 @@ type LocationResponse struct {
 	EndVerse    int    `json:"end_verse"`
 	StartOffset int    `json:"start_offset"`
 	EndOffset   int    `json:"end_offset"`
+	Derived     bool   `json:"derived"`
 }
 
 // Use NoteContent in field?
@@ -99,6 +114,15 @@ type NoteResponse struct {
 	UpdatedAt time.Time `json:"updated_at"`
 
 	Location *LocationResponse `json:"location,omitempty"`
+
+	// CROSS_REFERENCE notes only: the referenced range, and whether the note was
+	// found by its location ("outgoing") or by its target ("incoming")
+	Target    *LocationResponse `json:"target,omitempty"`
+	Direction string            `json:"direction,omitempty"`
+
+	// GENERAL notes only: the notes whose links to this note couldn't be rewritten
+	// after its title changed
+	UnrewrittenLinks []*LinkRewriteFailure `json:"unrewritten_links,omitempty"`
 }
 
 type NoteSearchResponse struct {
@@ -112,10 +136,10 @@ type NoteQueryParams struct {
 	NoteType string
 }
 type noteModel struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewNoteModel(db *sql.DB) NoteModel {
+func NewNoteModel(db DBTX) NoteModel {
 	return &noteModel{db}
 }
 
@@ -125,9 +149,11 @@ func hashContent(content string) string {
 }
 
 // GetAllLocatedForChapter retrieves all notes (BIBLE and CROSS_REFERENCE)
-// associated with a specific chapter and verse range for a given user.
+// associated with a specific chapter and verse range for a given user, along with
+// GENERAL notes whose content references the range (derived locations).
 // It ensures users have access to their own notes by filtering on both the note ID and userID.
 // This prevents unauthorized access to notes belonging to other users.
+// A StartVerse of -1 selects the whole chapter.
 //
 // Parameters:
 //
@@ -137,55 +163,127 @@ func hashContent(content string) string {
 // Returns:
 //   - *NoteResponse: The retrieved Bible notes if found
 //   - *NoteResponse: The retrieved Cross-reference note if found
+//   - *NoteResponse: The retrieved GENERAL notes referencing the range if found
 //   - error: Any database error that occured.
-func (m noteModel) GetAllLocatedForChapter(ctx context.Context, userID int64, filter *LocationFilters) ([]*NoteResponse, []*NoteResponse, error) {
+func (m noteModel) GetAllLocatedForChapter(ctx context.Context, userID int64, filter *LocationFilters) ([]*NoteResponse, []*NoteResponse, []*NoteResponse, error) {
 	// SQL query to join notes, their locations, and the book name.
 	// It selects notes that overlap with the requested verse range.
+	// GENERAL notes are only included through derived locations; their content
+	// is left out like BIBLE notes, the client fetches the full note on demand.
+	// CROSS_REFERENCE notes are also selected by their target, anchored at
+	// their first user-linked location, so both ends surface the link.
 	query := `
 		SELECT
 			n.id, 
 			n.user_id, 
-			n.title, 
+			COALESCE(n.title, ''), 
 			CASE
 				WHEN n.note_type = 'CROSS_REFERENCE' THEN n.content
 				ELSE ''	
 			END AS content, 
 			n.note_type,
 			n.created_at, 
+			nl.id,
 			b.name, 
 			nl.chapter, 
 			nl.start_verse, 
 			nl.end_verse, 
-			nl.start_offset, 
-			nl.end_offset
+			COALESCE(nl.start_offset, 0), 
+			COALESCE(nl.end_offset, 0),
+			nl.derived,
+			'outgoing' AS direction,
+			tb.name,
+			xr.chapter,
+			xr.start_verse,
+			xr.end_verse
 		FROM 
 			notes AS n
 		JOIN 
 			note_locations AS  nl ON n.id = nl.note_id
 		JOIN 
 			books AS b ON nl.book_id = b.id
+		LEFT JOIN
+			note_cross_references AS xr ON xr.note_id = n.id
+		LEFT JOIN
+			books AS tb ON xr.book_id = tb.id
 		WHERE 
 			n.user_id = $1
+			AND n.deleted_at IS NULL
 			AND b.name = $2
 			AND nl.chapter = $3
-			AND nl.start_verse <= $5
-			AND nl.end_verse >= $4
-			AND n.note_type IN ('CROSS_REFERENCE', 'BIBLE')`
+			AND ($4 = -1 OR (nl.start_verse <= $5 AND nl.end_verse >= $4))
+			AND (
+				n.note_type IN ('CROSS_REFERENCE', 'BIBLE')
+				OR (n.note_type = 'GENERAL' AND nl.derived)
+			)
+
+		UNION ALL
+
+		SELECT
+			n.id,
+			n.user_id,
+			COALESCE(n.title, ''),
+			n.content,
+			n.note_type,
+			n.created_at,
+			nl.id,
+			b.name,
+			nl.chapter,
+			nl.start_verse,
+			nl.end_verse,
+			COALESCE(nl.start_offset, 0),
+			COALESCE(nl.end_offset, 0),
+			nl.derived,
+			'incoming',
+			tb.name,
+			xr.chapter,
+			xr.start_verse,
+			xr.end_verse
+		FROM
+			note_cross_references AS xr
+		JOIN
+			books AS tb ON xr.book_id = tb.id
+		JOIN
+			notes AS n ON n.id = xr.note_id
+		JOIN LATERAL (
+			SELECT
+				*
+			FROM
+				note_locations
+			WHERE
+				note_id = n.id
+				AND NOT derived
+			ORDER BY
+				id
+			LIMIT 1
+		) AS nl ON TRUE
+		JOIN
+			books AS b ON nl.book_id = b.id
+		WHERE
+			n.user_id = $1
+			AND n.deleted_at IS NULL
+			AND n.note_type = 'CROSS_REFERENCE'
+			AND tb.name = $2
+			AND xr.chapter = $3
+			AND ($4 = -1 OR (xr.start_verse <= $5 AND xr.end_verse >= $4))`
 
 	args := []any{userID, filter.Book, filter.Chapter, filter.StartVerse, filter.EndVerse}
 
 	rows, err := m.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	defer rows.Close()
 
 	BibleNotes := []*NoteResponse{}
 	CrossRefNotes := []*NoteResponse{}
+	ReferencingNotes := []*NoteResponse{}
 
 	for rows.Next() {
 		var content NoteContent
 		var location NoteLocation
+		var direction string
+		var target nullableLocation
 		err := rows.Scan(
 			&content.ID,
 			&content.UserID,
@@ -193,16 +291,23 @@ func (m noteModel) GetAllLocatedForChapter(ctx context.Context, userID int64, fi
 			&content.Content,
 			&content.NoteType,
 			&content.CreatedAt,
+			&location.ID,
 			&location.Book,
 			&location.Chapter,
 			&location.StartVerse,
 			&location.EndVerse,
 			&location.StartOffset,
 			&location.EndOffset,
+			&location.Derived,
+			&direction,
+			&target.Book,
+			&target.Chapter,
+			&target.StartVerse,
+			&target.EndVerse,
 		)
 
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 
 		locatedNote := &NoteResponse{
@@ -214,26 +319,55 @@ func (m noteModel) GetAllLocatedForChapter(ctx context.Context, userID int64, fi
 		}
 
 		locatedNote.Location = &LocationResponse{
+			ID:          location.ID,
 			Book:        location.Book,
 			Chapter:     location.Chapter,
 			StartVerse:  location.StartVerse,
 			EndVerse:    location.EndVerse,
 			StartOffset: location.StartOffset,
 			EndOffset:   location.EndOffset,
+			Derived:     location.Derived,
 		}
 
-		if locatedNote.NoteType == "BIBLE" {
+		switch locatedNote.NoteType {
+		case NoteTypeBible:
 			BibleNotes = append(BibleNotes, locatedNote)
-		} else {
+		case NoteTypeGeneral:
+			ReferencingNotes = append(ReferencingNotes, locatedNote)
+		default:
+			locatedNote.Direction = direction
+			locatedNote.Target = target.response()
 			CrossRefNotes = append(CrossRefNotes, locatedNote)
 		}
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	return BibleNotes, CrossRefNotes, nil
+	return BibleNotes, CrossRefNotes, ReferencingNotes, nil
+}
+
+// nullableLocation scans the target of a CROSS_REFERENCE note from a LEFT JOIN
+type nullableLocation struct {
+	Book       sql.NullString
+	Chapter    sql.NullInt64
+	StartVerse sql.NullInt64
+	EndVerse   sql.NullInt64
+}
+
+// response returns nil for notes without a structured target
+func (l nullableLocation) response() *LocationResponse {
+	if !l.Book.Valid {
+		return nil
+	}
+
+	return &LocationResponse{
+		Book:       l.Book.String,
+		Chapter:    int(l.Chapter.Int64),
+		StartVerse: int(l.StartVerse.Int64),
+		EndVerse:   int(l.EndVerse.Int64),
+	}
 }
 
 // Get retrieves a single note by its ID for a specific user.
@@ -252,17 +386,24 @@ func (m noteModel) GetAllLocatedForChapter(ctx context.Context, userID int64, fi
 func (m noteModel) Get(ctx context.Context, userID int64, id int64) (*NoteResponse, error) {
 	query := `
 		SELECT 
-			id, user_id, title, content, note_type, created_at, updated_at
+			notes.id, notes.user_id, notes.title, notes.content, notes.note_type, notes.created_at, notes.updated_at,
+			tb.name, xr.chapter, xr.start_verse, xr.end_verse
 		FROM 
 			notes
+		LEFT JOIN
+			note_cross_references AS xr ON xr.note_id = notes.id
+		LEFT JOIN
+			books AS tb ON xr.book_id = tb.id
 		WHERE 
 			notes.id = $1 
-			AND notes.user_id = $2`
+			AND notes.user_id = $2
+			AND notes.deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var note NoteResponse
+	var target nullableLocation
 
 	err := m.db.QueryRowContext(ctx, query, id, userID).Scan(
 		&note.ID,
@@ -272,6 +413,10 @@ func (m noteModel) Get(ctx context.Context, userID int64, id int64) (*NoteRespon
 		&note.NoteType,
 		&note.CreatedAt,
 		&note.UpdatedAt,
+		&target.Book,
+		&target.Chapter,
+		&target.StartVerse,
+		&target.EndVerse,
 	)
 
 	if err != nil {
@@ -283,6 +428,8 @@ func (m noteModel) Get(ctx context.Context, userID int64, id int64) (*NoteRespon
 		}
 	}
 
+	note.Target = target.response()
+
 	return &note, nil
 }
 
@@ -308,6 +455,7 @@ func (m noteModel) GetAllMetadata(ctx context.Context, userID int64, filter *Not
 		WHERE
 			user_id = $1
 			AND note_type = $2
+			AND deleted_at IS NULL
 		ORDER BY
 			%s %s	
 		LIMIT $3
@@ -373,6 +521,7 @@ func (m noteModel) Update(ctx context.Context, content *NoteContent) (*NoteRespo
 			id = $1 
 			AND	user_id = $2
 			AND note_type = $7
+			AND deleted_at IS NULL
 		RETURNING
 			id, title, content, note_type, created_at, updated_at`
 
@@ -433,7 +582,9 @@ func (m noteModel) Update(ctx context.Context, content *NoteContent) (*NoteRespo
 	return &responseNote, nil
 }
 
-func (m noteModel) InsertLocated(ctx context.Context, content *NoteContent, location *NoteLocation) (*NoteResponse, error) {
+// InsertLocated inserts a BIBLE or CROSS_REFERENCE note anchored at location.
+// target is the referenced range of a CROSS_REFERENCE note, nil for BIBLE notes.
+func (m noteModel) InsertLocated(ctx context.Context, content *NoteContent, location *NoteLocation, target *NoteLocation) (*NoteResponse, error) {
 	// BIBLE/CROSS_REFERENCE notes:
 	//   - Must hash content to prevent duplicate annotations on same verse
 	//   - Content must be unique (prevent spam/abuse)
@@ -463,6 +614,16 @@ func (m noteModel) InsertLocated(ctx context.Context, content *NoteContent, loca
 		FROM note_inserted n
 		CROSS JOIN book_lookup b 
 		RETURNING * 
+		),
+		target_inserted AS(
+			INSERT INTO note_cross_references
+			(note_id, book_id, chapter, start_verse, end_verse)
+		SELECT
+			n.note_id,
+			b.id,
+			$13, $14, $15
+		FROM note_inserted n
+		JOIN books b ON b.name = $12
 		)
 		SELECT 
 			n.note_id,
@@ -471,7 +632,7 @@ func (m noteModel) InsertLocated(ctx context.Context, content *NoteContent, loca
 			n.note_type,
 			n.created_at, 
 			n.updated_at,
-			$8 AS book,
+			$6 AS book,
 			l.chapter,
 			l.start_verse,
 			l.end_verse,
@@ -485,8 +646,17 @@ func (m noteModel) InsertLocated(ctx context.Context, content *NoteContent, loca
 	var responseNote NoteResponse
 	responseNote.Location = &LocationResponse{}
 
+	// A NULL target book matches no book, so no target row is inserted
+	var targetBook *string
+	var targetChapter, targetStartVerse, targetEndVerse int
+	if target != nil {
+		targetBook = &target.Book
+		targetChapter, targetStartVerse, targetEndVerse = target.Chapter, target.StartVerse, target.EndVerse
+	}
+
 	insertArgs := []any{content.UserID, content.Title, content.Content, contentHash, content.NoteType,
-		location.Book, location.Chapter, location.StartVerse, location.EndVerse, location.StartOffset, location.EndOffset}
+		location.Book, location.Chapter, location.StartVerse, location.EndVerse, location.StartOffset, location.EndOffset,
+		targetBook, targetChapter, targetStartVerse, targetEndVerse}
 
 	ctx, cancel := context.WithTimeout(ctx, 6*time.Second)
 	defer cancel()
@@ -506,6 +676,15 @@ func (m noteModel) InsertLocated(ctx context.Context, content *NoteContent, loca
 		return nil, err
 	}
 
+	if target != nil {
+		responseNote.Target = &LocationResponse{
+			Book:       target.Book,
+			Chapter:    target.Chapter,
+			StartVerse: target.StartVerse,
+			EndVerse:   target.EndVerse,
+		}
+	}
+
 	return &responseNote, nil
 }
 
@@ -565,6 +744,7 @@ func (m noteModel) ExistsForUser(ctx context.Context, id int64, userID int64) (b
 			WHERE 
 				id = $1
 				AND user_id = $2	
+				AND deleted_at IS NULL
 			)
 		`
 
@@ -602,6 +782,197 @@ func (m noteModel) Delete(ctx context.Context, id int64, userID int64) error {
 	return nil
 }
 
+// Trash moves a note to the trash. Trashed notes are hidden from every read
+// except GetTrash until they are restored or purged.
+// Returns ErrRecordNotFound if the note doesn't exist, doesn't belong to the user or is already trashed.
+func (m noteModel) Trash(ctx context.Context, id int64, userID int64) error {
+	query := `
+		UPDATE
+			notes
+		SET
+			deleted_at = NOW()
+		WHERE
+			id = $1
+			AND user_id = $2
+			AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Restore takes a note out of the trash.
+// Returns ErrRecordNotFound if the note isn't in the user's trash, or
+// ErrDuplicateTitleGeneral/ErrDuplicateContent if a note created since takes its place.
+func (m noteModel) Restore(ctx context.Context, id int64, userID int64) (*NoteResponse, error) {
+	query := `
+		UPDATE
+			notes
+		SET
+			deleted_at = NULL
+		WHERE
+			id = $1
+			AND user_id = $2
+			AND deleted_at IS NOT NULL
+		RETURNING
+			id, COALESCE(title, ''), content, note_type, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var note NoteResponse
+
+	err := m.db.QueryRowContext(ctx, query, id, userID).Scan(
+		&note.ID,
+		&note.Title,
+		&note.Content,
+		&note.NoteType,
+		&note.CreatedAt,
+		&note.UpdatedAt,
+	)
+
+	if err != nil {
+		var pgErr *pq.Error
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == UniqueViolation:
+			if pgErr.Constraint == "idx_general_notes_user_title" {
+				return nil, ErrDuplicateTitleGeneral
+			}
+			return nil, ErrDuplicateContent
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &note, nil
+}
+
+// GetTrash retrieves the user's trashed notes, most recently deleted first.
+// Returns an empty slice if the trash is empty.
+func (m noteModel) GetTrash(ctx context.Context, userID int64, filter *Filters) ([]*TrashedNote, Metadata, error) {
+	query := `
+		SELECT
+			COUNT(*) OVER(),
+			id, user_id, COALESCE(title, ''),
+			SUBSTRING(content, 1, 200) AS preview,
+			note_type, created_at, updated_at, deleted_at
+		FROM
+			notes
+		WHERE
+			user_id = $1
+			AND deleted_at IS NOT NULL
+		ORDER BY
+			deleted_at DESC, id DESC
+		LIMIT $2
+		OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID, filter.limit(), filter.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	notes := []*TrashedNote{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var note TrashedNote
+		err := rows.Scan(
+			&totalRecords,
+			&note.ID,
+			&note.UserID,
+			&note.Title,
+			&note.Preview,
+			&note.NoteType,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+			&note.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		notes = append(notes, &note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return notes, calculateMetadata(totalRecords, filter.Page, filter.PageSize), nil
+}
+
+// GetTrashedBefore retrieves up to limit notes of any user trashed before the given time,
+// oldest first, for the purge job.
+func (m noteModel) GetTrashedBefore(ctx context.Context, before time.Time, limit int) ([]*TrashedNote, error) {
+	query := `
+		SELECT
+			id, user_id, COALESCE(title, ''), note_type, created_at, updated_at, deleted_at
+		FROM
+			notes
+		WHERE
+			deleted_at IS NOT NULL
+			AND deleted_at < $1
+		ORDER BY
+			deleted_at
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*TrashedNote{}
+
+	for rows.Next() {
+		var note TrashedNote
+		err := rows.Scan(
+			&note.ID,
+			&note.UserID,
+			&note.Title,
+			&note.NoteType,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+			&note.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, &note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
 // Link creates a new location link for an existing note at the specified Bible verse location.
 // It validates that the note belongs to the user before creating the link.
 // Returns the note ID and the created location details.
@@ -623,8 +994,9 @@ func (m noteModel) Link(ctx context.Context, input *NoteInputLocation) (*NoteRes
 			WHERE
 				n.id = $1 
 				AND n.user_id = $2
+				AND n.deleted_at IS NULL
 			RETURNING 
-				note_id, $3, chapter, start_verse, end_verse, start_offset, end_offset
+				note_id, $3, id, chapter, start_verse, end_verse, start_offset, end_offset
 	`
 
 	args := []any{input.NoteID, input.UserID, input.Book, input.Chapter, input.StartVerse,
@@ -648,10 +1020,13 @@ func (m noteModel) Link(ctx context.Context, input *NoteInputLocation) (*NoteRes
 	)
 
 	if err != nil {
+		var pgErr *pq.Error
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			// Either note doesn't exist, doesn't belong to user, or book name is invalid
 			return nil, ErrRecordNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == UniqueViolation:
+			return nil, ErrLocationAlreadyLinked
 		default:
 			return nil, err
 		}
@@ -660,6 +1035,97 @@ func (m noteModel) Link(ctx context.Context, input *NoteInputLocation) (*NoteRes
 	return &responseNote, nil
 }
 
+// ReplaceDerivedLocations rebuilds the derived locations of a note in a single transaction.
+// User-linked locations (created through Link) are left untouched. A location that
+// can't be stored, e.g. one naming an unknown book, is skipped without losing the others.
+// Returns the skipped locations, and ErrRecordNotFound if the note doesn't exist or
+// doesn't belong to the user.
+func (m noteModel) ReplaceDerivedLocations(ctx context.Context, noteID, userID int64, locations []*NoteLocation) ([]*NoteLocation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the note first, this verifies ownership before anything is changed
+	ownerQuery := `
+		SELECT 
+			id
+		FROM 
+			notes
+		WHERE 
+			id = $1
+			AND user_id = $2
+		FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, ownerQuery, noteID, userID).Scan(&noteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	deleteQuery := `
+		DELETE FROM 
+			note_locations
+		WHERE 
+			note_id = $1
+			AND derived`
+
+	_, err = tx.ExecContext(ctx, deleteQuery, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	insertQuery := `
+		INSERT INTO note_locations (
+			note_id, book_id, chapter, start_verse,
+			end_verse, start_offset, end_offset, derived
+		)
+		SELECT 
+			$1, b.id, $3, $4, $5, 0, 0, true
+		FROM
+			books b
+		WHERE
+			b.name = $2`
+
+	skipped := []*NoteLocation{}
+
+	for _, location := range locations {
+		// Each location in its own savepoint, so a failed insert doesn't abort the others
+		err := savepoint(ctx, tx, func() error {
+			result, err := tx.ExecContext(ctx, insertQuery, noteID,
+				location.Book, location.Chapter, location.StartVerse, location.EndVerse)
+			if err != nil {
+				return err
+			}
+
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			if rowsAffected == 0 {
+				return ErrRecordNotFound
+			}
+
+			return nil
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			skipped = append(skipped, location)
+		}
+	}
+
+	return skipped, tx.Commit()
+}
+
 // DeleteLink removes a location link from a note.
 // Validates that the location belongs to the specified note and that the note belongs to the user.
 // Returns ErrRecordNotFound if the location doesn't exist or doesn't belong to the user's note.
@@ -699,38 +1165,103 @@ func (m noteModel) DeleteLink(ctx context.Context, note_id, location_id, userID
 	return nil
 }
 
+// NoteSearchFilters narrows a full-text note search.
+// Sort is "relevance" or one of created_at/updated_at, prefixed with "-" for descending.
+type NoteSearchFilters struct {
+	Filters
+	Query    string
+	NoteType string
+	Book     string     // notes located in the book, derived locations included
+	From     *time.Time // created at or after
+	Until    *time.Time // created before
+	Tag      string     // #tag written in the content
+}
+
+// NoteSearchFacets counts the notes matching a search by note type and by book.
+// Each count ignores the filter on its own dimension, so clients can show the alternatives.
+type NoteSearchFacets struct {
+	NoteTypes map[string]int `json:"note_types"`
+	Books     map[string]int `json:"books"`
+}
+
+// noteSearchConditions builds the WHERE clause shared by the search and its facets.
+// The filters on note type and book can be left out for their facet.
+func noteSearchConditions(userID int64, filter *NoteSearchFilters, withType, withBook bool) (string, []any) {
+	args := []any{userID, filter.Query}
+	conditions := []string{
+		"n.user_id = $1",
+		"n.deleted_at IS NULL",
+		"n.note_vector @@ websearch_to_tsquery('english', $2)",
+	}
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if withType && filter.NoteType != "" {
+		add("n.note_type = $%d", filter.NoteType)
+	}
+	if withBook && filter.Book != "" {
+		add(`EXISTS (
+				SELECT 1 FROM note_locations nl JOIN books b ON b.id = nl.book_id
+				WHERE nl.note_id = n.id AND b.name = $%d
+			)`, filter.Book)
+	}
+	if filter.From != nil {
+		add("n.created_at >= $%d", *filter.From)
+	}
+	if filter.Until != nil {
+		add("n.created_at < $%d", *filter.Until)
+	}
+	if filter.Tag != "" {
+		// Tags are validated as word characters, so they are safe inside the pattern
+		add(`n.content ~* ('(^|\s)#' || $%d || '\M')`, filter.Tag)
+	}
+
+	return strings.Join(conditions, "\n\t\t\tAND "), args
+}
+
 // SearchNotes performs full-text search on user's notes using PostgreSQL's ts_rank and ts_headline.
-// Returns notes ordered by relevance with highlighted snippets showing matched terms.
+// Returns notes ordered by relevance (or date) with highlighted snippets showing matched terms.
 // The snippet contains 10-20 words with matched terms wrapped in <mark> tags.
-func (m noteModel) SearchNotes(ctx context.Context, userID int64, searchQuery string, filter *Filters) ([]*NoteSearchResponse, Metadata, error) {
-	query := `
+func (m noteModel) SearchNotes(ctx context.Context, userID int64, filter *NoteSearchFilters) ([]*NoteSearchResponse, Metadata, error) {
+	orderBy := "rank DESC"
+	if filter.Sort != "relevance" {
+		orderBy = fmt.Sprintf("%s %s", filter.sortColumn(), filter.sortDirection())
+	}
+
+	where, args := noteSearchConditions(userID, filter, true, true)
+
+	query := fmt.Sprintf(`
 	WITH counted AS (
 		SELECT 
-			id, title, note_type, created_at, updated_at, 	
-			ts_rank(note_vector, websearch_to_tsquery('english', $2)) AS rank,
+			n.id, n.title, n.note_type, n.created_at, n.updated_at, 	
+			ts_rank(n.note_vector, websearch_to_tsquery('english', $2)) AS rank,
 			ts_headline('english', 
-			COALESCE(title, '') || ' ' || COALESCE(content, ''), 
+			COALESCE(n.title, '') || ' ' || COALESCE(n.content, ''), 
 			websearch_to_tsquery('english', $2),
 			'MaxWords = 20, MinWords=10, MaxFragments=1, StartSel=<mark>, StopSel=</mark>'
-			) AS snippet
+			) AS snippet,
 			COUNT(*) OVER() AS total_count
 		FROM 
-			notes
+			notes n
 		WHERE
-			user_id = $1
-			AND note_vector @@ websearch_to_tsquery('english', $2)
+			%s
 		)
 		SELECT * FROM counted
 		ORDER BY
-			rank DESC
-		LIMIT $3
-		OFFSET $4
-	`
+			%s, id DESC
+		LIMIT $%d
+		OFFSET $%d
+	`, where, orderBy, len(args)+1, len(args)+2)
+
+	args = append(args, filter.limit(), filter.offset())
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	rows, err := m.db.QueryContext(ctx, query, userID, searchQuery, filter.limit(), filter.offset())
+	rows, err := m.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -741,9 +1272,10 @@ func (m noteModel) SearchNotes(ctx context.Context, userID int64, searchQuery st
 
 	for rows.Next() {
 		var result NoteSearchResponse
+		var title sql.NullString
 		err := rows.Scan(
 			&result.ID,
-			&result.Title,
+			&title,
 			&result.NoteType,
 			&result.CreatedAt,
 			&result.UpdatedAt,
@@ -756,6 +1288,7 @@ func (m noteModel) SearchNotes(ctx context.Context, userID int64, searchQuery st
 			return nil, Metadata{}, err
 		}
 
+		result.Title = title.String
 		result.Location = nil
 
 		results = append(results, &result)
@@ -770,3 +1303,74 @@ func (m noteModel) SearchNotes(ctx context.Context, userID int64, searchQuery st
 	return results, metadata, nil
 
 }
+
+// SearchFacets counts the notes matching a search by note type and by book.
+// A note located in several books counts once per book.
+func (m noteModel) SearchFacets(ctx context.Context, userID int64, filter *NoteSearchFilters) (*NoteSearchFacets, error) {
+	facets := &NoteSearchFacets{
+		NoteTypes: map[string]int{},
+		Books:     map[string]int{},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	where, args := noteSearchConditions(userID, filter, false, true)
+
+	typeQuery := fmt.Sprintf(`
+		SELECT
+			n.note_type, COUNT(*)
+		FROM
+			notes n
+		WHERE
+			%s
+		GROUP BY
+			n.note_type`, where)
+
+	err := m.scanFacet(ctx, facets.NoteTypes, typeQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args = noteSearchConditions(userID, filter, true, false)
+
+	bookQuery := fmt.Sprintf(`
+		SELECT
+			b.name, COUNT(DISTINCT n.id)
+		FROM
+			notes n
+		JOIN
+			note_locations nl ON nl.note_id = n.id
+		JOIN
+			books b ON b.id = nl.book_id
+		WHERE
+			%s
+		GROUP BY
+			b.name`, where)
+
+	err = m.scanFacet(ctx, facets.Books, bookQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+func (m noteModel) scanFacet(ctx context.Context, counts map[string]int, query string, args ...any) error {
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value string
+		var count int
+		if err := rows.Scan(&value, &count); err != nil {
+			return err
+		}
+		counts[value] = count
+	}
+
+	return rows.Err()
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -78,7 +79,7 @@ func TestGetAllLocatedForChapter(t *testing.T) {
 	ctx, cancel := context.WithTimeout(t.Context(), 3*time.Second)
 	defer cancel()
 
-	BibleNotes, crossRefNotes, err := m.Notes.GetAllLocatedForChapter(ctx, testUser.ID, &filter)
+	BibleNotes, crossRefNotes, referencingNotes, err := m.Notes.GetAllLocatedForChapter(ctx, testUser.ID, &filter)
 	if err != nil {
 		t.Fatalf("GetAllLocatedForChapter() err: %v", err)
 	}
@@ -90,6 +91,97 @@ func TestGetAllLocatedForChapter(t *testing.T) {
 	if len(crossRefNotes) != 0 {
 		t.Errorf("expected 0 cross-ref notes, got %d", len(crossRefNotes))
 	}
+
+	if len(referencingNotes) != 0 {
+		t.Errorf("expected 0 referencing notes, got %d", len(referencingNotes))
+	}
+
+	// passages requested without verses (svs and evs left out) cover the whole chapter
+	wholeChapter := LocationFilters{Book: "Genesis", Chapter: 1, StartVerse: -1, EndVerse: -1}
+
+	BibleNotes, _, _, err = m.Notes.GetAllLocatedForChapter(ctx, testUser.ID, &wholeChapter)
+	if err != nil {
+		t.Fatalf("GetAllLocatedForChapter() whole chapter err: %v", err)
+	}
+
+	if len(BibleNotes) != 1 {
+		t.Errorf("expected 1 Bible note in the whole chapter, got %d", len(BibleNotes))
+	}
+
+	outside := LocationFilters{Book: "Genesis", Chapter: 1, StartVerse: 3, EndVerse: 4}
+
+	BibleNotes, _, _, err = m.Notes.GetAllLocatedForChapter(ctx, testUser.ID, &outside)
+	if err != nil {
+		t.Fatalf("GetAllLocatedForChapter() outside range err: %v", err)
+	}
+
+	if len(BibleNotes) != 0 {
+		t.Errorf("expected 0 Bible notes outside the range, got %d", len(BibleNotes))
+	}
+}
+
+func TestReplaceDerivedLocations(t *testing.T) {
+	bookID, err := insertTestBook("Genesis")
+	if err != nil {
+		t.Fatalf("failed to insert test book: %v", err)
+	}
+	defer deleteTestBook(bookID)
+
+	testUser, err := createTestUser()
+	if err != nil {
+		t.Fatalf("failed to set password: %v", err)
+	}
+	testUser.ID = int64(124)
+
+	err = insertTestUser(testUser)
+	if err != nil {
+		t.Fatalf("failed to insert test user: %v", err)
+	}
+	defer deleteTestUser(testUser.ID)
+
+	noteID, err := insertTestNoteContent(&NoteContent{
+		UserID:   testUser.ID,
+		Title:    "test general note",
+		Content:  "Genesis 1:1 and Hezekiah 1:1",
+		NoteType: NoteTypeGeneral,
+	})
+	if err != nil {
+		t.Fatalf("failed to insert test note: %v", err)
+	}
+
+	m := NewModels(testDB)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 3*time.Second)
+	defer cancel()
+
+	locations := []*NoteLocation{
+		{Book: "Hezekiah", Chapter: 1, StartVerse: 1, EndVerse: 1},
+		{Book: "Genesis", Chapter: 1, StartVerse: 1, EndVerse: 1},
+	}
+
+	skipped, err := m.Notes.ReplaceDerivedLocations(ctx, *noteID, testUser.ID, locations)
+	if err != nil {
+		t.Fatalf("ReplaceDerivedLocations() err: %v", err)
+	}
+
+	if len(skipped) != 1 || skipped[0].Book != "Hezekiah" {
+		t.Errorf("expected the unknown book to be skipped, got %v", skipped)
+	}
+
+	var stored int
+	err = testDB.QueryRow(`SELECT count(*) FROM note_locations WHERE note_id = $1 AND derived`, *noteID).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored != 1 {
+		t.Errorf("expected the valid reference to be stored, got %d derived locations", stored)
+	}
+
+	_, err = m.Notes.ReplaceDerivedLocations(ctx, *noteID, testUser.ID+1, locations)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound for another user's note, got %v", err)
+	}
 }
 
 func insertTestLocatedNote(content *NoteContent, location *NoteLocation, bookID int) (*int64, *int64, error) {
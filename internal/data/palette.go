@@ -0,0 +1,251 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrDuplicatePaletteColor = errors.New("this color is already in the palette")
+
+type PaletteModel interface {
+	Insert(ctx context.Context, entry *PaletteEntry) error
+	Get(ctx context.Context, id, userID int64) (*PaletteEntry, error)
+	GetAll(ctx context.Context, userID int64) ([]*PaletteEntry, error)
+	Update(ctx context.Context, entry *PaletteEntry) error
+	Delete(ctx context.Context, id, userID int64) error
+}
+
+// PaletteEntry gives a highlight color its meaning for a user, e.g. green = promises.
+// Highlights reference entries, so a label can change without touching them.
+type PaletteEntry struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Color     string    `json:"color"`
+	Label     string    `json:"label"`
+	Order     int       `json:"order"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type paletteModel struct {
+	db *sql.DB
+}
+
+func NewPaletteModel(db *sql.DB) PaletteModel {
+	return &paletteModel{db}
+}
+
+// Insert adds an entry to the user's palette and populates its ID, order and timestamps.
+// An Order of 0 puts the entry last.
+// Returns ErrDuplicatePaletteColor if the color is already in the palette.
+func (m paletteModel) Insert(ctx context.Context, entry *PaletteEntry) error {
+	query := `
+		INSERT INTO highlight_palette
+			(user_id, color, label, position)
+		SELECT
+			$1, $2, $3,
+			CASE
+				WHEN $4 > 0 THEN $4
+				ELSE COALESCE(MAX(position), 0) + 1
+			END
+		FROM
+			highlight_palette
+		WHERE
+			user_id = $1
+		RETURNING
+			id, position, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.db.QueryRowContext(ctx, query, entry.UserID, entry.Color, entry.Label, entry.Order).Scan(
+		&entry.ID,
+		&entry.Order,
+		&entry.CreatedAt,
+		&entry.UpdatedAt,
+	)
+	if err != nil {
+		return paletteError(err)
+	}
+
+	return nil
+}
+
+// Get retrieves an entry of the user's palette
+// Returns ErrRecordNotFound if it doesn't exist or belongs to another user
+func (m paletteModel) Get(ctx context.Context, id, userID int64) (*PaletteEntry, error) {
+	query := `
+		SELECT
+			id, user_id, color, label, position, created_at, updated_at
+		FROM
+			highlight_palette
+		WHERE
+			id = $1
+			AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	entry, err := scanPaletteEntry(m.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// GetAll retrieves the user's palette in display order
+func (m paletteModel) GetAll(ctx context.Context, userID int64) ([]*PaletteEntry, error) {
+	query := `
+		SELECT
+			id, user_id, color, label, position, created_at, updated_at
+		FROM
+			highlight_palette
+		WHERE
+			user_id = $1
+		ORDER BY
+			position, id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*PaletteEntry{}
+
+	for rows.Next() {
+		entry, err := scanPaletteEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Update replaces the color, label and order of an entry and populates its timestamps.
+// Highlights referencing the entry follow a color change, a label change doesn't touch them.
+// Returns ErrRecordNotFound if the entry doesn't exist or belongs to another user,
+// or ErrDuplicatePaletteColor if another entry has the color.
+func (m paletteModel) Update(ctx context.Context, entry *PaletteEntry) error {
+	query := `
+		WITH updated AS (
+			UPDATE
+				highlight_palette
+			SET
+				color = $3,
+				label = $4,
+				position = $5,
+				updated_at = NOW()
+			WHERE
+				id = $1
+				AND user_id = $2
+			RETURNING
+				id, color, created_at, updated_at
+		), recolored AS (
+			UPDATE
+				highlights AS h
+			SET
+				color = u.color,
+				updated_at = NOW()
+			FROM
+				updated AS u
+			WHERE
+				h.palette_id = u.id
+				AND h.color IS DISTINCT FROM u.color
+		)
+		SELECT
+			created_at, updated_at
+		FROM
+			updated`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.db.QueryRowContext(ctx, query, entry.ID, entry.UserID, entry.Color, entry.Label, entry.Order).Scan(
+		&entry.CreatedAt,
+		&entry.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return paletteError(err)
+	}
+
+	return nil
+}
+
+// Delete removes an entry from the user's palette, its highlights keep their color
+// Returns ErrRecordNotFound if the entry doesn't exist or belongs to another user
+func (m paletteModel) Delete(ctx context.Context, id, userID int64) error {
+	query := `
+		DELETE FROM
+			highlight_palette
+		WHERE
+			id = $1
+			AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func scanPaletteEntry(row rowScanner) (*PaletteEntry, error) {
+	var entry PaletteEntry
+
+	err := row.Scan(
+		&entry.ID,
+		&entry.UserID,
+		&entry.Color,
+		&entry.Label,
+		&entry.Order,
+		&entry.CreatedAt,
+		&entry.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func paletteError(err error) error {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) && pgErr.Code == UniqueViolation {
+		return ErrDuplicatePaletteColor
+	}
+	return err
+}
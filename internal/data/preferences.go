@@ -0,0 +1,111 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// Translations are the Bible translations passages can be read in
+var Translations = []string{"KJV"}
+
+// How verse numbers are shown in a passage
+const (
+	VerseNumbersInline      = "inline"
+	VerseNumbersSuperscript = "superscript"
+	VerseNumbersHidden      = "hidden"
+)
+
+var VerseNumberDisplays = []string{VerseNumbersInline, VerseNumbersSuperscript, VerseNumbersHidden}
+
+// Preferences are the user's defaults for the options requests would otherwise pass
+// every time. They are stored as one document, settings missing from it are read as
+// their defaults.
+type Preferences struct {
+	Translation    string `json:"translation,omitempty"`
+	Timezone       string `json:"timezone,omitempty"` // IANA name, the day streaks and plans count in
+	Locale         string `json:"locale,omitempty"`   // BCP 47 tag
+	HighlightColor string `json:"highlight_color,omitempty"`
+	VerseNumbers   string `json:"verse_numbers,omitempty"`
+	NotesSort      string `json:"notes_sort,omitempty"`
+	NotesPageSize  int    `json:"notes_page_size,omitempty"`
+}
+
+func DefaultPreferences() Preferences {
+	return Preferences{
+		Translation:    "KJV",
+		Timezone:       "UTC",
+		Locale:         "en",
+		HighlightColor: "#FFD700",
+		VerseNumbers:   VerseNumbersInline,
+		NotesSort:      "-created_at",
+		NotesPageSize:  10,
+	}
+}
+
+// WithDefaults returns the preferences with the settings left unset filled with their
+// defaults, e.g. for anonymous users
+func (p Preferences) WithDefaults() Preferences {
+	defaults := DefaultPreferences()
+
+	if p.Translation == "" {
+		p.Translation = defaults.Translation
+	}
+	if p.Timezone == "" {
+		p.Timezone = defaults.Timezone
+	}
+	if p.Locale == "" {
+		p.Locale = defaults.Locale
+	}
+	if p.HighlightColor == "" {
+		p.HighlightColor = defaults.HighlightColor
+	}
+	if p.VerseNumbers == "" {
+		p.VerseNumbers = defaults.VerseNumbers
+	}
+	if p.NotesSort == "" {
+		p.NotesSort = defaults.NotesSort
+	}
+	if p.NotesPageSize == 0 {
+		p.NotesPageSize = defaults.NotesPageSize
+	}
+
+	return p
+}
+
+// Scan reads the stored document, settings missing from it get their defaults
+func (p *Preferences) Scan(src any) error {
+	var js []byte
+	switch src := src.(type) {
+	case []byte:
+		js = src
+	case string:
+		js = []byte(src)
+	case nil:
+		*p = DefaultPreferences()
+		return nil
+	default:
+		return errors.New("preferences: unsupported type")
+	}
+
+	var stored Preferences
+	err := json.Unmarshal(js, &stored)
+	if err != nil {
+		return err
+	}
+
+	*p = stored.WithDefaults()
+
+	return nil
+}
+
+// Value stores the preferences as a document, as text since lib/pq would send bytes
+// as bytea
+func (p Preferences) Value() (driver.Value, error) {
+	js, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
@@ -0,0 +1,229 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type SessionModel interface {
+	GetAllForUser(ctx context.Context, userID int64) ([]*Session, error)
+	GetUser(ctx context.Context, tokenPlaintext string) (*User, time.Time, error)
+	Touch(ctx context.Context, tokenPlaintext string) error
+	Delete(ctx context.Context, id, userID int64) ([][]byte, error)
+	DeleteForToken(ctx context.Context, userID int64, tokenPlaintext string) ([][]byte, error)
+}
+
+// Session is an authentication token seen from the user's side: the device it was
+// issued to and when it was last used. Current marks the token of the request.
+type Session struct {
+	ID         int64      `json:"id"`
+	Hash       []byte     `json:"-"`
+	DeviceName string     `json:"device_name"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	Current    bool       `json:"current"`
+}
+
+// refreshableCondition matches an authentication token t whose family holds an
+// unused, unexpired refresh token
+const refreshableCondition = `EXISTS (
+	SELECT 1 FROM tokens AS r
+	WHERE r.family_id = t.family_id AND r.scope = 'refresh' AND r.used_at IS NULL AND r.expiry > NOW()
+)`
+
+type sessionModel struct {
+	db *sql.DB
+}
+
+func NewSessionModel(db *sql.DB) SessionModel {
+	return &sessionModel{db}
+}
+
+// GetAllForUser retrieves the user's authentication tokens that are unexpired or can
+// still be refreshed, most recently used first
+func (m sessionModel) GetAllForUser(ctx context.Context, userID int64) ([]*Session, error) {
+	query := `
+		SELECT
+			t.id, t.hash, t.device_name, t.user_agent, t.ip, t.created_at, t.last_used_at, t.expiry
+		FROM
+			tokens AS t
+		WHERE
+			t.user_id = $1
+			AND t.scope = $2
+			AND (t.expiry > NOW() OR ` + refreshableCondition + `)
+		ORDER BY
+			COALESCE(t.last_used_at, t.created_at) DESC, t.id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.Hash,
+			&session.DeviceName,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Touch records that an authentication token was just used
+func (m sessionModel) Touch(ctx context.Context, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		UPDATE
+			tokens
+		SET
+			last_used_at = NOW()
+		WHERE
+			hash = $1
+			AND scope = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.db.ExecContext(ctx, query, tokenHash[:], ScopeAuthentication)
+	return err
+}
+
+// GetUser retrieves the user of an unexpired authentication token and the token's expiry
+// Returns ErrRecordNotFound if the token doesn't exist or expired
+func (m sessionModel) GetUser(ctx context.Context, tokenPlaintext string) (*User, time.Time, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT
+			u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.version, u.preferences, t.expiry
+		FROM
+			users AS u
+		JOIN
+			tokens AS t ON t.user_id = u.id
+		WHERE
+			t.hash = $1
+			AND t.scope = $2
+			AND t.expiry > NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var user User
+	var expiry time.Time
+
+	err := m.db.QueryRowContext(ctx, query, tokenHash[:], ScopeAuthentication).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.Preferences,
+		&expiry,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, time.Time{}, ErrRecordNotFound
+		}
+		return nil, time.Time{}, err
+	}
+
+	return &user, expiry, nil
+}
+
+// Delete signs a session out by the ID of its authentication token. The refresh
+// tokens of the same login are removed with it. Returns the hashes of the removed tokens.
+// Returns ErrRecordNotFound if it doesn't exist or belongs to another user
+func (m sessionModel) Delete(ctx context.Context, id, userID int64) ([][]byte, error) {
+	return m.delete(ctx, userID, "id = $1", id)
+}
+
+// DeleteForToken signs out the session of an authentication token, like Delete
+func (m sessionModel) DeleteForToken(ctx context.Context, userID int64, tokenPlaintext string) ([][]byte, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	return m.delete(ctx, userID, "hash = $1", tokenHash[:])
+}
+
+// delete removes the authentication token matching condition on $1 and its family
+func (m sessionModel) delete(ctx context.Context, userID int64, condition string, arg any) ([][]byte, error) {
+	query := `
+		WITH session AS (
+			SELECT
+				id, family_id
+			FROM
+				tokens
+			WHERE
+				` + condition + `
+				AND user_id = $2
+				AND scope = $3
+		)
+		DELETE FROM
+			tokens AS t
+		USING
+			session AS s
+		WHERE
+			t.user_id = $2
+			AND (t.id = s.id OR t.family_id = s.family_id)
+		RETURNING
+			t.hash`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, arg, userID, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := [][]byte{}
+
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(hashes) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return hashes, nil
+}
@@ -0,0 +1,373 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	SyncEntityNote      = "note"
+	SyncEntityLocation  = "location"
+	SyncEntityHighlight = "highlight"
+	SyncEntityImage     = "image"
+)
+
+type SyncModel interface {
+	GetChanges(ctx context.Context, userID, since int64, limit int) ([]*SyncChange, error)
+	GetLatestChange(ctx context.Context, userID int64, entity string, entityID int64) (int64, error)
+	GetCursor(ctx context.Context, userID int64) (int64, error)
+	GetNotes(ctx context.Context, userID int64, ids []int64) ([]*NoteResponse, error)
+	GetLocations(ctx context.Context, userID int64, ids []int64) ([]*SyncLocation, error)
+	GetHighlights(ctx context.Context, userID int64, ids []int64) ([]*Highlight, error)
+	GetImages(ctx context.Context, userID int64, ids []int64) ([]*ImageData, error)
+}
+
+// SyncChange is the latest change of an entity, Cursor is its position in the change log
+type SyncChange struct {
+	Cursor   int64
+	Entity   string
+	EntityID int64
+	Deleted  bool
+}
+
+// SyncTombstone tells a client to drop an entity it may hold
+type SyncTombstone struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id"`
+}
+
+// SyncLocation is a note location with the note it belongs to
+type SyncLocation struct {
+	NoteID int64 `json:"note_id"`
+	LocationResponse
+}
+
+type syncModel struct {
+	db *sql.DB
+}
+
+func NewSyncModel(db *sql.DB) SyncModel {
+	return &syncModel{db}
+}
+
+// GetChanges retrieves the latest change of every entity of the user changed after
+// the since cursor, in cursor order, up to limit entities.
+func (m syncModel) GetChanges(ctx context.Context, userID, since int64, limit int) ([]*SyncChange, error) {
+	query := `
+		SELECT
+			id, entity, entity_id, deleted
+		FROM (
+			SELECT DISTINCT ON (entity, entity_id)
+				id, entity, entity_id, deleted
+			FROM
+				sync_changes
+			WHERE
+				user_id = $1
+				AND id > $2
+			ORDER BY
+				entity, entity_id, id DESC
+		) AS latest
+		ORDER BY
+			id
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*SyncChange{}
+
+	for rows.Next() {
+		var change SyncChange
+		err := rows.Scan(&change.Cursor, &change.Entity, &change.EntityID, &change.Deleted)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// GetLatestChange returns the cursor of the latest change of an entity, 0 if it never changed
+func (m syncModel) GetLatestChange(ctx context.Context, userID int64, entity string, entityID int64) (int64, error) {
+	query := `
+		SELECT
+			COALESCE(MAX(id), 0)
+		FROM
+			sync_changes
+		WHERE
+			user_id = $1
+			AND entity = $2
+			AND entity_id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var cursor int64
+	err := m.db.QueryRowContext(ctx, query, userID, entity, entityID).Scan(&cursor)
+
+	return cursor, err
+}
+
+// GetCursor returns the cursor of the user's latest change, 0 if there is none
+func (m syncModel) GetCursor(ctx context.Context, userID int64) (int64, error) {
+	query := `
+		SELECT
+			COALESCE(MAX(id), 0)
+		FROM
+			sync_changes
+		WHERE
+			user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var cursor int64
+	err := m.db.QueryRowContext(ctx, query, userID).Scan(&cursor)
+
+	return cursor, err
+}
+
+// GetNotes retrieves the user's notes with the given IDs and their full content.
+// Notes in the trash are left out.
+func (m syncModel) GetNotes(ctx context.Context, userID int64, ids []int64) ([]*NoteResponse, error) {
+	query := `
+		SELECT
+			n.id, n.user_id, COALESCE(n.title, ''), n.content, n.note_type, n.created_at, n.updated_at,
+			tb.name, xr.chapter, xr.start_verse, xr.end_verse
+		FROM
+			notes AS n
+		LEFT JOIN
+			note_cross_references AS xr ON xr.note_id = n.id
+		LEFT JOIN
+			books AS tb ON xr.book_id = tb.id
+		WHERE
+			n.user_id = $1
+			AND n.id = ANY($2)
+			AND n.deleted_at IS NULL
+		ORDER BY
+			n.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*NoteResponse{}
+
+	for rows.Next() {
+		var note NoteResponse
+		var target nullableLocation
+		err := rows.Scan(
+			&note.ID,
+			&note.UserID,
+			&note.Title,
+			&note.Content,
+			&note.NoteType,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+			&target.Book,
+			&target.Chapter,
+			&target.StartVerse,
+			&target.EndVerse,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		note.Target = target.response()
+		notes = append(notes, &note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// GetLocations retrieves the locations with the given IDs of the user's notes outside the trash
+func (m syncModel) GetLocations(ctx context.Context, userID int64, ids []int64) ([]*SyncLocation, error) {
+	query := `
+		SELECT
+			nl.id, nl.note_id, b.name, nl.chapter, nl.start_verse, nl.end_verse,
+			COALESCE(nl.start_offset, 0), COALESCE(nl.end_offset, 0), nl.derived
+		FROM
+			note_locations AS nl
+		JOIN
+			notes AS n ON n.id = nl.note_id
+		JOIN
+			books AS b ON b.id = nl.book_id
+		WHERE
+			n.user_id = $1
+			AND nl.id = ANY($2)
+			AND n.deleted_at IS NULL
+		ORDER BY
+			nl.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []*SyncLocation{}
+
+	for rows.Next() {
+		var location SyncLocation
+		err := rows.Scan(
+			&location.ID,
+			&location.NoteID,
+			&location.Book,
+			&location.Chapter,
+			&location.StartVerse,
+			&location.EndVerse,
+			&location.StartOffset,
+			&location.EndOffset,
+			&location.Derived,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		locations = append(locations, &location)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+// GetHighlights retrieves the user's highlights with the given IDs
+func (m syncModel) GetHighlights(ctx context.Context, userID int64, ids []int64) ([]*Highlight, error) {
+	query := `
+		SELECT
+			h.id, b.name, h.chapter, COALESCE(h.start_verse, 0), COALESCE(h.end_verse, 0),
+			h.start_offset, h.end_offset, COALESCE(h.color, ''), h.palette_id, h.created_at, h.updated_at
+		FROM
+			highlights AS h
+		JOIN
+			books AS b ON b.id = h.book_id
+		WHERE
+			h.user_id = $1
+			AND h.id = ANY($2)
+		ORDER BY
+			h.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	highlights := []*Highlight{}
+
+	for rows.Next() {
+		var highlight Highlight
+		err := rows.Scan(
+			&highlight.ID,
+			&highlight.Book,
+			&highlight.Chapter,
+			&highlight.StartVerse,
+			&highlight.EndVerse,
+			&highlight.StartOffset,
+			&highlight.EndOffset,
+			&highlight.Color,
+			&highlight.PaletteID,
+			&highlight.CreatedAt,
+			&highlight.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		highlights = append(highlights, &highlight)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return highlights, nil
+}
+
+// GetImages retrieves the metadata of the images with the given IDs of the user's notes outside the trash
+func (m syncModel) GetImages(ctx context.Context, userID int64, ids []int64) ([]*ImageData, error) {
+	query := `
+		SELECT
+			i.id, i.note_id, i.s3_key, COALESCE(i.width, 0), COALESCE(i.height, 0),
+			COALESCE(i.original_filename, ''), i.mime_type, COALESCE(i.file_size, 0), i.created_at
+		FROM
+			images AS i
+		JOIN
+			notes AS n ON n.id = i.note_id
+		WHERE
+			n.user_id = $1
+			AND i.id = ANY($2)
+			AND n.deleted_at IS NULL
+		ORDER BY
+			i.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*ImageData{}
+
+	for rows.Next() {
+		var image ImageData
+		err := rows.Scan(
+			&image.ID,
+			&image.NoteID,
+			&image.S3Key,
+			&image.Width,
+			&image.Height,
+			&image.OriginalFileName,
+			&image.MimeType,
+			&image.FileSize,
+			&image.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, &image)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
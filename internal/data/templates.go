@@ -0,0 +1,249 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateTemplateName = errors.New("a template with this name already exists")
+
+type TemplateModel interface {
+	Insert(ctx context.Context, template *NoteTemplate) error
+	Get(ctx context.Context, id, userID int64) (*NoteTemplate, error)
+	GetAll(ctx context.Context, userID int64) ([]*NoteTemplate, error)
+	Update(ctx context.Context, template *NoteTemplate) error
+	Delete(ctx context.Context, id, userID int64) error
+}
+
+type TemplateSection struct {
+	Heading string `json:"heading"`
+	Body    string `json:"body"`
+}
+
+// NoteTemplate is a named list of sections used to pre-fill BIBLE notes.
+// Built-in templates have no owner and can't be modified.
+type NoteTemplate struct {
+	ID          int64             `json:"id"`
+	UserID      int64             `json:"-"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Sections    []TemplateSection `json:"sections"`
+	BuiltIn     bool              `json:"built_in"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type templateModel struct {
+	db *sql.DB
+}
+
+func NewTemplateModel(db *sql.DB) TemplateModel {
+	return &templateModel{db}
+}
+
+// Insert creates a user template and populates its ID and timestamps.
+// Returns ErrDuplicateTemplateName if the user already has a template with this name.
+func (m templateModel) Insert(ctx context.Context, template *NoteTemplate) error {
+	query := `
+		INSERT INTO note_templates
+			(user_id, name, description, sections)
+		VALUES
+			($1, $2, $3, $4)
+		RETURNING
+			id, created_at, updated_at`
+
+	sections, err := json.Marshal(template.Sections)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.db.QueryRowContext(ctx, query, template.UserID, template.Name, template.Description, sections).Scan(
+		&template.ID,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+	)
+	if err != nil {
+		return templateError(err)
+	}
+
+	return nil
+}
+
+// Get retrieves a template owned by the user or a built-in one.
+// Returns ErrRecordNotFound if neither exists.
+func (m templateModel) Get(ctx context.Context, id, userID int64) (*NoteTemplate, error) {
+	query := `
+		SELECT
+			id, COALESCE(user_id, 0), name, description, sections, user_id IS NULL, created_at, updated_at
+		FROM
+			note_templates
+		WHERE
+			id = $1
+			AND (user_id = $2 OR user_id IS NULL)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	template, err := scanTemplate(m.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// GetAll retrieves the built-in templates followed by the user's templates by name.
+func (m templateModel) GetAll(ctx context.Context, userID int64) ([]*NoteTemplate, error) {
+	query := `
+		SELECT
+			id, COALESCE(user_id, 0), name, description, sections, user_id IS NULL, created_at, updated_at
+		FROM
+			note_templates
+		WHERE
+			user_id = $1 OR user_id IS NULL
+		ORDER BY
+			user_id NULLS FIRST, LOWER(name)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*NoteTemplate{}
+
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// Update replaces the name, description and sections of a user template.
+// Returns ErrRecordNotFound if the template doesn't belong to the user (built-ins included),
+// or ErrDuplicateTemplateName if the new name is taken.
+func (m templateModel) Update(ctx context.Context, template *NoteTemplate) error {
+	query := `
+		UPDATE
+			note_templates
+		SET
+			name = $3,
+			description = $4,
+			sections = $5,
+			updated_at = NOW()
+		WHERE
+			id = $1
+			AND user_id = $2
+		RETURNING
+			created_at, updated_at`
+
+	sections, err := json.Marshal(template.Sections)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	args := []any{template.ID, template.UserID, template.Name, template.Description, sections}
+
+	err = m.db.QueryRowContext(ctx, query, args...).Scan(&template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return templateError(err)
+	}
+
+	return nil
+}
+
+// Delete removes a user template.
+// Returns ErrRecordNotFound if the template doesn't belong to the user (built-ins included).
+func (m templateModel) Delete(ctx context.Context, id, userID int64) error {
+	query := `
+		DELETE FROM
+			note_templates
+		WHERE
+			id = $1
+			AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTemplate(row rowScanner) (*NoteTemplate, error) {
+	var template NoteTemplate
+	var sections []byte
+
+	err := row.Scan(
+		&template.ID,
+		&template.UserID,
+		&template.Name,
+		&template.Description,
+		&sections,
+		&template.BuiltIn,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(sections, &template.Sections); err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+func templateError(err error) error {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) && pgErr.Code == UniqueViolation {
+		return ErrDuplicateTemplateName
+	}
+	return err
+}
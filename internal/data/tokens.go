@@ -4,6 +4,8 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
+	"errors"
 	"time"
 )
 
@@ -11,21 +13,45 @@ const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
 	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	ScopeTwoFactor      = "two-factor"
+	ScopeEmailChange    = "email-change"
+	ScopeMagicLink      = "magic-link"
 )
 
+var ErrRefreshTokenReused = errors.New("refresh token already used")
+
 type TokenModel interface {
 	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+	NewSession(ctx context.Context, userID int64, ttl time.Duration, scope string, info SessionInfo) (*Token, error)
+	NewEmailChange(ctx context.Context, userID int64, ttl time.Duration, newEmail string) (*Token, error)
 	Insert(ctx context.Context, token *Token) error
+	UseRefreshToken(ctx context.Context, tokenPlaintext string) (*Token, error)
+	Consume(ctx context.Context, scope, tokenPlaintext string) (int64, error)
+	DeleteFamily(ctx context.Context, scope, familyID string) ([][]byte, error)
 	DeleteAllForUser(ctx context.Context, scope string, id int64) error
 	DeleteExpiredTokens(ctx context.Context) (int64, error)
 }
 
 type Token struct {
+	ID        int64     `json:"-"`
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	CreatedAt time.Time `json:"-"`
+	NewEmail  string    `json:"-"`
+	SessionInfo
+}
+
+// SessionInfo describes the device an authentication token was issued to.
+// FamilyID groups the access and refresh tokens of one login.
+type SessionInfo struct {
+	UserAgent  string `json:"-"`
+	IP         string `json:"-"`
+	DeviceName string `json:"-"`
+	FamilyID   string `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) *Token {
@@ -57,29 +83,190 @@ func (m tokenModel) New(ctx context.Context, userID int64, ttl time.Duration, sc
 	return token, err
 }
 
+// NewSession creates an authentication or refresh token for the device described by info
+func (m tokenModel) NewSession(ctx context.Context, userID int64, ttl time.Duration, scope string, info SessionInfo) (*Token, error) {
+	token := generateToken(userID, ttl, scope)
+	token.SessionInfo = info
+
+	err := m.Insert(ctx, token)
+	return token, err
+}
+
+// NewEmailChange creates a token verifying newEmail, replacing the user's pending email change
+func (m tokenModel) NewEmailChange(ctx context.Context, userID int64, ttl time.Duration, newEmail string) (*Token, error) {
+	token := generateToken(userID, ttl, ScopeEmailChange)
+	token.NewEmail = newEmail
+
+	err := m.Insert(ctx, token)
+	return token, err
+}
+
 func (m tokenModel) Insert(ctx context.Context, token *Token) error {
 	query := `
 		INSERT INTO tokens 
-			(hash, user_id, expiry, scope)
+			(hash, user_id, expiry, scope, user_agent, ip, device_name, family_id, new_email)
 		VALUES 
-			($1, $2, $3, $4)
+			($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''))
 		ON CONFLICT 
 			(user_id, scope)
 		WHERE 
-			scope IN ('activation', 'password-reset')
+			scope IN ('activation', 'password-reset', 'email-change', 'magic-link')
 		DO UPDATE SET
 			hash = EXCLUDED.hash,
-			expiry = EXCLUDED.expiry
-		`
+			expiry = EXCLUDED.expiry,
+			new_email = EXCLUDED.new_email
+		RETURNING
+			id, created_at`
+
+	args := []any{
+		token.Hash,
+		token.UserID,
+		token.Expiry,
+		token.Scope,
+		token.UserAgent,
+		token.IP,
+		token.DeviceName,
+		token.FamilyID,
+		token.NewEmail,
+	}
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.db.QueryRowContext(ctx, query, args...).Scan(&token.ID, &token.CreatedAt)
+}
+
+// UseRefreshToken marks an unexpired refresh token as used and returns it, a refresh
+// token can only be exchanged once. Of two concurrent exchanges only one succeeds, the
+// other counts as reuse.
+// Returns ErrRecordNotFound if it doesn't exist or expired, or the token along with
+// ErrRefreshTokenReused if it was already used.
+func (m tokenModel) UseRefreshToken(ctx context.Context, tokenPlaintext string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		WITH unused AS (
+			UPDATE
+				tokens
+			SET
+				used_at = NOW()
+			WHERE
+				hash = $1
+				AND scope = $2
+				AND expiry > NOW()
+				AND used_at IS NULL
+			RETURNING
+				hash
+		)
+		SELECT
+			t.user_id, COALESCE(t.family_id, ''), t.device_name, t.expiry,
+			NOT EXISTS (SELECT 1 FROM unused)
+		FROM
+			tokens AS t
+		WHERE
+			t.hash = $1
+			AND t.scope = $2
+			AND (t.expiry > NOW() OR t.used_at IS NOT NULL)`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err := m.db.ExecContext(ctx, query, args...)
+	token := &Token{
+		Plaintext: tokenPlaintext,
+		Hash:      tokenHash[:],
+		Scope:     ScopeRefresh,
+	}
+
+	var reused bool
+	err := m.db.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh).Scan(
+		&token.UserID,
+		&token.FamilyID,
+		&token.DeviceName,
+		&token.Expiry,
+		&reused,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	if reused {
+		return token, ErrRefreshTokenReused
+	}
 
-	return err
+	return token, nil
+}
+
+// DeleteFamily removes the tokens of a family with the given scope and returns their hashes
+func (m tokenModel) DeleteFamily(ctx context.Context, scope, familyID string) ([][]byte, error) {
+	query := `
+		DELETE FROM
+			tokens
+		WHERE
+			scope = $1
+			AND family_id = $2
+		RETURNING
+			hash`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, scope, familyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := [][]byte{}
+
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// Consume deletes an unexpired single-use token and returns the ID of its user, of two
+// concurrent uses only one gets it
+// Returns ErrRecordNotFound if it doesn't exist, expired or was used
+func (m tokenModel) Consume(ctx context.Context, scope, tokenPlaintext string) (int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		DELETE FROM
+			tokens
+		WHERE
+			hash = $1
+			AND scope = $2
+			AND expiry > NOW()
+		RETURNING
+			user_id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var userID int64
+
+	err := m.db.QueryRowContext(ctx, query, tokenHash[:], scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	return userID, nil
 }
 
 func (m tokenModel) DeleteAllForUser(ctx context.Context, scope string, id int64) error {
@@ -98,11 +285,13 @@ func (m tokenModel) DeleteAllForUser(ctx context.Context, scope string, id int64
 }
 
 func (m tokenModel) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	// Expired authentication tokens that can still be refreshed keep their session listed
 	query := `
 		DELETE FROM 
-			tokens
+			tokens AS t
 		WHERE 
-			expiry < NOW()`
+			t.expiry < NOW()
+			AND NOT (t.scope = 'authentication' AND ` + refreshableCondition + `)`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
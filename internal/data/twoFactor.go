@@ -0,0 +1,263 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type TwoFactorModel interface {
+	Get(ctx context.Context, userID int64) (*TwoFactor, error)
+	Enroll(ctx context.Context, userID int64, secret string) error
+	Confirm(ctx context.Context, userID int64, recoveryHashes [][]byte) error
+	UseStep(ctx context.Context, userID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, hash []byte) error
+	Delete(ctx context.Context, userID int64) error
+}
+
+// TwoFactor is a user's TOTP secret. Two-factor authentication is enabled once the
+// secret is confirmed, LastUsedStep is the time step of the latest accepted code.
+type TwoFactor struct {
+	UserID       int64
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+func (t *TwoFactor) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+type twoFactorModel struct {
+	db DBTX
+}
+
+func NewTwoFactorModel(db DBTX) TwoFactorModel {
+	return &twoFactorModel{db}
+}
+
+// Get retrieves the user's TOTP secret, confirmed or not
+// Returns ErrRecordNotFound if the user never enrolled
+func (m twoFactorModel) Get(ctx context.Context, userID int64) (*TwoFactor, error) {
+	query := `
+		SELECT
+			user_id, secret, confirmed_at, last_used_step, created_at
+		FROM
+			two_factor
+		WHERE
+			user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var twoFactor TwoFactor
+
+	err := m.db.QueryRowContext(ctx, query, userID).Scan(
+		&twoFactor.UserID,
+		&twoFactor.Secret,
+		&twoFactor.ConfirmedAt,
+		&twoFactor.LastUsedStep,
+		&twoFactor.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &twoFactor, nil
+}
+
+// Enroll stores a new unconfirmed secret for the user, replacing an earlier unconfirmed one
+// Returns ErrEditConflict if two-factor authentication is already enabled
+func (m twoFactorModel) Enroll(ctx context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO two_factor
+			(user_id, secret)
+		VALUES
+			($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET
+			secret = EXCLUDED.secret,
+			last_used_step = 0,
+			created_at = NOW()
+		WHERE
+			two_factor.confirmed_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Confirm enables two-factor authentication and replaces the user's recovery codes
+// Returns ErrRecordNotFound if the user has no unconfirmed secret
+func (m twoFactorModel) Confirm(ctx context.Context, userID int64, recoveryHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE
+			two_factor
+		SET
+			confirmed_at = NOW()
+		WHERE
+			user_id = $1
+			AND confirmed_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO recovery_codes
+			(hash, user_id)
+		VALUES
+			($1, $2)`
+
+	for _, hash := range recoveryHashes {
+		_, err = tx.ExecContext(ctx, query, hash, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records that a code of the time step was accepted, so it can't be used again
+// Returns ErrRecordNotFound if a code of this or a later step was already accepted
+func (m twoFactorModel) UseStep(ctx context.Context, userID, step int64) error {
+	query := `
+		UPDATE
+			two_factor
+		SET
+			last_used_step = $2
+		WHERE
+			user_id = $1
+			AND last_used_step < $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks one of the user's recovery codes as used
+// Returns ErrRecordNotFound if the code doesn't exist or was already used
+func (m twoFactorModel) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) error {
+	query := `
+		UPDATE
+			recovery_codes
+		SET
+			used_at = NOW()
+		WHERE
+			hash = $1
+			AND user_id = $2
+			AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, hash, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Delete turns two-factor authentication off, removing the secret and recovery codes
+// Returns ErrRecordNotFound if the user never enrolled
+func (m twoFactorModel) Delete(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM two_factor WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
@@ -14,21 +14,26 @@ var ErrDuplicateEmail = errors.New("duplicate email")
 
 type UserModel interface {
 	Insert(ctx context.Context, user *User) error
+	Get(ctx context.Context, id int64) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetForToken(ctx context.Context, tokenPlainText, tokenScope string) (*User, error)
 	Update(ctx context.Context, user *User) error
+	ChangeEmail(ctx context.Context, tokenPlaintext string) (*User, error)
+	UpdatePreferences(ctx context.Context, userID int64, changes Preferences) (Preferences, error)
+	Delete(ctx context.Context, id int64) error
 }
 
 var AnonymousUser = &User{}
 
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Name        string      `json:"name"`
+	Email       string      `json:"email"`
+	Password    password    `json:"-"`
+	Activated   bool        `json:"activated"`
+	Version     int         `json:"-"`
+	Preferences Preferences `json:"preferences"`
 }
 
 func (u *User) IsAnonymous() bool {
@@ -81,14 +86,14 @@ func (m userModel) Insert(ctx context.Context, user *User) error {
 		VALUES 
 			($1, $2, $3, $4)
 		RETURNING 
-			id, created_at, version`
+			id, created_at, version, preferences`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
 
-	err := m.db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := m.db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version, &user.Preferences)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -101,10 +106,49 @@ func (m userModel) Insert(ctx context.Context, user *User) error {
 	return nil
 }
 
+// Get retrieves a user by ID
+// Returns ErrRecordNotFound if the user doesn't exist
+func (m userModel) Get(ctx context.Context, id int64) (*User, error) {
+	query := `
+		SELECT 
+			id, created_at, name, email, password_hash, activated, version, preferences
+		FROM 
+			users 
+		WHERE 
+			id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.Preferences,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 func (m userModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
 		SELECT 
-			id, created_at, name, email, password_hash, activated, version
+			id, created_at, name, email, password_hash, activated, version, preferences
 		FROM 
 			users 
 		WHERE 
@@ -120,6 +164,7 @@ func (m userModel) GetByEmail(ctx context.Context, email string) (*User, error)
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.Preferences,
 	)
 
 	if err != nil {
@@ -139,7 +184,7 @@ func (m userModel) GetForToken(ctx context.Context, tokenPlainText, tokenScope s
 
 	query := `
 		SELECT
-			 users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+			 users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, users.preferences
 		FROM 
 			users
 		INNER JOIN 
@@ -164,6 +209,7 @@ func (m userModel) GetForToken(ctx context.Context, tokenPlainText, tokenScope s
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.Preferences,
 	)
 
 	if err != nil {
@@ -215,3 +261,120 @@ func (m userModel) Update(ctx context.Context, user *User) error {
 
 	return nil
 }
+
+// ChangeEmail sets the user's email to the address an unexpired email change token
+// verifies and deletes the token
+// Returns ErrRecordNotFound if the token doesn't exist or expired, or ErrDuplicateEmail
+// if the address was taken meanwhile
+func (m userModel) ChangeEmail(ctx context.Context, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		WITH change AS (
+			DELETE FROM
+				tokens
+			WHERE
+				hash = $1
+				AND scope = $2
+				AND expiry > NOW()
+			RETURNING
+				user_id, new_email
+		)
+		UPDATE
+			users
+		SET
+			email = change.new_email, version = version + 1
+		FROM
+			change
+		WHERE
+			users.id = change.user_id
+		RETURNING
+			users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, users.preferences`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.db.QueryRowContext(ctx, query, tokenHash[:], ScopeEmailChange).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.Preferences,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return nil, ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// UpdatePreferences merges the settings set in changes into the user's preferences, so
+// concurrent updates of different settings don't overwrite each other
+// Returns the updated preferences, or ErrRecordNotFound if the user doesn't exist
+func (m userModel) UpdatePreferences(ctx context.Context, userID int64, changes Preferences) (Preferences, error) {
+	query := `
+		UPDATE
+			users
+		SET
+			preferences = preferences || $2::jsonb
+		WHERE
+			id = $1
+		RETURNING
+			preferences`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var preferences Preferences
+
+	err := m.db.QueryRowContext(ctx, query, userID, changes).Scan(&preferences)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Preferences{}, ErrRecordNotFound
+		}
+		return Preferences{}, err
+	}
+
+	return preferences, nil
+}
+
+// Delete deletes a user, everything they own is deleted along with them
+// Returns ErrRecordNotFound if the user doesn't exist
+func (m userModel) Delete(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM
+			users
+		WHERE
+			id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
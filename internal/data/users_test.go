@@ -65,6 +65,41 @@ func TestUserModel_GetByEmail(t *testing.T) {
 
 }
 
+func TestUserModel_ChangeEmail(t *testing.T) {
+	testUser, err := createTestUser()
+	if err != nil {
+		t.Fatalf("failed to set password: %v", err)
+	}
+
+	m := NewModels(testDB)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err = m.Users.Insert(ctx, testUser)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	defer deleteUser(testUser.ID)
+
+	token, err := m.Tokens.NewEmailChange(ctx, testUser.ID, time.Hour, "changed@example.com")
+	if err != nil {
+		t.Fatalf("NewEmailChange() returned an error: %v", err)
+	}
+
+	changedUser, err := m.Users.ChangeEmail(ctx, token.Plaintext)
+	if err != nil {
+		t.Fatalf("ChangeEmail() returned an error: %v", err)
+	}
+
+	if changedUser.Email != "changed@example.com" {
+		t.Errorf("expected email to be changed@example.com, but got %s", changedUser.Email)
+	}
+
+	_, err = m.Users.ChangeEmail(ctx, token.Plaintext)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound for a used token, but got %v", err)
+	}
+}
+
 func createTestUser() (*User, error) {
 	testUser := User{
 		Name:      "cornelius",
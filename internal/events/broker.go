@@ -0,0 +1,231 @@
+package events
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// channel is the Postgres channel the sync_changes trigger notifies on
+const channel = "sync_changes"
+
+// subscriptionBuffer is how many events a slow stream may fall behind before it is dropped
+const subscriptionBuffer = 64
+
+// Event announces a change of a user's note, location, highlight or image.
+// ID is the change's sync cursor, clients resume from it.
+type Event struct {
+	ID       int64  `json:"cursor"`
+	UserID   int64  `json:"-"`
+	Entity   string `json:"type"`
+	EntityID int64  `json:"id"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// notification is the payload sent by the notify_sync_change trigger
+type notification struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"user_id"`
+	Entity   string `json:"entity"`
+	EntityID int64  `json:"entity_id"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// Broker listens for change notifications from Postgres and fans them out to the
+// subscriptions of their user. Every API instance runs its own broker, Postgres
+// delivers each notification to all of them.
+type Broker struct {
+	listener    *pq.Listener
+	logger      *slog.Logger
+	subscribers map[int64]map[*Subscription]struct{}
+	closed      bool
+	mu          sync.Mutex
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func newBroker(logger *slog.Logger) *Broker {
+	return &Broker{
+		logger:      logger,
+		subscribers: make(map[int64]map[*Subscription]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// NewBroker opens a dedicated connection listening on the sync_changes channel.
+// The connection is reestablished automatically if it is lost.
+func NewBroker(dsn string, logger *slog.Logger) (*Broker, error) {
+	b := newBroker(logger)
+
+	b.listener = pq.NewListener(dsn, 10*time.Second, time.Minute, b.reportProblem)
+
+	err := b.listener.Listen(channel)
+	if err != nil {
+		b.listener.Close()
+		return nil, err
+	}
+
+	go b.run()
+
+	return b, nil
+}
+
+func (b *Broker) reportProblem(event pq.ListenerEventType, err error) {
+	if err != nil {
+		b.logger.Error("event listener connection problem", "event", event, "error", err)
+	}
+}
+
+func (b *Broker) run() {
+	for {
+		select {
+		case n, ok := <-b.listener.Notify:
+			if !ok {
+				return
+			}
+
+			// A nil notification follows a reconnect, notifications sent meanwhile are
+			// lost. Dropping every stream makes clients reconnect and replay from their
+			// Last-Event-ID.
+			if n == nil {
+				b.logger.Info("event listener reconnected, dropping open streams")
+				b.dropAll()
+				continue
+			}
+
+			var payload notification
+			err := json.Unmarshal([]byte(n.Extra), &payload)
+			if err != nil {
+				b.logger.Error("failed to decode change notification", "payload", n.Extra, "error", err)
+				continue
+			}
+
+			b.publish(Event(payload))
+
+		case <-time.After(90 * time.Second):
+			// Detects a dead connection when no notification arrives for a while
+			go b.listener.Ping()
+
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events of a user
+// The subscription's channel is closed if the broker drops it, the subscriber then
+// has to resume from the last event it received
+func (b *Broker) Subscribe(userID int64) *Subscription {
+	sub := &Subscription{
+		userID: userID,
+		events: make(chan Event, subscriptionBuffer),
+		broker: b,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[*Subscription]struct{})
+	}
+	b.subscribers[userID][sub] = struct{}{}
+
+	return sub
+}
+
+// publish delivers an event to every subscription of its user.
+// A subscription whose buffer is full is dropped instead of blocking the others.
+func (b *Broker) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers[event.UserID] {
+		select {
+		case sub.events <- event:
+		default:
+			b.logger.Warn("event stream too slow, dropping it", "user_id", event.UserID)
+			b.removeLocked(sub)
+		}
+	}
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.removeLocked(sub)
+}
+
+func (b *Broker) removeLocked(sub *Subscription) {
+	subs, ok := b.subscribers[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subscribers, sub.userID)
+	}
+	close(sub.events)
+}
+
+func (b *Broker) dropAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, subs := range b.subscribers {
+		for sub := range subs {
+			b.removeLocked(sub)
+		}
+	}
+}
+
+// Close stops listening and ends every subscription, open streams finish so the
+// server can shut down
+func (b *Broker) Close() error {
+	var err error
+
+	b.closeOnce.Do(func() {
+		b.mu.Lock()
+		b.closed = true
+		b.mu.Unlock()
+
+		close(b.done)
+		b.dropAll()
+
+		if b.listener != nil {
+			err = b.listener.Close()
+		}
+	})
+
+	return err
+}
+
+// Subscription receives the events of one user until it is closed or dropped
+type Subscription struct {
+	userID int64
+	events chan Event
+	broker *Broker
+}
+
+// Events returns the channel events are delivered on, it is closed when the
+// subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.broker.remove(s)
+}
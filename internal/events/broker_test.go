@@ -0,0 +1,80 @@
+package events
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestBrokerPublish(t *testing.T) {
+	b := newBroker(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	first := b.Subscribe(1)
+	second := b.Subscribe(1)
+	other := b.Subscribe(2)
+
+	b.publish(Event{ID: 10, UserID: 1, Entity: "note", EntityID: 5})
+
+	for i, sub := range []*Subscription{first, second} {
+		select {
+		case event := <-sub.Events():
+			if event.ID != 10 || event.EntityID != 5 {
+				t.Errorf("subscription %d: got %+v", i, event)
+			}
+		default:
+			t.Errorf("subscription %d: no event delivered", i)
+		}
+	}
+
+	select {
+	case event := <-other.Events():
+		t.Errorf("event of user 1 delivered to user 2: %+v", event)
+	default:
+	}
+
+	first.Close()
+	if _, ok := <-first.Events(); ok {
+		t.Error("closed subscription still open")
+	}
+	// Closing twice is harmless
+	first.Close()
+
+	b.publish(Event{ID: 11, UserID: 1})
+	if event := <-second.Events(); event.ID != 11 {
+		t.Errorf("got %+v, want event 11", event)
+	}
+}
+
+func TestBrokerDropsSlowSubscription(t *testing.T) {
+	b := newBroker(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	sub := b.Subscribe(1)
+	for i := range subscriptionBuffer + 1 {
+		b.publish(Event{ID: int64(i + 1), UserID: 1})
+	}
+
+	received := 0
+	for range sub.Events() {
+		received++
+	}
+
+	if received != subscriptionBuffer {
+		t.Errorf("received %d events before the drop, want %d", received, subscriptionBuffer)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := newBroker(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	sub := b.Subscribe(1)
+	b.Close()
+
+	if _, ok := <-sub.Events(); ok {
+		t.Error("subscription open after broker close")
+	}
+
+	late := b.Subscribe(1)
+	if _, ok := <-late.Events(); ok {
+		t.Error("subscription open on a closed broker")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 
 	"time"
 
@@ -71,6 +72,43 @@ func (s *S3ImageService) UploadImage(
 	return s3Key, nil
 }
 
+// UploadExport uploads an export archive to S3
+// Format: users/123/exports/20251026-abc123-def456-ghi789.zip
+func (s *S3ImageService) UploadExport(ctx context.Context, archive []byte, userID int64) (string, error) {
+	timeStamp := time.Now().Format("20060102")
+	uniqueID := uuid.New().String()
+
+	s3Key := fmt.Sprintf("users/%d/exports/%s-%s.zip", userID, timeStamp, uniqueID)
+
+	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(s3Key),
+		Body:        bytes.NewReader(archive),
+		ContentType: aws.String("application/zip"),
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("failed to upload to S3: %w", err)
+	}
+
+	return s3Key, nil
+}
+
+// DownloadImage reads an image from S3
+func (s *S3ImageService) DownloadImage(ctx context.Context, s3Key string) ([]byte, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s3Key),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from S3: %w", err)
+	}
+	defer output.Body.Close()
+
+	return io.ReadAll(output.Body)
+}
+
 // DeleteImage deletes an image from S3
 func (s *S3ImageService) DeleteImage(ctx context.Context, s3Key string) error {
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
@@ -8,6 +8,10 @@ import (
 	"time"
 )
 
+// TaskHandler processes a task type registered from outside the scheduler,
+// e.g. by a service that owns the work (exports). Returned errors are logged.
+type TaskHandler func(task Task) error
+
 type Scheduler struct {
 	NumWorkers   int
 	TaskChannel  chan Task
@@ -15,6 +19,7 @@ type Scheduler struct {
 	DeadQueue    []Task
 	Mailer       *mailer.Mailer
 	Logger       *slog.Logger
+	handlers     map[string]TaskHandler
 	mu           *sync.Mutex
 }
 
@@ -23,6 +28,7 @@ func NewScheduler(numWorkers int) *Scheduler {
 		TaskChannel:  make(chan Task, 100),
 		DelayedQueue: BuildMinHeap(),
 		NumWorkers:   numWorkers,
+		handlers:     make(map[string]TaskHandler),
 		mu:           &sync.Mutex{},
 	}
 }
@@ -31,6 +37,14 @@ func (s Scheduler) Submit(task Task) {
 	s.TaskChannel <- task
 }
 
+// Handle registers the handler for a task type the scheduler doesn't process itself
+func (s Scheduler) Handle(taskType string, handler TaskHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[taskType] = handler
+}
+
 func (s Scheduler) Start() {
 	for range s.NumWorkers {
 		go s.worker(s.TaskChannel)
@@ -73,6 +87,29 @@ func (s Scheduler) processTask(task Task) {
 		s.sendPasswordResetEmail(task)
 	case SendTokenActivatoinEmail:
 		s.sendTokenActivatoinEmail(task)
+	case SendExportReadyEmail:
+		s.sendExportReadyEmail(task)
+	case SendEmailChangeEmail:
+		s.sendEmailChangeEmail(task)
+	case SendEmailChangeNotice:
+		s.sendEmailChangeNotice(task)
+	case SendSuspiciousLoginEmail:
+		s.sendSuspiciousLoginEmail(task)
+	case SendMagicLinkEmail:
+		s.sendMagicLinkEmail(task)
+	default:
+		s.mu.Lock()
+		handler, ok := s.handlers[task.Type]
+		s.mu.Unlock()
+
+		if !ok {
+			s.Logger.Error("no handler for task", "type", task.Type)
+			return
+		}
+
+		if err := handler(task); err != nil {
+			s.Logger.Error("task failed", "type", task.Type, "error", err)
+		}
 	}
 }
 
@@ -82,7 +119,7 @@ func (s Scheduler) sendActivationEmail(task Task) {
 		panic("Scheduler process task error, wrong data type, has to be 'TaskEmailData")
 	}
 
-	if task.Retries < task.MaxRetries {
+	if task.Retries > task.MaxRetries {
 		return
 	}
 
@@ -100,7 +137,7 @@ func (s Scheduler) sendPasswordResetEmail(task Task) {
 		return
 	}
 
-	if task.Retries < task.MaxRetries {
+	if task.Retries > task.MaxRetries {
 		return
 	}
 
@@ -117,7 +154,7 @@ func (s Scheduler) sendTokenActivatoinEmail(task Task) {
 		return
 	}
 
-	if task.Retries < task.MaxRetries {
+	if task.Retries > task.MaxRetries {
 		return
 	}
 	err := s.Mailer.Send(data.Email, "token_activation.tmpl", map[string]any{
@@ -127,6 +164,95 @@ func (s Scheduler) sendTokenActivatoinEmail(task Task) {
 	s.handleMailError(task, err)
 }
 
+func (s Scheduler) sendExportReadyEmail(task Task) {
+	data, ok := task.Data.(TaskExportReadyData)
+	if !ok {
+		return
+	}
+
+	if task.Retries > task.MaxRetries {
+		return
+	}
+
+	err := s.Mailer.Send(data.Email, "export_ready.tmpl", map[string]any{
+		"downloadURL": data.DownloadURL,
+		"expiresAt":   data.ExpiresAt.Format("January 2, 2006 15:04 MST"),
+	})
+
+	s.handleMailError(task, err)
+}
+
+func (s Scheduler) sendEmailChangeEmail(task Task) {
+	data, ok := task.Data.(TaskEmailChangeData)
+	if !ok {
+		return
+	}
+
+	if task.Retries > task.MaxRetries {
+		return
+	}
+
+	err := s.Mailer.Send(data.Email, "email_change.tmpl", map[string]any{
+		"confirmURL": data.ConfirmURL,
+	})
+
+	s.handleMailError(task, err)
+}
+
+func (s Scheduler) sendEmailChangeNotice(task Task) {
+	data, ok := task.Data.(TaskEmailChangeNoticeData)
+	if !ok {
+		return
+	}
+
+	if task.Retries > task.MaxRetries {
+		return
+	}
+
+	err := s.Mailer.Send(data.Email, "email_change_notice.tmpl", map[string]any{
+		"newEmail": data.NewEmail,
+	})
+
+	s.handleMailError(task, err)
+}
+
+func (s Scheduler) sendSuspiciousLoginEmail(task Task) {
+	data, ok := task.Data.(TaskSuspiciousLoginData)
+	if !ok {
+		return
+	}
+
+	if task.Retries > task.MaxRetries {
+		return
+	}
+
+	err := s.Mailer.Send(data.Email, "suspicious_login.tmpl", map[string]any{
+		"ip":          data.IP,
+		"attempts":    data.Attempts,
+		"lockedUntil": data.LockedUntil.UTC().Format("Jan 2, 2006 15:04 MST"),
+		"unlockURL":   data.UnlockURL,
+	})
+
+	s.handleMailError(task, err)
+}
+
+func (s Scheduler) sendMagicLinkEmail(task Task) {
+	data, ok := task.Data.(TaskMagicLinkData)
+	if !ok {
+		return
+	}
+
+	if task.Retries > task.MaxRetries {
+		return
+	}
+
+	err := s.Mailer.Send(data.Email, "magic_link.tmpl", map[string]any{
+		"loginURL": data.LoginURL,
+	})
+
+	s.handleMailError(task, err)
+}
+
 func (s Scheduler) handleMailError(task Task, err error) {
 	var mailerErr *mailer.MailerError
 	if errors.As(err, &mailerErr) {
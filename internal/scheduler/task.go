@@ -6,6 +6,12 @@ const (
 	SendActivationEmail      = "send-activation-email"
 	SendPasswordResetEmail   = "send-password-reset-email"
 	SendTokenActivatoinEmail = "send-token-activation-email"
+	SendExportReadyEmail     = "send-export-ready-email"
+	SendEmailChangeEmail     = "send-email-change-email"
+	SendEmailChangeNotice    = "send-email-change-notice"
+	SendSuspiciousLoginEmail = "send-suspicious-login-email"
+	SendMagicLinkEmail       = "send-magic-link-email"
+	BuildExport              = "build-export"
 )
 
 type Task struct {
@@ -33,3 +39,37 @@ type TaskTokenActivationData struct {
 	Email         string
 	ActivationURL string
 }
+
+type TaskExportData struct {
+	ExportID int64
+	UserID   int64
+}
+
+type TaskExportReadyData struct {
+	Email       string
+	DownloadURL string
+	ExpiresAt   time.Time
+}
+
+type TaskEmailChangeData struct {
+	Email      string
+	ConfirmURL string
+}
+
+type TaskEmailChangeNoticeData struct {
+	Email    string
+	NewEmail string
+}
+
+type TaskSuspiciousLoginData struct {
+	Email       string
+	IP          string
+	Attempts    int64
+	LockedUntil time.Time
+	UnlockURL   string
+}
+
+type TaskMagicLinkData struct {
+	Email    string
+	LoginURL string
+}
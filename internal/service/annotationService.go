@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+)
+
+// AnnotationService gathers a user's notes and highlights across chapters
+type AnnotationService struct {
+	annotationModel data.AnnotationModel
+	validator       *BibleValidator
+}
+
+func NewAnnotationService(annotationModel data.AnnotationModel, validator *BibleValidator) *AnnotationService {
+	return &AnnotationService{
+		annotationModel: annotationModel,
+		validator:       validator,
+	}
+}
+
+// AnnotationsInput selects a chapter range of a book, ToChapter 0 means to the end of the book
+type AnnotationsInput struct {
+	Book        string
+	FromChapter int
+	ToChapter   int
+	Page        int
+	PageSize    int
+}
+
+// ChapterAnnotations are the annotations of one chapter, grouped by starting verse
+type ChapterAnnotations struct {
+	Chapter int                 `json:"chapter"`
+	Verses  []*VerseAnnotations `json:"verses"`
+}
+
+// VerseAnnotations are the notes and highlights starting at a verse.
+// Verse 0 holds highlights covering the whole chapter.
+type VerseAnnotations struct {
+	Verse      int                  `json:"verse"`
+	Notes      []*data.NoteResponse `json:"notes"`
+	Highlights []*data.Highlight    `json:"highlights"`
+}
+
+// ListAnnotations retrieves the user's located notes and highlights of a chapter range,
+// grouped by chapter and verse. Pagination counts notes and highlights together.
+func (s *AnnotationService) ListAnnotations(ctx context.Context, userID int64, input AnnotationsInput) ([]*ChapterAnnotations, data.Metadata, *validator.Validator, error) {
+	filter := &data.AnnotationFilters{
+		Filters: data.Filters{
+			Page:     input.Page,
+			PageSize: input.PageSize,
+		},
+		Book:        input.Book,
+		FromChapter: input.FromChapter,
+		ToChapter:   input.ToChapter,
+	}
+
+	if filter.FromChapter == 0 {
+		filter.FromChapter = 1
+	}
+	if filter.ToChapter == 0 {
+		filter.ToChapter = 150
+	}
+
+	v := validator.New()
+	filter.Filters.Validate(v)
+	// The chapter range is checked below, under its own keys
+	s.validator.ValidateBook(v, filter.Book, 1, -1, -1)
+	v.Check(filter.FromChapter > 0 && filter.FromChapter <= 150, "from", "must be between 1 and 150")
+	v.Check(filter.ToChapter > 0 && filter.ToChapter <= 150, "to", "must be between 1 and 150")
+	v.Check(filter.FromChapter <= filter.ToChapter, "to", "must be greater than or equal to from")
+	if !v.Valid() {
+		return nil, data.Metadata{}, v, nil
+	}
+
+	annotations, metadata, err := s.annotationModel.GetForChapters(ctx, userID, filter)
+	if err != nil {
+		return nil, data.Metadata{}, nil, fmt.Errorf("list annotations: %w", err)
+	}
+
+	return groupAnnotations(annotations), metadata, nil, nil
+}
+
+// groupAnnotations groups annotations sorted by chapter and verse, keeping their order
+func groupAnnotations(annotations []*data.Annotation) []*ChapterAnnotations {
+	chapters := []*ChapterAnnotations{}
+
+	var chapter *ChapterAnnotations
+	var verse *VerseAnnotations
+
+	for _, annotation := range annotations {
+		if chapter == nil || chapter.Chapter != annotation.Chapter {
+			chapter = &ChapterAnnotations{Chapter: annotation.Chapter, Verses: []*VerseAnnotations{}}
+			chapters = append(chapters, chapter)
+			verse = nil
+		}
+
+		if verse == nil || verse.Verse != annotation.Verse {
+			verse = &VerseAnnotations{
+				Verse:      annotation.Verse,
+				Notes:      []*data.NoteResponse{},
+				Highlights: []*data.Highlight{},
+			}
+			chapter.Verses = append(chapter.Verses, verse)
+		}
+
+		switch annotation.Kind {
+		case data.AnnotationKindNote:
+			verse.Notes = append(verse.Notes, annotation.Note)
+		case data.AnnotationKindHighlight:
+			verse.Highlights = append(verse.Highlights, annotation.Highlight)
+		}
+	}
+
+	return chapters
+}
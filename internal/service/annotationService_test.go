@@ -0,0 +1,50 @@
+package service
+
+import (
+	"shuvoedward/Bible_project/internal/data"
+	"testing"
+)
+
+func TestGroupAnnotations(t *testing.T) {
+	note := func(id int64, chapter, verse int) *data.Annotation {
+		return &data.Annotation{Kind: data.AnnotationKindNote, Chapter: chapter, Verse: verse, Note: &data.NoteResponse{ID: id}}
+	}
+	highlight := func(id int64, chapter, verse int) *data.Annotation {
+		return &data.Annotation{Kind: data.AnnotationKindHighlight, Chapter: chapter, Verse: verse, Highlight: &data.Highlight{ID: id}}
+	}
+
+	chapters := groupAnnotations([]*data.Annotation{
+		highlight(1, 1, 0),
+		note(10, 1, 1),
+		highlight(2, 1, 1),
+		note(11, 1, 16),
+		note(12, 8, 28),
+	})
+
+	if len(chapters) != 2 {
+		t.Fatalf("got %d chapters, want 2", len(chapters))
+	}
+
+	first := chapters[0]
+	if first.Chapter != 1 || len(first.Verses) != 3 {
+		t.Fatalf("chapter 1: got chapter %d with %d verses, want 3 verses", first.Chapter, len(first.Verses))
+	}
+
+	verse := first.Verses[1]
+	if verse.Verse != 1 || len(verse.Notes) != 1 || len(verse.Highlights) != 1 {
+		t.Errorf("verse 1: got %d notes and %d highlights, want 1 and 1", len(verse.Notes), len(verse.Highlights))
+	}
+
+	if first.Verses[0].Verse != 0 || len(first.Verses[0].Notes) != 0 {
+		t.Errorf("verse 0 should only hold the whole-chapter highlight")
+	}
+
+	last := chapters[1]
+	if last.Chapter != 8 || last.Verses[0].Notes[0].ID != 12 {
+		t.Errorf("chapter 8: got %+v", last)
+	}
+
+	if got := groupAnnotations(nil); len(got) != 0 {
+		t.Errorf("groupAnnotations(nil) = %v, want empty", got)
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/cache"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"slices"
+	"strings"
+	"time"
+)
+
+const maxAPIKeys = 20
+
+// APIKeyInput holds the fields of a new API key, a nil Expiry never expires
+type APIKeyInput struct {
+	Name   string
+	Scopes []string
+	Expiry *time.Time
+}
+
+type APIKeyService struct {
+	apiKeyModel data.APIKeyModel
+	redis       *cache.RedisClient
+	logger      *slog.Logger
+}
+
+func NewAPIKeyService(apiKeyModel data.APIKeyModel, redis *cache.RedisClient, logger *slog.Logger) *APIKeyService {
+	return &APIKeyService{
+		apiKeyModel: apiKeyModel,
+		redis:       redis,
+		logger:      logger,
+	}
+}
+
+// CreateAPIKey validates and creates an API key for the user
+// Returns the key with its plaintext, which isn't retrievable later, and validation and error
+// Returns data.ErrDuplicateAPIKeyName if the user has a key with the same name
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, userID int64, input APIKeyInput) (*data.APIKey, *validator.Validator, error) {
+	key := &data.APIKey{
+		UserID: userID,
+		Name:   strings.TrimSpace(input.Name),
+		Scopes: input.Scopes,
+		Expiry: input.Expiry,
+	}
+
+	v := validator.New()
+	validateAPIKey(v, key)
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	keys, err := s.apiKeyModel.GetAllForUser(ctx, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get api keys: %w", err)
+	}
+
+	v.Check(len(keys) < maxAPIKeys, "api_keys", fmt.Sprintf("must not be more than %d, delete unused ones", maxAPIKeys))
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	err = s.apiKeyModel.New(ctx, key)
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateAPIKeyName) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("create api key: %w", err)
+	}
+
+	return key, nil, nil
+}
+
+// ListAPIKeys retrieves the user's API keys without their plaintext
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, userID int64) ([]*data.APIKey, error) {
+	keys, err := s.apiKeyModel.GetAllForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey revokes one of the user's API keys, it stops working immediately
+// Returns ErrAPIKeyNotFound if the key doesn't exist or belongs to another user
+func (s *APIKeyService) DeleteAPIKey(ctx context.Context, userID, keyID int64) error {
+	err := s.apiKeyModel.Delete(ctx, keyID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return fmt.Errorf("delete api key: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserForAPIKey authenticates a request made with an API key
+// Returns the key's user and the key, whose scopes limit what the request can do
+// Returns ErrInvalidToken if the key is unknown or expired
+func (s *APIKeyService) GetUserForAPIKey(ctx context.Context, keyPlaintext string) (*data.User, *data.APIKey, error) {
+	if len(keyPlaintext) != len(data.APIKeyPrefix)+26 {
+		return nil, nil, ErrInvalidToken
+	}
+
+	user, key, err := s.apiKeyModel.GetUser(ctx, keyPlaintext)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+
+	s.touchAPIKey(ctx, key.ID)
+
+	return user, key, nil
+}
+
+// touchAPIKey records the use of an API key at most once per sessionTouchInterval
+func (s *APIKeyService) touchAPIKey(ctx context.Context, keyID int64) {
+	key := fmt.Sprintf("api_key_used:%d", keyID)
+
+	due, err := s.redis.SetNX(ctx, key, "1", sessionTouchInterval)
+	if err != nil {
+		s.logger.Error("failed to throttle api key update", "error", err)
+		return
+	}
+	if !due {
+		return
+	}
+
+	err = s.apiKeyModel.Touch(ctx, keyID)
+	if err != nil {
+		s.logger.Error("failed to update api key last use", "error", err)
+	}
+}
+
+func validateAPIKey(v *validator.Validator, key *data.APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Scopes) > 0, "scopes", "must contain at least one scope")
+	v.Check(len(slices.Compact(slices.Sorted(slices.Values(key.Scopes)))) == len(key.Scopes), "scopes", "must not contain duplicate values")
+	for _, scope := range key.Scopes {
+		v.Check(slices.Contains(data.APIScopes, scope), "scopes",
+			fmt.Sprintf("must only contain %s", strings.Join(data.APIScopes, ", ")))
+	}
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"slices"
+)
+
+const maxBatchItems = 500
+
+// Batch modes. In atomic mode nothing is inserted unless every item is; in partial
+// mode the valid items are inserted and the others reported.
+const (
+	BatchModeAtomic  = "atomic"
+	BatchModePartial = "partial"
+)
+
+const (
+	BatchStatusCreated    = "created"
+	BatchStatusInvalid    = "invalid"
+	BatchStatusFailed     = "failed"
+	BatchStatusRolledBack = "rolled_back"
+)
+
+// errBatchRolledBack aborts the transaction of an atomic batch with a failed item
+var errBatchRolledBack = errors.New("batch rolled back")
+
+// BatchItemResult is the outcome of one item, Index is its position in the request
+type BatchItemResult struct {
+	Index  int               `json:"index"`
+	Status string            `json:"status"`
+	ID     int64             `json:"id,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// BatchReport holds one result per item, in request order
+type BatchReport struct {
+	Mode    string             `json:"mode"`
+	Created int                `json:"created"`
+	Failed  int                `json:"failed"`
+	Items   []*BatchItemResult `json:"items"`
+}
+
+// Complete reports whether every item was created
+func (r *BatchReport) Complete() bool {
+	return r.Failed == 0
+}
+
+func validateBatch(v *validator.Validator, mode string, count int) {
+	v.Check(slices.Contains([]string{BatchModeAtomic, BatchModePartial}, mode), "mode", "must be atomic or partial")
+	v.Check(count > 0, "items", "must contain at least one item")
+	v.Check(count <= maxBatchItems, "items", fmt.Sprintf("must not contain more than %d items", maxBatchItems))
+}
+
+// batchInsert validates every item, then inserts the valid ones in a single transaction.
+// insert returns the ID of the created item; failure maps the errors expected for an
+// item to a reason, any other error fails the whole batch.
+// In partial mode each insert runs in a savepoint so a failing item doesn't undo the others.
+func batchInsert(
+	ctx context.Context,
+	models data.Models,
+	mode string,
+	count int,
+	validate func(i int) *validator.Validator,
+	insert func(tx data.Models, i int) (int64, error),
+	failure func(err error) (string, bool),
+) (*BatchReport, error) {
+	report := &BatchReport{Mode: mode, Items: make([]*BatchItemResult, count)}
+
+	for i := range count {
+		report.Items[i] = &BatchItemResult{Index: i}
+		if v := validate(i); !v.Valid() {
+			report.Items[i].Status = BatchStatusInvalid
+			report.Items[i].Errors = v.Errors
+			report.Failed++
+		}
+	}
+
+	if mode == BatchModeAtomic && report.Failed > 0 {
+		report.rollBack()
+		return report, nil
+	}
+
+	err := models.WithTx(ctx, func(tx data.Models) error {
+		for _, item := range report.Items {
+			if item.Status == BatchStatusInvalid {
+				continue
+			}
+
+			var id int64
+			err := tx.Savepoint(ctx, func() error {
+				var err error
+				id, err = insert(tx, item.Index)
+				return err
+			})
+			if err != nil {
+				reason, expected := failure(err)
+				if !expected {
+					return err
+				}
+
+				item.Status = BatchStatusFailed
+				item.Reason = reason
+				report.Failed++
+
+				if mode == BatchModeAtomic {
+					return errBatchRolledBack
+				}
+				continue
+			}
+
+			item.Status = BatchStatusCreated
+			item.ID = id
+			report.Created++
+		}
+
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errBatchRolledBack):
+		report.rollBack()
+	case err != nil:
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// rollBack marks every item that isn't invalid or failed as rolled back
+func (r *BatchReport) rollBack() {
+	r.Created = 0
+	for _, item := range r.Items {
+		if item.Status == BatchStatusInvalid || item.Status == BatchStatusFailed {
+			continue
+		}
+		item.Status = BatchStatusRolledBack
+		item.ID = 0
+	}
+}
@@ -19,13 +19,18 @@ type highlightReader interface {
 	Get(ctx context.Context, userID int64, filter *data.LocationFilters) ([]*data.Highlight, error)
 }
 
+type paletteReader interface {
+	GetAll(ctx context.Context, userID int64) ([]*data.PaletteEntry, error)
+}
+
 type noteReader interface {
-	GetAllLocatedForChapter(ctx context.Context, userID int64, filter *data.LocationFilters) ([]*data.NoteResponse, []*data.NoteResponse, error)
+	GetAllLocatedForChapter(ctx context.Context, userID int64, filter *data.LocationFilters) ([]*data.NoteResponse, []*data.NoteResponse, []*data.NoteResponse, error)
 }
 
 type BookService struct {
 	passageModel   passageReader
 	highlightModel highlightReader
+	paletteModel   paletteReader
 	noteModel      noteReader
 	validator      *BibleValidator
 	logger         *slog.Logger
@@ -34,6 +39,7 @@ type BookService struct {
 func NewBookService(
 	passageModel passageReader,
 	highlightModel highlightReader,
+	paletteModel paletteReader,
 	noteModel noteReader,
 	validator *BibleValidator,
 	logger *slog.Logger,
@@ -41,28 +47,57 @@ func NewBookService(
 	return &BookService{
 		passageModel:   passageModel,
 		highlightModel: highlightModel,
+		paletteModel:   paletteModel,
 		noteModel:      noteModel,
 		validator:      validator,
 		logger:         logger,
 	}
 }
 
+// PassageOptions choose how a passage is shown, options left empty fall back to the
+// user's preferences. SkipNotes and SkipHighlights leave out user data the caller
+// may not read, e.g. with an API key lacking its scope.
+type PassageOptions struct {
+	Translation    string
+	VerseNumbers   string
+	SkipNotes      bool
+	SkipHighlights bool
+}
+
 type PassageResponse struct {
-	Passage       *data.Passage
-	Highlights    []*data.Highlight
-	BibleNotes    []*data.NoteResponse
-	CrossRefNotes []*data.NoteResponse
+	Passage          *data.Passage
+	Translation      string
+	VerseNumbers     string // how the client shows verse numbers
+	HighlightColor   string // color new highlights get unless another one is picked
+	Highlights       []*data.Highlight
+	Legend           []*data.PaletteEntry // palette entries used by the highlights, in palette order
+	BibleNotes       []*data.NoteResponse
+	CrossRefNotes    []*data.NoteResponse
+	ReferencingNotes []*data.NoteResponse // GENERAL notes whose content references the passage
 }
 
-// GetPassageWithUserData handles validation and retrieves passage, and highlights, Bible notes and cross-ref notes if user authenticated and active
+// GetPassageWithUserData handles validation and retrieves passage, and highlights, Bible notes, cross-ref notes and referencing notes if user authenticated and active
+// The user's preferences fill the options the request left empty, anonymous users get the defaults
 // Returns PassageResponse, validation error and error
-func (s *BookService) GetPassageWithUserData(ctx context.Context, userID int64, isAuthenticated bool, filter *data.LocationFilters) (*PassageResponse, *validator.Validator, error) {
+func (s *BookService) GetPassageWithUserData(ctx context.Context, user *data.User, filter *data.LocationFilters, options PassageOptions) (*PassageResponse, *validator.Validator, error) {
+	preferences := user.Preferences.WithDefaults()
+	if options.Translation == "" {
+		options.Translation = preferences.Translation
+	}
+	if options.VerseNumbers == "" {
+		options.VerseNumbers = preferences.VerseNumbers
+	}
+
 	v := validator.New()
+	validateTranslation(v, options.Translation)
+	validateVerseNumbers(v, options.VerseNumbers)
 	s.validator.ValidateBook(v, filter.Book, filter.Chapter, filter.StartVerse, filter.EndVerse)
 	if !v.Valid() {
 		return nil, v, nil
 	}
 
+	userID, isAuthenticated := user.ID, user.Activated
+
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
@@ -75,10 +110,15 @@ func (s *BookService) GetPassageWithUserData(ctx context.Context, userID int64,
 	}
 
 	response := &PassageResponse{
-		Passage:       passage,
-		Highlights:    []*data.Highlight{},
-		BibleNotes:    []*data.NoteResponse{},
-		CrossRefNotes: []*data.NoteResponse{},
+		Passage:          passage,
+		Translation:      options.Translation,
+		VerseNumbers:     options.VerseNumbers,
+		HighlightColor:   preferences.HighlightColor,
+		Highlights:       []*data.Highlight{},
+		Legend:           []*data.PaletteEntry{},
+		BibleNotes:       []*data.NoteResponse{},
+		CrossRefNotes:    []*data.NoteResponse{},
+		ReferencingNotes: []*data.NoteResponse{},
 	}
 
 	if !isAuthenticated {
@@ -86,34 +126,75 @@ func (s *BookService) GetPassageWithUserData(ctx context.Context, userID int64,
 	}
 
 	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		highlights, err := s.highlightModel.Get(ctx, userID, filter)
-		if err != nil {
-			s.logger.Error("failed to get highlights", "error", err)
-		} else {
+
+	if !options.SkipHighlights {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			highlights, err := s.highlightModel.Get(ctx, userID, filter)
+			if err != nil {
+				s.logger.Error("failed to get highlights", "error", err)
+				return
+			}
 			response.Highlights = highlights
-		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		bibleNotes, crossRefNotes, err := s.noteModel.GetAllLocatedForChapter(ctx, userID, filter)
-		if err != nil {
-			s.logger.Error("failed to get notes", "error", err)
-		} else {
-			response.BibleNotes = bibleNotes
-			response.CrossRefNotes = crossRefNotes
-		}
-	}()
+
+			legend, err := s.legend(ctx, userID, highlights)
+			if err != nil {
+				s.logger.Error("failed to get highlight palette", "error", err)
+				return
+			}
+			response.Legend = legend
+		}()
+	}
+
+	if !options.SkipNotes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bibleNotes, crossRefNotes, referencingNotes, err := s.noteModel.GetAllLocatedForChapter(ctx, userID, filter)
+			if err != nil {
+				s.logger.Error("failed to get notes", "error", err)
+			} else {
+				response.BibleNotes = bibleNotes
+				response.CrossRefNotes = crossRefNotes
+				response.ReferencingNotes = referencingNotes
+			}
+		}()
+	}
 
 	wg.Wait()
 
 	return response, nil, nil
 }
 
+// legend returns the user's palette entries referenced by highlights, in palette order
+func (s *BookService) legend(ctx context.Context, userID int64, highlights []*data.Highlight) ([]*data.PaletteEntry, error) {
+	used := make(map[int64]bool)
+	for _, highlight := range highlights {
+		if highlight.PaletteID != nil {
+			used[*highlight.PaletteID] = true
+		}
+	}
+
+	legend := []*data.PaletteEntry{}
+	if len(used) == 0 {
+		return legend, nil
+	}
+
+	entries, err := s.paletteModel.GetAll(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if used[entry.ID] {
+			legend = append(legend, entry)
+		}
+	}
+
+	return legend, nil
+}
+
 func (s *BookService) SearchVersesByWord(
 	ctx context.Context,
 	searchQuery string,
@@ -8,6 +8,8 @@ var (
 	ErrLinkNotFound    = errors.New("link not found")
 	ErrNoteNotFound    = errors.New("note not found")
 	ErrUnauthorized    = errors.New("unauthorized access")
+
+	ErrInvalidReference = errors.New("invalid scripture reference")
 )
 
 var (
@@ -17,12 +19,37 @@ var (
 	ErrEmailNotFound    = errors.New("email invalid")
 	ErrPasswordNotMatch = errors.New("password did not match")
 	ErrUserActivated    = errors.New("user has already been activated")
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrLoginLocked      = errors.New("too many failed logins")
+
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	ErrOIDCProviderNotFound = errors.New("identity provider not found")
+	ErrInvalidOIDCState     = errors.New("invalid or expired login state")
+	ErrOIDCLoginFailed      = errors.New("identity provider login failed")
+	ErrOIDCEmailNotVerified = errors.New("identity provider has not verified the email")
+)
+
+var (
+	ErrHighlightNotFound    = errors.New("highlight not found")
+	ErrPaletteEntryNotFound = errors.New("palette entry not found")
+	ErrPassageNotFound      = errors.New("passage not found")
+	ErrInvalidToken         = errors.New("invalid token")
+)
+
+// ExportService errors
+var (
+	ErrExportNotFound = errors.New("export not found")
 )
 
+// TemplateService errors
 var (
-	ErrHighlightNotFound = errors.New("highlight not found")
-	ErrPassageNotFound   = errors.New("passage not found")
-	ErrInvalidToken      = errors.New("invalid token")
+	ErrTemplateNotFound = errors.New("template not found")
 )
 
 // AutocompleteService errors
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/events"
+)
+
+// maxEventReplay caps the changes replayed on resume, beyond it the client is told to resync
+const maxEventReplay = 500
+
+type EventSubscriber interface {
+	Subscribe(userID int64) *events.Subscription
+}
+
+// EventService streams a user's changes as they are committed
+type EventService struct {
+	broker    EventSubscriber
+	syncModel data.SyncModel
+}
+
+func NewEventService(broker EventSubscriber, syncModel data.SyncModel) *EventService {
+	return &EventService{
+		broker:    broker,
+		syncModel: syncModel,
+	}
+}
+
+// EventStream holds the changes missed since the client's last event, followed by
+// the live subscription. Resync is set instead of Replay when too many changes were
+// missed, the client then catches up through GET /v1/sync.
+type EventStream struct {
+	Replay       []events.Event
+	Resync       bool
+	Subscription *events.Subscription
+}
+
+// Subscribe starts streaming the user's changes. With a lastEventID the changes made
+// after it are replayed first; the subscription starts before the replay is read, so
+// events may show up in both and the caller skips live events up to the last replayed one.
+func (s *EventService) Subscribe(ctx context.Context, userID, lastEventID int64) (*EventStream, error) {
+	stream := &EventStream{Subscription: s.broker.Subscribe(userID)}
+
+	if lastEventID <= 0 {
+		return stream, nil
+	}
+
+	changes, err := s.syncModel.GetChanges(ctx, userID, lastEventID, maxEventReplay+1)
+	if err != nil {
+		stream.Subscription.Close()
+		return nil, fmt.Errorf("get missed changes: %w", err)
+	}
+
+	if len(changes) > maxEventReplay {
+		stream.Resync = true
+		return stream, nil
+	}
+
+	stream.Replay = make([]events.Event, len(changes))
+	for i, change := range changes {
+		stream.Replay[i] = events.Event{
+			ID:       change.Cursor,
+			UserID:   userID,
+			Entity:   change.Entity,
+			EntityID: change.EntityID,
+			Deleted:  change.Deleted,
+		}
+	}
+
+	return stream, nil
+}
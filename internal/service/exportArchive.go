@@ -0,0 +1,201 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"shuvoedward/Bible_project/internal/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportDump is the JSON document at the root of an export archive
+type exportDump struct {
+	ExportedAt    time.Time          `json:"exported_at"`
+	Notes         []*data.ExportNote `json:"notes"`
+	Highlights    []*data.Highlight  `json:"highlights"`
+	MissingImages []string           `json:"missing_images,omitempty"`
+}
+
+// exportImage is an image file to include in the archive, keyed by its path inside it
+type exportImage struct {
+	Path    string
+	Content []byte
+}
+
+// writeExportArchive builds the zip archive:
+//
+//	export.json            full dump of notes, locations, images metadata and highlights
+//	notes/<id>-<slug>.md   one Markdown file per note with front-matter
+//	images/<note_id>/...   image files
+func writeExportArchive(dump *exportDump, images []exportImage) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	js, err := json.MarshalIndent(dump, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeZipFile(zw, "export.json", js, dump.ExportedAt); err != nil {
+		return nil, err
+	}
+
+	for _, note := range dump.Notes {
+		if err := writeZipFile(zw, noteMarkdownPath(note), noteMarkdown(note), note.UpdatedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, image := range images {
+		if err := writeZipFile(zw, image.Path, image.Content, dump.ExportedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeZipFile(zw *zip.Writer, name string, content []byte, modified time.Time) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(content)
+	return err
+}
+
+// noteMarkdown renders a note as Markdown with YAML front-matter.
+// Locations linked by the user are listed under "locations"; references detected
+// in the content are listed under "references" since they are derived on save.
+func noteMarkdown(note *data.ExportNote) []byte {
+	var b strings.Builder
+
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %d\n", note.ID)
+	if note.Title != "" {
+		fmt.Fprintf(&b, "title: %s\n", strconv.Quote(note.Title))
+	}
+	fmt.Fprintf(&b, "note_type: %s\n", note.NoteType)
+	fmt.Fprintf(&b, "created_at: %s\n", note.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "updated_at: %s\n", note.UpdatedAt.UTC().Format(time.RFC3339))
+
+	var locations, references []string
+	for _, location := range note.Locations {
+		reference := formatReference(location.Book, location.Chapter, location.StartVerse, location.EndVerse)
+		if location.Derived {
+			references = append(references, reference)
+		} else {
+			locations = append(locations, reference)
+		}
+	}
+
+	if note.Target != nil {
+		target := formatReference(note.Target.Book, note.Target.Chapter, note.Target.StartVerse, note.Target.EndVerse)
+		fmt.Fprintf(&b, "target: %s\n", strconv.Quote(target))
+	}
+
+	writeFrontMatterList(&b, "locations", locations)
+	writeFrontMatterList(&b, "references", references)
+
+	imagePaths := make([]string, len(note.Images))
+	for i, image := range note.Images {
+		imagePaths[i] = "../" + exportImagePath(image)
+	}
+	writeFrontMatterList(&b, "images", imagePaths)
+
+	// Content is written verbatim so a re-import hashes to the same content_hash
+	b.WriteString("---\n\n")
+	b.WriteString(note.Content)
+
+	return []byte(b.String())
+}
+
+func writeFrontMatterList(b *strings.Builder, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "%s:\n", key)
+	for _, value := range values {
+		fmt.Fprintf(b, "  - %s\n", strconv.Quote(value))
+	}
+}
+
+// formatReference formats a location as "John 3:16" or "John 3:16-18"
+func formatReference(book string, chapter, startVerse, endVerse int) string {
+	if endVerse > startVerse {
+		return fmt.Sprintf("%s %d:%d-%d", book, chapter, startVerse, endVerse)
+	}
+	return fmt.Sprintf("%s %d:%d", book, chapter, startVerse)
+}
+
+func noteMarkdownPath(note *data.ExportNote) string {
+	name := note.Title
+	if name == "" {
+		name = note.NoteType
+		if len(note.Locations) > 0 {
+			location := note.Locations[0]
+			name += " " + formatReference(location.Book, location.Chapter, location.StartVerse, location.EndVerse)
+		}
+	}
+
+	return fmt.Sprintf("notes/%d-%s.md", note.ID, slugify(name))
+}
+
+func exportImagePath(image *data.ImageData) string {
+	ext := path.Ext(image.S3Key)
+	switch image.MimeType {
+	case "image/webp":
+		ext = ".webp"
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/png":
+		ext = ".png"
+	}
+
+	return fmt.Sprintf("images/%d/%d%s", image.NoteID, image.ID, ext)
+}
+
+// slugify keeps letters and digits, joining words with dashes, for portable file names
+func slugify(s string) string {
+	const maxSlugLength = 60
+
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(s) {
+		isAlnum := (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+		if isAlnum {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+
+		if b.Len() >= maxSlugLength {
+			break
+		}
+	}
+
+	if b.Len() == 0 {
+		return "note"
+	}
+
+	return b.String()
+}
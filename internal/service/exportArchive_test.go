@@ -0,0 +1,66 @@
+package service
+
+import (
+	"shuvoedward/Bible_project/internal/data"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNoteMarkdown(t *testing.T) {
+	created := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	note := &data.ExportNote{
+		NoteResponse: data.NoteResponse{
+			ID:        7,
+			Title:     `Grace "alone"`,
+			Content:   "compare Isaiah 53:5",
+			NoteType:  data.NoteTypeGeneral,
+			CreatedAt: created,
+			UpdatedAt: created,
+		},
+		Locations: []*data.LocationResponse{
+			{Book: "Isaiah", Chapter: 53, StartVerse: 5, EndVerse: 5, Derived: true},
+		},
+		Images: []*data.ImageData{
+			{ID: 3, NoteID: 7, S3Key: "users/1/notes/x.webp", MimeType: "image/webp"},
+		},
+	}
+
+	want := `---
+id: 7
+title: "Grace \"alone\""
+note_type: GENERAL
+created_at: 2025-03-01T10:00:00Z
+updated_at: 2025-03-01T10:00:00Z
+references:
+  - "Isaiah 53:5"
+images:
+  - "../images/7/3.webp"
+---
+
+compare Isaiah 53:5`
+
+	if got := string(noteMarkdown(note)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := noteMarkdownPath(note); got != "notes/7-grace-alone.md" {
+		t.Errorf("got path %q", got)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Sermon: Romans 8!":     "sermon-romans-8",
+		"  ":                    "note",
+		"BIBLE John 3:16":       "bible-john-3-16",
+		strings.Repeat("a", 80): strings.Repeat("a", 60),
+	}
+
+	for input, want := range tests {
+		if got := slugify(input); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/scheduler"
+	"time"
+)
+
+const (
+	// exportLinkTTL is how long the emailed download link stays valid
+	exportLinkTTL = 24 * time.Hour
+
+	// exportStaleAfter is when a pending export is taken as lost, e.g. to a restart
+	// while it was queued, well past the time a build is given
+	exportStaleAfter = 30 * time.Minute
+)
+
+type ImageDownloader interface {
+	DownloadImage(ctx context.Context, s3Key string) ([]byte, error)
+}
+
+type ExportUploader interface {
+	UploadExport(ctx context.Context, archive []byte, userID int64) (string, error)
+}
+
+type ImageStorageExport interface {
+	ImageDownloader
+	ExportUploader
+	PresignedURLGenerator
+}
+
+// ExportService builds archives of a user's study data in the background
+type ExportService struct {
+	exportModel data.ExportModel
+	userModel   data.UserModel
+	storage     ImageStorageExport
+	scheduler   *scheduler.Scheduler
+	logger      *slog.Logger
+}
+
+func NewExportService(
+	exportModel data.ExportModel,
+	userModel data.UserModel,
+	storage ImageStorageExport,
+	taskScheduler *scheduler.Scheduler,
+	logger *slog.Logger,
+) *ExportService {
+	s := &ExportService{
+		exportModel: exportModel,
+		userModel:   userModel,
+		storage:     storage,
+		scheduler:   taskScheduler,
+		logger:      logger,
+	}
+
+	taskScheduler.Handle(scheduler.BuildExport, s.processExport)
+
+	return s
+}
+
+// RequestExport creates a pending export and hands it to the scheduler. If the user
+// already has an export in progress, that export is returned instead. Exports pending
+// for longer than exportStaleAfter were lost, they are marked as failed and replaced.
+func (s *ExportService) RequestExport(ctx context.Context, userID int64) (*data.Export, error) {
+	export, err := s.exportModel.Insert(ctx, userID)
+	if errors.Is(err, data.ErrExportInProgress) {
+		export, err = s.pendingExport(ctx, userID)
+		if err != nil || export != nil {
+			return export, err
+		}
+
+		export, err = s.exportModel.Insert(ctx, userID)
+	}
+	if err != nil {
+		if errors.Is(err, data.ErrExportInProgress) {
+			// another request just started one
+			export, err = s.exportModel.GetPending(ctx, userID)
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil, data.ErrExportInProgress
+			}
+		}
+		return export, err
+	}
+
+	task := scheduler.Task{
+		Type: scheduler.BuildExport,
+		Data: scheduler.TaskExportData{
+			ExportID: export.ID,
+			UserID:   userID,
+		},
+		CreatedAt: time.Now(),
+	}
+
+	s.scheduler.Submit(task)
+
+	return export, nil
+}
+
+// pendingExport returns the user's export in progress, or nil after failing a stale one
+func (s *ExportService) pendingExport(ctx context.Context, userID int64) (*data.Export, error) {
+	export, err := s.exportModel.GetPending(ctx, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil // finished meanwhile
+		}
+		return nil, fmt.Errorf("get pending export: %w", err)
+	}
+
+	if time.Since(export.CreatedAt) < exportStaleAfter {
+		return export, nil
+	}
+
+	s.logger.Warn("failing stale export", "export_id", export.ID, "user_id", userID, "created_at", export.CreatedAt)
+
+	err = s.exportModel.Fail(ctx, export.ID, "export was interrupted, request a new one")
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, fmt.Errorf("fail stale export: %w", err)
+	}
+
+	return nil, nil
+}
+
+// GetExport retrieves an export with a fresh download link while the archive is still available
+func (s *ExportService) GetExport(ctx context.Context, userID, exportID int64) (*data.Export, error) {
+	export, err := s.exportModel.Get(ctx, exportID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+
+	if export.Status != data.ExportStatusCompleted || export.S3Key == nil || export.ExpiresAt == nil {
+		return export, nil
+	}
+
+	remaining := time.Until(*export.ExpiresAt)
+	if remaining <= 0 {
+		return export, nil
+	}
+
+	export.DownloadURL, err = s.storage.GeneratePresignedURL(ctx, *export.S3Key, remaining)
+	if err != nil {
+		// Log error but still return the status
+		s.logger.Error("failed to generate export download url", "export_id", export.ID, "error", err)
+	}
+
+	return export, nil
+}
+
+// processExport runs on a scheduler worker: builds the archive, uploads it and
+// emails a time-limited download link
+func (s *ExportService) processExport(task scheduler.Task) error {
+	taskData, ok := task.Data.(scheduler.TaskExportData)
+	if !ok {
+		return fmt.Errorf("export task: wrong data type %T", task.Data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	downloadURL, expiresAt, err := s.buildExport(ctx, taskData)
+	if err != nil {
+		if failErr := s.exportModel.Fail(ctx, taskData.ExportID, "export could not be created"); failErr != nil {
+			s.logger.Error("failed to mark export as failed", "export_id", taskData.ExportID, "error", failErr)
+		}
+		return fmt.Errorf("export %d: %w", taskData.ExportID, err)
+	}
+
+	// The address is looked up when the archive is ready, it may have changed since
+	user, err := s.userModel.Get(ctx, taskData.UserID)
+	if err != nil {
+		return fmt.Errorf("export %d: get user: %w", taskData.ExportID, err)
+	}
+
+	s.scheduler.Submit(scheduler.Task{
+		Type: scheduler.SendExportReadyEmail,
+		Data: scheduler.TaskExportReadyData{
+			Email:       user.Email,
+			DownloadURL: downloadURL,
+			ExpiresAt:   expiresAt,
+		},
+		MaxRetries: 3,
+		CreatedAt:  time.Now(),
+	})
+
+	s.logger.Info("export completed",
+		"export_id", taskData.ExportID,
+		"user_id", taskData.UserID)
+
+	return nil
+}
+
+func (s *ExportService) buildExport(ctx context.Context, taskData scheduler.TaskExportData) (string, time.Time, error) {
+	notes, err := s.exportModel.GetNotes(ctx, taskData.UserID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("get notes: %w", err)
+	}
+
+	highlights, err := s.exportModel.GetHighlights(ctx, taskData.UserID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("get highlights: %w", err)
+	}
+
+	dump := &exportDump{
+		ExportedAt: time.Now().UTC(),
+		Notes:      notes,
+		Highlights: highlights,
+	}
+
+	var images []exportImage
+	for _, note := range notes {
+		for _, image := range note.Images {
+			downloadCtx, downloadCancel := context.WithTimeout(ctx, 30*time.Second)
+			content, err := s.storage.DownloadImage(downloadCtx, image.S3Key)
+			downloadCancel()
+
+			if err != nil {
+				// A missing image shouldn't cost the user the rest of their data
+				s.logger.Error("failed to download image for export",
+					"export_id", taskData.ExportID,
+					"s3_key", image.S3Key,
+					"error", err)
+				dump.MissingImages = append(dump.MissingImages, exportImagePath(image))
+				continue
+			}
+
+			images = append(images, exportImage{Path: exportImagePath(image), Content: content})
+		}
+	}
+
+	archive, err := writeExportArchive(dump, images)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("write archive: %w", err)
+	}
+
+	s3Key, err := s.storage.UploadExport(ctx, archive, taskData.UserID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	downloadURL, err := s.storage.GeneratePresignedURL(ctx, s3Key, exportLinkTTL)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("generate download url: %w", err)
+	}
+
+	expiresAt := time.Now().Add(exportLinkTTL)
+
+	err = s.exportModel.Complete(ctx, taskData.ExportID, s3Key, expiresAt)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("complete export: %w", err)
+	}
+
+	return downloadURL, expiresAt, nil
+}
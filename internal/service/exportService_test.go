@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/scheduler"
+	"testing"
+	"time"
+)
+
+// fakeExportModel keeps exports by ID, users have no notes or highlights
+type fakeExportModel struct {
+	data.ExportModel
+	exports map[int64]*data.Export
+}
+
+func (m *fakeExportModel) Insert(ctx context.Context, userID int64) (*data.Export, error) {
+	for _, export := range m.exports {
+		if export.UserID == userID && export.Status == data.ExportStatusPending {
+			return nil, data.ErrExportInProgress
+		}
+	}
+
+	export := &data.Export{ID: int64(len(m.exports) + 1), UserID: userID, Status: data.ExportStatusPending, CreatedAt: time.Now()}
+	m.exports[export.ID] = export
+
+	return export, nil
+}
+
+func (m *fakeExportModel) GetPending(ctx context.Context, userID int64) (*data.Export, error) {
+	for _, export := range m.exports {
+		if export.UserID == userID && export.Status == data.ExportStatusPending {
+			return export, nil
+		}
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *fakeExportModel) Fail(ctx context.Context, id int64, reason string) error {
+	m.exports[id].Status = data.ExportStatusFailed
+	return nil
+}
+
+func (m *fakeExportModel) Complete(ctx context.Context, id int64, s3Key string, expiresAt time.Time) error {
+	m.exports[id].Status = data.ExportStatusCompleted
+	return nil
+}
+
+func (m *fakeExportModel) GetNotes(ctx context.Context, userID int64) ([]*data.ExportNote, error) {
+	return []*data.ExportNote{}, nil
+}
+
+func (m *fakeExportModel) GetHighlights(ctx context.Context, userID int64) ([]*data.Highlight, error) {
+	return []*data.Highlight{}, nil
+}
+
+type fakeExportStorage struct{}
+
+func (fakeExportStorage) DownloadImage(ctx context.Context, s3Key string) ([]byte, error) {
+	return nil, nil
+}
+
+func (fakeExportStorage) UploadExport(ctx context.Context, archive []byte, userID int64) (string, error) {
+	return "exports/archive.zip", nil
+}
+
+func (fakeExportStorage) GeneratePresignedURL(ctx context.Context, s3Key string, duration time.Duration) (string, error) {
+	return "https://example.com/" + s3Key, nil
+}
+
+func newTestExportService(t *testing.T) (*ExportService, *fakeExportModel, *scheduler.Scheduler) {
+	t.Helper()
+
+	exports := &fakeExportModel{exports: make(map[int64]*data.Export)}
+	sched := scheduler.NewScheduler(0)
+
+	s := NewExportService(exports, &fakeUserModel{user: newTestUser(t)}, fakeExportStorage{}, sched, slog.New(slog.DiscardHandler))
+
+	return s, exports, sched
+}
+
+func TestExportService_ReadyEmail(t *testing.T) {
+	s, _, sched := newTestExportService(t)
+
+	export, err := s.RequestExport(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := <-sched.TaskChannel
+	if err := s.processExport(build); err != nil {
+		t.Fatal(err)
+	}
+
+	task := <-sched.TaskChannel
+	email, ok := task.Data.(scheduler.TaskExportReadyData)
+	if task.Type != scheduler.SendExportReadyEmail || !ok || email.Email != "alice@example.com" {
+		t.Fatalf("got task %+v for export %d, want the ready email sent to the user's address", task, export.ID)
+	}
+}
+
+func TestExportService_RequestExportInProgress(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns the pending export", func(t *testing.T) {
+		s, _, sched := newTestExportService(t)
+
+		first, err := s.RequestExport(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := s.RequestExport(ctx, 1)
+		if err != nil || second.ID != first.ID {
+			t.Fatalf("got %+v, %v, want the pending export %d", second, err, first.ID)
+		}
+		if len(sched.TaskChannel) != 1 {
+			t.Errorf("got %d build tasks, want 1", len(sched.TaskChannel))
+		}
+	})
+
+	t.Run("replaces a stale export", func(t *testing.T) {
+		s, exports, _ := newTestExportService(t)
+
+		stale, err := s.RequestExport(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// lost to a restart
+		stale.CreatedAt = time.Now().Add(-exportStaleAfter - time.Minute)
+
+		export, err := s.RequestExport(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if export.ID == stale.ID || export.Status != data.ExportStatusPending {
+			t.Errorf("got %+v, want a new pending export", export)
+		}
+		if exports.exports[stale.ID].Status != data.ExportStatusFailed {
+			t.Errorf("got stale export %s, want failed", exports.exports[stale.ID].Status)
+		}
+	})
+}
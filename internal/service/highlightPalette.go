@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"strings"
+)
+
+const maxPaletteEntries = 50
+
+var hexColorRX = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// PaletteEntryInput holds the fields to change on a palette entry, nil fields are kept
+type PaletteEntryInput struct {
+	Color *string
+	Label *string
+	Order *int
+}
+
+// ListPalette retrieves the user's palette in display order
+func (s *HighlightService) ListPalette(ctx context.Context, userID int64) ([]*data.PaletteEntry, error) {
+	entries, err := s.paletteModel.GetAll(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list palette: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CreatePaletteEntry validates and adds an entry to the user's palette, entry is populated in place.
+// Returns data.ErrDuplicatePaletteColor if the color is already in the palette.
+func (s *HighlightService) CreatePaletteEntry(ctx context.Context, userID int64, entry *data.PaletteEntry) (*validator.Validator, error) {
+	entry.Color = strings.TrimSpace(entry.Color)
+	entry.Label = strings.TrimSpace(entry.Label)
+
+	v := validator.New()
+	validatePaletteEntry(v, entry)
+	if !v.Valid() {
+		return v, nil
+	}
+
+	entries, err := s.paletteModel.GetAll(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get palette: %w", err)
+	}
+
+	v.Check(len(entries) < maxPaletteEntries, "palette", fmt.Sprintf("must not contain more than %d entries", maxPaletteEntries))
+	if !v.Valid() {
+		return v, nil
+	}
+
+	entry.UserID = userID
+
+	err = s.paletteModel.Insert(ctx, entry)
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicatePaletteColor) {
+			return nil, err
+		}
+		s.logger.Error("failed to create palette entry", "user_id", userID, "error", err)
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// UpdatePaletteEntry changes the color, label or order of a palette entry.
+// Highlights referencing the entry follow a new color, a new label only changes the legend.
+// Returns ErrPaletteEntryNotFound if the entry doesn't exist or belongs to another user.
+func (s *HighlightService) UpdatePaletteEntry(ctx context.Context, userID, entryID int64, input PaletteEntryInput) (*data.PaletteEntry, *validator.Validator, error) {
+	entry, err := s.paletteModel.Get(ctx, entryID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil, ErrPaletteEntryNotFound
+		}
+		return nil, nil, fmt.Errorf("get palette entry: %w", err)
+	}
+
+	if input.Color != nil {
+		entry.Color = strings.TrimSpace(*input.Color)
+	}
+	if input.Label != nil {
+		entry.Label = strings.TrimSpace(*input.Label)
+	}
+	if input.Order != nil {
+		entry.Order = *input.Order
+	}
+
+	v := validator.New()
+	validatePaletteEntry(v, entry)
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	err = s.paletteModel.Update(ctx, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil, ErrPaletteEntryNotFound
+		case errors.Is(err, data.ErrDuplicatePaletteColor):
+			return nil, nil, err
+		default:
+			return nil, nil, fmt.Errorf("update palette entry: %w", err)
+		}
+	}
+
+	return entry, nil, nil
+}
+
+// DeletePaletteEntry removes an entry from the user's palette, its highlights keep their color
+// Returns ErrPaletteEntryNotFound if the entry doesn't exist or belongs to another user
+func (s *HighlightService) DeletePaletteEntry(ctx context.Context, userID, entryID int64) error {
+	err := s.paletteModel.Delete(ctx, entryID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return ErrPaletteEntryNotFound
+		}
+		return fmt.Errorf("delete palette entry: %w", err)
+	}
+
+	return nil
+}
+
+func validatePaletteEntry(v *validator.Validator, entry *data.PaletteEntry) {
+	v.Check(entry.Color != "", "color", "must be provided")
+	v.Check(validator.Matches(entry.Color, hexColorRX), "color", "must be a hex color like #FFD700")
+	v.Check(entry.Label != "", "label", "must be provided")
+	v.Check(len(entry.Label) <= 100, "label", "must not be more than 100 bytes long")
+	v.Check(entry.Order >= 0, "order", "must not be negative")
+}
+
+// referencedPalette loads the user's palette when one of paletteIDs is set, keyed by entry ID
+func (s *HighlightService) referencedPalette(ctx context.Context, userID int64, paletteIDs ...*int64) (map[int64]*data.PaletteEntry, error) {
+	referenced := false
+	for _, id := range paletteIDs {
+		if id != nil {
+			referenced = true
+			break
+		}
+	}
+	if !referenced {
+		return nil, nil
+	}
+
+	entries, err := s.paletteModel.GetAll(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get palette: %w", err)
+	}
+
+	palette := make(map[int64]*data.PaletteEntry, len(entries))
+	for _, entry := range entries {
+		palette[entry.ID] = entry
+	}
+
+	return palette, nil
+}
+
+// applyPaletteEntry sets color to the color of the referenced palette entry
+func applyPaletteEntry(v *validator.Validator, palette map[int64]*data.PaletteEntry, paletteID *int64, color *string) {
+	if paletteID == nil {
+		return
+	}
+
+	entry, exists := palette[*paletteID]
+	v.Check(exists, "palette_id", "must be an entry of your palette")
+	if exists {
+		*color = entry.Color
+	}
+}
@@ -3,51 +3,49 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/validator"
+	"strings"
+	"time"
 )
 
 type HighlightService struct {
+	models         data.Models
 	highlightModel data.HighlightModel
+	paletteModel   data.PaletteModel
 	bibleValidator *BibleValidator
 	logger         *slog.Logger
 }
 
-func NewHighlightService(highlightModel data.HighlightModel, bibleValidator *BibleValidator, logger *slog.Logger) *HighlightService {
+func NewHighlightService(models data.Models, highlightModel data.HighlightModel, paletteModel data.PaletteModel, bibleValidator *BibleValidator, logger *slog.Logger) *HighlightService {
 	return &HighlightService{
+		models:         models,
 		highlightModel: highlightModel,
+		paletteModel:   paletteModel,
 		bibleValidator: bibleValidator,
 		logger:         logger,
 	}
 }
 
-// InsertHighlight validates highlight inputs, creates a new highlight in the database
+// InsertHighlight validates highlight inputs, creates a new highlight in the database.
+// A highlight referencing a palette entry takes the entry's color.
 // Returns validation and error, highlight is populated in place
 func (s *HighlightService) InsertHighlight(ctx context.Context, highlight *data.Highlight, userID int64) (*validator.Validator, error) {
-	// validation error
-	v := validator.New()
-
-	s.bibleValidator.ValidateBibleLocation(
-		v,
-		highlight.Book,
-		highlight.Chapter,
-		highlight.StartVerse,
-		highlight.EndVerse,
-		*highlight.StartOffset, // Note: Highlight uses *int, convert as needed
-		*highlight.EndOffset,
-	)
-
-	v.Check(userID > 0, "user_id", "must be valid")
-	v.Check(highlight.Color != "", "color", "must be provided")
+	palette, err := s.referencedPalette(ctx, userID, highlight.PaletteID)
+	if err != nil {
+		return nil, err
+	}
 
+	v := s.validateHighlight(highlight, userID, palette)
 	if !v.Valid() {
 		return v, nil
 	}
 
 	highlight.UserID = &userID
 
-	err := s.highlightModel.Insert(ctx, highlight)
+	err = s.highlightModel.Insert(ctx, highlight)
 	if err != nil {
 		s.logger.Error("failed to create highlight", "user_id", userID, "error", err)
 		return nil, err
@@ -56,10 +54,94 @@ func (s *HighlightService) InsertHighlight(ctx context.Context, highlight *data.
 	return nil, nil
 }
 
-func (s *HighlightService) UpdateHighlight(ctx context.Context, highlightID, userID int64, color string) (*validator.Validator, error) {
+// GetHighlight retrieves one of the user's highlights
+// Returns ErrHighlightNotFound if it doesn't exist or belongs to another user
+func (s *HighlightService) GetHighlight(ctx context.Context, userID, highlightID int64) (*data.Highlight, error) {
+	highlight, err := s.highlightModel.GetByID(ctx, highlightID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, ErrHighlightNotFound
+		}
+		return nil, fmt.Errorf("get highlight: %w", err)
+	}
+
+	return highlight, nil
+}
+
+// ListHighlightsInput filters the user's highlights, empty fields don't filter.
+// Until is exclusive.
+type ListHighlightsInput struct {
+	Color    string
+	Book     string
+	From     *time.Time
+	Until    *time.Time
+	Sort     string
+	Page     int
+	PageSize int
+}
+
+// ListHighlights retrieves a page of the user's highlights, newest first unless sorted
+// otherwise. "canonical" orders them by book, chapter and verse.
+func (s *HighlightService) ListHighlights(ctx context.Context, userID int64, input ListHighlightsInput) ([]*data.Highlight, data.Metadata, *validator.Validator, error) {
+	filter := &data.HighlightFilters{
+		Filters: data.Filters{
+			Page:         input.Page,
+			PageSize:     input.PageSize,
+			Sort:         input.Sort,
+			SortSafeList: []string{"canonical", "created_at", "-created_at", "updated_at", "-updated_at"},
+		},
+		Color: strings.TrimSpace(input.Color),
+		Book:  input.Book,
+		From:  input.From,
+		Until: input.Until,
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = "-created_at"
+	}
+
+	v := validator.New()
+	filter.Filters.Validate(v)
+	filter.Filters.ValidateSort(v)
+	if filter.Book != "" {
+		_, exists := s.bibleValidator.books[filter.Book]
+		v.Check(exists, "book", "must be a valid Bible book")
+	}
+	v.Check(len(filter.Color) <= 50, "color", "must not be more than 50 bytes long")
+	if filter.From != nil && filter.Until != nil {
+		v.Check(filter.From.Before(*filter.Until), "to", "must not be before from")
+	}
+	if !v.Valid() {
+		return nil, data.Metadata{}, v, nil
+	}
+
+	highlights, metadata, err := s.highlightModel.GetAll(ctx, userID, filter)
+	if err != nil {
+		return nil, data.Metadata{}, nil, fmt.Errorf("list highlights: %w", err)
+	}
+
+	return highlights, metadata, nil, nil
+}
+
+// HighlightUpdate is the new color of a highlight, or the palette entry it now refers to.
+// Without a PaletteID the highlight no longer refers to an entry.
+type HighlightUpdate struct {
+	Color     string
+	PaletteID *int64
+}
+
+// UpdateHighlight changes the color of a highlight, update.Color is set to the
+// color of the palette entry when one is given
+func (s *HighlightService) UpdateHighlight(ctx context.Context, highlightID, userID int64, update *HighlightUpdate) (*validator.Validator, error) {
+	palette, err := s.referencedPalette(ctx, userID, update.PaletteID)
+	if err != nil {
+		return nil, err
+	}
+
 	v := validator.New()
 	v.Check(highlightID > 0, "highlightID", "must be valid")
-	v.Check(color != "", "color", "must be provided")
+	applyPaletteEntry(v, palette, update.PaletteID, &update.Color)
+	v.Check(update.Color != "", "color", "must be provided")
 
 	// Optional: Add format validation for color (hex, rgb, etc.)
 	// v.Check(isValidColor(input.Color), "color", "must be a valid color format")
@@ -68,7 +150,7 @@ func (s *HighlightService) UpdateHighlight(ctx context.Context, highlightID, use
 		return v, nil
 	}
 
-	err := s.highlightModel.Update(ctx, highlightID, userID, color)
+	err = s.highlightModel.Update(ctx, highlightID, userID, update.Color, update.PaletteID)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			return nil, ErrHighlightNotFound
@@ -96,3 +178,83 @@ func (s *HighlightService) DeleteHighlight(ctx context.Context, highlightID, use
 
 	return nil, nil
 }
+
+// InsertHighlightBatch creates several highlights in a single transaction.
+// Every highlight is validated like in InsertHighlight; mode selects whether a failing
+// highlight rolls back the others (atomic) or is only reported (partial).
+// Created highlights are populated in place.
+func (s *HighlightService) InsertHighlightBatch(ctx context.Context, userID int64, mode string, highlights []*data.Highlight) (*BatchReport, *validator.Validator, error) {
+	v := validator.New()
+	validateBatch(v, mode, len(highlights))
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	paletteIDs := make([]*int64, len(highlights))
+	for i, highlight := range highlights {
+		highlight.UserID = &userID
+		paletteIDs[i] = highlight.PaletteID
+	}
+
+	palette, err := s.referencedPalette(ctx, userID, paletteIDs...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report, err := batchInsert(ctx, s.models, mode, len(highlights),
+		func(i int) *validator.Validator {
+			return s.validateHighlight(highlights[i], userID, palette)
+		},
+		func(tx data.Models, i int) (int64, error) {
+			err := tx.Highlights.Insert(ctx, highlights[i])
+			return highlights[i].ID, err
+		},
+		func(err error) (string, bool) {
+			// A validated highlight can still lose its book or palette entry meanwhile
+			switch {
+			case errors.Is(err, data.ErrHighlightBookNotFound):
+				return "book not found", true
+			case errors.Is(err, data.ErrHighlightPaletteNotFound):
+				return "palette entry not found", true
+			case errors.Is(err, data.ErrHighlightConstraint):
+				return err.Error(), true
+			default:
+				return "", false
+			}
+		},
+	)
+	if err != nil {
+		s.logger.Error("failed to create highlight batch", "user_id", userID, "error", err)
+		return nil, nil, err
+	}
+
+	return report, nil, nil
+}
+
+// validateHighlight checks a new highlight, its color is taken from palette when it
+// references an entry
+func (s *HighlightService) validateHighlight(highlight *data.Highlight, userID int64, palette map[int64]*data.PaletteEntry) *validator.Validator {
+	v := validator.New()
+
+	v.Check(highlight.StartOffset != nil, "start_offset", "must be provided")
+	v.Check(highlight.EndOffset != nil, "end_offset", "must be provided")
+	if !v.Valid() {
+		return v
+	}
+
+	s.bibleValidator.ValidateBibleLocation(
+		v,
+		highlight.Book,
+		highlight.Chapter,
+		highlight.StartVerse,
+		highlight.EndVerse,
+		*highlight.StartOffset, // Note: Highlight uses *int, convert as needed
+		*highlight.EndOffset,
+	)
+
+	v.Check(userID > 0, "user_id", "must be valid")
+	applyPaletteEntry(v, palette, highlight.PaletteID, &highlight.Color)
+	v.Check(highlight.Color != "", "color", "must be provided")
+
+	return v
+}
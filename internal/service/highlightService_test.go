@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/data"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// fakeConn is a database connection that inserts every highlight, except the ones
+// referencing palette entry deletedPaletteID which fail like the foreign key would.
+// It keeps the statements it ran.
+type fakeConn struct {
+	deletedPaletteID int64
+	nextID           int64
+	statements       []string
+}
+
+func (c *fakeConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeConn) Driver() driver.Driver                        { return nil }
+func (c *fakeConn) Close() error                                 { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                    { return c, nil }
+func (c *fakeConn) Commit() error                                { c.statements = append(c.statements, "COMMIT"); return nil }
+func (c *fakeConn) Rollback() error                              { c.statements = append(c.statements, "ROLLBACK"); return nil }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.statements = append(c.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.statements = append(c.statements, "INSERT")
+
+	// the last argument is palette_id
+	if paletteID, ok := args[len(args)-1].Value.(int64); ok && paletteID == c.deletedPaletteID {
+		return nil, &pq.Error{Code: data.ForeignKeyViolation, Constraint: "highlights_palette_id_fkey"}
+	}
+
+	c.nextID++
+	return &fakeRows{id: c.nextID}, nil
+}
+
+// fakeRows is the id and created_at returned by an insert
+type fakeRows struct {
+	id   int64
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "created_at"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0], dest[1] = r.id, time.Now()
+	return nil
+}
+
+func TestHighlightService_InsertHighlightBatchPartial(t *testing.T) {
+	conn := &fakeConn{deletedPaletteID: 8}
+	db := sql.OpenDB(conn)
+	defer db.Close()
+
+	// entry 8 is deleted after the palette was read
+	palette := &fakePaletteModel{entries: []*data.PaletteEntry{{ID: 7, Color: "green"}, {ID: 8, Color: "blue"}}}
+	books := map[string]struct{}{"John": {}}
+	s := NewHighlightService(data.NewModels(db), nil, palette, NewBibleValidator(books), slog.New(slog.DiscardHandler))
+
+	zero := 0
+	seven, eight := int64(7), int64(8)
+	highlight := func(verse int, paletteID *int64) *data.Highlight {
+		return &data.Highlight{Book: "John", Chapter: 3, StartVerse: verse, EndVerse: verse, StartOffset: &zero, EndOffset: &zero, PaletteID: paletteID}
+	}
+
+	report, v, err := s.InsertHighlightBatch(context.Background(), 1, BatchModePartial, []*data.Highlight{
+		highlight(16, &seven),
+		highlight(17, &eight),
+		highlight(18, &seven),
+	})
+	if err != nil || (v != nil && !v.Valid()) {
+		t.Fatalf("InsertHighlightBatch() got %v %v, want a report", v, err)
+	}
+
+	if report.Created != 2 || report.Failed != 1 {
+		t.Errorf("got %d created and %d failed, want 2 and 1", report.Created, report.Failed)
+	}
+
+	expected := []struct {
+		status string
+		reason string
+	}{
+		{BatchStatusCreated, ""},
+		{BatchStatusFailed, "palette entry not found"},
+		{BatchStatusCreated, ""},
+	}
+	for i, want := range expected {
+		item := report.Items[i]
+		if item.Status != want.status || item.Reason != want.reason {
+			t.Errorf("item %d: got %s %q, want %s %q", i, item.Status, item.Reason, want.status, want.reason)
+		}
+	}
+
+	if !slices.Contains(conn.statements, "ROLLBACK TO SAVEPOINT item") || conn.statements[len(conn.statements)-1] != "COMMIT" {
+		t.Errorf("got statements %v, want the failed item rolled back to its savepoint and the others committed", conn.statements)
+	}
+}
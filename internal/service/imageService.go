@@ -19,6 +19,8 @@ type ImageStorage interface {
 	UploadImage(ctx context.Context, imageData []byte, fileName string, contentType string, userID int64) (string, error)
 	GeneratePresignedURL(ctx context.Context, s3Key string, expiration time.Duration) (string, error)
 	DeleteImage(ctx context.Context, s3Key string) error
+	DownloadImage(ctx context.Context, s3Key string) ([]byte, error)
+	UploadExport(ctx context.Context, archive []byte, userID int64) (string, error)
 }
 
 type ImageService struct {
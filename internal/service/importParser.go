@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var errUnterminatedFrontMatter = errors.New("front-matter is not terminated by ---")
+
+// markdownNote is a note read from a Markdown file of an import archive
+type markdownNote struct {
+	Title     string
+	NoteType  string
+	Locations []string
+	Target    string
+	Content   string
+}
+
+// parseMarkdownNote reads a Markdown file with optional YAML front-matter, as
+// written by exports and Obsidian-style vaults. Only a flat subset of YAML is
+// understood: "key: value", "key: [a, b]" and "key:" followed by "  - item" lines.
+// Recognized keys are title, note_type (or type), locations (or location) and target;
+// others are ignored. Without a note type, notes with locations are BIBLE notes
+// and the others GENERAL notes titled after the file name.
+func parseMarkdownNote(fileName, raw string) (*markdownNote, error) {
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+
+	note := &markdownNote{Content: raw}
+
+	if strings.HasPrefix(raw, "---\n") {
+		rest := raw[len("---\n"):]
+
+		end := strings.Index(rest, "\n---\n")
+		var body string
+		switch {
+		case strings.HasPrefix(rest, "---\n"):
+			end, body = 0, rest[len("---\n"):]
+		case end >= 0:
+			body = rest[end+len("\n---\n"):]
+		case strings.HasSuffix(rest, "\n---"):
+			end, body = len(rest)-len("\n---"), ""
+		default:
+			return nil, errUnterminatedFrontMatter
+		}
+
+		fields := parseFrontMatter(rest[:end])
+
+		note.Title = firstValue(fields["title"])
+		note.NoteType = strings.ToUpper(firstValue(fields["note_type"], fields["type"]))
+		note.Locations = append(fields["locations"], fields["location"]...)
+		note.Target = firstValue(fields["target"])
+
+		// Exports separate the front-matter from the content with one blank line
+		note.Content = strings.TrimPrefix(body, "\n")
+	}
+
+	if note.NoteType == "" {
+		note.NoteType = "GENERAL"
+		if len(note.Locations) > 0 {
+			note.NoteType = "BIBLE"
+		}
+	}
+
+	if note.Title == "" && note.NoteType == "GENERAL" {
+		note.Title = strings.TrimSuffix(path.Base(fileName), path.Ext(fileName))
+	}
+
+	return note, nil
+}
+
+// parseFrontMatter returns the values of each key, scalars as one-element lists
+func parseFrontMatter(block string) map[string][]string {
+	fields := make(map[string][]string)
+	currentKey := ""
+
+	for line := range strings.SplitSeq(block, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// "  - item" continues the list of the previous key
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && currentKey != "" && line != trimmed {
+			fields[currentKey] = append(fields[currentKey], unquoteYAML(item))
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			currentKey = ""
+			continue
+		}
+
+		currentKey = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch {
+		case value == "":
+			fields[currentKey] = []string{}
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			list := []string{}
+			for item := range strings.SplitSeq(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, unquoteYAML(item))
+				}
+			}
+			fields[currentKey] = list
+		default:
+			fields[currentKey] = []string{unquoteYAML(value)}
+		}
+	}
+
+	return fields
+}
+
+func unquoteYAML(value string) string {
+	value = strings.TrimSpace(value)
+
+	if len(value) >= 2 {
+		switch {
+		case value[0] == '"' && value[len(value)-1] == '"':
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				return unquoted
+			}
+			return value[1 : len(value)-1]
+		case value[0] == '\'' && value[len(value)-1] == '\'':
+			return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+		}
+	}
+
+	return value
+}
+
+func firstValue(lists ...[]string) string {
+	for _, list := range lists {
+		if len(list) > 0 {
+			return list[0]
+		}
+	}
+	return ""
+}
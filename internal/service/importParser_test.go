@@ -0,0 +1,79 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseMarkdownNote(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		raw      string
+		expected markdownNote
+	}{
+		{
+			name:     "exported note",
+			fileName: "notes/3-bible-john-3-16.md",
+			raw:      "---\nid: 3\nnote_type: BIBLE\nlocations:\n  - \"John 3:16\"\n  - \"Romans 5:8\"\nreferences:\n  - \"Isaiah 53:5\"\n---\n\nFor God so loved\n",
+			expected: markdownNote{
+				NoteType:  "BIBLE",
+				Locations: []string{"John 3:16", "Romans 5:8"},
+				Content:   "For God so loved\n",
+			},
+		},
+		{
+			name:     "exported cross-reference",
+			fileName: "notes/4-cross-reference-john-3-16.md",
+			raw:      "---\nid: 4\nnote_type: CROSS_REFERENCE\ntarget: \"Romans 5:8\"\nlocations:\n  - \"John 3:16\"\n---\n\nJohn 3:16 → Romans 5:8",
+			expected: markdownNote{
+				NoteType:  "CROSS_REFERENCE",
+				Locations: []string{"John 3:16"},
+				Target:    "Romans 5:8",
+				Content:   "John 3:16 → Romans 5:8",
+			},
+		},
+		{
+			name:     "obsidian note with inline list",
+			fileName: "vault/Sermons/Grace.md",
+			raw:      "---\r\ntags: [sermon, grace]\r\nlocation: ['Ephesians 2:8']\r\n---\r\nBy grace",
+			expected: markdownNote{
+				NoteType:  "BIBLE",
+				Locations: []string{"Ephesians 2:8"},
+				Content:   "By grace",
+			},
+		},
+		{
+			name:     "plain markdown is a general note titled after the file",
+			fileName: "vault/Prayer List.md",
+			raw:      "# Prayer\n- family",
+			expected: markdownNote{
+				Title:    "Prayer List",
+				NoteType: "GENERAL",
+				Content:  "# Prayer\n- family",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMarkdownNote(tt.fileName, tt.raw)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got.Title != tt.expected.Title || got.NoteType != tt.expected.NoteType ||
+				got.Target != tt.expected.Target || got.Content != tt.expected.Content {
+				t.Errorf("got %+v, want %+v", *got, tt.expected)
+			}
+
+			if !slices.Equal(got.Locations, tt.expected.Locations) {
+				t.Errorf("got locations %v, want %v", got.Locations, tt.expected.Locations)
+			}
+		})
+	}
+
+	if _, err := parseMarkdownNote("a.md", "---\ntitle: x\n"); err == nil {
+		t.Error("expected error for unterminated front-matter")
+	}
+}
@@ -0,0 +1,491 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxImportFiles        = 1000
+	maxImportFileSize     = 1 << 20  // 1 MB per Markdown file
+	maxImportArchiveSize  = 50 << 20 // 50 MB uncompressed
+	maxImportHighlightRow = 5000
+)
+
+const (
+	ImportStatusImported = "imported"
+	ImportStatusSkipped  = "skipped"
+	ImportStatusFailed   = "failed"
+)
+
+type highlightImporter interface {
+	InsertHighlight(ctx context.Context, highlight *data.Highlight, userID int64) (*validator.Validator, error)
+}
+
+type noteImporter interface {
+	CreateNote(ctx context.Context, userID int64, input CreateNoteInput) (*data.NoteResponse, *validator.Validator, error)
+	LinkNote(ctx context.Context, noteLinkLocation *data.NoteInputLocation) (*data.NoteResponse, *validator.Validator, error)
+}
+
+// ImportItemResult is the outcome of a single Markdown file or CSV row
+type ImportItemResult struct {
+	File     string            `json:"file,omitempty"`
+	Row      int               `json:"row,omitempty"`
+	Status   string            `json:"status"`
+	ID       int64             `json:"id,omitempty"`
+	Reason   string            `json:"reason,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"`
+	Warnings []string          `json:"warnings,omitempty"`
+}
+
+type ImportReport struct {
+	Imported int                 `json:"imported"`
+	Skipped  int                 `json:"skipped"`
+	Failed   int                 `json:"failed"`
+	Items    []*ImportItemResult `json:"items"`
+}
+
+func (r *ImportReport) add(item *ImportItemResult) {
+	switch item.Status {
+	case ImportStatusImported:
+		r.Imported++
+	case ImportStatusSkipped:
+		r.Skipped++
+	case ImportStatusFailed:
+		r.Failed++
+	}
+	r.Items = append(r.Items, item)
+}
+
+// ImportService brings notes and highlights from other tools into the user's account
+type ImportService struct {
+	notes          noteImporter
+	highlights     highlightImporter
+	highlightModel data.HighlightModel
+	extractor      *ReferenceExtractor
+	logger         *slog.Logger
+}
+
+func NewImportService(
+	notes noteImporter,
+	highlights highlightImporter,
+	highlightModel data.HighlightModel,
+	extractor *ReferenceExtractor,
+	logger *slog.Logger,
+) *ImportService {
+	return &ImportService{
+		notes:          notes,
+		highlights:     highlights,
+		highlightModel: highlightModel,
+		extractor:      extractor,
+		logger:         logger,
+	}
+}
+
+// ImportMarkdownArchive imports every .md file of a zip archive as a note.
+// Notes are created through NoteService, so they are validated by NoteValidator and
+// notes that already exist (content_hash or GENERAL title uniqueness) are skipped.
+// Returns a validation error if the archive itself can't be read.
+func (s *ImportService) ImportMarkdownArchive(ctx context.Context, userID int64, archive []byte) (*ImportReport, *validator.Validator, error) {
+	v := validator.New()
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		v.AddError("file", "must be a valid zip archive")
+		return nil, v, nil
+	}
+
+	var files []*zip.File
+	var totalSize uint64
+	for _, file := range zr.File {
+		if !isImportableMarkdown(file) {
+			continue
+		}
+		files = append(files, file)
+		totalSize += file.UncompressedSize64
+	}
+
+	v.Check(len(files) > 0, "file", "must contain at least one .md file")
+	v.Check(len(files) <= maxImportFiles, "file", fmt.Sprintf("must not contain more than %d .md files", maxImportFiles))
+	v.Check(totalSize <= maxImportArchiveSize, "file", "must not be larger than 50MB uncompressed")
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	report := &ImportReport{Items: []*ImportItemResult{}}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		report.add(s.importMarkdownFile(ctx, userID, file))
+	}
+
+	return report, nil, nil
+}
+
+func isImportableMarkdown(file *zip.File) bool {
+	if file.FileInfo().IsDir() || !strings.EqualFold(path.Ext(file.Name), ".md") {
+		return false
+	}
+
+	// Skip macOS resource forks and hidden files/folders (.obsidian, .trash)
+	for part := range strings.SplitSeq(file.Name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *ImportService) importMarkdownFile(ctx context.Context, userID int64, file *zip.File) *ImportItemResult {
+	item := &ImportItemResult{File: file.Name, Status: ImportStatusFailed}
+
+	if file.UncompressedSize64 > maxImportFileSize {
+		item.Reason = "file must not be larger than 1MB"
+		return item
+	}
+
+	raw, err := readZipFile(file)
+	if err != nil {
+		item.Reason = "file could not be read"
+		return item
+	}
+
+	note, err := parseMarkdownNote(file.Name, raw)
+	if err != nil {
+		item.Reason = err.Error()
+		return item
+	}
+
+	input := CreateNoteInput{
+		Title:    note.Title,
+		Content:  note.Content,
+		NoteType: note.NoteType,
+	}
+
+	if note.NoteType == data.NoteTypeCrossRef {
+		input.Title = ""
+
+		// Older archives only have the target as the note's content
+		reference := note.Target
+		if reference == "" {
+			reference = note.Content
+		}
+
+		target, err := s.extractor.ParseReference(reference)
+		if err != nil || target.StartVerse == -1 {
+			item.Reason = fmt.Sprintf("invalid target %q: must be a reference like John 3:16", reference)
+			return item
+		}
+
+		input.TargetBook = target.Book
+		input.TargetChapter = target.Chapter
+		input.TargetStartVerse = target.StartVerse
+		input.TargetEndVerse = target.EndVerse
+	}
+
+	var locations []*data.LocationFilters
+	for _, reference := range note.Locations {
+		location, err := s.extractor.ParseReference(reference)
+		if err != nil || location.StartVerse == -1 {
+			item.Reason = fmt.Sprintf("invalid location %q: must be a reference like John 3:16", reference)
+			return item
+		}
+		locations = append(locations, location)
+	}
+
+	// The first location anchors BIBLE/CROSS_REFERENCE notes, the others are linked after.
+	// GENERAL notes get their locations from the references in their content.
+	if note.NoteType == data.NoteTypeGeneral {
+		locations = nil
+	} else if len(locations) > 0 {
+		input.Book = locations[0].Book
+		input.Chapter = locations[0].Chapter
+		input.StartVerse = locations[0].StartVerse
+		input.EndVerse = locations[0].EndVerse
+		locations = locations[1:]
+	}
+
+	created, v, err := s.notes.CreateNote(ctx, userID, input)
+	if v != nil && !v.Valid() {
+		item.Reason = "validation failed"
+		item.Errors = v.Errors
+		return item
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateContent),
+			errors.Is(err, data.ErrDuplicateTitleGeneral),
+			errors.Is(err, data.ErrLocationAlreadyLinked):
+			item.Status = ImportStatusSkipped
+			item.Reason = err.Error()
+		default:
+			s.logger.Error("failed to import note", "user_id", userID, "file", file.Name, "error", err)
+			item.Reason = "note could not be saved"
+		}
+		return item
+	}
+
+	item.Status = ImportStatusImported
+	item.ID = created.ID
+
+	for _, location := range locations {
+		_, v, err := s.notes.LinkNote(ctx, &data.NoteInputLocation{
+			NoteID:     created.ID,
+			UserID:     userID,
+			Book:       location.Book,
+			Chapter:    location.Chapter,
+			StartVerse: location.StartVerse,
+			EndVerse:   location.EndVerse,
+		})
+
+		reference := formatReference(location.Book, location.Chapter, location.StartVerse, location.EndVerse)
+		if (v != nil && !v.Valid()) || err != nil {
+			item.Warnings = append(item.Warnings, fmt.Sprintf("location %s was not linked", reference))
+		}
+	}
+
+	return item
+}
+
+func readZipFile(file *zip.File) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	// Don't trust the size in the header, a zip bomb can lie about it
+	content, err := io.ReadAll(io.LimitReader(rc, maxImportFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(content) > maxImportFileSize {
+		return "", errors.New("file too large")
+	}
+
+	return string(content), nil
+}
+
+// highlightKey identifies identical highlights to skip on re-import
+type highlightKey struct {
+	book                   string
+	chapter                int
+	startVerse, endVerse   int
+	startOffset, endOffset int
+	color                  string
+}
+
+func newHighlightKey(book string, h *data.Highlight) highlightKey {
+	key := highlightKey{
+		book:       book,
+		chapter:    h.Chapter,
+		startVerse: h.StartVerse,
+		endVerse:   h.EndVerse,
+		// a highlight without offsets covers whole verses, like offsets 0 and 0
+		color: strings.ToLower(h.Color),
+	}
+	if h.StartOffset != nil {
+		key.startOffset = *h.StartOffset
+	}
+	if h.EndOffset != nil {
+		key.endOffset = *h.EndOffset
+	}
+	return key
+}
+
+// ImportHighlightsCSV imports highlights from a CSV with a header row naming the
+// columns book, chapter, start_verse, end_verse and color, plus optional
+// start_offset, end_offset and palette_id. Rows are created through HighlightService,
+// so they are validated like POST /v1/highlights; rows without offsets cover whole
+// verses. Highlights identical to an existing one are skipped.
+// Returns a validation error if the header is missing required columns.
+func (s *ImportService) ImportHighlightsCSV(ctx context.Context, userID int64, r io.Reader) (*ImportReport, *validator.Validator, error) {
+	v := validator.New()
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		v.AddError("file", "must be a CSV file with a header row")
+		return nil, v, nil
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	for _, required := range []string{"book", "chapter", "start_verse", "end_verse", "color"} {
+		_, ok := columns[required]
+		v.Check(ok, "file", fmt.Sprintf("must have a %s column", required))
+	}
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	report := &ImportReport{Items: []*ImportItemResult{}}
+
+	// Existing highlights are loaded once per chapter for deduplication
+	existing := make(map[string]map[highlightKey]struct{})
+
+	for row := 2; ; row++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if row-1 > maxImportHighlightRow {
+			v.AddError("file", fmt.Sprintf("must not contain more than %d rows", maxImportHighlightRow))
+			return nil, v, nil
+		}
+
+		if err != nil {
+			report.add(&ImportItemResult{Row: row, Status: ImportStatusFailed, Reason: "row could not be parsed"})
+			continue
+		}
+
+		report.add(s.importHighlightRow(ctx, userID, row, columns, record, existing))
+	}
+
+	return report, nil, nil
+}
+
+func (s *ImportService) importHighlightRow(
+	ctx context.Context,
+	userID int64,
+	row int,
+	columns map[string]int,
+	record []string,
+	existing map[string]map[highlightKey]struct{},
+) *ImportItemResult {
+	item := &ImportItemResult{Row: row, Status: ImportStatusFailed}
+	v := validator.New()
+
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	number := func(name string) int {
+		n, err := strconv.Atoi(field(name))
+		if err != nil {
+			v.AddError(name, "must be an integer")
+		}
+		return n
+	}
+
+	optionalNumber := func(name string) *int {
+		if field(name) == "" {
+			return nil
+		}
+		n := number(name)
+		return &n
+	}
+
+	optionalID := func(name string) *int64 {
+		if field(name) == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(field(name), 10, 64)
+		if err != nil {
+			v.AddError(name, "must be an integer")
+		}
+		return &n
+	}
+
+	zero := 0
+	highlight := &data.Highlight{
+		Book:        field("book"),
+		Chapter:     number("chapter"),
+		StartVerse:  number("start_verse"),
+		EndVerse:    number("end_verse"),
+		StartOffset: optionalNumber("start_offset"),
+		EndOffset:   optionalNumber("end_offset"),
+		Color:       field("color"),
+		PaletteID:   optionalID("palette_id"),
+	}
+
+	if !v.Valid() {
+		item.Reason = "validation failed"
+		item.Errors = v.Errors
+		return item
+	}
+
+	// Rows without offsets cover whole verses
+	if highlight.StartOffset == nil {
+		highlight.StartOffset = &zero
+	}
+	if highlight.EndOffset == nil {
+		highlight.EndOffset = &zero
+	}
+
+	chapterKey := fmt.Sprintf("%s %d", highlight.Book, highlight.Chapter)
+	seen, ok := existing[chapterKey]
+	if !ok {
+		current, err := s.highlightModel.Get(ctx, userID, &data.LocationFilters{
+			Book:    highlight.Book,
+			Chapter: highlight.Chapter,
+		})
+		if err != nil {
+			s.logger.Error("failed to load highlights for import", "user_id", userID, "error", err)
+			item.Reason = "highlight could not be saved"
+			return item
+		}
+
+		seen = make(map[highlightKey]struct{}, len(current))
+		for _, h := range current {
+			seen[newHighlightKey(highlight.Book, h)] = struct{}{}
+		}
+		existing[chapterKey] = seen
+	}
+
+	key := newHighlightKey(highlight.Book, highlight)
+	if _, duplicate := seen[key]; duplicate {
+		item.Status = ImportStatusSkipped
+		item.Reason = "an identical highlight already exists"
+		return item
+	}
+
+	v, err := s.highlights.InsertHighlight(ctx, highlight, userID)
+	if v != nil && !v.Valid() {
+		item.Reason = "validation failed"
+		item.Errors = v.Errors
+		return item
+	}
+	if err != nil {
+		s.logger.Error("failed to import highlight", "user_id", userID, "row", row, "error", err)
+		item.Reason = "highlight could not be saved"
+		return item
+	}
+
+	// a palette entry sets the color
+	seen[newHighlightKey(highlight.Book, highlight)] = struct{}{}
+	item.Status = ImportStatusImported
+	item.ID = highlight.ID
+
+	return item
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/data"
+	"strings"
+	"testing"
+)
+
+// fakeHighlightModel keeps highlights in insertion order
+type fakeHighlightModel struct {
+	data.HighlightModel
+	highlights []*data.Highlight
+}
+
+func (m *fakeHighlightModel) Insert(ctx context.Context, highlight *data.Highlight) error {
+	highlight.ID = int64(len(m.highlights) + 1)
+	m.highlights = append(m.highlights, highlight)
+	return nil
+}
+
+func (m *fakeHighlightModel) Get(ctx context.Context, userID int64, filter *data.LocationFilters) ([]*data.Highlight, error) {
+	found := []*data.Highlight{}
+	for _, h := range m.highlights {
+		if h.Book == filter.Book && h.Chapter == filter.Chapter {
+			found = append(found, h)
+		}
+	}
+	return found, nil
+}
+
+type fakePaletteModel struct {
+	data.PaletteModel
+	entries []*data.PaletteEntry
+}
+
+func (m *fakePaletteModel) GetAll(ctx context.Context, userID int64) ([]*data.PaletteEntry, error) {
+	return m.entries, nil
+}
+
+func TestImportService_HighlightsCSV(t *testing.T) {
+	books := map[string]struct{}{"John": {}, "Romans": {}}
+	highlights := &fakeHighlightModel{}
+	palette := &fakePaletteModel{entries: []*data.PaletteEntry{{ID: 7, Color: "green"}}}
+
+	highlightService := NewHighlightService(data.Models{}, highlights, palette, NewBibleValidator(books), slog.New(slog.DiscardHandler))
+	s := NewImportService(nil, highlightService, highlights, NewReferenceExtractor(books), slog.New(slog.DiscardHandler))
+
+	csv := strings.Join([]string{
+		"book,chapter,start_verse,end_verse,color,start_offset,end_offset,palette_id",
+		"John,3,16,16,yellow,,,",
+		"John,3,16,16,yellow,0,0,",
+		"Romans,5,8,8,,,,7",
+		"Romans,5,8,8,,,,8",
+		"John,3,17,16,yellow,,,",
+		"Jude,1,1,1,yellow,,,",
+	}, "\n")
+
+	report, v, err := s.ImportHighlightsCSV(context.Background(), 1, strings.NewReader(csv))
+	if err != nil || (v != nil && !v.Valid()) {
+		t.Fatalf("ImportHighlightsCSV() got %v %v", v, err)
+	}
+
+	expected := []struct {
+		status string
+		field  string
+	}{
+		{ImportStatusImported, ""},
+		// the same highlight without offsets
+		{ImportStatusSkipped, ""},
+		{ImportStatusImported, ""},
+		{ImportStatusFailed, "palette_id"},
+		{ImportStatusFailed, "verse"},
+		{ImportStatusFailed, "book"},
+	}
+
+	if len(report.Items) != len(expected) {
+		t.Fatalf("got %d items, want %d", len(report.Items), len(expected))
+	}
+	for i, want := range expected {
+		item := report.Items[i]
+		if item.Status != want.status {
+			t.Errorf("row %d: got %s (%s), want %s", item.Row, item.Status, item.Reason, want.status)
+		}
+		if _, ok := item.Errors[want.field]; want.field != "" && !ok {
+			t.Errorf("row %d: got errors %v, want one for %s", item.Row, item.Errors, want.field)
+		}
+	}
+
+	if len(highlights.highlights) != 2 || highlights.highlights[1].Color != "green" {
+		t.Errorf("got highlights %+v, want two saved, the second with its palette color", highlights.highlights)
+	}
+}
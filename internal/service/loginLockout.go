@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"shuvoedward/Bible_project/internal/cache"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/scheduler"
+	"strings"
+	"time"
+)
+
+const (
+	// Failed logins of an account are counted for loginFailureWindow from the first one
+	loginFailureWindow = time.Hour
+
+	// From loginDelayAfter failures on, every failure makes the account wait before the
+	// next attempt, twice as long as the previous one up to loginMaxDelay
+	loginDelayAfter = 3
+	loginMaxDelay   = time.Minute
+
+	// loginLockoutAfter failures lock the account for loginLockoutDuration, its owner is
+	// emailed a link to unlock it
+	loginLockoutAfter    = 10
+	loginLockoutDuration = 30 * time.Minute
+)
+
+// LoginLockedError is returned for logins to an account that has to wait after too many
+// failed attempts. Unknown emails are counted and delayed the same way, so it doesn't
+// tell whether an account exists.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("login locked, retry after %s", e.RetryAfter)
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrLoginLocked
+}
+
+// checkLoginLock returns a LoginLockedError if logins to email have to wait
+func (s *TokenService) checkLoginLock(ctx context.Context, email string) error {
+	retryAfter, err := s.redis.TTL(ctx, loginKey("lock", email))
+	if err != nil {
+		if errors.Is(err, cache.ErrKeyNotFound) {
+			return nil
+		}
+		return fmt.Errorf("get login lock: %w", err)
+	}
+
+	return &LoginLockedError{RetryAfter: retryAfter}
+}
+
+// recordLoginFailure counts a failed login to email and delays or locks the next ones.
+// user is nil for unknown emails, which are delayed all the same but get no email.
+func (s *TokenService) recordLoginFailure(ctx context.Context, email string, user *data.User, ip string) {
+	failures, err := s.redis.Incr(ctx, loginKey("failures", email), loginFailureWindow)
+	if err != nil {
+		s.logger.Error("failed to count login failure", "error", err)
+		return
+	}
+
+	delay := loginDelay(failures)
+	if delay == 0 {
+		return
+	}
+
+	err = s.redis.Set(ctx, loginKey("lock", email), "1", delay)
+	if err != nil {
+		s.logger.Error("failed to delay logins", "error", err)
+		return
+	}
+
+	if failures < loginLockoutAfter || user == nil {
+		return
+	}
+
+	s.logger.Warn("account locked after failed logins", "user_id", user.ID, "failures", failures, "ip", ip)
+
+	err = s.sendUnlockEmail(ctx, user, failures, ip)
+	if err != nil {
+		s.logger.Error("failed to send unlock email", "user_id", user.ID, "error", err)
+	}
+}
+
+// loginDelay is how long an account waits after its nth failed login
+func loginDelay(failures int64) time.Duration {
+	switch {
+	case failures >= loginLockoutAfter:
+		return loginLockoutDuration
+	case failures >= loginDelayAfter:
+		return min(time.Second<<(failures-loginDelayAfter), loginMaxDelay)
+	default:
+		return 0
+	}
+}
+
+// sendUnlockEmail tells the owner of a locked account about the failed logins, with a
+// link to unlock it that works while the lockout lasts
+func (s *TokenService) sendUnlockEmail(ctx context.Context, user *data.User, failures int64, ip string) error {
+	token := rand.Text()
+
+	err := s.redis.Set(ctx, loginUnlockKey(token), user.Email, loginLockoutDuration)
+	if err != nil {
+		return fmt.Errorf("store unlock token: %w", err)
+	}
+
+	task := scheduler.Task{
+		Type:       scheduler.SendSuspiciousLoginEmail,
+		MaxRetries: 3,
+		Data: scheduler.TaskSuspiciousLoginData{
+			Email:       user.Email,
+			IP:          ip,
+			Attempts:    failures,
+			LockedUntil: time.Now().Add(loginLockoutDuration),
+			UnlockURL:   fmt.Sprintf("http://localhost:4000/v1/tokens/unlock/%s", token),
+		},
+		CreatedAt: time.Now(),
+	}
+
+	s.scheduler.Submit(task)
+
+	return nil
+}
+
+// clearLoginFailures forgets the failed logins to email and lifts its delay or lockout
+func (s *TokenService) clearLoginFailures(ctx context.Context, email string) error {
+	err := s.redis.Del(ctx, loginKey("failures", email), loginKey("lock", email))
+	if err != nil {
+		return fmt.Errorf("clear login failures: %w", err)
+	}
+
+	return nil
+}
+
+// UnlockLogin lifts the lockout of the account an unlock link was emailed to, each
+// link works once
+// Returns ErrInvalidToken if the link is unknown, expired or used
+func (s *TokenService) UnlockLogin(ctx context.Context, tokenPlaintext string) error {
+	if len(tokenPlaintext) != 26 {
+		return ErrInvalidToken
+	}
+
+	email, err := s.redis.GetDel(ctx, loginUnlockKey(tokenPlaintext))
+	if err != nil {
+		if errors.Is(err, cache.ErrKeyNotFound) {
+			return ErrInvalidToken
+		}
+		return fmt.Errorf("get unlock token: %w", err)
+	}
+
+	return s.clearLoginFailures(ctx, email)
+}
+
+// loginKey keys the login state of an account by a hash of its email, emails are case
+// insensitive and unknown ones are tracked too
+func loginKey(kind, email string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(email)))
+	return fmt.Sprintf("login_%s:%x", kind, hash)
+}
+
+func loginUnlockKey(tokenPlaintext string) string {
+	return "login_unlock:" + tokenHashHex(tokenPlaintext)
+}
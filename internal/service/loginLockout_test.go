@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/scheduler"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenService_LoginLockout(t *testing.T) {
+	ctx := context.Background()
+	info := data.SessionInfo{IP: "203.0.113.7"}
+
+	newService := func(t *testing.T) (*TokenService, func(time.Duration), *scheduler.Scheduler) {
+		s, store, mr := newTestTokenService(t)
+		s.userModel = &fakeUserModel{store: store, user: newTestUser(t)}
+		s.scheduler = scheduler.NewScheduler(0)
+
+		return s, mr.FastForward, s.scheduler
+	}
+
+	t.Run("delays then locks", func(t *testing.T) {
+		s, fastForward, sched := newService(t)
+
+		for failures := 1; failures < loginLockoutAfter; failures++ {
+			_, _, err := s.CreateAuthToken(ctx, "alice@example.com", "wrong-password", info)
+			if !errors.Is(err, ErrPasswordNotMatch) {
+				t.Fatalf("failure %d: got %v, want ErrPasswordNotMatch", failures, err)
+			}
+
+			if failures >= loginDelayAfter {
+				// even the right password has to wait
+				_, _, err = s.CreateAuthToken(ctx, "alice@example.com", "pa55word", info)
+				if !errors.Is(err, ErrLoginLocked) {
+					t.Fatalf("failure %d: got %v, want the next login delayed", failures, err)
+				}
+			}
+
+			fastForward(loginMaxDelay)
+		}
+
+		_, _, err := s.CreateAuthToken(ctx, "alice@example.com", "wrong-password", info)
+		if !errors.Is(err, ErrPasswordNotMatch) {
+			t.Fatalf("got %v, want ErrPasswordNotMatch", err)
+		}
+
+		fastForward(loginMaxDelay)
+		_, _, err = s.CreateAuthToken(ctx, "alice@example.com", "pa55word", info)
+		var locked *LoginLockedError
+		if !errors.As(err, &locked) || locked.RetryAfter <= loginMaxDelay {
+			t.Fatalf("got %v, want the account locked", err)
+		}
+
+		task := <-sched.TaskChannel
+		email, ok := task.Data.(scheduler.TaskSuspiciousLoginData)
+		if task.Type != scheduler.SendSuspiciousLoginEmail || !ok || email.Email != "alice@example.com" || email.IP != info.IP {
+			t.Fatalf("got task %+v, want a suspicious login email", task)
+		}
+
+		_, token, _ := strings.Cut(email.UnlockURL, "/v1/tokens/unlock/")
+		if err := s.UnlockLogin(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UnlockLogin(ctx, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("got %v, want the unlock link to work once", err)
+		}
+
+		result, _, err := s.CreateAuthToken(ctx, "alice@example.com", "pa55word", info)
+		if err != nil || result.TokenPair == nil {
+			t.Fatalf("got %v, want to log in after unlocking", err)
+		}
+	})
+
+	t.Run("unknown email is delayed the same", func(t *testing.T) {
+		s, _, sched := newService(t)
+
+		for range loginLockoutAfter {
+			s.CreateAuthToken(ctx, "nobody@example.com", "wrong-password", info)
+		}
+
+		_, _, err := s.CreateAuthToken(ctx, "nobody@example.com", "wrong-password", info)
+		if !errors.Is(err, ErrLoginLocked) {
+			t.Fatalf("got %v, want ErrLoginLocked", err)
+		}
+		if len(sched.TaskChannel) != 0 {
+			t.Error("emailed an unknown address")
+		}
+
+		_, _, err = s.CreateAuthToken(ctx, "alice@example.com", "pa55word", info)
+		if err != nil {
+			t.Errorf("got %v, want other accounts unaffected", err)
+		}
+	})
+}
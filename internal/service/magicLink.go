@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/scheduler"
+	"shuvoedward/Bible_project/internal/validator"
+	"time"
+)
+
+const (
+	magicLinkTTL = 15 * time.Minute
+
+	// An address gets at most one magic link per magicLinkInterval
+	magicLinkInterval = time.Minute
+)
+
+// CreateMagicLink emails a single-use link to log in without a password. Nothing tells
+// whether the email belongs to an account: unknown and unactivated emails, and emails
+// that were sent a link within the last minute, get nothing, without an error.
+// Returns validation and error
+func (s *TokenService) CreateMagicLink(ctx context.Context, email string) (*validator.Validator, error) {
+	v := validator.New()
+	validateEmail(v, email)
+	if !v.Valid() {
+		return v, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	due, err := s.redis.SetNX(ctx, loginKey("magic_link", email), "1", magicLinkInterval)
+	if err != nil {
+		return nil, fmt.Errorf("throttle magic link: %w", err)
+	}
+	if !due {
+		return nil, nil
+	}
+
+	user, err := s.userModel.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !user.Activated {
+		s.logger.Info("magic link requested for unactivated user", "user_id", user.ID)
+		return nil, nil
+	}
+
+	token, err := s.tokenModel.New(ctx, user.ID, magicLinkTTL, data.ScopeMagicLink)
+	if err != nil {
+		return nil, err
+	}
+
+	task := scheduler.Task{
+		Type:       scheduler.SendMagicLinkEmail,
+		MaxRetries: 3,
+		Data: scheduler.TaskMagicLinkData{
+			Email:    user.Email,
+			LoginURL: fmt.Sprintf("http://localhost:4000/v1/tokens/magic-link/%s", token.Plaintext),
+		},
+		CreatedAt: time.Now(),
+	}
+
+	s.scheduler.Submit(task)
+
+	return nil, nil
+}
+
+// ExchangeMagicLink logs in the user a magic link was sent to, like a login with email
+// and password. The link works once. Users with two-factor authentication get a
+// challenge token.
+// Returns ErrInvalidToken if the link is unknown, expired or used
+func (s *TokenService) ExchangeMagicLink(ctx context.Context, tokenPlaintext string, info data.SessionInfo) (*LoginResult, *validator.Validator, error) {
+	v := validator.New()
+	validateSessionInfo(v, info)
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	if len(tokenPlaintext) != 26 {
+		return nil, nil, ErrInvalidToken
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	userID, err := s.tokenModel.Consume(ctx, data.ScopeMagicLink, tokenPlaintext)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, fmt.Errorf("use magic link: %w", err)
+	}
+
+	user, err := s.userModel.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, fmt.Errorf("get user: %w", err)
+	}
+
+	result, err := s.LoginUser(ctx, user, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, nil, nil
+}
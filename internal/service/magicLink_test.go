@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/scheduler"
+	"strings"
+	"testing"
+)
+
+func TestTokenService_MagicLink(t *testing.T) {
+	ctx := context.Background()
+
+	s, store, mr := newTestTokenService(t)
+	s.userModel = &fakeUserModel{store: store, user: newTestUser(t)}
+	sched := scheduler.NewScheduler(0)
+	s.scheduler = sched
+
+	v, err := s.CreateMagicLink(ctx, "alice@example.com")
+	if v != nil || err != nil {
+		t.Fatalf("unexpected error: %v, %v", v, err)
+	}
+
+	task := <-sched.TaskChannel
+	email, ok := task.Data.(scheduler.TaskMagicLinkData)
+	if task.Type != scheduler.SendMagicLinkEmail || !ok || email.Email != "alice@example.com" {
+		t.Fatalf("got task %+v, want a magic link email", task)
+	}
+	_, token, _ := strings.Cut(email.LoginURL, "/v1/tokens/magic-link/")
+
+	t.Run("throttled and silent for unknown emails", func(t *testing.T) {
+		for _, address := range []string{"alice@example.com", "nobody@example.com"} {
+			v, err := s.CreateMagicLink(ctx, address)
+			if v != nil || err != nil {
+				t.Fatalf("%s: unexpected error: %v, %v", address, v, err)
+			}
+		}
+		if len(sched.TaskChannel) != 0 {
+			t.Error("sent another email")
+		}
+
+		mr.FastForward(magicLinkInterval)
+		s.CreateMagicLink(ctx, "alice@example.com")
+		if len(sched.TaskChannel) != 1 {
+			t.Error("expected a new link after the interval")
+		}
+		<-sched.TaskChannel
+	})
+
+	t.Run("works once", func(t *testing.T) {
+		result, _, err := s.ExchangeMagicLink(ctx, token, data.SessionInfo{})
+		if err != nil || result.TokenPair == nil {
+			t.Fatalf("got %v, want a token pair", err)
+		}
+
+		_, _, err = s.ExchangeMagicLink(ctx, token, data.SessionInfo{})
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("got %v, want ErrInvalidToken", err)
+		}
+	})
+}
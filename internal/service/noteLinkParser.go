@@ -0,0 +1,75 @@
+package service
+
+import (
+	"regexp"
+	"shuvoedward/Bible_project/internal/data"
+	"strconv"
+	"strings"
+)
+
+// maxNoteLinks caps how many links are stored for a single note
+const maxNoteLinks = 100
+
+// maxLinkTitleLength matches the notes.title column
+const maxLinkTitleLength = 255
+
+var (
+	// noteLinkRX matches [[note:123]] and [[Note Title]] links
+	noteLinkRX = regexp.MustCompile(`\[\[\s*([^\[\]]+?)\s*\]\]`)
+
+	// noteIDLinkRX matches the inner part of an id link
+	noteIDLinkRX = regexp.MustCompile(`(?i)^note:\s*(\d+)$`)
+)
+
+// ParseNoteLinks returns the distinct links found in content, in order of appearance.
+// Title links are deduplicated case-insensitively since GENERAL titles are matched that way.
+func ParseNoteLinks(content string) []*data.NoteLinkInput {
+	links := []*data.NoteLinkInput{}
+	seen := make(map[string]struct{})
+
+	for _, match := range noteLinkRX.FindAllStringSubmatch(content, -1) {
+		inner := strings.Join(strings.Fields(match[1]), " ")
+
+		link := &data.NoteLinkInput{Raw: inner}
+
+		if idMatch := noteIDLinkRX.FindStringSubmatch(inner); idMatch != nil {
+			id, err := strconv.ParseInt(idMatch[1], 10, 64)
+			if err != nil || id < 1 {
+				continue
+			}
+			link.TargetNoteID = id
+			link.Raw = "note:" + idMatch[1]
+		} else {
+			if len(inner) > maxLinkTitleLength {
+				continue
+			}
+			link.TargetTitle = inner
+		}
+
+		key := strings.ToLower(link.Raw)
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		links = append(links, link)
+		if len(links) == maxNoteLinks {
+			break
+		}
+	}
+
+	return links
+}
+
+// RewriteNoteLinks replaces every [[oldTitle]] link in content with [[newTitle]].
+// Matching is case-insensitive and tolerant of surrounding whitespace; id links are untouched.
+func RewriteNoteLinks(content, oldTitle, newTitle string) string {
+	words := strings.Fields(oldTitle)
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+
+	rx := regexp.MustCompile(`(?i)\[\[\s*` + strings.Join(words, `\s+`) + `\s*\]\]`)
+
+	return rx.ReplaceAllLiteralString(content, "[["+newTitle+"]]")
+}
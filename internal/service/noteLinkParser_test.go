@@ -0,0 +1,63 @@
+package service
+
+import (
+	"shuvoedward/Bible_project/internal/data"
+	"testing"
+)
+
+func TestParseNoteLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []data.NoteLinkInput
+	}{
+		{
+			name:    "id and title links",
+			content: "see [[note:12]] and [[ Grace  Alone ]]",
+			expected: []data.NoteLinkInput{
+				{Raw: "note:12", TargetNoteID: 12},
+				{Raw: "Grace Alone", TargetTitle: "Grace Alone"},
+			},
+		},
+		{
+			name:    "duplicates are case-insensitive",
+			content: "[[Faith]] [[faith]] [[NOTE:3]] [[note:3]]",
+			expected: []data.NoteLinkInput{
+				{Raw: "Faith", TargetTitle: "Faith"},
+				{Raw: "note:3", TargetNoteID: 3},
+			},
+		},
+		{
+			name:     "verse embeds and empty links are ignored",
+			content:  "{{John 3:16}} [[]] [[note:0]]",
+			expected: []data.NoteLinkInput{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseNoteLinks(tt.content)
+
+			if len(got) != len(tt.expected) {
+				t.Fatalf("got %d links, want %d: %+v", len(got), len(tt.expected), got)
+			}
+
+			for i, link := range got {
+				if *link != tt.expected[i] {
+					t.Errorf("link %d: got %+v, want %+v", i, *link, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteNoteLinks(t *testing.T) {
+	content := "see [[grace  alone]], [[Grace Alone Today]] and [[note:4]]"
+
+	got := RewriteNoteLinks(content, "Grace Alone", "Sola Gratia")
+	want := "see [[Sola Gratia]], [[Grace Alone Today]] and [[note:4]]"
+
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
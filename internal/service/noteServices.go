@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"regexp"
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/validator"
 	"slices"
@@ -26,28 +28,47 @@ type ImageStorageNote interface {
 	PresignedURLGenerator
 }
 
+type passageGetter interface {
+	Get(ctx context.Context, filters *data.LocationFilters) (*data.Passage, error)
+}
+
 // NoteService handles notes business logic
 type NoteService struct {
-	noteModel  data.NoteModel
-	imageModel data.ImageModel
-	imageStore ImageStorageNote
-	validator  *NoteValidator
-	logger     *slog.Logger
+	models        data.Models
+	noteModel     data.NoteModel
+	noteLinkModel data.NoteLinkModel
+	templateModel data.TemplateModel
+	imageModel    data.ImageModel
+	passageModel  passageGetter
+	imageStore    ImageStorageNote
+	validator     *NoteValidator
+	extractor     *ReferenceExtractor
+	logger        *slog.Logger
 }
 
 func NewNoteService(
+	models data.Models,
 	noteModel data.NoteModel,
+	noteLinkModel data.NoteLinkModel,
+	templateModel data.TemplateModel,
 	imageModel data.ImageModel,
+	passageModel passageGetter,
 	imageStoreNote ImageStorageNote,
 	validator *NoteValidator,
+	extractor *ReferenceExtractor,
 	logger *slog.Logger,
 ) *NoteService {
 	return &NoteService{
-		noteModel:  noteModel,
-		imageModel: imageModel,
-		imageStore: imageStoreNote,
-		validator:  validator,
-		logger:     logger,
+		models:        models,
+		noteModel:     noteModel,
+		noteLinkModel: noteLinkModel,
+		templateModel: templateModel,
+		imageModel:    imageModel,
+		passageModel:  passageModel,
+		imageStore:    imageStoreNote,
+		validator:     validator,
+		extractor:     extractor,
+		logger:        logger,
 	}
 }
 
@@ -62,6 +83,13 @@ type CreateNoteInput struct {
 	EndVerse    int
 	StartOffset int
 	EndOffset   int
+	TemplateID  int64
+
+	// Referenced range of CROSS_REFERENCE notes
+	TargetBook       string
+	TargetChapter    int
+	TargetStartVerse int
+	TargetEndVerse   int
 }
 
 // CreateNote handles validation and insertion based on note type.
@@ -83,8 +111,33 @@ func (s *NoteService) CreateNote(ctx context.Context, userID int64, input Create
 		EndOffset:   input.EndOffset,
 	}
 
+	// A template pre-fills the content of a BIBLE note for its location
+	if input.TemplateID > 0 {
+		v, err := s.applyTemplate(ctx, userID, input.TemplateID, content, location)
+		if v != nil || err != nil {
+			return nil, v, err
+		}
+	}
+
+	var target *data.NoteLocation
+	if content.NoteType == data.NoteTypeCrossRef && input.TargetBook != "" {
+		target = &data.NoteLocation{
+			Book:       input.TargetBook,
+			Chapter:    input.TargetChapter,
+			StartVerse: input.TargetStartVerse,
+			EndVerse:   input.TargetEndVerse,
+		}
+
+		// Without a comment, the content names both ends, which keeps it unique
+		if strings.TrimSpace(content.Content) == "" {
+			content.Content = fmt.Sprintf("%s → %s",
+				formatReference(location.Book, location.Chapter, location.StartVerse, location.EndVerse),
+				formatReference(target.Book, target.Chapter, target.StartVerse, target.EndVerse))
+		}
+	}
+
 	// 2. Validate based on note type
-	v := s.validator.ValidateNoteCreation(content, location)
+	v := s.validator.ValidateNoteCreation(content, location, target)
 	if !v.Valid() {
 		return nil, v, nil
 	}
@@ -97,7 +150,7 @@ func (s *NoteService) CreateNote(ctx context.Context, userID int64, input Create
 	case "GENERAL":
 		note, err = s.noteModel.InsertGeneral(ctx, content)
 	case "BIBLE", "CROSS_REFERENCE":
-		note, err = s.noteModel.InsertLocated(ctx, content, location)
+		note, err = s.noteModel.InsertLocated(ctx, content, location, target)
 	default:
 		return nil, nil, ErrInvalidNoteType
 	}
@@ -110,24 +163,329 @@ func (s *NoteService) CreateNote(ctx context.Context, userID int64, input Create
 		return nil, nil, err
 	}
 
+	if content.NoteType == data.NoteTypeGeneral {
+		s.syncDerivedLocations(ctx, userID, note.ID, content.Content)
+		s.resolveDanglingLinks(ctx, userID, note.ID, note.Title)
+	}
+	s.syncNoteLinks(ctx, userID, note.ID, content.Content)
+
 	return note, nil, nil
 }
 
-// DeleteNote handles note deletion with S3 cleanup
-// Business Rule: Delete S3 images first, then database
-// Rationale: Prevent orphaned S3 objects that cose money
-func (s *NoteService) DeleteNote(ctx context.Context, userID, noteID int64) error {
-	// 1. Check ownership (authorization)
+// applyTemplate renders a template into the content of a new BIBLE note.
+// The title defaults to "<template name>: <passage>".
+// Returns ErrTemplateNotFound if the template isn't built-in or owned by the user
+func (s *NoteService) applyTemplate(
+	ctx context.Context,
+	userID, templateID int64,
+	content *data.NoteContent,
+	location *data.NoteLocation,
+) (*validator.Validator, error) {
+	v := validator.New()
+
+	if content.NoteType == "" {
+		content.NoteType = data.NoteTypeBible
+	}
+	v.Check(content.NoteType == data.NoteTypeBible, "template_id", "can only be used with BIBLE notes")
+	v.Check(content.Content == "", "content", "must be empty when a template is used")
+	s.validator.ValidateLocation(v, location)
+	if !v.Valid() {
+		return v, nil
+	}
+
+	template, err := s.templateModel.Get(ctx, templateID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, fmt.Errorf("get template: %w", err)
+	}
+
+	content.Content = renderTemplate(template, location, time.Now())
+	if content.Title == "" {
+		content.Title = fmt.Sprintf("%s: %s", template.Name,
+			formatReference(location.Book, location.Chapter, location.StartVerse, location.EndVerse))
+	}
+
+	return nil, nil
+}
+
+// syncDerivedLocations stores the scripture references found in a GENERAL note's
+// content as derived locations, replacing the ones from the previous save.
+// Business Rule: derived data never fails the save, references that can't be stored
+// are skipped and logged, the others are kept
+func (s *NoteService) syncDerivedLocations(ctx context.Context, userID, noteID int64, content string) {
+	locations := s.extractor.Extract(content)
+
+	skipped, err := s.noteModel.ReplaceDerivedLocations(ctx, noteID, userID, locations)
+	if err != nil {
+		s.logger.Error("failed to store derived locations",
+			"note_id", noteID,
+			"user_id", userID,
+			"reference_count", len(locations),
+			"error", err)
+		return
+	}
+
+	for _, location := range skipped {
+		s.logger.Warn("skipped derived location",
+			"note_id", noteID,
+			"user_id", userID,
+			"reference", formatReference(location.Book, location.Chapter, location.StartVerse, location.EndVerse))
+	}
+}
+
+// syncNoteLinks stores the [[note:123]]/[[Note Title]] links found in content,
+// replacing the ones from the previous save.
+// Business Rule: derived data never fails the save, errors are only logged
+func (s *NoteService) syncNoteLinks(ctx context.Context, userID, noteID int64, content string) {
+	links := ParseNoteLinks(content)
+
+	err := s.noteLinkModel.Replace(ctx, userID, noteID, links)
+	if err != nil {
+		s.logger.Error("failed to store note links",
+			"note_id", noteID,
+			"user_id", userID,
+			"link_count", len(links),
+			"error", err)
+	}
+}
+
+// resolveDanglingLinks points existing [[Title]] links at a GENERAL note that
+// was just created or renamed to that title
+func (s *NoteService) resolveDanglingLinks(ctx context.Context, userID, noteID int64, title string) {
+	if title == "" {
+		return
+	}
+
+	err := s.noteLinkModel.ResolveDangling(ctx, userID, noteID, title)
+	if err != nil {
+		s.logger.Error("failed to resolve dangling note links",
+			"note_id", noteID,
+			"user_id", userID,
+			"error", err)
+	}
+}
+
+// renameNoteLinks rewrites the [[oldTitle]] links of every note linking to a
+// GENERAL note whose title changed, so the links keep resolving. Each linking note is
+// validated and updated like an edit of its own; a note that can't be, e.g. when the
+// rewrite would duplicate another note's content, keeps its content and its links are
+// left dangling.
+// Returns the notes that couldn't be rewritten
+func (s *NoteService) renameNoteLinks(ctx context.Context, userID, noteID int64, oldTitle, newTitle string) []*data.LinkRewriteFailure {
+	if oldTitle == "" || strings.EqualFold(oldTitle, newTitle) {
+		return nil
+	}
+
+	notes, err := s.noteLinkModel.GetTitleLinking(ctx, userID, noteID)
+	if err != nil {
+		s.logger.Error("failed to get linking notes",
+			"note_id", noteID,
+			"user_id", userID,
+			"error", err)
+		return []*data.LinkRewriteFailure{{Error: "the notes linking to this note could not be rewritten"}}
+	}
+
+	failures := []*data.LinkRewriteFailure{}
+	rewritten := 0
+
+	for _, note := range notes {
+		content := *note
+		content.Content = RewriteNoteLinks(note.Content, oldTitle, newTitle)
+		if content.Content == note.Content {
+			continue
+		}
+
+		err := s.rewriteNote(ctx, &content)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				continue // deleted since
+			}
+
+			failures = append(failures, &data.LinkRewriteFailure{
+				NoteID: note.ID,
+				Title:  note.Title,
+				Error:  err.Error(),
+			})
+
+			// The links now point at a title nobody has, store them as dangling
+			s.syncNoteLinks(ctx, userID, note.ID, note.Content)
+			continue
+		}
+
+		s.syncNoteLinks(ctx, userID, note.ID, content.Content)
+		rewritten++
+	}
+
+	if rewritten > 0 || len(failures) > 0 {
+		s.logger.Info("note links rewritten after rename",
+			"note_id", noteID,
+			"user_id", userID,
+			"notes_rewritten", rewritten,
+			"notes_failed", len(failures))
+	}
+
+	return failures
+}
+
+// rewriteNote updates a note whose content was rewritten for it, through the same
+// validation and update as an edit
+// Returns ErrRecordNotFound if the note is gone, other errors describe why it can't be stored
+func (s *NoteService) rewriteNote(ctx context.Context, content *data.NoteContent) error {
+	v := s.validator.ValidateUpdateNote(content)
+	if !v.Valid() {
+		fields := slices.Sorted(maps.Keys(v.Errors))
+		return fmt.Errorf("rewritten %s %s", fields[0], v.Errors[fields[0]])
+	}
+
+	_, err := s.noteModel.Update(ctx, content)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, data.ErrRecordNotFound):
+		return err
+	case errors.Is(err, data.ErrDuplicateContent):
+		return errors.New("rewritten content duplicates another note")
+	case errors.Is(err, data.ErrDuplicateTitleGeneral):
+		return errors.New("rewritten note duplicates another note's title")
+	default:
+		s.logger.Error("failed to rewrite note links",
+			"note_id", content.ID,
+			"user_id", content.UserID,
+			"error", err)
+		return errors.New("note could not be updated")
+	}
+}
+
+// GetBacklinks retrieves the notes linking to a specified note
+// Returns ErrNoteNotFound if the note doesn't exist or doesn't belong to the user
+func (s *NoteService) GetBacklinks(ctx context.Context, userID, noteID int64) ([]*data.NoteMetadata, error) {
 	exists, err := s.noteModel.ExistsForUser(ctx, noteID, userID)
 	if err != nil {
-		return fmt.Errorf("check note exists: %w", err)
+		return nil, fmt.Errorf("check note exists: %w", err)
 	}
 
 	if !exists {
-		return ErrNoteNotFound
+		return nil, ErrNoteNotFound
 	}
 
-	// 2. Get all images associated with this note
+	return s.noteLinkModel.GetBacklinks(ctx, userID, noteID)
+}
+
+// GetNoteLinks retrieves the outgoing links of a specified note, dangling ones included
+// Returns ErrNoteNotFound if the note doesn't exist or doesn't belong to the user
+func (s *NoteService) GetNoteLinks(ctx context.Context, userID, noteID int64) ([]*data.NoteLink, error) {
+	exists, err := s.noteModel.ExistsForUser(ctx, noteID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("check note exists: %w", err)
+	}
+
+	if !exists {
+		return nil, ErrNoteNotFound
+	}
+
+	return s.noteLinkModel.GetForNote(ctx, userID, noteID)
+}
+
+// GetDanglingLinks retrieves every link of the user that doesn't resolve to a note
+func (s *NoteService) GetDanglingLinks(ctx context.Context, userID int64) ([]*data.NoteLink, error) {
+	return s.noteLinkModel.GetDangling(ctx, userID)
+}
+
+// DeleteNote moves a note to the trash
+// Business Rule: Nothing is removed until the note is purged, so it can be restored
+func (s *NoteService) DeleteNote(ctx context.Context, userID, noteID int64) error {
+	err := s.noteModel.Trash(ctx, noteID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return ErrNoteNotFound
+		}
+		return fmt.Errorf("trash note: %w", err)
+	}
+
+	s.logger.Info("note moved to trash",
+		"note_id", noteID,
+		"user_id", userID,
+	)
+
+	return nil
+}
+
+// RestoreNote takes a note out of the trash
+// Returns ErrNoteNotFound if the note isn't in the user's trash, or a duplicate error
+// if a note with the same title (GENERAL) or content was created since
+func (s *NoteService) RestoreNote(ctx context.Context, userID, noteID int64) (*data.NoteResponse, error) {
+	note, err := s.noteModel.Restore(ctx, noteID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, ErrNoteNotFound
+		}
+		return nil, err
+	}
+
+	return note, nil
+}
+
+// ListTrash retrieves the user's trashed notes with pagination
+func (s *NoteService) ListTrash(ctx context.Context, userID int64, page, pageSize int) ([]*data.TrashedNote, data.Metadata, *validator.Validator, error) {
+	v := validator.New()
+
+	filters := data.Filters{
+		Page:     page,
+		PageSize: pageSize,
+	}
+	filters.Validate(v)
+
+	if !v.Valid() {
+		return nil, data.Metadata{}, v, nil
+	}
+
+	notes, metadata, err := s.noteModel.GetTrash(ctx, userID, &filters)
+	if err != nil {
+		return nil, data.Metadata{}, nil, fmt.Errorf("list trash: %w", err)
+	}
+
+	return notes, metadata, nil, nil
+}
+
+// purgeBatchSize caps how many trashed notes are purged per query
+const purgeBatchSize = 100
+
+// PurgeTrash permanently deletes notes that have been in the trash longer than retention.
+// Notes whose images can't be removed from S3 stay in the trash for the next run.
+// Returns the number of notes purged
+func (s *NoteService) PurgeTrash(ctx context.Context, retention time.Duration) (int, error) {
+	cutoff := time.Now().Add(-retention)
+	purged := 0
+
+	for {
+		notes, err := s.noteModel.GetTrashedBefore(ctx, cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, fmt.Errorf("get trashed notes: %w", err)
+		}
+
+		failed := 0
+		for _, note := range notes {
+			if err := s.purgeNote(ctx, note.UserID, note.ID); err != nil {
+				failed++
+				continue
+			}
+			purged++
+		}
+
+		// A full batch of failures would be fetched again, stop until the next run
+		if len(notes) < purgeBatchSize || failed == len(notes) {
+			return purged, nil
+		}
+	}
+}
+
+// purgeNote permanently deletes a note with S3 cleanup
+// Business Rule: Delete S3 images first, then database
+// Rationale: Prevent orphaned S3 objects that cose money
+func (s *NoteService) purgeNote(ctx context.Context, userID, noteID int64) error {
+	// 1. Get all images associated with this note
 	images, err := s.imageModel.GetForNote(ctx, noteID)
 	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
 		s.logger.Error("failed to retrieve images for deletion",
@@ -136,7 +494,7 @@ func (s *NoteService) DeleteNote(ctx context.Context, userID, noteID int64) erro
 		return fmt.Errorf("get note images: %w", err)
 	}
 
-	// 3. Delete from s3 first (most likely to fail)
+	// 2. Delete from s3 first (most likely to fail)
 	if len(images) > 0 {
 		if err := s.deleteImagesFromS3(ctx, images, noteID); err != nil {
 			// If S3 deletion fails, abort - don't touch database
@@ -144,7 +502,7 @@ func (s *NoteService) DeleteNote(ctx context.Context, userID, noteID int64) erro
 		}
 	}
 
-	// 4. All S3 deletion successful - safe to delete from database
+	// 3. All S3 deletion successful - safe to delete from database
 	if err := s.noteModel.Delete(ctx, noteID, userID); err != nil {
 		// S3 is deleted but DB failed - log for manual cleanup
 		s.logger.Error("DB deletion failed after S3 cleanup",
@@ -155,7 +513,7 @@ func (s *NoteService) DeleteNote(ctx context.Context, userID, noteID int64) erro
 		return fmt.Errorf("delete note from database: %w", err)
 	}
 
-	s.logger.Info("note deleted successfully",
+	s.logger.Info("note purged successfully",
 		"note_id", noteID,
 		"user_id", userID,
 		"images_deleted", len(images),
@@ -235,6 +593,67 @@ func (s *NoteService) GetNote(ctx context.Context, userID, noteID int64) (*data.
 	return note, imageData, nil
 }
 
+// maxVerseEmbeds caps how many embeds are expanded for a single note
+const maxVerseEmbeds = 20
+
+// verseEmbedRX matches embeds like {{John 3:16-18}} stored as-is in note content
+var verseEmbedRX = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// VerseEmbed is the expansion of a single {{reference}} embed.
+// Either Passage or Error is set, so one bad reference doesn't fail the whole note.
+type VerseEmbed struct {
+	Reference string        `json:"reference"`
+	Passage   *data.Passage `json:"passage,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// ExpandVerseEmbeds resolves every distinct {{reference}} embed in content through
+// the (cached) passage model, in order of appearance.
+// Returns one VerseEmbed per reference, failures are reported per reference
+func (s *NoteService) ExpandVerseEmbeds(ctx context.Context, content string) []*VerseEmbed {
+	embeds := []*VerseEmbed{}
+	seen := make(map[string]struct{})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	for _, match := range verseEmbedRX.FindAllStringSubmatch(content, -1) {
+		reference := match[1]
+		if _, exists := seen[reference]; exists {
+			continue
+		}
+		seen[reference] = struct{}{}
+
+		if len(embeds) == maxVerseEmbeds {
+			break
+		}
+
+		embed := &VerseEmbed{Reference: reference}
+		embeds = append(embeds, embed)
+
+		filter, err := s.extractor.ParseReference(reference)
+		if err != nil {
+			embed.Error = err.Error()
+			continue
+		}
+
+		passage, err := s.passageModel.Get(ctx, filter)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				embed.Error = ErrPassageNotFound.Error()
+				continue
+			}
+			s.logger.Error("failed to expand verse embed", "reference", reference, "error", err)
+			embed.Error = "passage could not be loaded"
+			continue
+		}
+
+		embed.Passage = passage
+	}
+
+	return embeds
+}
+
 // UpdateNote validates and updates a specified note
 // Returns the updated note, validation and error
 func (s *NoteService) UpdateNote(ctx context.Context, content *data.NoteContent) (*data.NoteResponse, *validator.Validator, error) {
@@ -244,6 +663,19 @@ func (s *NoteService) UpdateNote(ctx context.Context, content *data.NoteContent)
 		return nil, v, nil
 	}
 
+	// The previous title is needed to rewrite [[Title]] links after a rename
+	var oldTitle string
+	if content.NoteType == data.NoteTypeGeneral {
+		previous, err := s.noteModel.Get(ctx, content.UserID, content.ID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil, nil, ErrNoteNotFound
+			}
+			return nil, nil, err
+		}
+		oldTitle = previous.Title
+	}
+
 	note, err := s.noteModel.Update(ctx, content)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
@@ -254,6 +686,13 @@ func (s *NoteService) UpdateNote(ctx context.Context, content *data.NoteContent)
 		return nil, nil, err
 	}
 
+	if content.NoteType == data.NoteTypeGeneral {
+		s.syncDerivedLocations(ctx, content.UserID, note.ID, content.Content)
+		note.UnrewrittenLinks = s.renameNoteLinks(ctx, content.UserID, note.ID, oldTitle, note.Title)
+		s.resolveDanglingLinks(ctx, content.UserID, note.ID, note.Title)
+	}
+	s.syncNoteLinks(ctx, content.UserID, note.ID, content.Content)
+
 	return note, nil, nil
 }
 
@@ -279,7 +718,65 @@ func (s *NoteService) LinkNote(ctx context.Context, noteLinkLocation *data.NoteI
 
 // func (s *NoteService) DeleteLink(noteID, linID)
 
+// LinkNoteBatch links a note to several locations in a single transaction.
+// Every location is validated like in LinkNote; mode selects whether a failing
+// location rolls back the others (atomic) or is only reported (partial).
+// Returns ErrNoteNotFound if the note doesn't exist or doesn't belong to the user.
+func (s *NoteService) LinkNoteBatch(ctx context.Context, userID, noteID int64, mode string, locations []*data.NoteInputLocation) (*BatchReport, *validator.Validator, error) {
+	v := validator.New()
+	v.Check(noteID > 0, "note_id", "must be a valid id")
+	validateBatch(v, mode, len(locations))
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	_, err := s.noteModel.Get(ctx, userID, noteID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil, ErrNoteNotFound
+		}
+		return nil, nil, err
+	}
+
+	for _, location := range locations {
+		location.NoteID = noteID
+		location.UserID = userID
+	}
+
+	report, err := batchInsert(ctx, s.models, mode, len(locations),
+		func(i int) *validator.Validator {
+			return s.validator.ValidateNoteLink(locations[i])
+		},
+		func(tx data.Models, i int) (int64, error) {
+			linked, err := tx.Notes.Link(ctx, locations[i])
+			if err != nil {
+				return 0, err
+			}
+			return linked.Location.ID, nil
+		},
+		func(err error) (string, bool) {
+			switch {
+			case errors.Is(err, data.ErrLocationAlreadyLinked):
+				return "note is already linked to this location", true
+			case errors.Is(err, data.ErrRecordNotFound):
+				// The note was moved to the trash while the batch ran
+				return ErrNoteNotFound.Error(), true
+			default:
+				return "", false
+			}
+		},
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("link note batch: %w", err)
+	}
+
+	return report, nil, nil
+}
+
 // ListNotesInput contains parameters for listing notes
+// noteSortFields are the ways a list of notes can be sorted
+var noteSortFields = []string{"created_at", "-created_at", "title", "-title"}
+
 type ListNotesInput struct {
 	NoteType string
 	Page     int
@@ -288,7 +785,22 @@ type ListNotesInput struct {
 }
 
 // ListNotesMetadata retrieves paginated notes with validation
-func (s *NoteService) ListNotesMetadata(ctx context.Context, userID int64, input ListNotesInput) ([]*data.NoteMetadata, *validator.Validator, error) {
+// A page size or sort the request left empty falls back to the user's preferences
+func (s *NoteService) ListNotesMetadata(ctx context.Context, user *data.User, input ListNotesInput) ([]*data.NoteMetadata, *validator.Validator, error) {
+	userID := user.ID
+
+	preferences := user.Preferences.WithDefaults()
+	if input.PageSize == 0 {
+		input.PageSize = preferences.NotesPageSize
+	}
+	if input.Sort == "" {
+		input.Sort = preferences.NotesSort
+		// BIBLE notes have no title, a preferred title sort only applies to GENERAL notes
+		if !slices.Contains(s.getSortSafeListForNoteType(input.NoteType), input.Sort) {
+			input.Sort = data.DefaultPreferences().NotesSort
+		}
+	}
+
 	// 1. Validate usering existing validator
 	v := validator.New()
 
@@ -335,9 +847,8 @@ func (s *NoteService) validateNoteListParams(v *validator.Validator, noteType, s
 	v.Check(slices.Contains(validNoteTypes, noteType), "note_type", "must be GENERAL or BIBLE")
 
 	// Validate sort fields (domain rule)
-	validSortFields := []string{"created_at", "-created_at", "title", "-title"}
 	if sort != "" {
-		v.Check(slices.Contains(validSortFields, sort), "sort", "invalid sort field")
+		v.Check(slices.Contains(noteSortFields, sort), "sort", "invalid sort field")
 	}
 
 	// Business rule: BIBLE notes can't be sorted by title
@@ -358,30 +869,80 @@ type SearchInput struct {
 	SearchQuery string
 	Page        int
 	PageSize    int
+	Sort        string
+	NoteType    string
+	Book        string
+	From        *time.Time
+	Until       *time.Time
+	Tag         string
 }
 
+// SearchResult is a page of note search results with facet counts over all matches
+type SearchResult struct {
+	Notes    []*data.NoteSearchResponse
+	Metadata data.Metadata
+	Facets   *data.NoteSearchFacets
+}
+
+// tagRX matches tags as written after # in note content
+var tagRX = regexp.MustCompile(`^\w{1,50}$`)
+
 // SearchNotes searches notes and validates search input.
-// Returns search notes results, metadata, validation and error
-func (s *NoteService) SearchNotes(ctx context.Context, userID int64, input SearchInput) ([]*data.NoteSearchResponse, data.Metadata, *validator.Validator, error) {
+// Returns search notes results with facets, validation and error
+func (s *NoteService) SearchNotes(ctx context.Context, userID int64, input SearchInput) (*SearchResult, *validator.Validator, error) {
 	v := validator.New()
 
-	filter := data.Filters{
-		Page:     input.Page,
-		PageSize: input.PageSize,
+	if input.Sort == "" {
+		input.Sort = "relevance"
+	}
+
+	filter := &data.NoteSearchFilters{
+		Filters: data.Filters{
+			Page:         input.Page,
+			PageSize:     input.PageSize,
+			Sort:         input.Sort,
+			SortSafeList: []string{"relevance", "created_at", "updated_at", "-created_at", "-updated_at"},
+		},
+		Query:    strings.TrimSpace(input.SearchQuery),
+		NoteType: input.NoteType,
+		Book:     input.Book,
+		From:     input.From,
+		Until:    input.Until,
+		Tag:      strings.TrimPrefix(input.Tag, "#"),
 	}
 	filter.Validate(v)
+	filter.ValidateSort(v)
+
+	v.Check(filter.Query != "", "q", "must be provided")
+	if filter.NoteType != "" {
+		v.Check(slices.Contains([]string{data.NoteTypeGeneral, data.NoteTypeBible, data.NoteTypeCrossRef}, filter.NoteType),
+			"type", "must be GENERAL, BIBLE, or CROSS_REFERENCE")
+	}
+	if filter.Book != "" {
+		s.validator.BibleValidator.ValidateBook(v, filter.Book, 1, -1, -1)
+	}
+	if filter.From != nil && filter.Until != nil {
+		v.Check(filter.From.Before(*filter.Until), "to", "must not be before from")
+	}
+	if filter.Tag != "" {
+		v.Check(tagRX.MatchString(filter.Tag), "tag", "must be letters, digits or underscores, at most 50")
+	}
 
 	if !v.Valid() {
-		return nil, data.Metadata{}, v, nil
+		return nil, v, nil
 	}
 
-	results, metadata, err := s.noteModel.SearchNotes(ctx, userID, input.SearchQuery, &filter)
+	notes, metadata, err := s.noteModel.SearchNotes(ctx, userID, filter)
 	if err != nil {
-		return nil, data.Metadata{}, nil, err
+		return nil, nil, err
 	}
 
-	return results, metadata, nil, nil
+	facets, err := s.noteModel.SearchFacets(ctx, userID, filter)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	return &SearchResult{Notes: notes, Metadata: metadata, Facets: facets}, nil, nil
 }
 
 func (s *NoteService) DeleteLink(ctx context.Context, userID, noteID, locationID int64) (*validator.Validator, error) {
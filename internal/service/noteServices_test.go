@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/data"
+	"strings"
+	"testing"
+)
+
+// fakeNoteModel keeps notes by ID, an update whose content hashes like another
+// BIBLE note's fails like the content hash index would
+type fakeNoteModel struct {
+	data.NoteModel
+	notes map[int64]*data.NoteContent
+}
+
+func (m *fakeNoteModel) Get(ctx context.Context, userID, id int64) (*data.NoteResponse, error) {
+	note, ok := m.notes[id]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+	return &data.NoteResponse{ID: note.ID, Title: note.Title, Content: note.Content, NoteType: note.NoteType}, nil
+}
+
+func (m *fakeNoteModel) Update(ctx context.Context, content *data.NoteContent) (*data.NoteResponse, error) {
+	if _, ok := m.notes[content.ID]; !ok {
+		return nil, data.ErrRecordNotFound
+	}
+
+	for _, other := range m.notes {
+		if other.ID != content.ID && other.NoteType == data.NoteTypeBible && other.Content == content.Content {
+			return nil, data.ErrDuplicateContent
+		}
+	}
+
+	stored := *content
+	m.notes[content.ID] = &stored
+
+	return &data.NoteResponse{ID: stored.ID, Title: stored.Title, Content: stored.Content, NoteType: stored.NoteType}, nil
+}
+
+func (m *fakeNoteModel) ReplaceDerivedLocations(ctx context.Context, noteID, userID int64, locations []*data.NoteLocation) ([]*data.NoteLocation, error) {
+	return nil, nil
+}
+
+// fakeNoteLinkModel finds the notes linking by title in the note model, and keeps the
+// links each note was last stored with
+type fakeNoteLinkModel struct {
+	data.NoteLinkModel
+	notes *fakeNoteModel
+	links map[int64][]*data.NoteLinkInput
+}
+
+func (m *fakeNoteLinkModel) GetTitleLinking(ctx context.Context, userID, targetNoteID int64) ([]*data.NoteContent, error) {
+	linking := []*data.NoteContent{}
+	for _, id := range []int64{2, 3} {
+		note := *m.notes.notes[id]
+		linking = append(linking, &note)
+	}
+	return linking, nil
+}
+
+func (m *fakeNoteLinkModel) Replace(ctx context.Context, userID, sourceNoteID int64, links []*data.NoteLinkInput) error {
+	m.links[sourceNoteID] = links
+	return nil
+}
+
+func (m *fakeNoteLinkModel) ResolveDangling(ctx context.Context, userID, noteID int64, title string) error {
+	return nil
+}
+
+func TestNoteService_RenameRewritesLinks(t *testing.T) {
+	notes := &fakeNoteModel{notes: map[int64]*data.NoteContent{
+		1: {ID: 1, UserID: 1, Title: "Grace", Content: "unearned favour", NoteType: data.NoteTypeGeneral},
+		// rewriting its link makes it the same as note 4
+		2: {ID: 2, UserID: 1, Content: "see [[Grace]]", NoteType: data.NoteTypeBible},
+		3: {ID: 3, UserID: 1, Title: "Sermon", Content: "on [[grace]] and law", NoteType: data.NoteTypeGeneral},
+		4: {ID: 4, UserID: 1, Content: "see [[Mercy]]", NoteType: data.NoteTypeBible},
+	}}
+	links := &fakeNoteLinkModel{notes: notes, links: make(map[int64][]*data.NoteLinkInput)}
+
+	books := map[string]struct{}{"John": {}}
+	s := NewNoteService(data.Models{}, notes, links, nil, nil, nil, nil,
+		NewNoteValidator(books), NewReferenceExtractor(books), slog.New(slog.DiscardHandler))
+
+	note, v, err := s.UpdateNote(context.Background(), &data.NoteContent{
+		ID:       1,
+		UserID:   1,
+		Title:    "Mercy",
+		Content:  "unearned favour",
+		NoteType: data.NoteTypeGeneral,
+	})
+	if err != nil || (v != nil && !v.Valid()) {
+		t.Fatalf("UpdateNote() got %v %v, want the rename to succeed", v, err)
+	}
+
+	if got := notes.notes[3].Content; got != "on [[Mercy]] and law" {
+		t.Errorf("got note 3 content %q, want its link rewritten", got)
+	}
+	if got := links.links[3]; len(got) != 1 || got[0].TargetTitle != "Mercy" {
+		t.Errorf("got note 3 links %+v, want them stored for the new title", got)
+	}
+
+	if got := notes.notes[2].Content; got != "see [[Grace]]" {
+		t.Errorf("got note 2 content %q, want it unchanged after the collision", got)
+	}
+	if got := links.links[2]; len(got) != 1 || got[0].TargetTitle != "Grace" {
+		t.Errorf("got note 2 links %+v, want them stored for the old title, dangling", got)
+	}
+
+	if len(note.UnrewrittenLinks) != 1 || note.UnrewrittenLinks[0].NoteID != 2 ||
+		!strings.Contains(note.UnrewrittenLinks[0].Error, "duplicates") {
+		t.Errorf("got unrewritten links %+v, want the collision on note 2 reported", note.UnrewrittenLinks)
+	}
+}
@@ -1,10 +1,16 @@
 package service
 
 import (
+	"fmt"
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/validator"
+	"strings"
+	"unicode/utf8"
 )
 
+// maxNoteContentLength is the content_max_length constraint of the notes table
+const maxNoteContentLength = 50000
+
 // NoteValidtor handles note validation logic
 type NoteValidator struct {
 	BibleValidator *BibleValidator
@@ -16,15 +22,19 @@ func NewNoteValidator(books map[string]struct{}) *NoteValidator {
 }
 
 // ValidateNoteCreation based on note type
+// target is the referenced range of CROSS_REFERENCE notes
 // Returns the validator - caller checks v.Valid()
-func (nv *NoteValidator) ValidateNoteCreation(content *data.NoteContent, location *data.NoteLocation) *validator.Validator {
+func (nv *NoteValidator) ValidateNoteCreation(content *data.NoteContent, location, target *data.NoteLocation) *validator.Validator {
 	v := validator.New() // pass validator through NoteValidator struct?
 
 	switch content.NoteType {
 	case "GENERAL":
 		nv.validateGeneralNote(v, content)
-	case "BIBLE", "CROSS_REFERENCE":
+	case "BIBLE":
+		nv.validateLocatedNote(v, content, location)
+	case "CROSS_REFERENCE":
 		nv.validateLocatedNote(v, content, location)
+		nv.validateCrossReferenceTarget(v, location, target)
 	default:
 		v.AddError("note_type", "must be GENERAL, BIBLE, or CROSS_REFERENCE")
 	}
@@ -36,7 +46,14 @@ func (nv *NoteValidator) ValidateNoteCreation(content *data.NoteContent, locatio
 func (nv *NoteValidator) validateGeneralNote(v *validator.Validator, content *data.NoteContent) {
 	v.Check(content.UserID > 0, "user_id", "must be valid")
 	v.Check(content.Title != "", "title", "must be provided")
-	v.Check(content.Content != "", "content", "must be provided")
+	validateNoteContent(v, content.Content)
+}
+
+// validateNoteContent checks content against the limit the notes table enforces
+func validateNoteContent(v *validator.Validator, content string) {
+	v.Check(content != "", "content", "must be provided")
+	v.Check(utf8.RuneCountInString(content) <= maxNoteContentLength, "content",
+		fmt.Sprintf("must not be more than %d characters long", maxNoteContentLength))
 }
 
 // validateLocatedNote validate BIBLE and CROSS_REFERENCE notes
@@ -45,7 +62,7 @@ func (nv *NoteValidator) validateLocatedNote(
 	content *data.NoteContent,
 	location *data.NoteLocation) {
 
-	v.Check(content.Content != "", "content", "must be provided")
+	validateNoteContent(v, content.Content)
 
 	// CROSS_REFERENCE notes should not have titles
 	if content.NoteType == "CROSS_REFERENCE" {
@@ -55,6 +72,29 @@ func (nv *NoteValidator) validateLocatedNote(
 	nv.ValidateLocation(v, location)
 }
 
+// validateCrossReferenceTarget validates the target range of a CROSS_REFERENCE note
+// under target_* keys, so errors aren't confused with the source location's
+func (nv *NoteValidator) validateCrossReferenceTarget(v *validator.Validator, source, target *data.NoteLocation) {
+	if target == nil {
+		v.AddError("target", "must be provided for CROSS_REFERENCE notes")
+		return
+	}
+
+	tv := validator.New()
+	nv.BibleValidator.ValidateBook(tv, target.Book, target.Chapter, target.StartVerse, target.EndVerse)
+	for key, message := range tv.Errors {
+		v.AddError("target_"+key, message)
+	}
+
+	if source != nil {
+		sameRange := source.Book == target.Book &&
+			source.Chapter == target.Chapter &&
+			source.StartVerse == target.StartVerse &&
+			source.EndVerse == target.EndVerse
+		v.Check(!sameRange, "target", "must differ from the note's location")
+	}
+}
+
 func (nv *NoteValidator) ValidateLocation(v *validator.Validator, location *data.NoteLocation) {
 	if location == nil {
 		v.AddError("location", "must be provided for BIBLE and CROSS_REFERENCE notes")
@@ -77,12 +117,19 @@ func (nv *NoteValidator) ValidateLocation(v *validator.Validator, location *data
 func (nv *NoteValidator) ValidateUpdateNote(content *data.NoteContent) *validator.Validator {
 	v := validator.New()
 
-	nv.validateGeneralNote(v, content)
-
 	v.Check(content.ID > 0, "note_id", "must be greater than zero")
 
-	if content.NoteType == "CROSS_REFERENCE" {
-		v.Check(content.Title == "", "title", "CROSS_REFERENCE note, title not allowed")
+	switch content.NoteType {
+	case "BIBLE", "CROSS_REFERENCE":
+		// titles are optional on located notes, CROSS_REFERENCE notes have none
+		v.Check(content.UserID > 0, "user_id", "must be valid")
+		validateNoteContent(v, content.Content)
+
+		if content.NoteType == "CROSS_REFERENCE" {
+			v.Check(content.Title == "", "title", "CROSS_REFERENCE note, title not allowed")
+		}
+	default:
+		nv.validateGeneralNote(v, content)
 	}
 
 	return v
@@ -115,3 +162,45 @@ func (nv *NoteValidator) ValidateDeleteLink(noteID, locationID, userID int64) *v
 
 	return v
 }
+
+// templatePlaceholders are the {{name}} placeholders filled in when a template pre-fills a note.
+// Any other {{...}} must be a scripture reference, it's kept as a verse embed.
+var templatePlaceholders = map[string]struct{}{
+	"passage": {},
+	"date":    {},
+	"book":    {},
+	"chapter": {},
+}
+
+// ValidateTemplate validates a note template's name, description and sections.
+// isReference reports whether an unknown placeholder is a valid verse embed.
+// Returns the validator, caller checks v.Valid()
+func (nv *NoteValidator) ValidateTemplate(template *data.NoteTemplate, isReference func(string) bool) *validator.Validator {
+	v := validator.New()
+
+	v.Check(template.Name != "", "name", "must be provided")
+	v.Check(utf8.RuneCountInString(template.Name) <= 100, "name", "must not be more than 100 characters")
+	v.Check(utf8.RuneCountInString(template.Description) <= 500, "description", "must not be more than 500 characters")
+
+	v.Check(len(template.Sections) > 0, "sections", "must contain at least one section")
+	v.Check(len(template.Sections) <= 20, "sections", "must not contain more than 20 sections")
+
+	for i, section := range template.Sections {
+		key := fmt.Sprintf("sections[%d]", i)
+
+		v.Check(section.Heading != "", key+".heading", "must be provided")
+		v.Check(utf8.RuneCountInString(section.Heading) <= 200, key+".heading", "must not be more than 200 characters")
+		v.Check(utf8.RuneCountInString(section.Body) <= 5000, key+".body", "must not be more than 5000 characters")
+
+		for _, text := range []string{section.Heading, section.Body} {
+			for _, match := range verseEmbedRX.FindAllStringSubmatch(text, -1) {
+				if _, ok := templatePlaceholders[strings.ToLower(match[1])]; ok {
+					continue
+				}
+				v.Check(isReference(match[1]), key, fmt.Sprintf("unknown placeholder {{%s}}", match[1]))
+			}
+		}
+	}
+
+	return v
+}
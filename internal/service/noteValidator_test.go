@@ -0,0 +1,64 @@
+package service
+
+import (
+	"shuvoedward/Bible_project/internal/data"
+	"strings"
+	"testing"
+)
+
+func TestNoteValidator_ContentLength(t *testing.T) {
+	nv := NewNoteValidator(map[string]struct{}{"John": {}})
+	location := &data.NoteLocation{Book: "John", Chapter: 3, StartVerse: 16, EndVerse: 16}
+
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"at the limit", strings.Repeat("é", maxNoteContentLength), true},
+		{"over the limit", strings.Repeat("a", maxNoteContentLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// create and update agree, for every note type
+			for _, noteType := range []string{data.NoteTypeGeneral, data.NoteTypeBible} {
+				content := &data.NoteContent{ID: 1, UserID: 1, Title: "Grace", Content: tt.content, NoteType: noteType}
+
+				if v := nv.ValidateNoteCreation(content, location, nil); v.Valid() != tt.valid {
+					t.Errorf("create %s: got valid %v, want %v: %v", noteType, v.Valid(), tt.valid, v.Errors)
+				}
+				if v := nv.ValidateUpdateNote(content); v.Valid() != tt.valid {
+					t.Errorf("update %s: got valid %v, want %v: %v", noteType, v.Valid(), tt.valid, v.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestNoteValidator_UpdateTitle(t *testing.T) {
+	nv := NewNoteValidator(map[string]struct{}{"John": {}})
+
+	tests := []struct {
+		name     string
+		noteType string
+		title    string
+		valid    bool
+	}{
+		{"GENERAL needs a title", data.NoteTypeGeneral, "", false},
+		{"BIBLE without a title", data.NoteTypeBible, "", true},
+		{"BIBLE with a title", data.NoteTypeBible, "Grace", true},
+		{"CROSS_REFERENCE without a title", data.NoteTypeCrossRef, "", true},
+		{"CROSS_REFERENCE with a title", data.NoteTypeCrossRef, "Grace", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := &data.NoteContent{ID: 1, UserID: 1, Title: tt.title, Content: "see John 3:16", NoteType: tt.noteType}
+
+			if v := nv.ValidateUpdateNote(content); v.Valid() != tt.valid {
+				t.Errorf("got valid %v, want %v: %v", v.Valid(), tt.valid, v.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"shuvoedward/Bible_project/internal/cache"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// oidcStateTTL is how long a user has to log in at the provider and come back
+	oidcStateTTL = 10 * time.Minute
+
+	// oidcTimeout bounds the requests made to a provider
+	oidcTimeout = 10 * time.Second
+)
+
+// OIDCProviderConfig is an OpenID Connect provider users can log in with. Name is used
+// in the login URLs, Issuer is where the provider's configuration is discovered.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// OIDCAuthorization is where the user is sent to log in at a provider, State comes
+// back with the code and is checked by the client before finishing the login
+type OIDCAuthorization struct {
+	URL   string `json:"authorization_url"`
+	State string `json:"state"`
+}
+
+// oidcState is what is remembered about a login between sending the user to the
+// provider and their return
+type oidcState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// oidcClaims are the ID token claims used to link an identity to a user
+type oidcClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// userLogin starts sessions for users an identity provider vouched for
+type userLogin interface {
+	LoginUser(ctx context.Context, user *data.User, info data.SessionInfo) (*LoginResult, error)
+	RevokeAllTokens(ctx context.Context, userID int64) error
+}
+
+// oidcProvider discovers its provider's endpoints and keys on first use, so the API
+// starts even if a provider is unreachable
+type oidcProvider struct {
+	config OIDCProviderConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover %s: %w", p.config.Name, err)
+	}
+
+	p.provider = provider
+
+	return provider, nil
+}
+
+func (p *oidcProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+}
+
+type OIDCService struct {
+	providers     map[string]*oidcProvider
+	identityModel data.IdentityModel
+	userModel     data.UserModel
+	login         userLogin
+	redis         *cache.RedisClient
+	client        *http.Client
+	logger        *slog.Logger
+}
+
+func NewOIDCService(
+	providers []OIDCProviderConfig,
+	identityModel data.IdentityModel,
+	userModel data.UserModel,
+	login userLogin,
+	redis *cache.RedisClient,
+	logger *slog.Logger,
+) *OIDCService {
+	s := &OIDCService{
+		providers:     make(map[string]*oidcProvider, len(providers)),
+		identityModel: identityModel,
+		userModel:     userModel,
+		login:         login,
+		redis:         redis,
+		client:        &http.Client{Timeout: oidcTimeout},
+		logger:        logger,
+	}
+
+	for _, config := range providers {
+		s.providers[config.Name] = &oidcProvider{config: config}
+	}
+
+	return s
+}
+
+// Providers lists the names of the configured providers
+func (s *OIDCService) Providers() []string {
+	return slices.Sorted(maps.Keys(s.providers))
+}
+
+// AuthorizationURL starts a login at a provider with the authorization code flow and
+// PKCE. The state, code verifier and nonce are kept until the user comes back.
+// Returns ErrOIDCProviderNotFound if the provider isn't configured
+func (s *OIDCService) AuthorizationURL(ctx context.Context, providerName string) (*OIDCAuthorization, error) {
+	p, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(oidc.ClientContext(ctx, s.client), oidcTimeout)
+	defer cancel()
+
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state := rand.Text()
+	loginState := oidcState{
+		Provider: providerName,
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    rand.Text(),
+	}
+
+	js, err := json.Marshal(loginState)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.redis.Set(ctx, oidcStateKey(state), string(js), oidcStateTTL)
+	if err != nil {
+		return nil, fmt.Errorf("store oidc state: %w", err)
+	}
+
+	url := p.oauth2Config(provider).AuthCodeURL(
+		state,
+		oauth2.S256ChallengeOption(loginState.Verifier),
+		oidc.Nonce(loginState.Nonce),
+	)
+
+	return &OIDCAuthorization{URL: url, State: state}, nil
+}
+
+// Login finishes a login at a provider, exchanging the code for an ID token and logging
+// in the user linked to the identity. An identity that isn't linked yet is linked to the
+// user with the same email, or a new user is created, but only if the provider verified
+// the email. Users with two-factor authentication get a challenge token.
+// Returns ErrOIDCProviderNotFound, ErrInvalidOIDCState if the state is unknown, expired
+// or used, ErrOIDCLoginFailed if the provider rejects the code or its ID token is
+// invalid, or ErrOIDCEmailNotVerified
+func (s *OIDCService) Login(ctx context.Context, providerName, code, state string, info data.SessionInfo) (*LoginResult, *validator.Validator, error) {
+	v := validator.New()
+	v.Check(code != "", "code", "must be provided")
+	v.Check(state != "", "state", "must be provided")
+	validateSessionInfo(v, info)
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	p, ok := s.providers[providerName]
+	if !ok {
+		return nil, nil, ErrOIDCProviderNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(oidc.ClientContext(ctx, s.client), oidcTimeout)
+	defer cancel()
+
+	loginState, err := s.takeState(ctx, state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if loginState.Provider != providerName {
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(loginState.Verifier))
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			s.logger.Warn("identity provider rejected code", "provider", providerName, "error", err)
+			return nil, nil, ErrOIDCLoginFailed
+		}
+		return nil, nil, fmt.Errorf("exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		s.logger.Warn("identity provider returned no id token", "provider", providerName)
+		return nil, nil, ErrOIDCLoginFailed
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		s.logger.Warn("invalid id token", "provider", providerName, "error", err)
+		return nil, nil, ErrOIDCLoginFailed
+	}
+
+	if idToken.Nonce != loginState.Nonce {
+		s.logger.Warn("id token nonce mismatch", "provider", providerName)
+		return nil, nil, ErrOIDCLoginFailed
+	}
+
+	var claims oidcClaims
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read id token claims: %w", err)
+	}
+
+	identity := &data.Identity{
+		Provider: providerName,
+		Subject:  idToken.Subject,
+		Email:    claims.Email,
+	}
+
+	user, err := s.userForIdentity(ctx, identity, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.login.LoginUser(ctx, user, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, nil, nil
+}
+
+// takeState gets the state of a login and drops it, each state finishes one login
+func (s *OIDCService) takeState(ctx context.Context, state string) (*oidcState, error) {
+	js, err := s.redis.GetDel(ctx, oidcStateKey(state))
+	if err != nil {
+		if errors.Is(err, cache.ErrKeyNotFound) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, fmt.Errorf("get oidc state: %w", err)
+	}
+
+	var loginState oidcState
+	err = json.Unmarshal([]byte(js), &loginState)
+	if err != nil {
+		return nil, fmt.Errorf("decode oidc state: %w", err)
+	}
+
+	return &loginState, nil
+}
+
+// userForIdentity returns the user linked to the identity, linking it on its first login
+func (s *OIDCService) userForIdentity(ctx context.Context, identity *data.Identity, claims oidcClaims) (*data.User, error) {
+	user, err := s.identityModel.GetUser(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, fmt.Errorf("get identity: %w", err)
+	}
+
+	if !claims.EmailVerified || !validator.Matches(claims.Email, validator.EmailRX) {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	user, err = s.userModel.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		err = s.linkUser(ctx, user, identity)
+	case errors.Is(err, data.ErrRecordNotFound):
+		user, err = s.createUser(ctx, identity, claims)
+	default:
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	// A concurrent login of the same identity linked it first
+	if errors.Is(err, data.ErrDuplicateIdentity) {
+		user, err = s.identityModel.GetUser(ctx, identity.Provider, identity.Subject)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("link identity: %w", err)
+	}
+
+	return user, nil
+}
+
+// linkUser links the identity to the user with its email. A user who never activated
+// is activated, since the provider verified the email. Their password wasn't set by a
+// proven owner of the email though, it is replaced and their tokens are revoked.
+func (s *OIDCService) linkUser(ctx context.Context, user *data.User, identity *data.Identity) error {
+	claimed := !user.Activated
+	if claimed {
+		user.Activated = true
+
+		err := user.Password.Set(rand.Text())
+		if err != nil {
+			return fmt.Errorf("hash password: %w", err)
+		}
+	}
+
+	err := s.identityModel.Link(ctx, user, identity)
+	if err != nil {
+		return err
+	}
+
+	if claimed {
+		err = s.login.RevokeAllTokens(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("revoke tokens: %w", err)
+		}
+	}
+
+	s.logger.Info("linked identity", "user_id", user.ID, "provider", identity.Provider, "activated", claimed)
+
+	return nil
+}
+
+// createUser signs up an activated user for the identity. They have a random password,
+// a password reset sets one to also log in with email and password.
+func (s *OIDCService) createUser(ctx context.Context, identity *data.Identity, claims oidcClaims) (*data.User, error) {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" || len(name) > 500 {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user := &data.User{
+		Name:      name,
+		Email:     claims.Email,
+		Activated: true,
+	}
+
+	err := user.Password.Set(rand.Text())
+	if err != nil {
+		return nil, fmt.Errorf("hash password: %w", err)
+	}
+
+	err = s.identityModel.NewUser(ctx, user, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("created user for identity", "user_id", user.ID, "provider", identity.Provider)
+
+	return user, nil
+}
+
+func oidcStateKey(state string) string {
+	return fmt.Sprintf("oidc_state:%s", state)
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"shuvoedward/Bible_project/internal/cache"
+	"shuvoedward/Bible_project/internal/data"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// mockOIDCProvider is an OpenID Connect provider that issues a code for the claims of
+// the next login and only exchanges it with the matching PKCE verifier
+type mockOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockOIDCCode
+}
+
+type mockOIDCCode struct {
+	challenge string
+	claims    map[string]any
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockOIDCProvider{key: key, codes: make(map[string]mockOIDCCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("POST /token", p.token)
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// authorize logs the user in as if they went to the authorization URL, returning the code
+// and state the provider redirects back with
+func (p *mockOIDCProvider) authorize(t *testing.T, authorizationURL string, claims map[string]any) (string, string) {
+	t.Helper()
+
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("expected S256 code challenge, got %q", query.Get("code_challenge_method"))
+	}
+
+	claims["iss"] = p.URL
+	claims["aud"] = query.Get("client_id")
+	claims["nonce"] = query.Get("nonce")
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+
+	code := rand.Text()
+
+	p.mu.Lock()
+	p.codes[code] = mockOIDCCode{challenge: query.Get("code_challenge"), claims: claims}
+	p.mu.Unlock()
+
+	return code, query.Get("state")
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	code, ok := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != code.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "invalid_grant"}`))
+		return
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: p.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	payload, _ := json.Marshal(code.claims)
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := signed.CompactSerialize()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// fakeIdentityModel keeps identities and the users created for them in memory
+type fakeIdentityModel struct {
+	users      *fakeUserModel
+	identities map[string]int64
+	created    []*data.User
+}
+
+func (m *fakeIdentityModel) GetUser(ctx context.Context, provider, subject string) (*data.User, error) {
+	userID, ok := m.identities[provider+"|"+subject]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+	for _, user := range m.created {
+		if user.ID == userID {
+			return user, nil
+		}
+	}
+	return m.users.Get(ctx, userID)
+}
+
+func (m *fakeIdentityModel) NewUser(ctx context.Context, user *data.User, identity *data.Identity) error {
+	user.ID = int64(100 + len(m.created))
+	m.created = append(m.created, user)
+	return m.Link(ctx, user, identity)
+}
+
+func (m *fakeIdentityModel) Link(ctx context.Context, user *data.User, identity *data.Identity) error {
+	key := identity.Provider + "|" + identity.Subject
+	if _, ok := m.identities[key]; ok {
+		return data.ErrDuplicateIdentity
+	}
+	identity.UserID = user.ID
+	m.identities[key] = user.ID
+	return nil
+}
+
+// fakeUserLogin logs users in with a token pair and records revocations
+type fakeUserLogin struct {
+	revoked []int64
+}
+
+func (f *fakeUserLogin) LoginUser(ctx context.Context, user *data.User, info data.SessionInfo) (*LoginResult, error) {
+	return &LoginResult{TokenPair: &TokenPair{Access: &data.Token{UserID: user.ID}}}, nil
+}
+
+func (f *fakeUserLogin) RevokeAllTokens(ctx context.Context, userID int64) error {
+	f.revoked = append(f.revoked, userID)
+	return nil
+}
+
+func TestOIDCService(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+
+	mr := miniredis.RunT(t)
+	redisClient, err := cache.NewRedisClient(cache.RedisConfig{Host: mr.Host(), Port: mr.Port()}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newService := func(user *data.User) (*OIDCService, *fakeIdentityModel, *fakeUserLogin) {
+		users := &fakeUserModel{user: user}
+		identities := &fakeIdentityModel{users: users, identities: make(map[string]int64)}
+		login := &fakeUserLogin{}
+
+		s := NewOIDCService(
+			[]OIDCProviderConfig{{
+				Name:        "mock",
+				Issuer:      provider.URL,
+				ClientID:    "bible-notes",
+				RedirectURL: "http://localhost:9000/login/callback",
+			}},
+			identities,
+			users,
+			login,
+			redisClient,
+			slog.New(slog.DiscardHandler),
+		)
+
+		return s, identities, login
+	}
+
+	ctx := context.Background()
+	info := data.SessionInfo{UserAgent: "test"}
+
+	// login goes through the provider and returns the user logged in as
+	login := func(t *testing.T, s *OIDCService, claims map[string]any) (int64, error) {
+		t.Helper()
+
+		authorization, err := s.AuthorizationURL(ctx, "mock")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, state := provider.authorize(t, authorization.URL, claims)
+		if state != authorization.State {
+			t.Fatalf("expected state %q, got %q", authorization.State, state)
+		}
+
+		result, v, err := s.Login(ctx, "mock", code, state, info)
+		if v != nil {
+			t.Fatalf("unexpected validation errors: %v", v.Errors)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		return result.Access.UserID, nil
+	}
+
+	t.Run("new user", func(t *testing.T) {
+		s, identities, _ := newService(nil)
+
+		userID, err := login(t, s, map[string]any{"sub": "u1", "email": "bob@example.com", "email_verified": true, "name": "Bob"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(identities.created) != 1 {
+			t.Fatalf("expected a new user, got %d", len(identities.created))
+		}
+		created := identities.created[0]
+		if created.ID != userID || !created.Activated || created.Name != "Bob" || created.Email != "bob@example.com" {
+			t.Errorf("unexpected user %+v", created)
+		}
+
+		// The identity logs in as the same user from now on
+		again, err := login(t, s, map[string]any{"sub": "u1", "email": "bob@example.com", "email_verified": true})
+		if err != nil || again != userID {
+			t.Errorf("expected user %d again, got %d, %v", userID, again, err)
+		}
+		if len(identities.created) != 1 {
+			t.Errorf("expected no other user, got %d", len(identities.created))
+		}
+	})
+
+	t.Run("links existing user by email", func(t *testing.T) {
+		user := newTestUser(t)
+		s, identities, logins := newService(user)
+
+		userID, err := login(t, s, map[string]any{"sub": "u2", "email": user.Email, "email_verified": true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if userID != user.ID || len(identities.created) != 0 {
+			t.Errorf("expected existing user %d, got %d", user.ID, userID)
+		}
+		if match, _ := user.Password.Matches("pa55word"); !match {
+			t.Error("expected the password of an activated user to be kept")
+		}
+		if len(logins.revoked) != 0 {
+			t.Errorf("expected no revoked tokens, got %v", logins.revoked)
+		}
+	})
+
+	t.Run("activates unactivated user", func(t *testing.T) {
+		user := newTestUser(t)
+		user.Activated = false
+		s, _, logins := newService(user)
+
+		userID, err := login(t, s, map[string]any{"sub": "u3", "email": user.Email, "email_verified": true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if userID != user.ID || !user.Activated {
+			t.Errorf("expected user %d to be activated", user.ID)
+		}
+		if match, _ := user.Password.Matches("pa55word"); match {
+			t.Error("expected the password of an unactivated user to be replaced")
+		}
+		if len(logins.revoked) != 1 || logins.revoked[0] != user.ID {
+			t.Errorf("expected tokens of user %d revoked, got %v", user.ID, logins.revoked)
+		}
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		user := newTestUser(t)
+		s, identities, _ := newService(user)
+
+		_, err := login(t, s, map[string]any{"sub": "u4", "email": user.Email, "email_verified": false})
+		if !errors.Is(err, ErrOIDCEmailNotVerified) {
+			t.Fatalf("expected ErrOIDCEmailNotVerified, got %v", err)
+		}
+		if len(identities.identities) != 0 {
+			t.Errorf("expected no linked identity, got %v", identities.identities)
+		}
+	})
+
+	t.Run("state works once", func(t *testing.T) {
+		s, _, _ := newService(nil)
+
+		authorization, err := s.AuthorizationURL(ctx, "mock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, state := provider.authorize(t, authorization.URL, map[string]any{"sub": "u5", "email": "carol@example.com", "email_verified": true})
+
+		if _, _, err := s.Login(ctx, "mock", code, state, info); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, _, err = s.Login(ctx, "mock", code, state, info)
+		if !errors.Is(err, ErrInvalidOIDCState) {
+			t.Errorf("expected ErrInvalidOIDCState, got %v", err)
+		}
+	})
+
+	t.Run("code without verifier", func(t *testing.T) {
+		s, _, _ := newService(nil)
+
+		// A code issued for another login's PKCE challenge is rejected by the provider
+		first, err := s.AuthorizationURL(ctx, "mock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := s.AuthorizationURL(ctx, "mock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := provider.authorize(t, first.URL, map[string]any{"sub": "u6", "email": "dave@example.com", "email_verified": true})
+
+		_, _, err = s.Login(ctx, "mock", code, second.State, info)
+		if !errors.Is(err, ErrOIDCLoginFailed) {
+			t.Errorf("expected ErrOIDCLoginFailed, got %v", err)
+		}
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		s, _, _ := newService(nil)
+
+		_, err := s.AuthorizationURL(ctx, "other")
+		if !errors.Is(err, ErrOIDCProviderNotFound) {
+			t.Errorf("expected ErrOIDCProviderNotFound, got %v", err)
+		}
+	})
+}
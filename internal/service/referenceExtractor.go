@@ -0,0 +1,149 @@
+package service
+
+import (
+	"regexp"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxDerivedLocations caps how many references are stored for a single note
+// so a pasted reading plan can't explode note_locations
+const maxDerivedLocations = 50
+
+// bookAliases maps common alternative spellings to canonical book names
+var bookAliases = map[string]string{
+	"Psalm":         "Psalms",
+	"Song of Songs": "Song of Solomon",
+}
+
+// ReferenceExtractor detects scripture references ("Isaiah 53:5", "1 Peter 2:24",
+// "John 3:16-18") in free text. References must name a verse; bare chapters
+// like "Romans 8" are ignored.
+type ReferenceExtractor struct {
+	pattern   *regexp.Regexp
+	reference *regexp.Regexp    // a single reference, verse optional
+	canonical map[string]string // lowercased name or alias -> canonical book name
+	validator *BibleValidator
+}
+
+func NewReferenceExtractor(books map[string]struct{}) *ReferenceExtractor {
+	canonical := make(map[string]string, len(books)+len(bookAliases))
+	names := make([]string, 0, len(books)+len(bookAliases))
+
+	for book := range books {
+		canonical[strings.ToLower(book)] = book
+		names = append(names, book)
+	}
+
+	for alias, book := range bookAliases {
+		if _, exists := books[book]; exists {
+			canonical[strings.ToLower(alias)] = book
+			names = append(names, alias)
+		}
+	}
+
+	// Longest names first so "1 John" wins over "John" and "Psalms" over "Psalm"
+	slices.SortFunc(names, func(a, b string) int { return len(b) - len(a) })
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strings.ReplaceAll(regexp.QuoteMeta(name), " ", `\s+`)
+	}
+
+	bookGroup := `(` + strings.Join(quoted, "|") + `)`
+
+	// <book> <chapter>:<verse>[-<verse>]
+	pattern := regexp.MustCompile(`(?i)\b` + bookGroup + `\s+(\d{1,3}):(\d{1,3})(?:\s*[-–]\s*(\d{1,3}))?\b`)
+
+	// <book> <chapter>[:<verse>[-<verse>]]
+	reference := regexp.MustCompile(`(?i)^` + bookGroup + `\s+(\d{1,3})(?::(\d{1,3})(?:\s*[-–]\s*(\d{1,3}))?)?$`)
+
+	return &ReferenceExtractor{
+		pattern:   pattern,
+		reference: reference,
+		canonical: canonical,
+		validator: NewBibleValidator(books),
+	}
+}
+
+// ParseReference parses a single reference such as "John 3:16-18" or "Psalm 23".
+// A reference without verses selects the whole chapter (StartVerse and EndVerse are -1).
+func (e *ReferenceExtractor) ParseReference(reference string) (*data.LocationFilters, error) {
+	match := e.reference.FindStringSubmatch(strings.TrimSpace(reference))
+	if match == nil {
+		return nil, ErrInvalidReference
+	}
+
+	book, ok := e.canonical[strings.ToLower(strings.Join(strings.Fields(match[1]), " "))]
+	if !ok {
+		return nil, ErrInvalidReference
+	}
+
+	filter := &data.LocationFilters{Book: book, StartVerse: -1, EndVerse: -1}
+	filter.Chapter, _ = strconv.Atoi(match[2])
+
+	if match[3] != "" {
+		filter.StartVerse, _ = strconv.Atoi(match[3])
+		filter.EndVerse = filter.StartVerse
+	}
+	if match[4] != "" {
+		filter.EndVerse, _ = strconv.Atoi(match[4])
+	}
+
+	v := validator.New()
+	e.validator.ValidateBook(v, filter.Book, filter.Chapter, filter.StartVerse, filter.EndVerse)
+	if !v.Valid() {
+		return nil, ErrInvalidReference
+	}
+
+	return filter, nil
+}
+
+// Extract returns the distinct, valid references found in text, in order of appearance
+func (e *ReferenceExtractor) Extract(text string) []*data.NoteLocation {
+	locations := []*data.NoteLocation{}
+	seen := make(map[data.NoteLocation]struct{})
+
+	for _, match := range e.pattern.FindAllStringSubmatch(text, -1) {
+		name := strings.ToLower(strings.Join(strings.Fields(match[1]), " "))
+		book, ok := e.canonical[name]
+		if !ok {
+			continue
+		}
+
+		chapter, _ := strconv.Atoi(match[2])
+		startVerse, _ := strconv.Atoi(match[3])
+		endVerse := startVerse
+		if match[4] != "" {
+			endVerse, _ = strconv.Atoi(match[4])
+		}
+
+		location := data.NoteLocation{
+			Book:       book,
+			Chapter:    chapter,
+			StartVerse: startVerse,
+			EndVerse:   endVerse,
+		}
+
+		v := validator.New()
+		e.validator.ValidateBook(v, location.Book, location.Chapter, location.StartVerse, location.EndVerse)
+		if !v.Valid() {
+			continue
+		}
+
+		if _, exists := seen[location]; exists {
+			continue
+		}
+		seen[location] = struct{}{}
+
+		locations = append(locations, &location)
+		if len(locations) == maxDerivedLocations {
+			break
+		}
+	}
+
+	return locations
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"shuvoedward/Bible_project/internal/data"
+	"testing"
+)
+
+func TestReferenceExtractor_Extract(t *testing.T) {
+	books := make(map[string]struct{}, len(data.AllBooks))
+	for _, book := range data.AllBooks {
+		books[book] = struct{}{}
+	}
+
+	extractor := NewReferenceExtractor(books)
+
+	tests := []struct {
+		name     string
+		text     string
+		expected []data.NoteLocation
+	}{
+		{
+			name: "two references",
+			text: "compare Isaiah 53:5 with 1 Peter 2:24",
+			expected: []data.NoteLocation{
+				{Book: "Isaiah", Chapter: 53, StartVerse: 5, EndVerse: 5},
+				{Book: "1 Peter", Chapter: 2, StartVerse: 24, EndVerse: 24},
+			},
+		},
+		{
+			name: "verse range and alias",
+			text: "see john 3:16-18 and Psalm 23:1",
+			expected: []data.NoteLocation{
+				{Book: "John", Chapter: 3, StartVerse: 16, EndVerse: 18},
+				{Book: "Psalms", Chapter: 23, StartVerse: 1, EndVerse: 1},
+			},
+		},
+		{
+			name: "numbered book wins over plain book",
+			text: "1 John 4:8",
+			expected: []data.NoteLocation{
+				{Book: "1 John", Chapter: 4, StartVerse: 8, EndVerse: 8},
+			},
+		},
+		{
+			name: "duplicates and invalid ranges are dropped",
+			text: "Romans 8:28, Romans 8:28, Romans 8:30-29, Romans 8",
+			expected: []data.NoteLocation{
+				{Book: "Romans", Chapter: 8, StartVerse: 28, EndVerse: 28},
+			},
+		},
+		{
+			name:     "no references",
+			text:     "faith, hope and love",
+			expected: []data.NoteLocation{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractor.Extract(tt.text)
+
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %d references, got %d", len(tt.expected), len(got))
+			}
+
+			for i, location := range got {
+				if *location != tt.expected[i] {
+					t.Errorf("reference %d: expected %+v, got %+v", i, tt.expected[i], *location)
+				}
+			}
+		})
+	}
+}
+
+func TestReferenceExtractor_ParseReference(t *testing.T) {
+	books := map[string]struct{}{"John": {}, "Psalms": {}}
+
+	extractor := NewReferenceExtractor(books)
+
+	tests := []struct {
+		name      string
+		reference string
+		expected  *data.LocationFilters
+	}{
+		{"verse range", "John 3:16-18", &data.LocationFilters{Book: "John", Chapter: 3, StartVerse: 16, EndVerse: 18}},
+		{"single verse", "john 3:16", &data.LocationFilters{Book: "John", Chapter: 3, StartVerse: 16, EndVerse: 16}},
+		{"whole chapter", "Psalm 23", &data.LocationFilters{Book: "Psalms", Chapter: 23, StartVerse: -1, EndVerse: -1}},
+		{"unknown book", "Hezekiah 1:1", nil},
+		{"trailing text", "John 3:16 and more", nil},
+		{"invalid chapter", "John 0:1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractor.ParseReference(tt.reference)
+
+			if tt.expected == nil {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", *got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if *got != *tt.expected {
+				t.Errorf("expected %+v, got %+v", *tt.expected, *got)
+			}
+		})
+	}
+}
@@ -13,10 +13,19 @@ type Service struct {
 	Note         *NoteService
 	User         *UserService
 	Token        *TokenService
+	TwoFactor    *TwoFactorService
+	APIKey       *APIKeyService
+	OIDC         *OIDCService
 	Highlight    *HighlightService
 	Book         *BookService
 	Autocomplete *AutocompleteService
 	Image        *ImageService
+	Export       *ExportService
+	Import       *ImportService
+	Template     *TemplateService
+	Annotation   *AnnotationService
+	Sync         *SyncService
+	Event        *EventService
 	Scheduler    *scheduler.Scheduler
 }
 
@@ -32,39 +41,82 @@ func NewServices(
 	booksSearchIndex map[string][]string,
 	imageProcessor ImageProcessor,
 	scheduler *scheduler.Scheduler,
+	broker EventSubscriber,
+	oidcProviders []OIDCProviderConfig,
 ) *Service {
 	noteValidator := NewNoteValidator(books)
+	extractor := NewReferenceExtractor(books)
+
+	noteService := NewNoteService(
+		models,
+		models.Notes,
+		models.NoteLinks,
+		models.Templates,
+		models.NoteImages,
+		models.Passages,
+		s3Service,
+		noteValidator,
+		extractor,
+		logger,
+	)
+
+	highlightService := NewHighlightService(
+		models,
+		models.Highlights,
+		models.Palette,
+		NewBibleValidator(books),
+		logger,
+	)
+
+	twoFactorService := NewTwoFactorService(
+		models.TwoFactor,
+		models.Users,
+		logger,
+	)
+
+	tokenService := NewTokenService(
+		models.Tokens,
+		models.Users,
+		models.Sessions,
+		twoFactorService,
+		redisClient,
+		scheduler,
+		logger,
+	)
 
 	return &Service{
-		Note: NewNoteService(
-			models.Notes,
-			models.NoteImages,
-			s3Service,
-			noteValidator,
-			logger,
-		),
+		Note: noteService,
 		User: NewUserService(
 			models,
 			models.Users,
 			models.Tokens,
+			models.NoteImages,
+			models.Exports,
+			s3Service,
+			tokenService,
 			scheduler,
 			logger,
 		),
-		Token: NewTokenService(
-			models.Tokens,
-			models.Users,
+		Token:     tokenService,
+		TwoFactor: twoFactorService,
+		APIKey: NewAPIKeyService(
+			models.APIKeys,
 			redisClient,
-			scheduler,
 			logger,
 		),
-		Highlight: NewHighlightService(
-			models.Highlights,
-			NewBibleValidator(books),
+		OIDC: NewOIDCService(
+			oidcProviders,
+			models.Identities,
+			models.Users,
+			tokenService,
+			redisClient,
 			logger,
 		),
+		Highlight: highlightService,
 		Book: NewBookService(
 			models.Passages,
 			models.Highlights,
+			models.Palette,
 			models.Notes,
 			NewBibleValidator(books),
 			logger,
@@ -79,5 +131,40 @@ func NewServices(
 			models.NoteImages,
 			models.Notes,
 		),
+		Export: NewExportService(
+			models.Exports,
+			models.Users,
+			s3Service,
+			scheduler,
+			logger,
+		),
+		Import: NewImportService(
+			noteService,
+			highlightService,
+			models.Highlights,
+			extractor,
+			logger,
+		),
+		Template: NewTemplateService(
+			models.Templates,
+			noteValidator,
+			extractor,
+			logger,
+		),
+		Annotation: NewAnnotationService(
+			models.Annotations,
+			NewBibleValidator(books),
+		),
+		Sync: NewSyncService(
+			models.Sync,
+			noteService,
+			highlightService,
+			s3Service,
+			logger,
+		),
+		Event: NewEventService(
+			broker,
+			models.Sync,
+		),
 	}
 }
@@ -0,0 +1,513 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"slices"
+	"time"
+)
+
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 1000
+	maxSyncPush      = 100
+)
+
+const (
+	SyncOpCreate = "create"
+	SyncOpUpdate = "update"
+	SyncOpDelete = "delete"
+)
+
+const (
+	SyncStatusApplied  = "applied"
+	SyncStatusConflict = "conflict"
+	SyncStatusInvalid  = "invalid"
+	SyncStatusNotFound = "not_found"
+	SyncStatusFailed   = "failed"
+)
+
+type noteSyncer interface {
+	CreateNote(ctx context.Context, userID int64, input CreateNoteInput) (*data.NoteResponse, *validator.Validator, error)
+	DeleteLink(ctx context.Context, userID, noteID, locationID int64) (*validator.Validator, error)
+	DeleteNote(ctx context.Context, userID, noteID int64) error
+	LinkNote(ctx context.Context, noteLinkLocation *data.NoteInputLocation) (*data.NoteResponse, *validator.Validator, error)
+	UpdateNote(ctx context.Context, content *data.NoteContent) (*data.NoteResponse, *validator.Validator, error)
+}
+
+type highlightSyncer interface {
+	DeleteHighlight(ctx context.Context, highlightID, userID int64) (*validator.Validator, error)
+	InsertHighlight(ctx context.Context, highlight *data.Highlight, userID int64) (*validator.Validator, error)
+	UpdateHighlight(ctx context.Context, highlightID, userID int64, update *HighlightUpdate) (*validator.Validator, error)
+}
+
+// SyncService lets offline clients pull changes since a cursor and push their own
+type SyncService struct {
+	syncModel  data.SyncModel
+	notes      noteSyncer
+	highlights highlightSyncer
+	imageStore PresignedURLGenerator
+	logger     *slog.Logger
+}
+
+func NewSyncService(
+	syncModel data.SyncModel,
+	notes noteSyncer,
+	highlights highlightSyncer,
+	imageStore PresignedURLGenerator,
+	logger *slog.Logger,
+) *SyncService {
+	return &SyncService{
+		syncModel:  syncModel,
+		notes:      notes,
+		highlights: highlights,
+		imageStore: imageStore,
+		logger:     logger,
+	}
+}
+
+// SyncPull is a page of changes. Entities are in their current state, deleted ones
+// (and notes moved to the trash, with their locations and images) are tombstones.
+// Cursor is passed as since to get the next page, HasMore tells if there is one.
+type SyncPull struct {
+	Notes      []*data.NoteResponse  `json:"notes"`
+	Locations  []*data.SyncLocation  `json:"locations"`
+	Highlights []*data.Highlight     `json:"highlights"`
+	Images     []*data.ImageData     `json:"images"`
+	Tombstones []*data.SyncTombstone `json:"tombstones"`
+	Cursor     int64                 `json:"cursor"`
+	HasMore    bool                  `json:"has_more"`
+}
+
+// Pull retrieves the latest state of everything the user changed after since, oldest
+// change first, limit entities per page. since 0 returns everything.
+func (s *SyncService) Pull(ctx context.Context, userID, since int64, limit int) (*SyncPull, *validator.Validator, error) {
+	if limit == 0 {
+		limit = defaultSyncLimit
+	}
+
+	v := validator.New()
+	v.Check(since >= 0, "since", "must be zero or a cursor returned by a previous sync")
+	v.Check(limit > 0 && limit <= maxSyncLimit, "limit", fmt.Sprintf("must be between 1 and %d", maxSyncLimit))
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	// One extra change tells whether there is another page
+	changes, err := s.syncModel.GetChanges(ctx, userID, since, limit+1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get sync changes: %w", err)
+	}
+
+	pull := &SyncPull{
+		Notes:      []*data.NoteResponse{},
+		Locations:  []*data.SyncLocation{},
+		Highlights: []*data.Highlight{},
+		Images:     []*data.ImageData{},
+		Tombstones: []*data.SyncTombstone{},
+		Cursor:     since,
+	}
+
+	if len(changes) > limit {
+		changes = changes[:limit]
+		pull.HasMore = true
+	}
+	if len(changes) > 0 {
+		pull.Cursor = changes[len(changes)-1].Cursor
+	}
+
+	changed := map[string][]int64{}
+	for _, change := range changes {
+		if change.Deleted {
+			pull.Tombstones = append(pull.Tombstones, &data.SyncTombstone{Type: change.Entity, ID: change.EntityID})
+			continue
+		}
+		changed[change.Entity] = append(changed[change.Entity], change.EntityID)
+	}
+
+	if ids := changed[data.SyncEntityNote]; len(ids) > 0 {
+		pull.Notes, err = s.syncModel.GetNotes(ctx, userID, ids)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get sync notes: %w", err)
+		}
+		pull.Tombstones = appendMissing(pull.Tombstones, data.SyncEntityNote, ids, pull.Notes, func(n *data.NoteResponse) int64 { return n.ID })
+	}
+
+	if ids := changed[data.SyncEntityLocation]; len(ids) > 0 {
+		pull.Locations, err = s.syncModel.GetLocations(ctx, userID, ids)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get sync locations: %w", err)
+		}
+		pull.Tombstones = appendMissing(pull.Tombstones, data.SyncEntityLocation, ids, pull.Locations, func(l *data.SyncLocation) int64 { return l.ID })
+	}
+
+	if ids := changed[data.SyncEntityHighlight]; len(ids) > 0 {
+		pull.Highlights, err = s.syncModel.GetHighlights(ctx, userID, ids)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get sync highlights: %w", err)
+		}
+		pull.Tombstones = appendMissing(pull.Tombstones, data.SyncEntityHighlight, ids, pull.Highlights, func(h *data.Highlight) int64 { return h.ID })
+	}
+
+	if ids := changed[data.SyncEntityImage]; len(ids) > 0 {
+		pull.Images, err = s.syncModel.GetImages(ctx, userID, ids)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get sync images: %w", err)
+		}
+		pull.Tombstones = appendMissing(pull.Tombstones, data.SyncEntityImage, ids, pull.Images, func(i *data.ImageData) int64 { return i.ID })
+		s.presignImages(ctx, pull.Images)
+	}
+
+	return pull, nil, nil
+}
+
+// appendMissing adds a tombstone for every changed ID that is no longer readable,
+// e.g. a location of a note that was trashed after the change was recorded
+func appendMissing[T any](tombstones []*data.SyncTombstone, entity string, ids []int64, found []T, id func(T) int64) []*data.SyncTombstone {
+	present := make(map[int64]struct{}, len(found))
+	for _, item := range found {
+		present[id(item)] = struct{}{}
+	}
+
+	for _, changedID := range ids {
+		if _, ok := present[changedID]; !ok {
+			tombstones = append(tombstones, &data.SyncTombstone{Type: entity, ID: changedID})
+		}
+	}
+
+	return tombstones
+}
+
+func (s *SyncService) presignImages(ctx context.Context, images []*data.ImageData) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for _, image := range images {
+		presignedURL, err := s.imageStore.GeneratePresignedURL(ctx, image.S3Key, 3*time.Hour)
+		if err != nil {
+			// Log error but continue - the client can fetch the note for a new URL
+			s.logger.Error("failed to generate presigned url", "image_id", image.ID, "error", err)
+		}
+		image.PresignedURL = presignedURL
+	}
+}
+
+// SyncPushChange is one change made by a client while offline.
+// BaseCursor is the cursor the client last synced the entity at, an update or delete
+// of an entity changed on the server since then is a conflict. 0 skips the check.
+type SyncPushChange struct {
+	ClientID   string
+	Type       string
+	Op         string
+	ID         int64
+	BaseCursor int64
+
+	// Notes and locations, NoteID is the note a location is added to
+	NoteID      int64
+	Title       string
+	Content     string
+	NoteType    string
+	Book        string
+	Chapter     int
+	StartVerse  int
+	EndVerse    int
+	StartOffset int
+	EndOffset   int
+
+	TargetBook       string
+	TargetChapter    int
+	TargetStartVerse int
+	TargetEndVerse   int
+
+	// Highlights
+	Color     string
+	PaletteID *int64
+}
+
+// SyncPushResult is the outcome of a single pushed change. On a conflict Server
+// holds the server's current copy, or is empty if the entity was deleted.
+type SyncPushResult struct {
+	ClientID string            `json:"client_id,omitempty"`
+	Type     string            `json:"type"`
+	Op       string            `json:"op"`
+	Status   string            `json:"status"`
+	ID       int64             `json:"id,omitempty"`
+	Reason   string            `json:"reason,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"`
+	Server   any               `json:"server,omitempty"`
+}
+
+// SyncPushReport holds one result per change, in order, and the cursor after all of them
+type SyncPushReport struct {
+	Results []*SyncPushResult `json:"results"`
+	Cursor  int64             `json:"cursor"`
+}
+
+// Push applies the client's changes one by one through the note and highlight services,
+// so each change gets the same validation as the regular endpoints. A failing change
+// doesn't stop the others.
+func (s *SyncService) Push(ctx context.Context, userID int64, changes []SyncPushChange) (*SyncPushReport, *validator.Validator, error) {
+	v := validator.New()
+	v.Check(len(changes) > 0, "changes", "must contain at least one change")
+	v.Check(len(changes) <= maxSyncPush, "changes", fmt.Sprintf("must not contain more than %d changes", maxSyncPush))
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	report := &SyncPushReport{Results: make([]*SyncPushResult, 0, len(changes))}
+
+	for _, change := range changes {
+		result, err := s.apply(ctx, userID, change)
+		if err != nil {
+			s.logger.Error("failed to apply sync change",
+				"user_id", userID,
+				"type", change.Type,
+				"op", change.Op,
+				"id", change.ID,
+				"error", err,
+			)
+			result = &SyncPushResult{Status: SyncStatusFailed, Reason: "could not apply change"}
+		}
+
+		result.ClientID = change.ClientID
+		result.Type = change.Type
+		result.Op = change.Op
+		if result.ID == 0 {
+			result.ID = change.ID
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	cursor, err := s.syncModel.GetCursor(ctx, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get sync cursor: %w", err)
+	}
+	report.Cursor = cursor
+
+	return report, nil, nil
+}
+
+// apply applies a single change, expected failures are reported in the result
+func (s *SyncService) apply(ctx context.Context, userID int64, change SyncPushChange) (*SyncPushResult, error) {
+	v := validator.New()
+	v.Check(slices.Contains([]string{data.SyncEntityNote, data.SyncEntityLocation, data.SyncEntityHighlight}, change.Type), "type", "must be note, location or highlight")
+	v.Check(slices.Contains([]string{SyncOpCreate, SyncOpUpdate, SyncOpDelete}, change.Op), "op", "must be create, update or delete")
+	v.Check(change.Op == SyncOpCreate || change.ID > 0, "id", "must be provided")
+	v.Check(change.Type != data.SyncEntityLocation || change.Op != SyncOpUpdate, "op", "locations can only be created or deleted")
+	v.Check(change.BaseCursor >= 0, "base_cursor", "must not be negative")
+	if !v.Valid() {
+		return invalidResult(v), nil
+	}
+
+	if change.Op != SyncOpCreate && change.BaseCursor > 0 {
+		result, err := s.checkConflict(ctx, userID, change)
+		if err != nil || result != nil {
+			return result, err
+		}
+	}
+
+	switch change.Type {
+	case data.SyncEntityNote:
+		return s.applyNote(ctx, userID, change)
+	case data.SyncEntityLocation:
+		return s.applyLocation(ctx, userID, change)
+	default:
+		return s.applyHighlight(ctx, userID, change)
+	}
+}
+
+// checkConflict returns a conflict result if the entity changed after the client's base cursor
+func (s *SyncService) checkConflict(ctx context.Context, userID int64, change SyncPushChange) (*SyncPushResult, error) {
+	latest, err := s.syncModel.GetLatestChange(ctx, userID, change.Type, change.ID)
+	if err != nil {
+		return nil, err
+	}
+	if latest <= change.BaseCursor {
+		return nil, nil
+	}
+
+	result := &SyncPushResult{Status: SyncStatusConflict, Reason: "changed on the server since base_cursor"}
+
+	ids := []int64{change.ID}
+	switch change.Type {
+	case data.SyncEntityNote:
+		notes, err := s.syncModel.GetNotes(ctx, userID, ids)
+		if err != nil {
+			return nil, err
+		}
+		if len(notes) > 0 {
+			result.Server = notes[0]
+		}
+	case data.SyncEntityLocation:
+		locations, err := s.syncModel.GetLocations(ctx, userID, ids)
+		if err != nil {
+			return nil, err
+		}
+		if len(locations) > 0 {
+			result.Server = locations[0]
+		}
+	case data.SyncEntityHighlight:
+		highlights, err := s.syncModel.GetHighlights(ctx, userID, ids)
+		if err != nil {
+			return nil, err
+		}
+		if len(highlights) > 0 {
+			result.Server = highlights[0]
+		}
+	}
+
+	return result, nil
+}
+
+func (s *SyncService) applyNote(ctx context.Context, userID int64, change SyncPushChange) (*SyncPushResult, error) {
+	var (
+		note *data.NoteResponse
+		v    *validator.Validator
+		err  error
+	)
+
+	switch change.Op {
+	case SyncOpCreate:
+		note, v, err = s.notes.CreateNote(ctx, userID, CreateNoteInput{
+			Title:            change.Title,
+			Content:          change.Content,
+			NoteType:         change.NoteType,
+			Book:             change.Book,
+			Chapter:          change.Chapter,
+			StartVerse:       change.StartVerse,
+			EndVerse:         change.EndVerse,
+			StartOffset:      change.StartOffset,
+			EndOffset:        change.EndOffset,
+			TargetBook:       change.TargetBook,
+			TargetChapter:    change.TargetChapter,
+			TargetStartVerse: change.TargetStartVerse,
+			TargetEndVerse:   change.TargetEndVerse,
+		})
+	case SyncOpUpdate:
+		note, v, err = s.notes.UpdateNote(ctx, &data.NoteContent{
+			ID:       change.ID,
+			UserID:   userID,
+			Title:    change.Title,
+			Content:  change.Content,
+			NoteType: change.NoteType,
+		})
+	case SyncOpDelete:
+		err = s.notes.DeleteNote(ctx, userID, change.ID)
+	}
+
+	if v != nil && !v.Valid() {
+		return invalidResult(v), nil
+	}
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result := &SyncPushResult{Status: SyncStatusApplied}
+	if note != nil {
+		result.ID = note.ID
+	}
+
+	return result, nil
+}
+
+func (s *SyncService) applyLocation(ctx context.Context, userID int64, change SyncPushChange) (*SyncPushResult, error) {
+	if change.Op == SyncOpDelete {
+		v, err := s.notes.DeleteLink(ctx, userID, change.NoteID, change.ID)
+		if v != nil && !v.Valid() {
+			return invalidResult(v), nil
+		}
+		if err != nil {
+			return errorResult(err)
+		}
+		return &SyncPushResult{Status: SyncStatusApplied}, nil
+	}
+
+	note, v, err := s.notes.LinkNote(ctx, &data.NoteInputLocation{
+		NoteID:      change.NoteID,
+		UserID:      userID,
+		Book:        change.Book,
+		Chapter:     change.Chapter,
+		StartVerse:  change.StartVerse,
+		EndVerse:    change.EndVerse,
+		StartOffset: change.StartOffset,
+		EndOffset:   change.EndOffset,
+	})
+	if v != nil && !v.Valid() {
+		return invalidResult(v), nil
+	}
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result := &SyncPushResult{Status: SyncStatusApplied}
+	if note.Location != nil {
+		result.ID = note.Location.ID
+	}
+
+	return result, nil
+}
+
+func (s *SyncService) applyHighlight(ctx context.Context, userID int64, change SyncPushChange) (*SyncPushResult, error) {
+	var (
+		v   *validator.Validator
+		err error
+	)
+
+	result := &SyncPushResult{Status: SyncStatusApplied}
+
+	switch change.Op {
+	case SyncOpCreate:
+		highlight := &data.Highlight{
+			Book:        change.Book,
+			Chapter:     change.Chapter,
+			StartVerse:  change.StartVerse,
+			EndVerse:    change.EndVerse,
+			StartOffset: &change.StartOffset,
+			EndOffset:   &change.EndOffset,
+			Color:       change.Color,
+			PaletteID:   change.PaletteID,
+		}
+		v, err = s.highlights.InsertHighlight(ctx, highlight, userID)
+		result.ID = highlight.ID
+	case SyncOpUpdate:
+		v, err = s.highlights.UpdateHighlight(ctx, change.ID, userID, &HighlightUpdate{Color: change.Color, PaletteID: change.PaletteID})
+	case SyncOpDelete:
+		v, err = s.highlights.DeleteHighlight(ctx, change.ID, userID)
+	}
+
+	if v != nil && !v.Valid() {
+		return invalidResult(v), nil
+	}
+	if err != nil {
+		return errorResult(err)
+	}
+
+	return result, nil
+}
+
+func invalidResult(v *validator.Validator) *SyncPushResult {
+	return &SyncPushResult{Status: SyncStatusInvalid, Errors: v.Errors}
+}
+
+// errorResult maps the errors the regular endpoints report to the client to a result,
+// any other error is returned
+func errorResult(err error) (*SyncPushResult, error) {
+	switch {
+	case errors.Is(err, ErrNoteNotFound),
+		errors.Is(err, ErrLinkNotFound),
+		errors.Is(err, ErrHighlightNotFound),
+		errors.Is(err, ErrTemplateNotFound):
+		return &SyncPushResult{Status: SyncStatusNotFound, Reason: err.Error()}, nil
+	case errors.Is(err, data.ErrDuplicateTitleGeneral),
+		errors.Is(err, data.ErrLocationAlreadyLinked),
+		errors.Is(err, data.ErrDuplicateContent):
+		return &SyncPushResult{Status: SyncStatusConflict, Reason: err.Error()}, nil
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"shuvoedward/Bible_project/internal/data"
+	"testing"
+)
+
+func TestAppendMissing(t *testing.T) {
+	tombstones := []*data.SyncTombstone{{Type: data.SyncEntityHighlight, ID: 7}}
+	found := []*data.SyncLocation{
+		{NoteID: 1, LocationResponse: data.LocationResponse{ID: 10}},
+		{NoteID: 1, LocationResponse: data.LocationResponse{ID: 12}},
+	}
+
+	got := appendMissing(tombstones, data.SyncEntityLocation, []int64{10, 11, 12, 13}, found,
+		func(l *data.SyncLocation) int64 { return l.ID })
+
+	want := []data.SyncTombstone{
+		{Type: data.SyncEntityHighlight, ID: 7},
+		{Type: data.SyncEntityLocation, ID: 11},
+		{Type: data.SyncEntityLocation, ID: 13},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d tombstones, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("tombstone %d: got %+v, want %+v", i, *got[i], want[i])
+		}
+	}
+}
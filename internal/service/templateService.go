@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TemplateService handles note templates business logic
+type TemplateService struct {
+	templateModel data.TemplateModel
+	validator     *NoteValidator
+	extractor     *ReferenceExtractor
+	logger        *slog.Logger
+}
+
+func NewTemplateService(
+	templateModel data.TemplateModel,
+	validator *NoteValidator,
+	extractor *ReferenceExtractor,
+	logger *slog.Logger,
+) *TemplateService {
+	return &TemplateService{
+		templateModel: templateModel,
+		validator:     validator,
+		extractor:     extractor,
+		logger:        logger,
+	}
+}
+
+// TemplateInput represents the input for creating or replacing a template
+type TemplateInput struct {
+	Name        string
+	Description string
+	Sections    []data.TemplateSection
+}
+
+// ListTemplates retrieves the built-in templates and the user's own
+func (s *TemplateService) ListTemplates(ctx context.Context, userID int64) ([]*data.NoteTemplate, error) {
+	return s.templateModel.GetAll(ctx, userID)
+}
+
+// GetTemplate retrieves a built-in template or one of the user's
+// Returns ErrTemplateNotFound if the template doesn't exist or belongs to another user
+func (s *TemplateService) GetTemplate(ctx context.Context, userID, templateID int64) (*data.NoteTemplate, error) {
+	template, err := s.templateModel.Get(ctx, templateID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, fmt.Errorf("get template: %w", err)
+	}
+
+	return template, nil
+}
+
+// CreateTemplate validates and inserts a user template
+// Returns the template, validation errors, or data.ErrDuplicateTemplateName
+func (s *TemplateService) CreateTemplate(ctx context.Context, userID int64, input TemplateInput) (*data.NoteTemplate, *validator.Validator, error) {
+	template := newTemplate(userID, input)
+
+	v := s.validator.ValidateTemplate(template, s.isReference)
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	err := s.templateModel.Insert(ctx, template)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return template, nil, nil
+}
+
+// UpdateTemplate validates and replaces a user template
+// Business Rule: built-in templates are read-only, they are reported as not found
+func (s *TemplateService) UpdateTemplate(ctx context.Context, userID, templateID int64, input TemplateInput) (*data.NoteTemplate, *validator.Validator, error) {
+	template := newTemplate(userID, input)
+	template.ID = templateID
+
+	v := s.validator.ValidateTemplate(template, s.isReference)
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	err := s.templateModel.Update(ctx, template)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil, ErrTemplateNotFound
+		}
+		return nil, nil, err
+	}
+
+	return template, nil, nil
+}
+
+// DeleteTemplate deletes a user template
+// Notes created from it keep their content
+func (s *TemplateService) DeleteTemplate(ctx context.Context, userID, templateID int64) error {
+	err := s.templateModel.Delete(ctx, templateID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return ErrTemplateNotFound
+		}
+		return fmt.Errorf("delete template: %w", err)
+	}
+
+	return nil
+}
+
+func (s *TemplateService) isReference(reference string) bool {
+	_, err := s.extractor.ParseReference(reference)
+	return err == nil
+}
+
+func newTemplate(userID int64, input TemplateInput) *data.NoteTemplate {
+	sections := make([]data.TemplateSection, len(input.Sections))
+	for i, section := range input.Sections {
+		sections[i] = data.TemplateSection{
+			Heading: strings.TrimSpace(section.Heading),
+			Body:    section.Body,
+		}
+	}
+
+	return &data.NoteTemplate{
+		UserID:      userID,
+		Name:        strings.TrimSpace(input.Name),
+		Description: strings.TrimSpace(input.Description),
+		Sections:    sections,
+	}
+}
+
+// renderTemplate builds note content from a template, one "## Heading" per section.
+// {{passage}}, {{date}}, {{book}} and {{chapter}} are filled in from the location;
+// any other {{reference}} is left as a verse embed.
+func renderTemplate(template *data.NoteTemplate, location *data.NoteLocation, now time.Time) string {
+	values := map[string]string{
+		"passage": formatReference(location.Book, location.Chapter, location.StartVerse, location.EndVerse),
+		"date":    now.Format(time.DateOnly),
+		"book":    location.Book,
+		"chapter": strconv.Itoa(location.Chapter),
+	}
+
+	fill := func(text string) string {
+		return verseEmbedRX.ReplaceAllStringFunc(text, func(match string) string {
+			name := verseEmbedRX.FindStringSubmatch(match)[1]
+			if value, ok := values[strings.ToLower(name)]; ok {
+				return value
+			}
+			return match
+		})
+	}
+
+	var b strings.Builder
+	for i, section := range template.Sections {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "## %s\n\n", fill(section.Heading))
+		if body := fill(section.Body); body != "" {
+			b.WriteString(body)
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
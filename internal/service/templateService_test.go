@@ -0,0 +1,28 @@
+package service
+
+import (
+	"shuvoedward/Bible_project/internal/data"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	template := &data.NoteTemplate{
+		Name: "SOAP",
+		Sections: []data.TemplateSection{
+			{Heading: "Scripture", Body: "{{passage}} ({{ Date }})"},
+			{Heading: "Observation", Body: ""},
+			{Heading: "{{book}} {{chapter}}", Body: "compare {{Romans 5:8}}"},
+		},
+	}
+	location := &data.NoteLocation{Book: "John", Chapter: 3, StartVerse: 16, EndVerse: 18}
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	want := "## Scripture\n\nJohn 3:16-18 (2025-03-01)\n" +
+		"\n## Observation\n\n" +
+		"\n## John 3\n\ncompare {{Romans 5:8}}\n"
+
+	if got := renderTemplate(template, location, now); got != want {
+		t.Errorf("renderTemplate() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -2,6 +2,10 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -9,30 +13,79 @@ import (
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/scheduler"
 	"shuvoedward/Bible_project/internal/validator"
-	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	// tokenCacheTTL caps how long the user of a token is cached, never past its expiry
+	tokenCacheTTL = 2 * time.Hour
+
+	// sessionTouchInterval throttles last-used updates of a session to one per interval
+	sessionTouchInterval = 5 * time.Minute
+
+	// A two-factor challenge is answered within its TTL and allows a few wrong codes
+	twoFactorChallengeTTL = 5 * time.Minute
+	maxTwoFactorAttempts  = 5
+)
+
+// cachedUser is what the token cache keeps of a user: enough to authorize requests and
+// apply their preferences without a database round trip
+type cachedUser struct {
+	ID          int64            `json:"id"`
+	Activated   bool             `json:"activated"`
+	Preferences data.Preferences `json:"preferences"`
+}
+
+// TokenPair is issued on login and on every refresh: a short-lived access token for
+// requests and a refresh token that can be exchanged once for the next pair
+type TokenPair struct {
+	Access  *data.Token
+	Refresh *data.Token
+}
+
+// LoginResult is the outcome of a password check: a token pair, or a challenge token
+// to answer with a second factor when the user has two-factor authentication enabled
+type LoginResult struct {
+	*TokenPair
+	Challenge *data.Token
+}
+
+// twoFactorVerifier checks the second factor of users who enabled it
+type twoFactorVerifier interface {
+	Enabled(ctx context.Context, userID int64) (bool, error)
+	VerifyCode(ctx context.Context, userID int64, code string) (bool, error)
+}
+
 type TokenService struct {
-	tokenModel data.TokenModel
-	userModel  data.UserModel
-	redis      *cache.RedisClient
-	scheduler  *scheduler.Scheduler
-	logger     *slog.Logger
+	tokenModel   data.TokenModel
+	userModel    data.UserModel
+	sessionModel data.SessionModel
+	twoFactor    twoFactorVerifier
+	redis        *cache.RedisClient
+	scheduler    *scheduler.Scheduler
+	logger       *slog.Logger
 }
 
 func NewTokenService(
 	tokenModel data.TokenModel,
 	userModel data.UserModel,
+	sessionModel data.SessionModel,
+	twoFactor twoFactorVerifier,
 	redis *cache.RedisClient,
 	scheduler *scheduler.Scheduler,
 	logger *slog.Logger) *TokenService {
 	return &TokenService{
-		tokenModel: tokenModel,
-		userModel:  userModel,
-		redis:      redis,
-		logger:     logger,
+		tokenModel:   tokenModel,
+		userModel:    userModel,
+		sessionModel: sessionModel,
+		twoFactor:    twoFactor,
+		redis:        redis,
+		scheduler:    scheduler,
+		logger:       logger,
 	}
 }
 
@@ -81,49 +134,230 @@ func (s *TokenService) CreatePasswordResetToken(ctx context.Context, email strin
 	return nil, nil
 }
 
-// CreateAuthToken validates user email and password and creates authentication token
-// Returns token plain text and validation and error
-func (s *TokenService) CreateAuthToken(ctx context.Context, email, password string) (string, *validator.Validator, error) {
+// CreateAuthToken validates user email and password and creates an access and refresh
+// token, recording the device they are issued to as a session. Users with two-factor
+// authentication get a challenge token instead, see VerifyTwoFactor.
+// Failed logins delay the next ones to the same email and eventually lock it, see
+// recordLoginFailure.
+// Returns the token pair or challenge and validation and error, a LoginLockedError if
+// the email has to wait
+func (s *TokenService) CreateAuthToken(ctx context.Context, email, password string, info data.SessionInfo) (*LoginResult, *validator.Validator, error) {
 	v := validator.New()
 	validateEmail(v, email)
 	validatePassword(v, password)
+	validateSessionInfo(v, info)
 	if !v.Valid() {
-		return "", v, nil
+		return nil, v, nil
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	err := s.checkLoginLock(ctx, email)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	user, err := s.userModel.GetByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
-			return "", nil, ErrEmailNotFound
+			s.recordLoginFailure(ctx, email, nil, info.IP)
+			return nil, nil, ErrEmailNotFound
 		}
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	match, err := user.Password.Matches(password)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	if !match {
-		return "", nil, ErrPasswordNotMatch
+		s.recordLoginFailure(ctx, email, user, info.IP)
+		return nil, nil, ErrPasswordNotMatch
+	}
+
+	err = s.clearLoginFailures(ctx, email)
+	if err != nil {
+		s.logger.Error(err.Error())
+	}
+
+	result, err := s.LoginUser(ctx, user, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, nil, nil
+}
+
+// LoginUser logs in a user whose identity was already checked, by password or by an
+// identity provider. Users with two-factor authentication get a challenge token.
+func (s *TokenService) LoginUser(ctx context.Context, user *data.User, info data.SessionInfo) (*LoginResult, error) {
+	enabled, err := s.twoFactor.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabled {
+		challenge, err := s.tokenModel.New(ctx, user.ID, twoFactorChallengeTTL, data.ScopeTwoFactor)
+		if err != nil {
+			return nil, err
+		}
+
+		return &LoginResult{Challenge: challenge}, nil
+	}
+
+	pair, err := s.startSession(ctx, user, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{TokenPair: pair}, nil
+}
+
+// VerifyTwoFactor completes the login of a user with two-factor authentication, code is
+// from their authenticator or one of their recovery codes. The challenge is dropped
+// after too many wrong codes.
+// Returns ErrInvalidToken if the challenge is unknown or expired, or ErrInvalidTwoFactorCode
+func (s *TokenService) VerifyTwoFactor(ctx context.Context, challengePlaintext, code string, info data.SessionInfo) (*TokenPair, *validator.Validator, error) {
+	v := validator.New()
+	v.Check(code != "", "code", "must be provided")
+	validateSessionInfo(v, info)
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	if len(challengePlaintext) != 26 {
+		return nil, nil, ErrInvalidToken
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	user, err := s.userModel.GetForToken(ctx, challengePlaintext, data.ScopeTwoFactor)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
 	}
 
-	token, err := s.tokenModel.New(ctx, user.ID, 24*time.Hour, data.ScopeAuthentication)
+	valid, err := s.twoFactor.VerifyCode(ctx, user.ID, code)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	fmt.Println(token.Plaintext)
-	fmt.Println(user.ID)
-	err = s.redis.SetToken(token.Plaintext, user.ID, user.Activated)
+	if !valid {
+		key := fmt.Sprintf("two_factor_attempts:%s", tokenHashHex(challengePlaintext))
+
+		attempts, err := s.redis.Incr(ctx, key, twoFactorChallengeTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if attempts >= maxTwoFactorAttempts {
+			s.logger.Warn("too many two-factor attempts, dropping challenge", "user_id", user.ID)
+			err = s.tokenModel.DeleteAllForUser(ctx, data.ScopeTwoFactor, user.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		return nil, nil, ErrInvalidTwoFactorCode
+	}
+
+	err = s.tokenModel.DeleteAllForUser(ctx, data.ScopeTwoFactor, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pair, err := s.startSession(ctx, user, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pair, nil, nil
+}
+
+// startSession issues the first token pair of a login, starting a new token family
+func (s *TokenService) startSession(ctx context.Context, user *data.User, info data.SessionInfo) (*TokenPair, error) {
+	info.FamilyID = rand.Text()
+
+	return s.issueTokenPair(ctx, user, truncateSessionInfo(info))
+}
+
+// RefreshToken exchanges a refresh token for a new token pair of the same family, the
+// family's previous access token stops working. Reusing an exchanged refresh token
+// means it leaked, the whole family is revoked and the device has to log in again.
+// Returns ErrInvalidToken if the token is unknown, expired or reused
+func (s *TokenService) RefreshToken(ctx context.Context, refreshPlaintext string, info data.SessionInfo) (*TokenPair, error) {
+	if len(refreshPlaintext) != 26 {
+		return nil, ErrInvalidToken
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	token, err := s.tokenModel.UseRefreshToken(ctx, refreshPlaintext)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return nil, ErrInvalidToken
+	case errors.Is(err, data.ErrRefreshTokenReused):
+		s.logger.Warn("refresh token reused, revoking its family", "user_id", token.UserID)
+		err = s.revokeFamily(ctx, token.UserID, token.FamilyID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	case err != nil:
+		return nil, fmt.Errorf("use refresh token: %w", err)
+	}
+
+	user, err := s.userModel.Get(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	hashes, err := s.tokenModel.DeleteFamily(ctx, data.ScopeAuthentication, token.FamilyID)
+	if err != nil {
+		return nil, fmt.Errorf("delete previous access token: %w", err)
+	}
+
+	err = s.uncacheHashes(ctx, user.ID, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	info.FamilyID = token.FamilyID
+	if info.DeviceName == "" {
+		info.DeviceName = token.DeviceName
+	}
+
+	return s.issueTokenPair(ctx, user, truncateSessionInfo(info))
+}
+
+// issueTokenPair creates an access and a refresh token in the family of info and
+// caches the access token
+func (s *TokenService) issueTokenPair(ctx context.Context, user *data.User, info data.SessionInfo) (*TokenPair, error) {
+	access, err := s.tokenModel.NewSession(ctx, user.ID, accessTokenTTL, data.ScopeAuthentication, info)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := s.tokenModel.NewSession(ctx, user.ID, refreshTokenTTL, data.ScopeRefresh, info)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.SetToken(access.Plaintext, user, access.Expiry, ctx)
 	if err != nil {
 		s.logger.Error(err.Error())
 	}
 
-	return token.Plaintext, nil, nil
+	return &TokenPair{Access: access, Refresh: refresh}, nil
 }
 
 // CreateActivationToken validates email and creates activation token. Also validates if user exists
@@ -184,22 +418,23 @@ func (s *TokenService) GetUserForToken(ctx context.Context, tokenPlainText strin
 	userDataStr, err := s.GetForToken(tokenPlainText, ctx)
 	if err == nil {
 		// cache hit
-		// userId, activated
-		// id:userID,activated:t
-		tempUserData := strings.Split(userDataStr, ",")
-		idStr, _ := strings.CutPrefix(tempUserData[0], "id:")
-		activatedStr, _ := strings.CutPrefix(tempUserData[1], "activated:")
-
-		id, _ := strconv.ParseInt(idStr, 10, 64)
-		activated, _ := strconv.ParseBool(activatedStr)
+		var cached cachedUser
+		err = json.Unmarshal([]byte(userDataStr), &cached)
+		if err == nil {
+			s.touchSession(ctx, tokenPlainText)
+
+			return &data.User{
+				ID:          cached.ID,
+				Activated:   cached.Activated,
+				Preferences: cached.Preferences,
+			}, nil
+		}
 
-		return &data.User{
-			ID:        id,
-			Activated: activated,
-		}, nil
+		// cached in an older format, it is replaced below
+		s.logger.Warn("failed to decode cached token", "error", err)
 	}
 
-	user, err := s.userModel.GetForToken(ctx, tokenPlainText, data.ScopeAuthentication)
+	user, expiry, err := s.sessionModel.GetUser(ctx, tokenPlainText)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			return nil, ErrInvalidToken
@@ -209,16 +444,38 @@ func (s *TokenService) GetUserForToken(ctx context.Context, tokenPlainText strin
 
 	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	err = s.SetToken(tokenPlainText, user.ID, user.Activated, ctx)
+	err = s.SetToken(tokenPlainText, user, expiry, ctx)
 	if err != nil {
 		s.logger.Error("failed to cache token", "error", err)
 	}
 
+	s.touchSession(ctx, tokenPlainText)
+
 	return user, nil
 }
 
+// touchSession records the use of an authentication token at most once per
+// sessionTouchInterval, so most requests only cost a Redis round trip
+func (s *TokenService) touchSession(ctx context.Context, tokenPlaintext string) {
+	key := fmt.Sprintf("token_used:%s", tokenHashHex(tokenPlaintext))
+
+	due, err := s.redis.SetNX(ctx, key, "1", sessionTouchInterval)
+	if err != nil {
+		s.logger.Error("failed to throttle session update", "error", err)
+		return
+	}
+	if !due {
+		return
+	}
+
+	err = s.sessionModel.Touch(ctx, tokenPlaintext)
+	if err != nil {
+		s.logger.Error("failed to update session last use", "error", err)
+	}
+}
+
 func (s *TokenService) GetForToken(token string, ctx context.Context) (string, error) {
-	key := fmt.Sprintf("token:%s", token)
+	key := tokenCacheKey(token)
 
 	token, err := s.redis.Get(ctx, key)
 	if err != nil {
@@ -228,15 +485,182 @@ func (s *TokenService) GetForToken(token string, ctx context.Context) (string, e
 	return token, nil
 }
 
-func (s *TokenService) SetToken(token string, userID int64, userActivated bool, ctx context.Context) error {
-	key := fmt.Sprintf("token:%s", token)
+// SetToken caches the user of a token for 2 hours, or until the token expires if sooner.
+// The key is also added to the user's set of cached tokens, so revoking every token or
+// changing the user's preferences can drop them from the cache.
+func (s *TokenService) SetToken(token string, user *data.User, expiry time.Time, ctx context.Context) error {
+	key := tokenCacheKey(token)
+
+	userData, err := json.Marshal(cachedUser{
+		ID:          user.ID,
+		Activated:   user.Activated,
+		Preferences: user.Preferences,
+	})
+	if err != nil {
+		return fmt.Errorf("Error encoding user token: %v", err)
+	}
 
-	userData := fmt.Sprintf(`id:%d,activated:%t`, userID, userActivated)
+	ttl := min(tokenCacheTTL, time.Until(expiry))
+	if ttl <= 0 {
+		return nil
+	}
 
-	err := s.redis.Set(ctx, key, userData, 2*time.Hour)
+	err = s.redis.Set(ctx, key, string(userData), ttl)
 	if err != nil {
 		return fmt.Errorf("Error setting user token: %v", err)
 	}
 
+	// Outlives the cached tokens, the expiry is pushed back by every cached token
+	err = s.redis.SAdd(ctx, userTokensKey(user.ID), tokenCacheTTL, key)
+	if err != nil {
+		return fmt.Errorf("Error indexing user token: %v", err)
+	}
+
 	return nil
 }
+
+// RevokeToken deletes one of the user's authentication tokens along with the refresh
+// tokens of its session and drops it from the cache, so it stops working immediately
+func (s *TokenService) RevokeToken(ctx context.Context, userID int64, tokenPlaintext string) error {
+	hashes, err := s.sessionModel.DeleteForToken(ctx, userID, tokenPlaintext)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return fmt.Errorf("delete token: %w", err)
+	}
+
+	err = s.uncacheHashes(ctx, userID, hashes)
+	if err != nil {
+		return err
+	}
+
+	return s.uncacheToken(ctx, userID, tokenCacheKey(tokenPlaintext))
+}
+
+// ListSessions retrieves the user's signed in devices, marking the one of currentToken
+func (s *TokenService) ListSessions(ctx context.Context, userID int64, currentToken string) ([]*data.Session, error) {
+	sessions, err := s.sessionModel.GetAllForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+
+	current := tokenHashHex(currentToken)
+	for _, session := range sessions {
+		session.Current = hex.EncodeToString(session.Hash) == current
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's devices out, its token stops working immediately
+// Returns ErrSessionNotFound if the session doesn't exist or belongs to another user
+func (s *TokenService) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	hashes, err := s.sessionModel.Delete(ctx, sessionID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("delete session: %w", err)
+	}
+
+	return s.uncacheHashes(ctx, userID, hashes)
+}
+
+// revokeFamily deletes every token of a family and drops them from the cache
+func (s *TokenService) revokeFamily(ctx context.Context, userID int64, familyID string) error {
+	for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+		hashes, err := s.tokenModel.DeleteFamily(ctx, scope, familyID)
+		if err != nil {
+			return fmt.Errorf("delete token family: %w", err)
+		}
+
+		err = s.uncacheHashes(ctx, userID, hashes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TokenService) uncacheHashes(ctx context.Context, userID int64, hashes [][]byte) error {
+	for _, hash := range hashes {
+		err := s.uncacheToken(ctx, userID, "token:"+hex.EncodeToString(hash))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TokenService) uncacheToken(ctx context.Context, userID int64, key string) error {
+	err := s.redis.Del(ctx, key)
+	if err != nil {
+		return fmt.Errorf("uncache token: %w", err)
+	}
+
+	err = s.redis.SRem(ctx, userTokensKey(userID), key)
+	if err != nil {
+		s.logger.Error("failed to unindex token", "user_id", userID, "error", err)
+	}
+
+	return nil
+}
+
+// RevokeAllTokens deletes every authentication and refresh token of the user and drops
+// them from the cache, signing the user out everywhere
+func (s *TokenService) RevokeAllTokens(ctx context.Context, userID int64) error {
+	for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+		err := s.tokenModel.DeleteAllForUser(ctx, scope, userID)
+		if err != nil {
+			return fmt.Errorf("delete tokens: %w", err)
+		}
+	}
+
+	return s.UncacheUser(ctx, userID)
+}
+
+// UncacheUser drops every cached token of the user, their next requests load the user
+// from the database again
+func (s *TokenService) UncacheUser(ctx context.Context, userID int64) error {
+	indexKey := userTokensKey(userID)
+
+	keys, err := s.redis.SMembers(ctx, indexKey)
+	if err != nil {
+		return fmt.Errorf("get cached tokens: %w", err)
+	}
+
+	err = s.redis.Del(ctx, append(keys, indexKey)...)
+	if err != nil {
+		return fmt.Errorf("uncache tokens: %w", err)
+	}
+
+	return nil
+}
+
+func userTokensKey(userID int64) string {
+	return fmt.Sprintf("user_tokens:%d", userID)
+}
+
+// tokenCacheKey keys the cache by the token's hash, like the tokens table, so a
+// session can be dropped from the cache without knowing its plaintext
+func tokenCacheKey(tokenPlaintext string) string {
+	return "token:" + tokenHashHex(tokenPlaintext)
+}
+
+func tokenHashHex(tokenPlaintext string) string {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	return hex.EncodeToString(hash[:])
+}
+
+func validateSessionInfo(v *validator.Validator, info data.SessionInfo) {
+	v.Check(len(info.DeviceName) <= 100, "device_name", "must not be more than 100 bytes long")
+}
+
+// truncateSessionInfo caps the client-supplied user agent, it is informational only
+func truncateSessionInfo(info data.SessionInfo) data.SessionInfo {
+	if len(info.UserAgent) > 512 {
+		info.UserAgent = info.UserAgent[:512]
+	}
+	info.DeviceName = strings.TrimSpace(info.DeviceName)
+	return info
+}
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/cache"
+	"shuvoedward/Bible_project/internal/data"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// fakeTokenStore keeps tokens in memory for the token and session models
+type fakeTokenStore struct {
+	tokens  []*data.Token
+	used    map[string]bool
+	touched int
+}
+
+func (s *fakeTokenStore) add(plaintext string, userID int64, scope, familyID string, ttl time.Duration) *data.Token {
+	hash := sha256.Sum256([]byte(plaintext))
+	token := &data.Token{
+		ID:        int64(len(s.tokens) + 1),
+		Plaintext: plaintext,
+		Hash:      hash[:],
+		UserID:    userID,
+		Scope:     scope,
+		Expiry:    time.Now().Add(ttl),
+	}
+	token.FamilyID = familyID
+	s.tokens = append(s.tokens, token)
+	return token
+}
+
+// remove deletes the tokens matching match and returns their hashes
+func (s *fakeTokenStore) remove(match func(t *data.Token) bool) [][]byte {
+	hashes := [][]byte{}
+	kept := s.tokens[:0]
+	for _, token := range s.tokens {
+		if match(token) {
+			hashes = append(hashes, token.Hash)
+		} else {
+			kept = append(kept, token)
+		}
+	}
+	s.tokens = kept
+	return hashes
+}
+
+func (s *fakeTokenStore) find(plaintext string) *data.Token {
+	for _, token := range s.tokens {
+		if token.Plaintext == plaintext {
+			return token
+		}
+	}
+	return nil
+}
+
+type fakeTokenModel struct {
+	data.TokenModel
+	store *fakeTokenStore
+}
+
+func (m *fakeTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*data.Token, error) {
+	return m.store.add(rand.Text(), userID, scope, "", ttl), nil
+}
+
+func (m *fakeTokenModel) NewSession(ctx context.Context, userID int64, ttl time.Duration, scope string, info data.SessionInfo) (*data.Token, error) {
+	return m.store.add(rand.Text(), userID, scope, info.FamilyID, ttl), nil
+}
+
+func (m *fakeTokenModel) UseRefreshToken(ctx context.Context, tokenPlaintext string) (*data.Token, error) {
+	token := m.store.find(tokenPlaintext)
+	if token == nil || token.Scope != data.ScopeRefresh {
+		return nil, data.ErrRecordNotFound
+	}
+	if m.store.used[tokenPlaintext] {
+		return token, data.ErrRefreshTokenReused
+	}
+	m.store.used[tokenPlaintext] = true
+	return token, nil
+}
+
+func (m *fakeTokenModel) Consume(ctx context.Context, scope, tokenPlaintext string) (int64, error) {
+	token := m.store.find(tokenPlaintext)
+	if token == nil || token.Scope != scope || token.Expiry.Before(time.Now()) {
+		return 0, data.ErrRecordNotFound
+	}
+	m.store.remove(func(t *data.Token) bool { return t == token })
+	return token.UserID, nil
+}
+
+func (m *fakeTokenModel) DeleteFamily(ctx context.Context, scope, familyID string) ([][]byte, error) {
+	return m.store.remove(func(t *data.Token) bool {
+		return t.Scope == scope && t.FamilyID == familyID
+	}), nil
+}
+
+func (m *fakeTokenModel) DeleteAllForUser(ctx context.Context, scope string, id int64) error {
+	m.store.remove(func(t *data.Token) bool {
+		return t.Scope == scope && t.UserID == id
+	})
+	return nil
+}
+
+type fakeSessionModel struct {
+	data.SessionModel
+	store *fakeTokenStore
+}
+
+func (m *fakeSessionModel) GetAllForUser(ctx context.Context, userID int64) ([]*data.Session, error) {
+	sessions := []*data.Session{}
+	for _, token := range m.store.tokens {
+		if token.UserID == userID && token.Scope == data.ScopeAuthentication {
+			sessions = append(sessions, &data.Session{ID: token.ID, Hash: token.Hash})
+		}
+	}
+	return sessions, nil
+}
+
+func (m *fakeSessionModel) Touch(ctx context.Context, tokenPlaintext string) error {
+	m.store.touched++
+	return nil
+}
+
+func (m *fakeSessionModel) Delete(ctx context.Context, id, userID int64) ([][]byte, error) {
+	for _, token := range m.store.tokens {
+		if token.ID == id && token.UserID == userID && token.Scope == data.ScopeAuthentication {
+			return m.deleteSession(token), nil
+		}
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *fakeSessionModel) DeleteForToken(ctx context.Context, userID int64, tokenPlaintext string) ([][]byte, error) {
+	token := m.store.find(tokenPlaintext)
+	if token == nil || token.UserID != userID || token.Scope != data.ScopeAuthentication {
+		return nil, data.ErrRecordNotFound
+	}
+	return m.deleteSession(token), nil
+}
+
+func (m *fakeSessionModel) deleteSession(session *data.Token) [][]byte {
+	return m.store.remove(func(t *data.Token) bool {
+		return t == session || (session.FamilyID != "" && t.FamilyID == session.FamilyID)
+	})
+}
+
+// fakeUserModel finds user by ID or email, other IDs are activated users without details
+type fakeUserModel struct {
+	data.UserModel
+	store *fakeTokenStore
+	user  *data.User
+}
+
+func (m *fakeUserModel) Get(ctx context.Context, id int64) (*data.User, error) {
+	if m.user != nil && m.user.ID == id {
+		return m.user, nil
+	}
+	return &data.User{ID: id, Activated: true}, nil
+}
+
+func (m *fakeUserModel) GetByEmail(ctx context.Context, email string) (*data.User, error) {
+	if m.user == nil || m.user.Email != email {
+		return nil, data.ErrRecordNotFound
+	}
+	return m.user, nil
+}
+
+func (m *fakeUserModel) GetForToken(ctx context.Context, tokenPlaintext, tokenScope string) (*data.User, error) {
+	token := m.store.find(tokenPlaintext)
+	if token == nil || token.Scope != tokenScope || token.Expiry.Before(time.Now()) {
+		return nil, data.ErrRecordNotFound
+	}
+	return m.Get(ctx, token.UserID)
+}
+
+// fakeTwoFactor accepts the code 123456 of users who enabled two-factor authentication
+type fakeTwoFactor struct {
+	enabled map[int64]bool
+}
+
+func (f *fakeTwoFactor) Enabled(ctx context.Context, userID int64) (bool, error) {
+	return f.enabled[userID], nil
+}
+
+func (f *fakeTwoFactor) VerifyCode(ctx context.Context, userID int64, code string) (bool, error) {
+	return f.enabled[userID] && code == "123456", nil
+}
+
+func newTestUser(t *testing.T) *data.User {
+	t.Helper()
+
+	user := &data.User{ID: 1, Email: "alice@example.com", Activated: true}
+	if err := user.Password.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func newTestTokenService(t *testing.T) (*TokenService, *fakeTokenStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+
+	redisClient, err := cache.NewRedisClient(cache.RedisConfig{Host: mr.Host(), Port: mr.Port()}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { redisClient.Close() })
+
+	store := &fakeTokenStore{used: make(map[string]bool)}
+
+	s := NewTokenService(
+		&fakeTokenModel{store: store},
+		&fakeUserModel{store: store},
+		&fakeSessionModel{store: store},
+		&fakeTwoFactor{},
+		redisClient,
+		nil,
+		slog.New(slog.DiscardHandler),
+	)
+
+	return s, store, mr
+}
+
+// cacheTokens adds authentication tokens to the store and the cache
+func cacheTokens(t *testing.T, s *TokenService, store *fakeTokenStore, userID int64, familyID string, plaintexts ...string) {
+	t.Helper()
+
+	for _, plaintext := range plaintexts {
+		token := store.add(plaintext, userID, data.ScopeAuthentication, familyID, time.Hour)
+		if err := s.SetToken(plaintext, &data.User{ID: userID, Activated: true}, token.Expiry, context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTokenService_RevokeToken(t *testing.T) {
+	s, store, mr := newTestTokenService(t)
+	ctx := context.Background()
+
+	cacheTokens(t, s, store, 1, "family-a", "token-a")
+	cacheTokens(t, s, store, 1, "family-b", "token-b")
+	store.add("refresh-a", 1, data.ScopeRefresh, "family-a", time.Hour)
+
+	if err := s.RevokeToken(ctx, 1, "token-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.find("token-a") != nil || store.find("refresh-a") != nil {
+		t.Error("revoked session still has tokens")
+	}
+	if mr.Exists(tokenCacheKey("token-a")) {
+		t.Error("revoked token is still cached")
+	}
+	if !mr.Exists(tokenCacheKey("token-b")) {
+		t.Error("other token was dropped from the cache")
+	}
+}
+
+func TestTokenService_RevokeAllTokens(t *testing.T) {
+	s, store, mr := newTestTokenService(t)
+	ctx := context.Background()
+
+	cacheTokens(t, s, store, 1, "", "token-a", "token-b")
+	cacheTokens(t, s, store, 2, "", "token-c")
+	store.add("refresh-a", 1, data.ScopeRefresh, "family-a", time.Hour)
+
+	if err := s.RevokeAllTokens(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range store.tokens {
+		if token.UserID == 1 {
+			t.Errorf("%s token %s was not deleted", token.Scope, token.Plaintext)
+		}
+	}
+	for _, key := range []string{tokenCacheKey("token-a"), tokenCacheKey("token-b"), "user_tokens:1"} {
+		if mr.Exists(key) {
+			t.Errorf("%s is still cached", key)
+		}
+	}
+	if !mr.Exists(tokenCacheKey("token-c")) {
+		t.Error("another user's token was dropped from the cache")
+	}
+}
+
+func TestTokenService_CachedPreferences(t *testing.T) {
+	s, _, mr := newTestTokenService(t)
+	ctx := context.Background()
+
+	plaintext := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	user := &data.User{ID: 1, Activated: true, Preferences: data.DefaultPreferences()}
+	user.Preferences.Timezone = "Asia/Dhaka"
+
+	if err := s.SetToken(plaintext, user, time.Now().Add(time.Hour), ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := s.GetUserForToken(ctx, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.ID != user.ID || !cached.Activated || cached.Preferences != user.Preferences {
+		t.Errorf("got %+v, want %+v", cached, user)
+	}
+
+	if err := s.UncacheUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(tokenCacheKey(plaintext)) {
+		t.Error("token is still cached")
+	}
+}
+
+func TestTokenService_Sessions(t *testing.T) {
+	s, store, mr := newTestTokenService(t)
+	ctx := context.Background()
+
+	cacheTokens(t, s, store, 1, "", "token-a", "token-b")
+
+	sessions, err := s.ListSessions(ctx, 1, "token-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions[0].Current || !sessions[1].Current {
+		t.Errorf("got current %t, %t, want false, true", sessions[0].Current, sessions[1].Current)
+	}
+
+	if err := s.RevokeSession(ctx, 1, sessions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(tokenCacheKey("token-a")) {
+		t.Error("revoked session is still cached")
+	}
+
+	if err := s.RevokeSession(ctx, 1, 99); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestTokenService_TouchSessionThrottled(t *testing.T) {
+	s, store, mr := newTestTokenService(t)
+	ctx := context.Background()
+
+	s.touchSession(ctx, "token-a")
+	s.touchSession(ctx, "token-a")
+	if store.touched != 1 {
+		t.Fatalf("touched %d times, want 1", store.touched)
+	}
+
+	mr.FastForward(sessionTouchInterval)
+
+	s.touchSession(ctx, "token-a")
+	if store.touched != 2 {
+		t.Errorf("touched %d times after the interval, want 2", store.touched)
+	}
+}
+
+func TestTokenService_RefreshToken(t *testing.T) {
+	s, store, mr := newTestTokenService(t)
+	ctx := context.Background()
+
+	first, err := s.issueTokenPair(ctx, &data.User{ID: 1, Activated: true}, data.SessionInfo{FamilyID: "family-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := s.RefreshToken(ctx, first.Refresh.Plaintext, data.SessionInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Access.FamilyID != "family-a" || second.Refresh.FamilyID != "family-a" {
+		t.Errorf("rotated tokens left the family")
+	}
+	if store.find(first.Access.Plaintext) != nil || mr.Exists(tokenCacheKey(first.Access.Plaintext)) {
+		t.Error("previous access token still works after rotation")
+	}
+	if !mr.Exists(tokenCacheKey(second.Access.Plaintext)) {
+		t.Error("new access token was not cached")
+	}
+
+	// The first refresh token leaked and is replayed
+	_, err = s.RefreshToken(ctx, first.Refresh.Plaintext, data.SessionInfo{})
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got %v, want ErrInvalidToken", err)
+	}
+
+	if len(store.tokens) != 0 {
+		t.Errorf("%d tokens of the family survived the reuse", len(store.tokens))
+	}
+	if mr.Exists(tokenCacheKey(second.Access.Plaintext)) {
+		t.Error("access token of the revoked family is still cached")
+	}
+
+	if _, err = s.RefreshToken(ctx, "too-short", data.SessionInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestTokenService_TwoFactorLogin(t *testing.T) {
+	s, _, _ := newTestTokenService(t)
+	ctx := context.Background()
+
+	s.userModel.(*fakeUserModel).user = newTestUser(t)
+	s.twoFactor = &fakeTwoFactor{enabled: map[int64]bool{1: true}}
+
+	login := func() string {
+		t.Helper()
+
+		result, v, err := s.CreateAuthToken(ctx, "alice@example.com", "pa55word", data.SessionInfo{})
+		if err != nil || v != nil {
+			t.Fatalf("login failed: %v %v", v, err)
+		}
+		if result.TokenPair != nil || result.Challenge == nil {
+			t.Fatal("got tokens before the second factor")
+		}
+
+		return result.Challenge.Plaintext
+	}
+
+	challenge := login()
+
+	for range maxTwoFactorAttempts - 1 {
+		_, _, err := s.VerifyTwoFactor(ctx, challenge, "000000", data.SessionInfo{})
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("got %v, want ErrInvalidTwoFactorCode", err)
+		}
+	}
+
+	pair, _, err := s.VerifyTwoFactor(ctx, challenge, "123456", data.SessionInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Access == nil || pair.Refresh == nil {
+		t.Fatal("no tokens issued for a valid code")
+	}
+
+	if _, _, err = s.VerifyTwoFactor(ctx, challenge, "123456", data.SessionInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("answered challenge: got %v, want ErrInvalidToken", err)
+	}
+
+	challenge = login()
+
+	for range maxTwoFactorAttempts {
+		s.VerifyTwoFactor(ctx, challenge, "000000", data.SessionInfo{})
+	}
+
+	if _, _, err = s.VerifyTwoFactor(ctx, challenge, "123456", data.SessionInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("after too many attempts: got %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"regexp"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	totpIssuer = "Bible Notes"
+
+	// totpPeriod is how long a code is valid, the previous and next codes are accepted
+	// too so a slightly wrong clock doesn't lock the user out
+	totpPeriod = 30
+
+	recoveryCodeCount = 10
+)
+
+var totpCodeRX = regexp.MustCompile(`^[0-9]{6}$`)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// TOTPEnrollment is what an authenticator app needs to generate codes, the QR code
+// encodes the otpauth URI
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	QRCode []byte `json:"qr_code_png"`
+}
+
+type TwoFactorService struct {
+	twoFactorModel data.TwoFactorModel
+	userModel      data.UserModel
+	logger         *slog.Logger
+}
+
+func NewTwoFactorService(twoFactorModel data.TwoFactorModel, userModel data.UserModel, logger *slog.Logger) *TwoFactorService {
+	return &TwoFactorService{
+		twoFactorModel: twoFactorModel,
+		userModel:      userModel,
+		logger:         logger,
+	}
+}
+
+// Enroll generates a TOTP secret for the user, it takes effect once confirmed with a code.
+// Enrolling again before confirming replaces the secret.
+// Returns ErrTwoFactorEnabled if two-factor authentication is already on
+func (s *TwoFactorService) Enroll(ctx context.Context, userID int64) (*TOTPEnrollment, error) {
+	user, err := s.userModel.Get(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generate totp secret: %w", err)
+	}
+
+	err = s.twoFactorModel.Enroll(ctx, userID, key.Secret())
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			return nil, ErrTwoFactorEnabled
+		}
+		return nil, fmt.Errorf("enroll two-factor: %w", err)
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, fmt.Errorf("render qr code: %w", err)
+	}
+
+	var qrCode bytes.Buffer
+	err = png.Encode(&qrCode, img)
+	if err != nil {
+		return nil, fmt.Errorf("encode qr code: %w", err)
+	}
+
+	return &TOTPEnrollment{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+		QRCode: qrCode.Bytes(),
+	}, nil
+}
+
+// Confirm turns two-factor authentication on with a first code from the authenticator
+// Returns the recovery codes, shown to the user this once, and validation and error
+// Returns ErrTwoFactorNotEnabled if the user didn't enroll, or ErrTwoFactorEnabled if it's already on
+func (s *TwoFactorService) Confirm(ctx context.Context, userID int64, code string) ([]string, *validator.Validator, error) {
+	code = strings.TrimSpace(code)
+
+	v := validator.New()
+	v.Check(validator.Matches(code, totpCodeRX), "code", "must be a 6 digit code")
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	twoFactor, err := s.twoFactorModel.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil, ErrTwoFactorNotEnabled
+		}
+		return nil, nil, fmt.Errorf("get two-factor: %w", err)
+	}
+
+	if twoFactor.Enabled() {
+		return nil, nil, ErrTwoFactorEnabled
+	}
+
+	valid, err := s.verifyTOTP(ctx, twoFactor, code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v.Check(valid, "code", "is invalid or expired")
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	codes, hashes := generateRecoveryCodes()
+
+	err = s.twoFactorModel.Confirm(ctx, userID, hashes)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil, ErrTwoFactorEnabled
+		}
+		return nil, nil, fmt.Errorf("confirm two-factor: %w", err)
+	}
+
+	return codes, nil, nil
+}
+
+// Disable turns two-factor authentication off after checking the user's password
+// Returns ErrPasswordNotMatch if the password is wrong, or ErrTwoFactorNotEnabled if it's off
+func (s *TwoFactorService) Disable(ctx context.Context, userID int64, password string) (*validator.Validator, error) {
+	v := validator.New()
+	v.Check(password != "", "password", "must be provided")
+	if !v.Valid() {
+		return v, nil
+	}
+
+	user, err := s.userModel.Get(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !match {
+		return nil, ErrPasswordNotMatch
+	}
+
+	err = s.twoFactorModel.Delete(ctx, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, ErrTwoFactorNotEnabled
+		}
+		return nil, fmt.Errorf("disable two-factor: %w", err)
+	}
+
+	return nil, nil
+}
+
+// Enabled reports whether the user has to sign in with a second factor
+func (s *TwoFactorService) Enabled(ctx context.Context, userID int64) (bool, error) {
+	twoFactor, err := s.twoFactorModel.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("get two-factor: %w", err)
+	}
+
+	return twoFactor.Enabled(), nil
+}
+
+// VerifyCode checks a code from the authenticator or one of the user's recovery codes,
+// each code is accepted once
+func (s *TwoFactorService) VerifyCode(ctx context.Context, userID int64, code string) (bool, error) {
+	twoFactor, err := s.twoFactorModel.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("get two-factor: %w", err)
+	}
+
+	if !twoFactor.Enabled() {
+		return false, nil
+	}
+
+	code = strings.TrimSpace(code)
+	if validator.Matches(code, totpCodeRX) {
+		return s.verifyTOTP(ctx, twoFactor, code)
+	}
+
+	err = s.twoFactorModel.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("use recovery code: %w", err)
+	}
+
+	s.logger.Info("recovery code used", "user_id", userID)
+
+	return true, nil
+}
+
+// verifyTOTP checks code against the codes of the current, previous and next time step
+// and records the matching step, so the same code can't be replayed
+func (s *TwoFactorService) verifyTOTP(ctx context.Context, twoFactor *data.TwoFactor, code string) (bool, error) {
+	now := time.Now()
+
+	for _, skew := range []int64{0, -1, 1} {
+		t := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+
+		expected, err := totp.GenerateCodeCustom(twoFactor.Secret, t, totpOpts)
+		if err != nil {
+			return false, fmt.Errorf("generate totp code: %w", err)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+
+		err = s.twoFactorModel.UseStep(ctx, twoFactor.UserID, t.Unix()/totpPeriod)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, fmt.Errorf("use totp step: %w", err)
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// generateRecoveryCodes returns recovery codes formatted like XXXXX-XXXXX and their hashes
+func generateRecoveryCodes() ([]string, [][]byte) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		text := rand.Text()
+		codes[i] = text[:5] + "-" + text[5:10]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes
+}
+
+// hashRecoveryCode hashes a recovery code ignoring case, dashes and spaces
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/data"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+type fakeTwoFactorModel struct {
+	data.TwoFactorModel
+	twoFactor     *data.TwoFactor
+	recoveryCodes map[string]bool
+}
+
+func (m *fakeTwoFactorModel) Get(ctx context.Context, userID int64) (*data.TwoFactor, error) {
+	if m.twoFactor == nil || m.twoFactor.UserID != userID {
+		return nil, data.ErrRecordNotFound
+	}
+	twoFactor := *m.twoFactor
+	return &twoFactor, nil
+}
+
+func (m *fakeTwoFactorModel) Enroll(ctx context.Context, userID int64, secret string) error {
+	if m.twoFactor != nil && m.twoFactor.Enabled() {
+		return data.ErrEditConflict
+	}
+	m.twoFactor = &data.TwoFactor{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (m *fakeTwoFactorModel) Confirm(ctx context.Context, userID int64, recoveryHashes [][]byte) error {
+	now := time.Now()
+	m.twoFactor.ConfirmedAt = &now
+
+	m.recoveryCodes = make(map[string]bool)
+	for _, hash := range recoveryHashes {
+		m.recoveryCodes[string(hash)] = false
+	}
+	return nil
+}
+
+func (m *fakeTwoFactorModel) UseStep(ctx context.Context, userID, step int64) error {
+	if m.twoFactor.LastUsedStep >= step {
+		return data.ErrRecordNotFound
+	}
+	m.twoFactor.LastUsedStep = step
+	return nil
+}
+
+func (m *fakeTwoFactorModel) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) error {
+	used, exists := m.recoveryCodes[string(hash)]
+	if !exists || used {
+		return data.ErrRecordNotFound
+	}
+	m.recoveryCodes[string(hash)] = true
+	return nil
+}
+
+func (m *fakeTwoFactorModel) Delete(ctx context.Context, userID int64) error {
+	if m.twoFactor == nil {
+		return data.ErrRecordNotFound
+	}
+	m.twoFactor = nil
+	m.recoveryCodes = nil
+	return nil
+}
+
+func TestTwoFactorService(t *testing.T) {
+	ctx := context.Background()
+	model := &fakeTwoFactorModel{}
+	s := NewTwoFactorService(model, &fakeUserModel{user: newTestUser(t)}, slog.New(slog.DiscardHandler))
+
+	enrollment, err := s.Enroll(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/Bible%20Notes:alice@example.com?") {
+		t.Errorf("unexpected otpauth URI %q", enrollment.URI)
+	}
+	if !bytes.HasPrefix(enrollment.QRCode, []byte("\x89PNG")) {
+		t.Error("QR code is not a PNG")
+	}
+
+	enabled, _ := s.Enabled(ctx, 1)
+	if enabled {
+		t.Fatal("enabled before confirmation")
+	}
+
+	code, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, v, _ := s.Confirm(ctx, 1, "000000")
+	if v == nil || v.Errors["code"] == "" {
+		t.Fatal("confirmed with a wrong code")
+	}
+
+	recoveryCodes, v, err := s.Confirm(ctx, 1, code)
+	if err != nil || v != nil {
+		t.Fatalf("confirm failed: %v %v", v, err)
+	}
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Errorf("got %d recovery codes, want %d", len(recoveryCodes), recoveryCodeCount)
+	}
+
+	if _, err = s.Enroll(ctx, 1); !errors.Is(err, ErrTwoFactorEnabled) {
+		t.Errorf("enroll when enabled: got %v, want ErrTwoFactorEnabled", err)
+	}
+
+	if valid, _ := s.VerifyCode(ctx, 1, code); valid {
+		t.Error("the confirmation code was accepted again")
+	}
+
+	// Recovery codes ignore case and dashes, and work once
+	recoveryCode := strings.ToLower(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+	if valid, _ := s.VerifyCode(ctx, 1, recoveryCode); !valid {
+		t.Error("recovery code was rejected")
+	}
+	if valid, _ := s.VerifyCode(ctx, 1, recoveryCodes[0]); valid {
+		t.Error("recovery code was accepted twice")
+	}
+
+	if _, err = s.Disable(ctx, 1, "wrong password"); !errors.Is(err, ErrPasswordNotMatch) {
+		t.Errorf("disable with wrong password: got %v, want ErrPasswordNotMatch", err)
+	}
+	if _, err = s.Disable(ctx, 1, "pa55word"); err != nil {
+		t.Fatal(err)
+	}
+
+	enabled, _ = s.Enabled(ctx, 1)
+	if enabled {
+		t.Error("still enabled after disabling")
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shuvoedward/Bible_project/internal/data"
+	"shuvoedward/Bible_project/internal/validator"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// PreferencesUpdate holds the preferences to change, nil fields are left as they are
+type PreferencesUpdate struct {
+	Translation    *string
+	Timezone       *string
+	Locale         *string
+	HighlightColor *string
+	VerseNumbers   *string
+	NotesSort      *string
+	NotesPageSize  *int
+}
+
+// GetPreferences retrieves the user's preferences, defaults filled in
+// Returns ErrUserNotFound if the user doesn't exist
+func (s *UserService) GetPreferences(ctx context.Context, userID int64) (data.Preferences, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return data.Preferences{}, err
+	}
+
+	return user.Preferences, nil
+}
+
+// UpdatePreferences validates and applies a partial update of the user's preferences.
+// The user's cached tokens are dropped, so the next requests apply the new preferences.
+// Returns the updated preferences, validation and error, ErrUserNotFound if the user
+// doesn't exist
+func (s *UserService) UpdatePreferences(ctx context.Context, userID int64, input PreferencesUpdate) (data.Preferences, *validator.Validator, error) {
+	changes, v := validatePreferencesUpdate(input)
+	if !v.Valid() {
+		return data.Preferences{}, v, nil
+	}
+
+	if changes == (data.Preferences{}) {
+		preferences, err := s.GetPreferences(ctx, userID)
+		return preferences, nil, err
+	}
+
+	preferences, err := s.userModel.UpdatePreferences(ctx, userID, changes)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return data.Preferences{}, nil, ErrUserNotFound
+		}
+		return data.Preferences{}, nil, fmt.Errorf("update preferences: %w", err)
+	}
+
+	err = s.tokens.UncacheUser(ctx, userID)
+	if err != nil {
+		// The cache expires within tokenCacheTTL, until then requests use the old preferences
+		s.logger.Error("failed to uncache tokens", "user_id", userID, "error", err)
+	}
+
+	return preferences, nil, nil
+}
+
+// validatePreferencesUpdate checks the preferences set in input and returns them
+// normalized, the others are left empty
+func validatePreferencesUpdate(input PreferencesUpdate) (data.Preferences, *validator.Validator) {
+	v := validator.New()
+	var changes data.Preferences
+
+	if input.Translation != nil {
+		changes.Translation = strings.ToUpper(strings.TrimSpace(*input.Translation))
+		validateTranslation(v, changes.Translation)
+	}
+
+	if input.Timezone != nil {
+		changes.Timezone = strings.TrimSpace(*input.Timezone)
+		v.Check(changes.Timezone != "", "timezone", "must be provided")
+		if changes.Timezone != "" {
+			_, err := time.LoadLocation(changes.Timezone)
+			v.Check(err == nil && changes.Timezone != "Local", "timezone", "must be an IANA time zone like Europe/London")
+		}
+	}
+
+	if input.Locale != nil {
+		locale := strings.TrimSpace(*input.Locale)
+		tag, err := language.Parse(locale)
+		if locale == "" || err != nil {
+			v.AddError("locale", "must be a language tag like en-US")
+		} else {
+			changes.Locale = tag.String()
+		}
+	}
+
+	if input.HighlightColor != nil {
+		changes.HighlightColor = strings.TrimSpace(*input.HighlightColor)
+		v.Check(validator.Matches(changes.HighlightColor, hexColorRX), "highlight_color", "must be a hex color like #FFD700")
+	}
+
+	if input.VerseNumbers != nil {
+		changes.VerseNumbers = strings.TrimSpace(*input.VerseNumbers)
+		validateVerseNumbers(v, changes.VerseNumbers)
+	}
+
+	if input.NotesSort != nil {
+		changes.NotesSort = strings.TrimSpace(*input.NotesSort)
+		v.Check(slices.Contains(noteSortFields, changes.NotesSort), "notes_sort", "invalid sort field")
+	}
+
+	if input.NotesPageSize != nil {
+		changes.NotesPageSize = *input.NotesPageSize
+		v.Check(changes.NotesPageSize > 0, "notes_page_size", "must be at least 1")
+		v.Check(changes.NotesPageSize <= 100, "notes_page_size", "must be at most 100")
+	}
+
+	return changes, v
+}
+
+func validateTranslation(v *validator.Validator, translation string) {
+	v.Check(slices.Contains(data.Translations, translation), "translation", "must be one of "+strings.Join(data.Translations, ", "))
+}
+
+func validateVerseNumbers(v *validator.Validator, verseNumbers string) {
+	v.Check(slices.Contains(data.VerseNumberDisplays, verseNumbers), "verse_numbers", "must be one of "+strings.Join(data.VerseNumberDisplays, ", "))
+}
@@ -8,32 +8,66 @@ import (
 	"shuvoedward/Bible_project/internal/data"
 	"shuvoedward/Bible_project/internal/scheduler"
 	"shuvoedward/Bible_project/internal/validator"
+	"strings"
 	"time"
 )
 
+// emailChangeTTL is how long the link confirming a new email address works
+const emailChangeTTL = 24 * time.Hour
+
+// tokenRevoker signs a user out everywhere, or drops their cached tokens so the next
+// requests see their changes
+type tokenRevoker interface {
+	RevokeAllTokens(ctx context.Context, userID int64) error
+	UncacheUser(ctx context.Context, userID int64) error
+}
+
+// userFiles lists the S3 objects a user owns, of one kind
+type userFiles interface {
+	GetKeysForUser(ctx context.Context, userID int64) ([]string, error)
+}
+
 type UserService struct {
-	models     data.Models
-	userModel  data.UserModel
-	tokenModel data.TokenModel
-	scheduler  *scheduler.Scheduler
-	logger     *slog.Logger
+	models      data.Models
+	userModel   data.UserModel
+	tokenModel  data.TokenModel
+	imageModel  userFiles
+	exportModel userFiles
+	storage     ImageDeleter
+	tokens      tokenRevoker
+	scheduler   *scheduler.Scheduler
+	logger      *slog.Logger
 }
 
 func NewUserService(
 	models data.Models,
 	userModel data.UserModel,
 	tokenModel data.TokenModel,
+	imageModel userFiles,
+	exportModel userFiles,
+	storage ImageDeleter,
+	tokens tokenRevoker,
 	scheduler *scheduler.Scheduler,
 	logger *slog.Logger,
 ) *UserService {
 	return &UserService{
-		models:     models,
-		userModel:  userModel,
-		tokenModel: tokenModel,
-		logger:     logger,
+		models:      models,
+		userModel:   userModel,
+		tokenModel:  tokenModel,
+		imageModel:  imageModel,
+		exportModel: exportModel,
+		storage:     storage,
+		tokens:      tokens,
+		scheduler:   scheduler,
+		logger:      logger,
 	}
 }
 
+// UserUpdate holds the profile fields to change, nil fields are left as they are
+type UserUpdate struct {
+	Name *string
+}
+
 // RegisterUser creates a new user account and token
 // Returns inserted user, plaintext token, validation and error
 func (s *UserService) RegisterUser(ctx context.Context, name, email, password string) (*data.User, *validator.Validator, error) {
@@ -125,6 +159,7 @@ func (s *UserService) ActivateUser(ctx context.Context, token string) (*data.Use
 }
 
 // UpdatePassword validates and updates user password only. Deletes the password reset token for the user
+// and revokes all of their authentication tokens, signing them out everywhere
 // Returns validation error and error
 func (s *UserService) UpdatePassword(ctx context.Context, tokenPlaintext, password string) (*validator.Validator, error) {
 	v := validator.New()
@@ -157,14 +192,231 @@ func (s *UserService) UpdatePassword(ctx context.Context, tokenPlaintext, passwo
 		return nil, err
 	}
 
+	err = s.tokens.RevokeAllTokens(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// GetUser retrieves the user's profile
+// Returns ErrUserNotFound if the user doesn't exist
+func (s *UserService) GetUser(ctx context.Context, userID int64) (*data.User, error) {
+	user, err := s.userModel.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateUser validates and applies a partial update of the user's profile
+// Returns the updated user, validation and error, data.ErrEditConflict if the user
+// changed meanwhile
+func (s *UserService) UpdateUser(ctx context.Context, userID int64, input UserUpdate) (*data.User, *validator.Validator, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if input.Name != nil {
+		user.Name = strings.TrimSpace(*input.Name)
+	}
+
+	v := validator.New()
+	validateName(v, user.Name)
+	if !v.Valid() {
+		return nil, v, nil
+	}
+
+	err = s.userModel.Update(ctx, user)
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("update user: %w", err)
+	}
+
+	return user, nil, nil
+}
+
+// RequestEmailChange starts changing the user's email after re-entering the password.
+// The new address gets a link to confirm it and the current one a notice of the change.
+// Returns validation and error, ErrPasswordNotMatch or ErrDuplicateEmail if another
+// user has the address
+func (s *UserService) RequestEmailChange(ctx context.Context, userID int64, newEmail, password string) (*validator.Validator, error) {
+	newEmail = strings.TrimSpace(newEmail)
+
+	v := validator.New()
+	validateEmail(v, newEmail)
+	v.Check(password != "", "password", "must be provided")
+	if !v.Valid() {
+		return v, nil
+	}
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, ErrPasswordNotMatch
+	}
+
+	v.Check(!strings.EqualFold(newEmail, user.Email), "email", "must be different from the current email")
+	if !v.Valid() {
+		return v, nil
+	}
+
+	_, err = s.userModel.GetByEmail(ctx, newEmail)
+	if err == nil {
+		return nil, ErrDuplicateEmail
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, fmt.Errorf("get user by email: %w", err)
+	}
+
+	token, err := s.tokenModel.NewEmailChange(ctx, user.ID, emailChangeTTL, newEmail)
+	if err != nil {
+		return nil, fmt.Errorf("create email change token: %w", err)
+	}
+
+	s.scheduler.Submit(scheduler.Task{
+		Type: scheduler.SendEmailChangeEmail,
+		Data: scheduler.TaskEmailChangeData{
+			Email:      newEmail,
+			ConfirmURL: fmt.Sprintf("http://localhost:4000/v1/users/email/%s", token.Plaintext),
+		},
+		MaxRetries: 3,
+		CreatedAt:  time.Now(),
+	})
+
+	s.scheduler.Submit(scheduler.Task{
+		Type: scheduler.SendEmailChangeNotice,
+		Data: scheduler.TaskEmailChangeNoticeData{
+			Email:    user.Email,
+			NewEmail: newEmail,
+		},
+		MaxRetries: 3,
+		CreatedAt:  time.Now(),
+	})
+
+	return nil, nil
+}
+
+// ConfirmEmailChange switches the user's email to the address the token was sent to
+// Returns the updated user, ErrTokenNotFound if the token is unknown or expired, or
+// ErrDuplicateEmail if the address was taken meanwhile
+func (s *UserService) ConfirmEmailChange(ctx context.Context, tokenPlaintext string) (*data.User, error) {
+	user, err := s.userModel.ChangeEmail(ctx, tokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, ErrTokenNotFound
+		case errors.Is(err, data.ErrDuplicateEmail):
+			return nil, ErrDuplicateEmail
+		default:
+			return nil, fmt.Errorf("change email: %w", err)
+		}
+	}
+
+	s.logger.Info("email changed", "user_id", user.ID)
+
+	return user, nil
+}
+
+// DeleteUser deletes the user's account after re-entering the password. Their images and
+// export archives are deleted from S3 first, then they are signed out everywhere and the
+// user is deleted with everything they own.
+// Returns validation and error, ErrPasswordNotMatch
+func (s *UserService) DeleteUser(ctx context.Context, userID int64, password string) (*validator.Validator, error) {
+	v := validator.New()
+	v.Check(password != "", "password", "must be provided")
+	if !v.Valid() {
+		return v, nil
+	}
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, ErrPasswordNotMatch
+	}
+
+	// S3 objects go first, so a failure leaves the account to retry with
+	err = s.deleteUserFiles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tokens.RevokeAllTokens(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("revoke tokens: %w", err)
+	}
+
+	err = s.userModel.Delete(ctx, userID)
+	if err != nil {
+		s.logger.Error("DB deletion failed after S3 cleanup", "user_id", userID, "error", err)
+		return nil, fmt.Errorf("delete user: %w", err)
+	}
+
+	s.logger.Info("user deleted", "user_id", userID)
+
 	return nil, nil
 }
 
+// deleteUserFiles deletes the user's images and export archives from S3
+// Returns error if any deletion fails
+func (s *UserService) deleteUserFiles(ctx context.Context, userID int64) error {
+	images, err := s.imageModel.GetKeysForUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get image keys: %w", err)
+	}
+
+	archives, err := s.exportModel.GetKeysForUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get export keys: %w", err)
+	}
+
+	keys := append(images, archives...)
+
+	var failed int
+	for _, key := range keys {
+		deleteCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := s.storage.DeleteImage(deleteCtx, key)
+		cancel()
+
+		if err != nil {
+			failed++
+			s.logger.Error("failed to delete file", "error", err, "s3_key", key, "user_id", userID)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d file(s) from S3, total: %d", failed, len(keys))
+	}
+
+	return nil
+}
+
 func validateUserRegistration(user data.User, password string) *validator.Validator {
 	v := validator.New()
 
-	v.Check(user.Name != "", "name", "must be provided")
-	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+	validateName(v, user.Name)
 
 	validateEmail(v, user.Email)
 
@@ -173,6 +425,11 @@ func validateUserRegistration(user data.User, password string) *validator.Valida
 	return v
 }
 
+func validateName(v *validator.Validator, name string) {
+	v.Check(name != "", "name", "must be provided")
+	v.Check(len(name) <= 500, "name", "must not be more than 500 bytes long")
+}
+
 func validateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email")
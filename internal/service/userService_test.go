@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"shuvoedward/Bible_project/internal/data"
+	"slices"
+	"testing"
+)
+
+type fakeUserFiles []string
+
+func (f fakeUserFiles) GetKeysForUser(ctx context.Context, userID int64) ([]string, error) {
+	return f, nil
+}
+
+// fakeStorage records deleted keys and fails to delete the keys in failing
+type fakeStorage struct {
+	deleted []string
+	failing []string
+}
+
+func (f *fakeStorage) DeleteImage(ctx context.Context, s3Key string) error {
+	if slices.Contains(f.failing, s3Key) {
+		return errors.New("s3 unavailable")
+	}
+	f.deleted = append(f.deleted, s3Key)
+	return nil
+}
+
+// deletableUserModel records deleted users
+type deletableUserModel struct {
+	*fakeUserModel
+	deleted []int64
+}
+
+func (m *deletableUserModel) Delete(ctx context.Context, id int64) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+type fakeRevoker struct {
+	revoked  []int64
+	uncached []int64
+}
+
+func (f *fakeRevoker) RevokeAllTokens(ctx context.Context, userID int64) error {
+	f.revoked = append(f.revoked, userID)
+	return nil
+}
+
+func (f *fakeRevoker) UncacheUser(ctx context.Context, userID int64) error {
+	f.uncached = append(f.uncached, userID)
+	return nil
+}
+
+func TestUserService_DeleteUser(t *testing.T) {
+	user := newTestUser(t)
+
+	newService := func(storage *fakeStorage) (*UserService, *deletableUserModel, *fakeRevoker) {
+		users := &deletableUserModel{fakeUserModel: &fakeUserModel{user: user}}
+		revoker := &fakeRevoker{}
+
+		s := NewUserService(
+			data.Models{},
+			users,
+			nil,
+			fakeUserFiles{"images/1/a.jpg", "images/1/b.jpg"},
+			fakeUserFiles{"exports/1/export.zip"},
+			storage,
+			revoker,
+			nil,
+			slog.New(slog.DiscardHandler),
+		)
+
+		return s, users, revoker
+	}
+
+	ctx := context.Background()
+
+	t.Run("deletes files then user", func(t *testing.T) {
+		storage := &fakeStorage{}
+		s, users, revoker := newService(storage)
+
+		v, err := s.DeleteUser(ctx, user.ID, "pa55word")
+		if v != nil || err != nil {
+			t.Fatalf("unexpected error: %v, %v", v, err)
+		}
+
+		if len(storage.deleted) != 3 {
+			t.Errorf("expected 3 files deleted, got %v", storage.deleted)
+		}
+		if !slices.Equal(users.deleted, []int64{user.ID}) || !slices.Equal(revoker.revoked, []int64{user.ID}) {
+			t.Errorf("expected user %d deleted and signed out, got %v, %v", user.ID, users.deleted, revoker.revoked)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		storage := &fakeStorage{}
+		s, users, _ := newService(storage)
+
+		_, err := s.DeleteUser(ctx, user.ID, "wrong-password")
+		if !errors.Is(err, ErrPasswordNotMatch) {
+			t.Fatalf("expected ErrPasswordNotMatch, got %v", err)
+		}
+		if len(storage.deleted) != 0 || len(users.deleted) != 0 {
+			t.Errorf("expected nothing deleted, got %v, %v", storage.deleted, users.deleted)
+		}
+	})
+
+	t.Run("S3 failure keeps the account", func(t *testing.T) {
+		storage := &fakeStorage{failing: []string{"images/1/b.jpg"}}
+		s, users, revoker := newService(storage)
+
+		_, err := s.DeleteUser(ctx, user.ID, "pa55word")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(users.deleted) != 0 || len(revoker.revoked) != 0 {
+			t.Errorf("expected the user to be kept, got %v, %v", users.deleted, revoker.revoked)
+		}
+	})
+}
+
+// preferencesUserModel records the preference changes it stores
+type preferencesUserModel struct {
+	*fakeUserModel
+	changes []data.Preferences
+}
+
+func (m *preferencesUserModel) UpdatePreferences(ctx context.Context, userID int64, changes data.Preferences) (data.Preferences, error) {
+	m.changes = append(m.changes, changes)
+	return changes.WithDefaults(), nil
+}
+
+func TestUserService_UpdatePreferences(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+	ctx := context.Background()
+
+	t.Run("stores only the changed settings", func(t *testing.T) {
+		users := &preferencesUserModel{fakeUserModel: &fakeUserModel{user: newTestUser(t)}}
+		revoker := &fakeRevoker{}
+		s := NewUserService(data.Models{}, users, nil, nil, nil, nil, revoker, nil, slog.New(slog.DiscardHandler))
+
+		preferences, v, err := s.UpdatePreferences(ctx, 1, PreferencesUpdate{
+			Timezone: ptr("America/New_York"),
+			Locale:   ptr("en-us"),
+		})
+		if v != nil || err != nil {
+			t.Fatalf("unexpected error: %v, %v", v, err)
+		}
+
+		want := data.Preferences{Timezone: "America/New_York", Locale: "en-US"}
+		if len(users.changes) != 1 || users.changes[0] != want {
+			t.Errorf("stored %+v, want %+v", users.changes, want)
+		}
+		if preferences.Timezone != "America/New_York" || preferences.Translation != "KJV" {
+			t.Errorf("got %+v, want the change with defaults", preferences)
+		}
+		if !slices.Equal(revoker.uncached, []int64{1}) {
+			t.Errorf("expected the user's tokens uncached, got %v", revoker.uncached)
+		}
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		pageSize := 0
+		_, v := validatePreferencesUpdate(PreferencesUpdate{
+			Translation:    ptr("XYZ"),
+			Timezone:       ptr("Local"),
+			Locale:         ptr("not a locale"),
+			HighlightColor: ptr("yellow"),
+			VerseNumbers:   ptr("roman"),
+			NotesSort:      ptr("updated_at"),
+			NotesPageSize:  &pageSize,
+		})
+
+		for _, key := range []string{"translation", "timezone", "locale", "highlight_color", "verse_numbers", "notes_sort", "notes_page_size"} {
+			if _, ok := v.Errors[key]; !ok {
+				t.Errorf("expected an error for %s", key)
+			}
+		}
+	})
+}
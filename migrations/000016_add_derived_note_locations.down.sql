@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS note_locations_derived_note_id_idx;
+ALTER TABLE note_locations DROP COLUMN IF EXISTS derived;
@@ -0,0 +1,8 @@
+-- Derived locations are detected from note content (e.g. references written in
+-- GENERAL notes) rather than linked explicitly by the user. They are rebuilt on
+-- every save, so user-linked rows must never be touched by that process.
+ALTER TABLE note_locations
+ADD COLUMN derived boolean NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS note_locations_derived_note_id_idx ON note_locations
+(note_id) WHERE derived;
@@ -0,0 +1,26 @@
+-- Wiki-style links between notes, parsed from note content on save.
+-- [[note:123]] links by id, [[Note Title]] links to a GENERAL note by its
+-- unique title (idx_general_notes_user_title).
+-- target_note_id is NULL while the link is dangling (unknown title or id,
+-- or the target note was deleted).
+CREATE TABLE IF NOT EXISTS note_links(
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_note_id bigint NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    target_note_id bigint REFERENCES notes(id) ON DELETE SET NULL,
+    target_title varchar(255),
+    raw varchar(300) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now()
+);
+
+-- Index to quickly find all links written in a note
+CREATE INDEX IF NOT EXISTS note_links_source_note_id_idx ON note_links
+(source_note_id);
+
+-- Index to quickly find backlinks of a note
+CREATE INDEX IF NOT EXISTS note_links_target_note_id_idx ON note_links
+(target_note_id);
+
+-- Index to resolve dangling title links when a matching note is created
+CREATE INDEX IF NOT EXISTS note_links_dangling_title_idx ON note_links
+(user_id, LOWER(target_title)) WHERE target_note_id IS NULL;
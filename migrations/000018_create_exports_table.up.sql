@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS exports (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    s3_key varchar(512),
+    error text,
+    expires_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) with time zone,
+    CONSTRAINT exports_status_check CHECK (status IN ('pending', 'completed', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS exports_user_id_idx ON exports(user_id);
+
+-- One export in progress per user
+CREATE UNIQUE INDEX IF NOT EXISTS exports_user_pending_idx ON exports(user_id) WHERE status = 'pending';
@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS notes_deleted_at_idx;
+
+DROP INDEX IF EXISTS idx_bible_notes_user_content_hash;
+CREATE UNIQUE INDEX idx_bible_notes_user_content_hash
+ON notes(user_id, content_hash)
+WHERE note_type IN ('BIBLE', 'CROSS_REFERENCE');
+
+DROP INDEX IF EXISTS idx_general_notes_user_title;
+CREATE UNIQUE INDEX idx_general_notes_user_title
+ON notes(user_id, LOWER(title))
+WHERE note_type = 'GENERAL';
+
+ALTER TABLE notes DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,16 @@
+ALTER TABLE notes ADD COLUMN deleted_at timestamp(0) with time zone;
+
+-- Notes in the trash no longer block the title or content of new notes
+DROP INDEX IF EXISTS idx_general_notes_user_title;
+CREATE UNIQUE INDEX idx_general_notes_user_title
+ON notes(user_id, LOWER(title))
+WHERE note_type = 'GENERAL' AND deleted_at IS NULL;
+
+DROP INDEX IF EXISTS idx_bible_notes_user_content_hash;
+CREATE UNIQUE INDEX idx_bible_notes_user_content_hash
+ON notes(user_id, content_hash)
+WHERE note_type IN ('BIBLE', 'CROSS_REFERENCE') AND deleted_at IS NULL;
+
+-- Index to list the trash and find notes due for purge
+CREATE INDEX IF NOT EXISTS notes_deleted_at_idx ON notes(deleted_at)
+WHERE deleted_at IS NOT NULL;
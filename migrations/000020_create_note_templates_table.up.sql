@@ -0,0 +1,34 @@
+-- Templates with a NULL user_id are built-in and visible to every user
+CREATE TABLE IF NOT EXISTS note_templates (
+    id bigserial PRIMARY KEY,
+    user_id bigint REFERENCES users(id) ON DELETE CASCADE,
+    name varchar(100) NOT NULL,
+    description varchar(500) NOT NULL DEFAULT '',
+    sections jsonb NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_note_templates_user_name
+ON note_templates(user_id, LOWER(name))
+WHERE user_id IS NOT NULL;
+
+INSERT INTO note_templates (user_id, name, description, sections) VALUES
+(NULL, 'SOAP', 'Scripture, Observation, Application, Prayer', '[
+    {"heading": "Scripture", "body": "{{passage}} ({{date}})"},
+    {"heading": "Observation", "body": ""},
+    {"heading": "Application", "body": ""},
+    {"heading": "Prayer", "body": ""}
+]'),
+(NULL, 'Inductive', 'Observe, interpret and apply the passage', '[
+    {"heading": "Observation", "body": "What does {{passage}} say? Who, what, where, when?"},
+    {"heading": "Interpretation", "body": "What did it mean to its first readers?"},
+    {"heading": "Application", "body": "How does it apply today?"}
+]'),
+(NULL, 'Sermon outline', 'Text, big idea, outline and application', '[
+    {"heading": "Text", "body": "{{passage}}"},
+    {"heading": "Big Idea", "body": ""},
+    {"heading": "Outline", "body": "1. \n2. \n3. "},
+    {"heading": "Illustrations", "body": ""},
+    {"heading": "Application", "body": ""}
+]');
@@ -0,0 +1,13 @@
+-- The target end of a CROSS_REFERENCE note; the source is the note's location.
+-- Notes created before this table keep their target as free text in content.
+CREATE TABLE IF NOT EXISTS note_cross_references (
+    note_id bigint PRIMARY KEY REFERENCES notes(id) ON DELETE CASCADE,
+    book_id integer NOT NULL REFERENCES books(id),
+    chapter integer NOT NULL,
+    start_verse integer NOT NULL,
+    end_verse integer NOT NULL
+);
+
+-- Index to find the cross-references pointing into a chapter
+CREATE INDEX IF NOT EXISTS note_cross_references_target_idx ON note_cross_references
+(book_id, chapter);
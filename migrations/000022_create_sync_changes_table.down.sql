@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS images_sync_trigger ON images;
+DROP TRIGGER IF EXISTS highlights_sync_trigger ON highlights;
+DROP TRIGGER IF EXISTS note_cross_references_sync_trigger ON note_cross_references;
+DROP TRIGGER IF EXISTS note_locations_sync_trigger ON note_locations;
+DROP TRIGGER IF EXISTS notes_sync_trigger ON notes;
+DROP FUNCTION IF EXISTS record_sync_change();
+DROP TABLE IF EXISTS sync_changes;
@@ -0,0 +1,116 @@
+-- Change log behind GET /v1/sync. Every write to a user's notes, locations,
+-- highlights and images appends a row; the row id is the sync cursor.
+CREATE TABLE IF NOT EXISTS sync_changes (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    entity varchar(20) NOT NULL,
+    entity_id bigint NOT NULL,
+    deleted boolean NOT NULL DEFAULT false,
+    changed_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS sync_changes_user_id_idx ON sync_changes(user_id, id);
+CREATE INDEX IF NOT EXISTS sync_changes_entity_idx ON sync_changes(entity, entity_id, id);
+
+-- Writers of the same user are serialized with a transaction-scoped advisory lock
+-- taken before the cursor is drawn, so a user's changes commit in cursor order
+-- and a client never skips a change committed after it synced.
+CREATE OR REPLACE FUNCTION record_sync_change() RETURNS trigger AS $$
+DECLARE
+    entity_row record;
+    owner_id bigint;
+    is_deleted boolean;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        entity_row := OLD;
+    ELSE
+        entity_row := NEW;
+    END IF;
+
+    IF TG_TABLE_NAME IN ('notes', 'highlights') THEN
+        owner_id := entity_row.user_id;
+    ELSE
+        -- Rows removed along with their note are covered by the note's tombstone
+        SELECT user_id INTO owner_id FROM notes WHERE id = entity_row.note_id;
+        IF owner_id IS NULL THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    -- Rows removed along with their user have no one left to sync with
+    PERFORM 1 FROM users WHERE id = owner_id;
+    IF NOT FOUND THEN
+        RETURN NULL;
+    END IF;
+
+    is_deleted := TG_OP = 'DELETE';
+
+    PERFORM pg_advisory_xact_lock(owner_id);
+
+    IF TG_TABLE_NAME = 'notes' THEN
+        IF TG_OP <> 'DELETE' THEN
+            is_deleted := NEW.deleted_at IS NOT NULL;
+        END IF;
+
+        INSERT INTO sync_changes (user_id, entity, entity_id, deleted)
+        VALUES (owner_id, 'note', entity_row.id, is_deleted);
+
+        -- Trashing or restoring a note hides or brings back its locations and images
+        IF TG_OP = 'UPDATE' AND OLD.deleted_at IS DISTINCT FROM NEW.deleted_at THEN
+            INSERT INTO sync_changes (user_id, entity, entity_id, deleted)
+            SELECT owner_id, 'location', id, is_deleted FROM note_locations WHERE note_id = NEW.id
+            UNION ALL
+            SELECT owner_id, 'image', id, is_deleted FROM images WHERE note_id = NEW.id;
+        END IF;
+    ELSIF TG_TABLE_NAME = 'note_cross_references' THEN
+        -- The target is part of the note
+        INSERT INTO sync_changes (user_id, entity, entity_id, deleted)
+        VALUES (owner_id, 'note', entity_row.note_id, false);
+    ELSE
+        INSERT INTO sync_changes (user_id, entity, entity_id, deleted)
+        VALUES (owner_id, TG_ARGV[0], entity_row.id, is_deleted);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notes_sync_trigger
+AFTER INSERT OR UPDATE OR DELETE ON notes
+FOR EACH ROW
+EXECUTE FUNCTION record_sync_change('note');
+
+CREATE TRIGGER note_locations_sync_trigger
+AFTER INSERT OR UPDATE OR DELETE ON note_locations
+FOR EACH ROW
+EXECUTE FUNCTION record_sync_change('location');
+
+CREATE TRIGGER note_cross_references_sync_trigger
+AFTER INSERT OR UPDATE ON note_cross_references
+FOR EACH ROW
+EXECUTE FUNCTION record_sync_change('note');
+
+CREATE TRIGGER highlights_sync_trigger
+AFTER INSERT OR UPDATE OR DELETE ON highlights
+FOR EACH ROW
+EXECUTE FUNCTION record_sync_change('highlight');
+
+CREATE TRIGGER images_sync_trigger
+AFTER INSERT OR UPDATE OR DELETE ON images
+FOR EACH ROW
+EXECUTE FUNCTION record_sync_change('image');
+
+-- Existing data is the starting point of every client
+INSERT INTO sync_changes (user_id, entity, entity_id, deleted)
+SELECT user_id, 'note', id, deleted_at IS NOT NULL FROM notes;
+
+INSERT INTO sync_changes (user_id, entity, entity_id, deleted)
+SELECT n.user_id, 'location', nl.id, n.deleted_at IS NOT NULL
+FROM note_locations nl JOIN notes n ON n.id = nl.note_id;
+
+INSERT INTO sync_changes (user_id, entity, entity_id, deleted)
+SELECT user_id, 'highlight', id, false FROM highlights;
+
+INSERT INTO sync_changes (user_id, entity, entity_id, deleted)
+SELECT n.user_id, 'image', i.id, n.deleted_at IS NOT NULL
+FROM images i JOIN notes n ON n.id = i.note_id;
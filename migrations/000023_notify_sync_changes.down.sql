@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS sync_changes_notify_trigger ON sync_changes;
+DROP FUNCTION IF EXISTS notify_sync_change();
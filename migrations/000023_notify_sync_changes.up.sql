@@ -0,0 +1,20 @@
+-- Every recorded change is announced on the sync_changes channel once its transaction
+-- commits, so each API instance can push it to the user's open event streams.
+-- The payload only identifies the change, clients fetch the data through /v1/sync.
+CREATE OR REPLACE FUNCTION notify_sync_change() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('sync_changes', json_build_object(
+        'id', NEW.id,
+        'user_id', NEW.user_id,
+        'entity', NEW.entity,
+        'entity_id', NEW.entity_id,
+        'deleted', NEW.deleted
+    )::text);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER sync_changes_notify_trigger
+    AFTER INSERT ON sync_changes
+    FOR EACH ROW EXECUTE FUNCTION notify_sync_change();
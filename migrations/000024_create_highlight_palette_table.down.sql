@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS highlights_palette_id_idx;
+ALTER TABLE highlights DROP COLUMN IF EXISTS palette_id;
+DROP TABLE IF EXISTS highlight_palette;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS highlight_palette (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    color varchar(50) NOT NULL,
+    label varchar(100) NOT NULL,
+    position integer NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT now()
+);
+
+-- A color means one thing per user
+CREATE UNIQUE INDEX IF NOT EXISTS highlight_palette_user_color_idx
+    ON highlight_palette (user_id, LOWER(color));
+
+-- Highlights keep their color when their palette entry is deleted
+ALTER TABLE highlights
+    ADD COLUMN IF NOT EXISTS palette_id bigint REFERENCES highlight_palette(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS highlights_palette_id_idx ON highlights (palette_id)
+    WHERE palette_id IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Authentication tokens double as sessions, so users can see where they are signed in
+-- and revoke a single device. The id lets a session be referenced without its hash.
+ALTER TABLE tokens
+    ADD COLUMN id bigserial NOT NULL UNIQUE,
+    ADD COLUMN created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ADD COLUMN last_used_at timestamp(0) with time zone,
+    ADD COLUMN user_agent text NOT NULL DEFAULT '',
+    ADD COLUMN ip text NOT NULL DEFAULT '',
+    ADD COLUMN device_name text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS tokens_user_scope_idx ON tokens (user_id, scope);
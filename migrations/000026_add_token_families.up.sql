@@ -0,0 +1,8 @@
+-- A login starts a token family: its short-lived access tokens and the refresh tokens
+-- rotated from one another. Used refresh tokens are kept until they expire, so reusing
+-- one is detected and revokes the whole family.
+ALTER TABLE tokens
+    ADD COLUMN family_id text,
+    ADD COLUMN used_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id) WHERE family_id IS NOT NULL;
@@ -0,0 +1,15 @@
+-- Long-lived keys for scripts and integrations, limited to the scopes they were created with.
+-- The prefix identifies a key in listings, the key itself is only stored hashed.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name varchar(100) NOT NULL,
+    hash bytea NOT NULL UNIQUE,
+    prefix text NOT NULL,
+    scopes text[] NOT NULL,
+    expiry timestamp(0) with time zone,
+    last_used_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_user_name_idx ON api_keys (user_id, LOWER(name));
@@ -0,0 +1,13 @@
+-- Accounts at OpenID Connect providers a user logs in with. The subject identifies the
+-- account at its provider, the email is the one the provider verified when linking.
+CREATE TABLE IF NOT EXISTS identities (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email citext NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS identities_user_id_idx ON identities (user_id);
@@ -0,0 +1,10 @@
+DELETE FROM tokens WHERE scope = 'email-change';
+
+DROP INDEX IF EXISTS idx_tokens_user_scope_verification;
+
+CREATE UNIQUE INDEX idx_tokens_user_scope_verification
+ON tokens(user_id, scope)
+WHERE scope IN ('activation', 'password-reset');
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS new_email;
@@ -0,0 +1,10 @@
+-- An email change token carries the address it verifies, a user has one pending change
+-- at a time like activation and password reset tokens
+ALTER TABLE tokens
+    ADD COLUMN new_email citext;
+
+DROP INDEX IF EXISTS idx_tokens_user_scope_verification;
+
+CREATE UNIQUE INDEX idx_tokens_user_scope_verification
+ON tokens(user_id, scope)
+WHERE scope IN ('activation', 'password-reset', 'email-change');
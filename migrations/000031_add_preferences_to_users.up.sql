@@ -0,0 +1,4 @@
+-- A user's preferences are one document, settings they never chose are left out and
+-- read as their defaults
+ALTER TABLE users
+    ADD COLUMN preferences jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,7 @@
+DELETE FROM tokens WHERE scope = 'magic-link';
+
+DROP INDEX IF EXISTS idx_tokens_user_scope_verification;
+
+CREATE UNIQUE INDEX idx_tokens_user_scope_verification
+ON tokens(user_id, scope)
+WHERE scope IN ('activation', 'password-reset', 'email-change');
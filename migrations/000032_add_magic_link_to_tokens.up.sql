@@ -0,0 +1,6 @@
+-- A user has one magic link at a time, requesting another replaces it
+DROP INDEX IF EXISTS idx_tokens_user_scope_verification;
+
+CREATE UNIQUE INDEX idx_tokens_user_scope_verification
+ON tokens(user_id, scope)
+WHERE scope IN ('activation', 'password-reset', 'email-change', 'magic-link');